@@ -0,0 +1,75 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ja7ad/consumption/pkg/consumption"
+)
+
+// exitBudget is the exit status when a run or report exceeds a --max-*
+// budget; any other failure exits with 1.
+const exitBudget = 3
+
+// budgetError reports the exceeded limits of a finished run.
+type budgetError struct {
+	breaches []consumption.Breach
+}
+
+func (e *budgetError) Error() string {
+	lines := make([]string, len(e.breaches))
+	for i, b := range e.breaches {
+		lines[i] = "  - " + b.String()
+	}
+	return fmt.Sprintf("energy budget exceeded (exit %d):\n%s", exitBudget, strings.Join(lines, "\n"))
+}
+
+// budget parses the --max-* flags. --max-cpu, --max-disk and --max-ram take
+// either an energy or a power; the unit decides.
+func (o opts) budget() (consumption.Budget, error) {
+	var b consumption.Budget
+	var err error
+	if o.maxEnergy != "" {
+		if b.Energy.Total, err = consumption.ParseEnergy(o.maxEnergy); err != nil {
+			return b, fmt.Errorf("--max-energy: %w", err)
+		}
+	}
+	if o.maxAvgPower != "" {
+		if b.AvgPower.PTotal, err = consumption.ParsePower(o.maxAvgPower); err != nil {
+			return b, fmt.Errorf("--max-avg-power: %w", err)
+		}
+	}
+	for _, c := range []struct {
+		spec *string
+		name string
+		j, w *float64
+	}{
+		{spec: &o.maxCPU, name: "--max-cpu", j: &b.Energy.CPU, w: &b.AvgPower.PCPU},
+		{spec: &o.maxDisk, name: "--max-disk", j: &b.Energy.Disk, w: &b.AvgPower.PDisk},
+		{spec: &o.maxRAM, name: "--max-ram", j: &b.Energy.RAM, w: &b.AvgPower.PRAM},
+	} {
+		if *c.spec == "" {
+			continue
+		}
+		v, energy, err := consumption.ParseLimit(*c.spec)
+		if err != nil {
+			return b, fmt.Errorf("%s: %w", c.name, err)
+		}
+		if energy {
+			*c.j = v
+		} else {
+			*c.w = v
+		}
+	}
+	return b, nil
+}
+
+// checkBudget returns a *budgetError when energy or avg exceed b.
+func checkBudget(b consumption.Budget, energy consumption.Energy, avg consumption.Result) error {
+	if breaches := b.Check(energy, avg); len(breaches) > 0 {
+		return &budgetError{breaches: breaches}
+	}
+	return nil
+}
@@ -0,0 +1,736 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/ja7ad/consumption/pkg/carbon"
+	"github.com/ja7ad/consumption/pkg/consumption"
+	"github.com/ja7ad/consumption/pkg/system/proc"
+	"github.com/ja7ad/consumption/pkg/tariff"
+)
+
+// coefficientFlagNames lists the coefficient and model flags registered by
+// addModelFlags that override profile values ("uncertainty" last: its
+// relative specs need the final central values).
+var coefficientFlagNames = []string{"p-idle", "p-max", "gamma", "er", "ew", "e-mem-ref", "e-mem-rss", "alpha", "model", "curve", "uncertainty"}
+
+// modelFlagNames lists every flag registered by addModelFlags.
+var modelFlagNames = append([]string{"profile", "config"}, coefficientFlagNames...)
+
+func calc() *cobra.Command {
+	var (
+		o        opts
+		group    string
+		format   string
+		from, to string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "calc <report.{csv,json,ndjson}|->...",
+		Short: "Calculate power/energy statistics from CSV/JSON/NDJSON reports",
+		Long: `Calculate power/energy from utilization snapshot CSV, JSON or NDJSON.
+
+The summary holds the time-weighted average power and the energy per
+component, the total energy (the last e_cum_j, or Σ p_total_w·interval_sec
+for reports without it), the min/max/sd and p50/p95/p99 of the per-tick
+total power, and the duration.
+
+Several reports are read as one series, ordered by their first timestamp
+(e.g. the parts of a rotated or resumed run); their energy, emissions and
+cost add up. --from and --to keep the rows with from <= time < to; each
+takes an RFC 3339 time, a local "2006-01-02 15:04:05", a time of day on the
+report's first day ("15:04:05") or an offset from the first row ("5m").
+
+Reports cut off mid-write (a killed run leaves a JSON array without its "]",
+or a torn last line) are read up to the cut, with a warning saying how many
+rows were recovered.
+
+With --profile, --config or any model flag (--p-idle, --p-max, --gamma,
+--er, --ew, --e-mem-ref, --e-mem-rss, --alpha, --model, --curve), power and energy are rebuilt
+from the raw columns (u_vm, u_proc, read_bytes, write_bytes, refault_bytes,
+rss_churn_bytes, interval_sec) and shown next to the original values. Unset
+model flags keep their profile (or default) values. Report utilizations are
+rounded to 3 decimals; use 'consumption replay' on a --record trace for
+exact results.
+
+With --grid-intensity or --grid-intensity-csv (and optionally --pue),
+emissions are computed from each row's energy at the row's timestamp;
+otherwise co2_cum_g from the report is shown when present. --price or
+--tariff prices the energy the same way and projects a monthly cost from the
+average total power. --uncertainty ranges (or a profile's ranges) add
+Monte Carlo p5–p95 bands for the recomputed average power and energy.
+
+Reports of a --group run hold one series per group; select one with --group.
+
+--max-energy, --max-avg-power and --max-cpu/--max-disk/--max-ram check the
+(recomputed, if model flags are given) results against a budget and exit
+with status 3 when one is exceeded.
+
+--format json and --format csv print the summary for other tools: one JSON
+object (with model flags, an object with "original" and "recomputed") or a
+CSV header plus one row per source. --format markdown prints the same
+results as GitHub-flavored Markdown (for pull request comments); it is also
+appended to $GITHUB_STEP_SUMMARY when set.
+
+Examples:
+  consumption calc report.csv
+  consumption calc report.json
+  consumption calc report.ndjson
+  consumption calc report.csv --p-max 35 --gamma 1.6
+  consumption calc report.csv --profile xeon
+  consumption calc report.csv --curve specpower.csv
+  consumption calc report.csv --grid-intensity-csv grid.csv --pue 1.2
+  consumption calc report.csv --tariff tou.yaml
+  consumption calc report.csv --uncertainty p-max=18..25 --uncertainty gamma=±10%
+  consumption calc grouped.csv --group api
+  consumption calc report.csv --p-max 35 --format markdown >> comment.md
+  consumption calc report.csv --max-energy 500J --max-cpu 2.5W
+  consumption calc part1.csv part2.csv --from 10:00:00 --to 10:30:00
+  consumption calc report.csv --from 1m --format json | jq .energy_j.total
+  consumption calc report.csv --format csv >> history.csv
+  cat report.json | consumption calc -`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !slices.Contains([]string{"text", "json", "csv", "markdown"}, format) {
+				return fmt.Errorf("--format %q: want text, json, csv or markdown", format)
+			}
+			budget, err := o.budget()
+			if err != nil {
+				return err
+			}
+			rows, err := readReports(args, from, to)
+			if err != nil {
+				return err
+			}
+			if rows, err = selectGroup(rows, group); err != nil {
+				return err
+			}
+			if len(rows) == 0 {
+				return fmt.Errorf("no rows found")
+			}
+
+			orig := summarizeRows(rows)
+			origProfile := reportProfile(rows)
+
+			tr, err := o.carbon()
+			if err != nil {
+				return err
+			}
+			meter, err := o.tariff()
+			if err != nil {
+				return err
+			}
+			priceRows(rows, tr, meter, &orig)
+
+			if !modelFlagsChanged(cmd.Flags()) {
+				switch format {
+				case "markdown":
+					if err := printMarkdown(rows, orig.report(origProfile, meter), nil); err != nil {
+						return err
+					}
+					return orig.checkBudget(budget)
+				case "json", "csv":
+					if err := printCalc(format, orig.result("original", origProfile, meter)); err != nil {
+						return err
+					}
+					return orig.checkBudget(budget)
+				}
+				fmt.Printf("\nconsumption avg (over %d samples of ~%s):\n", orig.n, orig.approx())
+				if origProfile != "" {
+					fmt.Printf("- profile:       %s\n", origProfile)
+				}
+				if d := orig.duration(); d != "" {
+					fmt.Printf("- duration:      %s\n", d)
+				}
+				fmt.Printf("- watt (cpu):    %.3f W\n", orig.avg.PCPU)
+				fmt.Printf("- watt (disk):   %.3f W\n", orig.avg.PDisk)
+				fmt.Printf("- watt (ram):    %.3f W\n", orig.avg.PRAM)
+				fmt.Printf("- watt (total):  %.3f W\n", orig.avg.PTotal)
+				fmt.Printf("- energy:        %.3f J\n", orig.energy)
+				e, p := orig.split, orig.spread
+				fmt.Printf("- energy split:  cpu %.3f J, disk %.3f J, ram %.3f J, idle %.3f J\n", e.CPU, e.Disk, e.RAM, e.IdleShare)
+				fmt.Printf("- total spread:  min %.3f W, max %.3f W, sd %.3f W\n", p.Min, p.Max, p.StdDev)
+				fmt.Printf("- total pctl:    p50 %.3f W, p95 %.3f W, p99 %.3f W\n", p.P50, p.P95, p.P99)
+				if orig.hasCO2 {
+					fmt.Printf("- co2e:          %.6f g\n", orig.co2)
+				}
+				if orig.hasCost {
+					fmt.Printf("- cost:          %.6g %s\n", orig.cost, currency(meter))
+				}
+				if meter != nil {
+					fmt.Printf("- cost (month):  %.2f %s projected at %.3f W\n",
+						meter.Tariff().MonthlyCost(orig.avg.PTotal), currency(meter), orig.avg.PTotal)
+				}
+				if orig.hasBand {
+					fmt.Printf("- energy p5–p95: %.3f–%.3f J\n", orig.energyBand.P5, orig.energyBand.P95)
+				}
+				fmt.Println()
+				return orig.checkBudget(budget)
+			}
+
+			cfg, profileName, err := o.config(cmd.Flags())
+			if err != nil {
+				return err
+			}
+			// fresh emissions/cost totals for the recomputed energy
+			lay, err := o.layers(cfg)
+			if err != nil {
+				return err
+			}
+			re, err := recomputeRows(rows, cfg, lay)
+			if err != nil {
+				return err
+			}
+
+			if origProfile == "" {
+				origProfile = "unknown"
+			}
+			switch format {
+			case "markdown":
+				base := orig.report(origProfile, meter)
+				if err := printMarkdown(rows, re.report(profileName, meter), &base); err != nil {
+					return err
+				}
+				return re.checkBudget(budget)
+			case "json", "csv":
+				if err := printCalc(format, orig.result("original", origProfile, meter), re.result("recomputed", profileName, meter)); err != nil {
+					return err
+				}
+				return re.checkBudget(budget)
+			}
+
+			fmt.Printf("\nconsumption avg (over %d samples of ~%s):\n", orig.n, orig.approx())
+			if d := orig.duration(); d != "" {
+				fmt.Printf("- duration: %s\n", d)
+			}
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "\toriginal\trecomputed\tdelta")
+			fmt.Fprintf(tw, "- profile:\t%s\t%s\t\n", origProfile, profileName)
+			line := func(label, unit string, a, b float64) {
+				fmt.Fprintf(tw, "- %s\t%.3f %s\t%.3f %s\t%s\n", label, a, unit, b, unit, pctDelta(a, b))
+			}
+			line("watt (cpu):", "W", orig.avg.PCPU, re.avg.PCPU)
+			line("watt (disk):", "W", orig.avg.PDisk, re.avg.PDisk)
+			line("watt (ram):", "W", orig.avg.PRAM, re.avg.PRAM)
+			line("watt (total):", "W", orig.avg.PTotal, re.avg.PTotal)
+			line("energy:", "J", orig.energy, re.energy)
+			line("energy (cpu):", "J", orig.split.CPU, re.split.CPU)
+			line("energy (disk):", "J", orig.split.Disk, re.split.Disk)
+			line("energy (ram):", "J", orig.split.RAM, re.split.RAM)
+			line("energy (idle):", "J", orig.split.IdleShare, re.split.IdleShare)
+			line("total min:", "W", orig.spread.Min, re.spread.Min)
+			line("total max:", "W", orig.spread.Max, re.spread.Max)
+			line("total p50:", "W", orig.spread.P50, re.spread.P50)
+			line("total p95:", "W", orig.spread.P95, re.spread.P95)
+			line("total p99:", "W", orig.spread.P99, re.spread.P99)
+			// Report-only totals cannot be recomputed without --grid-intensity/--tariff.
+			optional := func(label, unit, verb string, a, b float64, hasA, hasB bool) {
+				if !hasA && !hasB {
+					return
+				}
+				as, bs, d := "n/a", "n/a", "n/a"
+				if hasA {
+					as = fmt.Sprintf(verb+" %s", a, unit)
+				}
+				if hasB {
+					bs = fmt.Sprintf(verb+" %s", b, unit)
+				}
+				if hasA && hasB {
+					d = pctDelta(a, b)
+				}
+				fmt.Fprintf(tw, "- %s\t%s\t%s\t%s\n", label, as, bs, d)
+			}
+			optional("co2e:", "g", "%.6f", orig.co2, re.co2, orig.hasCO2, re.hasCO2)
+			optional("cost:", currency(meter), "%.6g", orig.cost, re.cost, orig.hasCost, re.hasCost)
+			if meter != nil {
+				t, cur := meter.Tariff(), currency(meter)
+				a, b := t.MonthlyCost(orig.avg.PTotal), t.MonthlyCost(re.avg.PTotal)
+				fmt.Fprintf(tw, "- cost (month):\t%.2f %s\t%.2f %s\t%s\n", a, cur, b, cur, pctDelta(a, b))
+			}
+			band := func(unit string, x consumption.Interval, has bool) string {
+				if !has {
+					return "n/a"
+				}
+				return fmt.Sprintf("%.3f–%.3f %s", x.P5, x.P95, unit)
+			}
+			if re.hasBand {
+				fmt.Fprintf(tw, "- watt (total) p5–p95:\tn/a\t%s\t\n", band("W", re.powerBand, true))
+			}
+			if orig.hasBand || re.hasBand {
+				fmt.Fprintf(tw, "- energy p5–p95:\t%s\t%s\t\n", band("J", orig.energyBand, orig.hasBand), band("J", re.energyBand, re.hasBand))
+			}
+			_ = tw.Flush()
+			fmt.Println()
+			return re.checkBudget(budget)
+		},
+	}
+
+	cmd.Flags().StringVar(&group, "group", "", "only use rows of this group (reports of --group runs)")
+	cmd.Flags().StringVar(&format, "format", "text", "output format: text, json, csv or markdown (markdown is also appended to $GITHUB_STEP_SUMMARY when set)")
+	cmd.Flags().StringVar(&from, "from", "", "only use rows at or after this time (RFC 3339, \"2006-01-02 15:04:05\", \"15:04:05\" or an offset like 30s)")
+	cmd.Flags().StringVar(&to, "to", "", "only use rows before this time (same forms as --from)")
+	addModelFlags(cmd.Flags(), &o)
+	addCarbonFlags(cmd.Flags(), &o)
+	addTariffFlags(cmd.Flags(), &o)
+	addBudgetFlags(cmd.Flags(), &o)
+	return cmd
+}
+
+// selectGroup keeps the rows of group name. With no name, rows spanning
+// several groups are rejected: their ticks overlap and cannot be summed as
+// one series.
+func selectGroup(rows []row, name string) ([]row, error) {
+	var names []string
+	for _, r := range rows {
+		if !slices.Contains(names, r.Group) {
+			names = append(names, r.Group)
+		}
+	}
+	if name == "" {
+		if len(names) > 1 {
+			return nil, fmt.Errorf("report holds groups %s; select one with --group", strings.Join(names, ", "))
+		}
+		return rows, nil
+	}
+	if !slices.Contains(names, name) {
+		return nil, fmt.Errorf("no rows for group %q (report holds %s)", name, strings.Join(names, ", "))
+	}
+	return slices.DeleteFunc(rows, func(r row) bool { return r.Group != name }), nil
+}
+
+// modelFlagsChanged reports whether any model coefficient flag was set explicitly.
+func modelFlagsChanged(fs *pflag.FlagSet) bool {
+	for _, name := range modelFlagNames {
+		if fs.Changed(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// reportProfile returns the profile label recorded in the report, if any.
+func reportProfile(rows []row) string {
+	for _, r := range rows {
+		if r.Profile != "" {
+			return r.Profile
+		}
+	}
+	return ""
+}
+
+// rowSummary is the aggregate calc prints for a set of rows.
+type rowSummary struct {
+	n      int
+	avg    consumption.Result
+	energy float64            // J
+	split  consumption.Energy // J per component (Total is energy)
+	sumDt  float64            // s
+	co2    float64            // gCO2e
+	hasCO2 bool
+
+	cost    float64
+	hasCost bool
+
+	powerBand  consumption.Interval // average P_total, recomputed only
+	energyBand consumption.Interval
+	hasBand    bool
+
+	spread   consumption.Spread // per-tick P_total
+	from, to time.Time          // first and last row time, if recorded
+}
+
+func (s rowSummary) approx() string {
+	if s.sumDt <= 0 {
+		return "unknown"
+	}
+	sec := s.sumDt / float64(s.n)
+	return (time.Duration(sec * float64(time.Second))).Round(1 * time.Millisecond).String()
+}
+
+// duration is the summed tick time, with the first and last row time when
+// the report has timestamps; empty when neither is known.
+func (s rowSummary) duration() string {
+	var d string
+	if s.sumDt > 0 {
+		d = time.Duration(s.sumDt * float64(time.Second)).Round(time.Millisecond).String()
+	}
+	if !s.from.IsZero() && !s.to.IsZero() {
+		span := s.from.Format(time.RFC3339) + " → " + s.to.Format(time.RFC3339)
+		if d == "" {
+			return span
+		}
+		d += " (" + span + ")"
+	}
+	return d
+}
+
+// summarizeRows averages the stored power columns, weighted by interval_sec
+// when every row has one. Energy comes from the last e_cum_j when present,
+// otherwise from Σ p_total·interval.
+func summarizeRows(rows []row) rowSummary {
+	s := rowSummary{from: rows[0].At, to: rows[len(rows)-1].At}
+	series := consumption.NewSeries()
+	var integ, wsum float64
+	timed := true
+	for _, r := range rows {
+		timed = timed && r.IntervalSec > 0
+	}
+	for _, r := range rows {
+		w := 1.0
+		if timed {
+			w = r.IntervalSec
+		}
+		s.avg.PCPU += r.PCPU * w
+		s.avg.PDisk += r.PDisk * w
+		s.avg.PRAM += r.PRAM * w
+		s.avg.PIdleShare += r.PIdleShare * w
+		s.avg.PTotal += r.PTotal * w
+		s.split.CPU += r.PCPU * r.IntervalSec
+		s.split.Disk += r.PDisk * r.IntervalSec
+		s.split.RAM += r.PRAM * r.IntervalSec
+		s.split.IdleShare += r.PIdleShare * r.IntervalSec
+		series.Add(r.PTotal, w)
+		wsum += w
+		s.sumDt += r.IntervalSec
+		integ += r.PTotal * r.IntervalSec
+		s.n++
+	}
+	if wsum > 0 {
+		s.avg.PCPU /= wsum
+		s.avg.PDisk /= wsum
+		s.avg.PRAM /= wsum
+		s.avg.PIdleShare /= wsum
+		s.avg.PTotal /= wsum
+	}
+	s.spread = series.Spread()
+	s.energy = integ
+	last := rows[len(rows)-1]
+	if last.EnergyCumJ > 0 {
+		s.energy = last.EnergyCumJ
+	}
+	s.split.Total = s.energy
+	if last.CO2CumG > 0 {
+		s.co2, s.hasCO2 = last.CO2CumG, true
+	}
+	if last.CostCum > 0 {
+		s.cost, s.hasCost = last.CostCum, true
+	}
+	if last.ECumP95 > 0 {
+		s.energyBand = consumption.Interval{P5: last.ECumP5, P95: last.ECumP95}
+		s.hasBand = true
+	}
+	return s
+}
+
+// priceRows converts each row's tick energy to emissions and cost at the
+// row's time, replacing the report's own totals in s. Tick energy is the
+// e_cum_j step when the report has it, else p_total·interval.
+func priceRows(rows []row, tr *carbon.Tracker, m *tariff.Meter, s *rowSummary) {
+	if tr == nil && m == nil {
+		return
+	}
+	useCum := rows[len(rows)-1].EnergyCumJ > 0
+	var prev float64
+	for _, r := range rows {
+		e := r.PTotal * r.IntervalSec
+		if useCum {
+			e, prev = r.EnergyCumJ-prev, r.EnergyCumJ
+		}
+		if tr != nil {
+			tr.Add(r.At, e)
+		}
+		if m != nil {
+			m.Add(r.At, e)
+		}
+	}
+	if tr != nil {
+		s.co2, s.hasCO2 = tr.TotalG(), true
+	}
+	if m != nil {
+		s.cost, s.hasCost = m.Total(), true
+	}
+}
+
+// checkBudget checks s against b.
+func (s rowSummary) checkBudget(b consumption.Budget) error {
+	return checkBudget(b, s.split, s.avg)
+}
+
+// report converts s for the report writers.
+func (s rowSummary) report(profile string, m *tariff.Meter) reportSummary {
+	r := reportSummary{
+		Profile:    profile,
+		Avg:        s.avg,
+		Energy:     s.energy,
+		Carbon:     s.hasCO2,
+		CO2G:       s.co2,
+		Tariff:     s.hasCost,
+		Cost:       s.cost,
+		Currency:   currency(m),
+		Uncertain:  s.hasBand,
+		PTotalBand: s.powerBand,
+		EnergyBand: s.energyBand,
+		Stats: consumption.Stats{
+			Samples:     s.n,
+			DurationSec: s.sumDt,
+			Avg:         s.avg,
+			Energy:      s.split,
+			PTotal:      s.spread,
+		},
+	}
+	if m != nil {
+		r.MonthlyCost = m.Tariff().MonthlyCost(s.avg.PTotal)
+	}
+	return r
+}
+
+// calcResult is the calc summary for --format json and csv.
+type calcResult struct {
+	Source      string         `json:"source"` // "original" or "recomputed"
+	Profile     string         `json:"profile,omitempty"`
+	Samples     int            `json:"samples"`
+	DurationSec float64        `json:"duration_sec"`
+	From        *time.Time     `json:"from,omitempty"` // first row time
+	To          *time.Time     `json:"to,omitempty"`   // last row time
+	AvgW        calcComponents `json:"avg_w"`
+	EnergyJ     calcComponents `json:"energy_j"`
+	PTotalW     calcSpread     `json:"p_total_w"`
+	CO2G        *float64       `json:"co2_g,omitempty"`
+	Cost        *float64       `json:"cost,omitempty"`
+	Currency    string         `json:"currency,omitempty"`
+	MonthlyCost *float64       `json:"monthly_cost,omitempty"`
+	PTotalBandW *calcBand      `json:"p_total_band_w,omitempty"` // recomputed only
+	EnergyBandJ *calcBand      `json:"energy_band_j,omitempty"`
+}
+
+type calcComponents struct {
+	CPU       float64 `json:"cpu"`
+	Disk      float64 `json:"disk"`
+	RAM       float64 `json:"ram"`
+	IdleShare float64 `json:"idle_share"`
+	Total     float64 `json:"total"`
+}
+
+type calcSpread struct {
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	Mean   float64 `json:"mean"`
+	StdDev float64 `json:"sd"`
+	P50    float64 `json:"p50"`
+	P95    float64 `json:"p95"`
+	P99    float64 `json:"p99"`
+}
+
+type calcBand struct {
+	P5  float64 `json:"p5"`
+	P95 float64 `json:"p95"`
+}
+
+// result converts s for --format json and csv.
+func (s rowSummary) result(source, profile string, m *tariff.Meter) calcResult {
+	p := s.spread
+	r := calcResult{
+		Source:      source,
+		Profile:     profile,
+		Samples:     s.n,
+		DurationSec: s.sumDt,
+		AvgW:        calcComponents{s.avg.PCPU, s.avg.PDisk, s.avg.PRAM, s.avg.PIdleShare, s.avg.PTotal},
+		EnergyJ:     calcComponents{s.split.CPU, s.split.Disk, s.split.RAM, s.split.IdleShare, s.energy},
+		PTotalW:     calcSpread{p.Min, p.Max, p.Mean, p.StdDev, p.P50, p.P95, p.P99},
+		Currency:    currency(m),
+	}
+	if !s.from.IsZero() && !s.to.IsZero() {
+		r.From, r.To = &s.from, &s.to
+	}
+	if s.hasCO2 {
+		r.CO2G = &s.co2
+	}
+	if s.hasCost {
+		r.Cost = &s.cost
+	}
+	if m != nil {
+		mc := m.Tariff().MonthlyCost(s.avg.PTotal)
+		r.MonthlyCost = &mc
+	}
+	if s.hasBand {
+		if s.powerBand.P95 > 0 {
+			r.PTotalBandW = &calcBand{s.powerBand.P5, s.powerBand.P95}
+		}
+		r.EnergyBandJ = &calcBand{s.energyBand.P5, s.energyBand.P95}
+	}
+	return r
+}
+
+// calcCSVHeader names the columns of calcResult.csvRecord.
+var calcCSVHeader = []string{
+	"source", "profile", "samples", "duration_sec", "from", "to",
+	"avg_cpu_w", "avg_disk_w", "avg_ram_w", "avg_idle_share_w", "avg_total_w",
+	"energy_cpu_j", "energy_disk_j", "energy_ram_j", "energy_idle_share_j", "energy_total_j",
+	"p_total_min_w", "p_total_max_w", "p_total_mean_w", "p_total_sd_w", "p_total_p50_w", "p_total_p95_w", "p_total_p99_w",
+	"co2_g", "cost", "currency", "monthly_cost",
+	"p_total_band_p5_w", "p_total_band_p95_w", "energy_band_p5_j", "energy_band_p95_j",
+}
+
+// csvRecord flattens r in calcCSVHeader order; absent values are empty.
+func (r calcResult) csvRecord() []string {
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	opt := func(v *float64) string {
+		if v == nil {
+			return ""
+		}
+		return f(*v)
+	}
+	ts := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.Format(time.RFC3339Nano)
+	}
+	band := func(b *calcBand) (string, string) {
+		if b == nil {
+			return "", ""
+		}
+		return f(b.P5), f(b.P95)
+	}
+	pLo, pHi := band(r.PTotalBandW)
+	eLo, eHi := band(r.EnergyBandJ)
+	a, e, p := r.AvgW, r.EnergyJ, r.PTotalW
+	return []string{
+		r.Source, r.Profile, strconv.Itoa(r.Samples), f(r.DurationSec), ts(r.From), ts(r.To),
+		f(a.CPU), f(a.Disk), f(a.RAM), f(a.IdleShare), f(a.Total),
+		f(e.CPU), f(e.Disk), f(e.RAM), f(e.IdleShare), f(e.Total),
+		f(p.Min), f(p.Max), f(p.Mean), f(p.StdDev), f(p.P50), f(p.P95), f(p.P99),
+		opt(r.CO2G), opt(r.Cost), r.Currency, opt(r.MonthlyCost),
+		pLo, pHi, eLo, eHi,
+	}
+}
+
+// printCalc writes results as JSON (one object, or original and recomputed)
+// or as CSV with one row per result.
+func printCalc(format string, results ...calcResult) error {
+	if format == "csv" {
+		w := csv.NewWriter(os.Stdout)
+		_ = w.Write(calcCSVHeader)
+		for _, r := range results {
+			_ = w.Write(r.csvRecord())
+		}
+		w.Flush()
+		return w.Error()
+	}
+	var v any = results[0]
+	if len(results) == 2 {
+		v = struct {
+			Original   calcResult `json:"original"`
+			Recomputed calcResult `json:"recomputed"`
+		}{results[0], results[1]}
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// printMarkdown writes the Markdown report of rows to stdout and appends it
+// to $GITHUB_STEP_SUMMARY when set.
+func printMarkdown(rows []row, sum reportSummary, base *reportSummary) error {
+	var md bytes.Buffer
+	if err := writeMarkdown(&md, rows, sum, base, nil); err != nil {
+		return err
+	}
+	if _, err := os.Stdout.Write(md.Bytes()); err != nil {
+		return err
+	}
+	return appendStepSummary(md.Bytes())
+}
+
+// currency returns the meter's currency label, if any.
+func currency(m *tariff.Meter) string {
+	if m == nil {
+		return ""
+	}
+	return m.Tariff().Currency
+}
+
+// recomputeRows feeds the raw report columns back through the accumulator
+// and every enabled layer (emissions, cost, uncertainty ensemble). Every row
+// needs its tick length (see fillIntervals): the model turns byte counts
+// into power over it, so a zero length would inflate disk and RAM power.
+func recomputeRows(rows []row, cfg consumption.Config, l layers) (rowSummary, error) {
+	for i, r := range rows {
+		if !(r.IntervalSec > 0) {
+			return rowSummary{}, fmt.Errorf("row %d: no interval_sec, and no timestamps to derive it from; "+
+				"cannot recompute without tick lengths", i+1)
+		}
+	}
+	acc, err := consumption.NewChecked(&cfg)
+	if err != nil {
+		return rowSummary{}, err
+	}
+	var sumDt float64
+	for _, r := range rows {
+		before := acc.EnergyCumJ()
+		snap := rowSnapshot(r)
+		acc.Apply(snap)
+		sumDt += r.IntervalSec
+		if l.carbon != nil {
+			l.carbon.Add(r.At, acc.EnergyCumJ()-before)
+		}
+		if l.meter != nil {
+			l.meter.Add(r.At, acc.EnergyCumJ()-before)
+		}
+		if l.ens != nil {
+			l.ens.Apply(snap)
+		}
+	}
+	st := acc.Stats()
+	s := rowSummary{
+		n: len(rows), avg: st.Avg, energy: st.Energy.Total, split: st.Energy, sumDt: sumDt,
+		spread: st.PTotal, from: rows[0].At, to: rows[len(rows)-1].At,
+	}
+	if l.carbon != nil {
+		s.co2, s.hasCO2 = l.carbon.TotalG(), true
+	}
+	if l.meter != nil {
+		s.cost, s.hasCost = l.meter.Total(), true
+	}
+	if l.ens != nil {
+		s.powerBand, s.energyBand, s.hasBand = l.ens.AvgPTotal(), l.ens.EnergyCumJ(), true
+	}
+	return s, nil
+}
+
+// rowSnapshot reconstructs the collector snapshot a row was computed from.
+func rowSnapshot(r row) proc.Snapshot {
+	return proc.Snapshot{
+		TimeSec:       r.IntervalSec,
+		UVm:           r.UVm,
+		UProc:         r.UProc,
+		ReadBytes:     r.ReadBytes,
+		WriteBytes:    r.WriteBytes,
+		RefaultBytes:  r.RefaultB,
+		RSSChurnBytes: r.RSSChurnB,
+	}
+}
+
+func pctDelta(a, b float64) string {
+	if a == 0 {
+		if b == 0 {
+			return "0.0%"
+		}
+		return "n/a"
+	}
+	return fmt.Sprintf("%+.1f%%", (b-a)/a*100)
+}
@@ -0,0 +1,87 @@
+//go:build linux
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ja7ad/consumption/pkg/consumption"
+	"github.com/ja7ad/consumption/pkg/system/proc"
+	"github.com/ja7ad/consumption/pkg/types"
+)
+
+// recordRows simulates a run: the rows a report of snaps would hold.
+func recordRows(t *testing.T, cfg consumption.Config, n int) []row {
+	t.Helper()
+	acc, err := consumption.NewChecked(&cfg)
+	require.NoError(t, err)
+	at := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	rows := make([]row, n)
+	for i := range rows {
+		snap := proc.Snapshot{
+			TimeSec: 0.5 + 0.25*float64(i%3), UVm: 0.2 + 0.05*float64(i%8), UProc: 0.1 + 0.02*float64(i%5),
+			ReadBytes: types.Bytes(200_000 * (i % 4)), WriteBytes: types.Bytes(150_000 * (i % 3)),
+			RefaultBytes: types.Bytes(4096 * (i % 6)), RSSChurnBytes: types.Bytes(80_000 * (i % 5)),
+		}
+		at = at.Add(time.Duration(snap.TimeSec * float64(time.Second)))
+		res := acc.Apply(snap)
+		rows[i] = newRow(at, snap, res, acc.EnergyCumJ())
+	}
+	return rows
+}
+
+func TestRecomputeRows_OriginalCoefficientsReproduceColumns(t *testing.T) {
+	cfg := consumption.Config{PIdle: 6, PMax: 28, Gamma: 1.2, ER: 5e-8, EW: 9e-8, EMemRef: 2e-10, EMemRSS: 3e-10, Alpha: 0.4}
+	rows := recordRows(t, cfg, 60)
+
+	orig := summarizeRows(rows)
+	re, err := recomputeRows(rows, cfg, layers{})
+	require.NoError(t, err)
+
+	assert.Equal(t, orig.n, re.n)
+	assert.InDelta(t, orig.sumDt, re.sumDt, 1e-9)
+	assert.InDelta(t, orig.energy, re.energy, 1e-9)
+	for _, c := range []struct {
+		name string
+		a, b float64
+	}{
+		{"avg cpu", orig.avg.PCPU, re.avg.PCPU},
+		{"avg disk", orig.avg.PDisk, re.avg.PDisk},
+		{"avg ram", orig.avg.PRAM, re.avg.PRAM},
+		{"avg idle", orig.avg.PIdleShare, re.avg.PIdleShare},
+		{"avg total", orig.avg.PTotal, re.avg.PTotal},
+		{"energy cpu", orig.split.CPU, re.split.CPU},
+		{"energy disk", orig.split.Disk, re.split.Disk},
+		{"energy ram", orig.split.RAM, re.split.RAM},
+		{"energy idle", orig.split.IdleShare, re.split.IdleShare},
+		{"min", orig.spread.Min, re.spread.Min},
+		{"max", orig.spread.Max, re.spread.Max},
+		{"sd", orig.spread.StdDev, re.spread.StdDev},
+	} {
+		assert.InDelta(t, c.a, c.b, 1e-9, c.name)
+	}
+	assert.Positive(t, re.split.Disk, "the rows carry disk activity")
+	assert.Positive(t, re.split.RAM, "the rows carry memory activity")
+
+	// A different model changes the result.
+	other := cfg
+	other.PMax = 40
+	re2, err := recomputeRows(rows, other, layers{})
+	require.NoError(t, err)
+	assert.Greater(t, re2.energy, re.energy)
+}
+
+func TestRecomputeRows_RejectsRowsWithoutInterval(t *testing.T) {
+	rows := recordRows(t, consumption.Config{}, 5)
+	rows[3].IntervalSec = 0
+	_, err := recomputeRows(rows, consumption.Config{}, layers{})
+	assert.ErrorContains(t, err, "row 4: no interval_sec")
+
+	rows[3].IntervalSec = 1
+	_, err = recomputeRows(rows, consumption.Config{Model: "cubic"}, layers{})
+	assert.ErrorIs(t, err, consumption.ErrUnknownModel)
+}
@@ -0,0 +1,234 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ja7ad/consumption/pkg/calibrate"
+	"github.com/ja7ad/consumption/pkg/consumption"
+	"github.com/ja7ad/consumption/pkg/profile"
+	"github.com/ja7ad/consumption/pkg/system/proc"
+	"github.com/ja7ad/consumption/pkg/system/util"
+	"github.com/ja7ad/consumption/pkg/trace"
+)
+
+type calibrateOpts struct {
+	reference string
+	phaseDur  time.Duration
+	interval  time.Duration
+	dir       string
+	collector string
+	record    string
+	fromTrace string
+	out       string
+	name      string
+}
+
+func calibrateCmd() *cobra.Command {
+	var c calibrateOpts
+
+	cmd := &cobra.Command{
+		Use:   "calibrate",
+		Short: "Fit model coefficients against a reference power measurement",
+		Long: `Run built-in stress phases (idle, CPU at 25/50/75/100%, disk write,
+disk read, memory churn) while sampling this process and a reference power
+source, then fit p_idle, p_max, gamma, er, ew, e_mem_ref and e_mem_rss by
+least squares. The result is written as a reusable JSON profile with
+goodness-of-fit statistics (R², RMSE, MAE).
+
+References:
+  auto         RAPL if readable, else battery
+  rapl         /sys/class/powercap/intel-rapl:* package energy (usually needs root)
+  battery      /sys/class/power_supply/BAT*/power_now (run unplugged)
+  csv:<path>   wattmeter log with time (RFC3339 or Unix seconds) and watts columns
+
+Keep the host otherwise idle: the reference measures the whole machine.
+
+Examples:
+  sudo consumption calibrate --out laptop.json
+  consumption calibrate --reference csv:meter.csv --phase-duration 20s
+  consumption calibrate --from-trace calib.bin --reference csv:meter.csv`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCalibrate(cmd.Context(), c)
+		},
+	}
+
+	cmd.Flags().StringVar(&c.reference, "reference", "auto", "power reference: auto|rapl|battery|csv:<path>")
+	cmd.Flags().DurationVar(&c.phaseDur, "phase-duration", 10*time.Second, "duration of each stress phase")
+	cmd.Flags().DurationVarP(&c.interval, "interval", "i", time.Second, "sampling interval")
+	cmd.Flags().StringVar(&c.dir, "dir", "", "directory for disk stress scratch files (default: OS temp dir)")
+	cmd.Flags().StringVar(&c.collector, "collector", proc.ProcFS, "sampling backend (procfs avoids moving this process)")
+	cmd.Flags().StringVar(&c.record, "record", "", "also record the raw snapshots to a trace file")
+	cmd.Flags().StringVar(&c.fromTrace, "from-trace", "", "fit a previously recorded trace instead of running stress phases (needs a csv reference)")
+	cmd.Flags().StringVarP(&c.out, "out", "o", "consumption-profile.json", "where to write the fitted profile")
+	cmd.Flags().StringVar(&c.name, "name", "", "profile name (default: host name)")
+	return cmd
+}
+
+func runCalibrate(ctx context.Context, c calibrateOpts) error {
+	ref, err := calibrate.NewReference(c.reference)
+	if err != nil {
+		return err
+	}
+
+	host, kernel, cpus, mem := util.SystemSummary()
+	fmt.Printf(_console, host, kernel, cpus, mem, time.Now().Format("2006-01-02 15:04:05"))
+
+	var windows []calibrate.Window
+	if c.fromTrace != "" {
+		if ref.Live() {
+			return errors.New("--from-trace needs an offline reference (csv:<path>)")
+		}
+		windows, err = traceWindows(c.fromTrace)
+		if err != nil {
+			return err
+		}
+		if err := calibrate.ResolveOffline(windows, ref); err != nil {
+			return err
+		}
+	} else {
+		windows, err = stressWindows(ctx, c, ref, host, kernel, cpus, mem)
+		if err != nil {
+			return err
+		}
+	}
+
+	res, err := calibrate.Fit(calibrate.Samples(windows), *consumption.DefaultConfig(), calibrate.FitOptions{})
+	if err != nil {
+		return err
+	}
+
+	name := c.name
+	if name == "" {
+		name = host
+	}
+	p := profile.Profile{
+		Name:        name,
+		Description: fmt.Sprintf("calibrated on %s against %s", host, ref.Name()),
+		Config:      res.Config,
+		Fit: &profile.FitStats{
+			Reference: ref.Name(),
+			Samples:   res.N,
+			Fitted:    res.Fitted,
+			Fixed:     res.Fixed,
+			R2:        res.R2,
+			RMSE:      res.RMSE,
+			MAE:       res.MAE,
+			MaxErr:    res.MaxErr,
+			Host:      host,
+			Kernel:    kernel,
+			At:        time.Now(),
+		},
+	}
+	if err := p.Save(c.out); err != nil {
+		return err
+	}
+
+	fmt.Printf("\ncalibrated profile %q (reference %s, %d samples):\n", p.Name, ref.Name(), res.N)
+	fmt.Printf("- p_idle:     %.3f W\n", res.Config.PIdle)
+	fmt.Printf("- p_max:      %.3f W\n", res.Config.PMax)
+	fmt.Printf("- gamma:      %.3f\n", res.Config.Gamma)
+	fmt.Printf("- er:         %.3e J/B\n", res.Config.ER)
+	fmt.Printf("- ew:         %.3e J/B\n", res.Config.EW)
+	fmt.Printf("- e_mem_ref:  %.3e J/B\n", res.Config.EMemRef)
+	fmt.Printf("- e_mem_rss:  %.3e J/B\n", res.Config.EMemRSS)
+	fmt.Printf("fit: R²=%.4f  RMSE=%.3f W  MAE=%.3f W  max|err|=%.3f W\n", res.R2, res.RMSE, res.MAE, res.MaxErr)
+	if len(res.Fixed) > 0 {
+		fmt.Printf("kept defaults (no signal): %s\n", strings.Join(res.Fixed, ", "))
+	}
+	fmt.Printf("written to %s\n\n", c.out)
+	return nil
+}
+
+func stressWindows(ctx context.Context, c calibrateOpts, ref calibrate.Reference, host, kernel, cpus, mem string) ([]calibrate.Window, error) {
+	col, err := proc.NewCollectorByName(c.collector, 0)
+	if err != nil {
+		return nil, fmt.Errorf("collector: %w", err)
+	}
+	defer func() {
+		_ = col.Close()
+	}()
+
+	var rec *trace.Writer
+	if c.record != "" {
+		rec, err = trace.Create(c.record, trace.Meta{
+			ToolVersion: Version,
+			Host:        host,
+			Kernel:      kernel,
+			CPUs:        cpus,
+			Mem:         mem,
+			NumCPU:      runtime.NumCPU(),
+			Collector:   c.collector,
+			Interval:    c.interval,
+			PIDs:        []int{os.Getpid()},
+			Started:     time.Now(),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("record: %w", err)
+		}
+		defer rec.Close()
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	plan := calibrate.DefaultPlan(c.phaseDur, c.dir)
+	fmt.Printf("# %d phases of %s against %s\n", len(plan), c.phaseDur, ref.Name())
+	return calibrate.Run(ctx, plan, calibrate.Options{
+		Collector: col,
+		PIDs:      []int{os.Getpid()},
+		Reference: ref,
+		Interval:  c.interval,
+		OnPhase: func(p calibrate.Phase) {
+			fmt.Printf("# phase %-10s level %3.0f%%\n", p.Name, p.Level*100)
+		},
+		OnWindow: func(w calibrate.Window) {
+			if rec != nil {
+				_ = rec.Write(trace.Record{At: w.To, Snapshot: w.Snapshot})
+			}
+			if ref.Live() {
+				fmt.Printf("  U_vm=%.3f read=%s write=%s ref=%.3f W\n",
+					w.Snapshot.UVm, w.Snapshot.ReadBytes.Humanized(), w.Snapshot.WriteBytes.Humanized(), w.Watts)
+			}
+		},
+	})
+}
+
+// traceWindows turns recorded (non-warmup) snapshots into calibration windows.
+func traceWindows(path string) ([]calibrate.Window, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	rd, err := trace.NewReader(bufio.NewReader(f))
+	if err != nil {
+		return nil, err
+	}
+	recs, err := rd.ReadAll()
+	if err != nil && !errors.Is(err, trace.ErrTruncated) {
+		return nil, err
+	}
+	var ws []calibrate.Window
+	for _, r := range recs {
+		if r.Warmup {
+			continue
+		}
+		from := r.At.Add(-time.Duration(r.Snapshot.TimeSec * float64(time.Second)))
+		ws = append(ws, calibrate.Window{Phase: "trace", From: from, To: r.At, Snapshot: r.Snapshot})
+	}
+	return ws, nil
+}
@@ -0,0 +1,347 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// chartPoints caps the points per chart; longer runs are averaged into
+// buckets of consecutive ticks.
+const chartPoints = 500
+
+// chartPoint is one (possibly downsampled) tick: powers, utilizations and
+// I/O rates are time-weighted over the bucket, energies are its last values.
+type chartPoint struct {
+	at                          time.Time // last tick of the bucket
+	x                           float64   // seconds since the first tick
+	cpu, disk, ram, idle, total float64   // W
+	eCum, eP5, eP95             float64   // J
+	uVm, uProc                  float64
+	readRate, writeRate         float64 // B/s
+	refaultRate, rssChurnRate   float64 // B/s
+}
+
+// downsample turns rows into at most n chart points.
+func downsample(rows []row, n int) []chartPoint {
+	if len(rows) == 0 {
+		return nil
+	}
+	k := (len(rows) + n - 1) / n
+	t0 := rows[0].At
+	span := rows[len(rows)-1].At.Sub(t0) > 0
+
+	var pts []chartPoint
+	for i := 0; i < len(rows); i += k {
+		bucket := rows[i:min(i+k, len(rows))]
+		var p chartPoint
+		var w, dt float64
+		var rd, wr, rf, rss float64
+		for _, r := range bucket {
+			wt := r.IntervalSec
+			if wt <= 0 {
+				wt = 1
+			}
+			w += wt
+			dt += r.IntervalSec
+			p.cpu += r.PCPU * wt
+			p.disk += r.PDisk * wt
+			p.ram += r.PRAM * wt
+			p.idle += r.PIdleShare * wt
+			p.total += r.PTotal * wt
+			p.uVm += r.UVm * wt
+			p.uProc += r.UProc * wt
+			rd += float64(r.ReadBytes)
+			wr += float64(r.WriteBytes)
+			rf += float64(r.RefaultB)
+			rss += float64(r.RSSChurnB)
+		}
+		p.cpu, p.disk, p.ram, p.idle, p.total = p.cpu/w, p.disk/w, p.ram/w, p.idle/w, p.total/w
+		p.uVm, p.uProc = p.uVm/w, p.uProc/w
+		if dt > 0 {
+			p.readRate, p.writeRate, p.refaultRate, p.rssChurnRate = rd/dt, wr/dt, rf/dt, rss/dt
+		}
+		last := bucket[len(bucket)-1]
+		p.at = last.At
+		p.eCum, p.eP5, p.eP95 = last.EnergyCumJ, last.ECumP5, last.ECumP95
+		if span {
+			p.x = last.At.Sub(t0).Seconds()
+		} else {
+			p.x = float64(i + len(bucket) - 1)
+		}
+		pts = append(pts, p)
+	}
+	return pts
+}
+
+// chartSet is the charts of one series of rows (one group, or the whole run).
+type chartSet struct {
+	Group  string
+	Ticks  int // rows before downsampling
+	Points int
+	Charts []template.HTML
+}
+
+// buildCharts renders the power, energy, utilization and I/O charts for
+// rows, one set per group in first-seen order.
+func buildCharts(rows []row, grouped, uncertain bool) []chartSet {
+	var sets []chartSet
+	for _, s := range splitGroups(rows, grouped) {
+		g, rs := s.name, s.rows
+		pts := downsample(rs, chartPoints)
+		xs := make([]float64, len(pts))
+		col := func(f func(chartPoint) float64) []float64 {
+			out := make([]float64, len(pts))
+			for i, p := range pts {
+				out[i] = f(p)
+			}
+			return out
+		}
+		for i, p := range pts {
+			xs[i] = p.x
+		}
+		timed := len(rs) > 1 && rs[len(rs)-1].At.Sub(rs[0].At) > 0
+
+		power := svgChart{Title: "Power by component", Unit: "W", XS: xs, Timed: timed, Stacked: true, Series: []svgSeries{
+			{"cpu", "#4e79a7", col(func(p chartPoint) float64 { return p.cpu })},
+			{"disk", "#f28e2b", col(func(p chartPoint) float64 { return p.disk })},
+			{"ram", "#59a14f", col(func(p chartPoint) float64 { return p.ram })},
+			{"idle share", "#bab0ac", col(func(p chartPoint) float64 { return p.idle })},
+		}}
+		energy := svgChart{Title: "Cumulative energy", Unit: "J", XS: xs, Timed: timed, Series: []svgSeries{
+			{"E_cum", "#4e79a7", col(func(p chartPoint) float64 { return p.eCum })},
+		}}
+		if uncertain {
+			energy.Band = &svgBand{"p5–p95", "#4e79a7",
+				col(func(p chartPoint) float64 { return p.eP5 }), col(func(p chartPoint) float64 { return p.eP95 })}
+		}
+		util := svgChart{Title: "Utilization", Unit: "", XS: xs, Timed: timed, YMax: 1, Series: []svgSeries{
+			{"U_vm", "#e15759", col(func(p chartPoint) float64 { return p.uVm })},
+			{"U_proc", "#4e79a7", col(func(p chartPoint) float64 { return p.uProc })},
+		}}
+		io := svgChart{Title: "I/O", Unit: "B/s", XS: xs, Timed: timed, Series: []svgSeries{
+			{"read", "#76b7b2", col(func(p chartPoint) float64 { return p.readRate })},
+			{"write", "#edc948", col(func(p chartPoint) float64 { return p.writeRate })},
+			{"refault", "#b07aa1", col(func(p chartPoint) float64 { return p.refaultRate })},
+			{"rss churn", "#ff9da7", col(func(p chartPoint) float64 { return p.rssChurnRate })},
+		}}
+		sets = append(sets, chartSet{
+			Group:  g,
+			Ticks:  len(rs),
+			Points: len(pts),
+			Charts: []template.HTML{power.render(), energy.render(), util.render(), io.render()},
+		})
+	}
+	return sets
+}
+
+type rowSeries struct {
+	name string
+	rows []row
+}
+
+// splitGroups splits rows into one series per group, in first-seen order;
+// without grouped, all rows form one unnamed series.
+func splitGroups(rows []row, grouped bool) []rowSeries {
+	var out []rowSeries
+	idx := map[string]int{}
+	for _, r := range rows {
+		g := ""
+		if grouped {
+			g = r.Group
+		}
+		i, ok := idx[g]
+		if !ok {
+			i = len(out)
+			idx[g] = i
+			out = append(out, rowSeries{name: g})
+		}
+		out[i].rows = append(out[i].rows, r)
+	}
+	return out
+}
+
+type svgSeries struct {
+	Name, Color string
+	YS          []float64
+}
+
+type svgBand struct {
+	Name, Color string
+	Lo, Hi      []float64
+}
+
+// svgChart is a line chart, or a stacked area chart, over a shared x axis.
+type svgChart struct {
+	Title, Unit string
+	XS          []float64
+	Timed       bool // x is seconds since start (else tick index)
+	Stacked     bool
+	YMax        float64 // fixed top of the y axis; 0 scales to the data
+	Series      []svgSeries
+	Band        *svgBand
+}
+
+const (
+	svgW, svgH                        = 900, 240
+	svgLeft, svgRight, svgTop, svgBot = 64, 16, 28, 28
+)
+
+// render draws the chart as an inline <svg>. Only numbers and fixed labels
+// go into the markup.
+func (c svgChart) render() template.HTML {
+	n := len(c.XS)
+	tops := c.tops()
+	ymax := c.YMax
+	if ymax == 0 {
+		for _, ys := range tops {
+			for _, y := range ys {
+				ymax = math.Max(ymax, y)
+			}
+		}
+		if c.Band != nil {
+			for _, y := range c.Band.Hi {
+				ymax = math.Max(ymax, y)
+			}
+		}
+		ymax = niceCeil(ymax)
+	}
+	xmin, xmax := 0.0, 1.0
+	if n > 0 {
+		xmin, xmax = c.XS[0], c.XS[n-1]
+		if xmax <= xmin {
+			xmax = xmin + 1
+		}
+	}
+	pw, ph := float64(svgW-svgLeft-svgRight), float64(svgH-svgTop-svgBot)
+	px := func(x float64) float64 { return svgLeft + (x-xmin)/(xmax-xmin)*pw }
+	py := func(y float64) float64 { return svgTop + ph - math.Min(y/ymax, 1)*ph }
+	path := func(xs, ys []float64, b *strings.Builder) {
+		for j := range xs {
+			fmt.Fprintf(b, "%.1f,%.1f ", px(xs[j]), py(ys[j]))
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="100%%" role="img" font-size="11" font-family="system-ui,sans-serif">`, svgW, svgH)
+	title := c.Title
+	if c.Unit != "" {
+		title += " (" + c.Unit + ")"
+	}
+	fmt.Fprintf(&b, `<text x="%d" y="16" font-size="13" font-weight="600">%s</text>`, svgLeft, template.HTMLEscapeString(title))
+
+	// grid and y labels
+	for i := 0; i <= 4; i++ {
+		y := ymax * float64(i) / 4
+		fmt.Fprintf(&b, `<line x1="%d" x2="%d" y1="%.1f" y2="%.1f" stroke="#e5e5e5"/>`, svgLeft, svgW-svgRight, py(y), py(y))
+		fmt.Fprintf(&b, `<text x="%d" y="%.1f" text-anchor="end" fill="#555">%s</text>`, svgLeft-6, py(y)+4, fmtAxis(y))
+	}
+	// x labels
+	for i := 0; i <= 4; i++ {
+		x := xmin + (xmax-xmin)*float64(i)/4
+		anchor := "middle"
+		switch i {
+		case 0:
+			anchor = "start"
+		case 4:
+			anchor = "end"
+		}
+		label := strconv.Itoa(int(math.Round(x)))
+		if c.Timed {
+			label = (time.Duration(x * float64(time.Second))).Round(time.Second).String()
+		}
+		fmt.Fprintf(&b, `<text x="%.1f" y="%d" text-anchor="%s" fill="#555">%s</text>`, px(x), svgH-8, anchor, label)
+	}
+
+	if n > 0 {
+		if c.Band != nil {
+			b.WriteString(`<polygon fill-opacity="0.2" stroke="none" fill="` + c.Band.Color + `" points="`)
+			path(c.XS, c.Band.Hi, &b)
+			for j := n - 1; j >= 0; j-- {
+				fmt.Fprintf(&b, "%.1f,%.1f ", px(c.XS[j]), py(c.Band.Lo[j]))
+			}
+			b.WriteString(`"/>`)
+		}
+		for i, s := range c.Series {
+			if c.Stacked {
+				b.WriteString(`<polygon fill-opacity="0.85" stroke="none" fill="` + s.Color + `" points="`)
+				path(c.XS, tops[i], &b)
+				for j := n - 1; j >= 0; j-- {
+					lo := 0.0
+					if i > 0 {
+						lo = tops[i-1][j]
+					}
+					fmt.Fprintf(&b, "%.1f,%.1f ", px(c.XS[j]), py(lo))
+				}
+				b.WriteString(`"/>`)
+				continue
+			}
+			b.WriteString(`<polyline fill="none" stroke-width="1.5" stroke="` + s.Color + `" points="`)
+			path(c.XS, s.YS, &b)
+			b.WriteString(`"/>`)
+		}
+	}
+
+	// legend, right-aligned on the title line
+	x := svgW - svgRight
+	legend := c.Series
+	if c.Band != nil {
+		legend = append(legend, svgSeries{Name: c.Band.Name, Color: c.Band.Color})
+	}
+	for i := len(legend) - 1; i >= 0; i-- {
+		s := legend[i]
+		x -= 14 + 7*len([]rune(s.Name))
+		fmt.Fprintf(&b, `<rect x="%d" y="7" width="10" height="10" fill="%s"/><text x="%d" y="16">%s</text>`,
+			x, s.Color, x+13, template.HTMLEscapeString(s.Name))
+	}
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+// tops returns the upper edge of each series: its values, or when stacked,
+// the running sum of it and the series below.
+func (c svgChart) tops() [][]float64 {
+	tops := make([][]float64, len(c.Series))
+	for i, s := range c.Series {
+		tops[i] = s.YS
+		if c.Stacked && i > 0 {
+			tops[i] = make([]float64, len(c.XS))
+			for j := range c.XS {
+				tops[i][j] = tops[i-1][j] + s.YS[j]
+			}
+		}
+	}
+	return tops
+}
+
+// niceCeil rounds v up to 1, 2 or 5 times a power of ten (1 for v <= 0).
+func niceCeil(v float64) float64 {
+	if v <= 0 {
+		return 1
+	}
+	e := math.Pow(10, math.Floor(math.Log10(v)))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if v <= m*e {
+			return m * e
+		}
+	}
+	return 10 * e
+}
+
+// fmtAxis formats an axis label compactly (1.5k, 2M).
+func fmtAxis(v float64) string {
+	switch a := math.Abs(v); {
+	case a >= 1e9:
+		return strconv.FormatFloat(v/1e9, 'g', 3, 64) + "G"
+	case a >= 1e6:
+		return strconv.FormatFloat(v/1e6, 'g', 3, 64) + "M"
+	case a >= 1e4:
+		return strconv.FormatFloat(v/1e3, 'g', 3, 64) + "k"
+	}
+	return strconv.FormatFloat(v, 'g', 3, 64)
+}
@@ -0,0 +1,142 @@
+//go:build linux
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ja7ad/consumption/pkg/types"
+)
+
+func TestDownsample(t *testing.T) {
+	t0 := time.Date(2025, 1, 6, 12, 0, 0, 0, time.UTC)
+	tick := func(sec, interval, pcpu float64, read uint64) row {
+		return row{
+			At: t0.Add(time.Duration(sec * float64(time.Second))), IntervalSec: interval,
+			PCPU: pcpu, PTotal: pcpu + 1, UVm: pcpu / 10, ReadBytes: types.Bytes(read), EnergyCumJ: sec,
+		}
+	}
+	seq := func(n int) []row {
+		var rs []row
+		for i := range n {
+			rs = append(rs, tick(float64(i+1), 1, float64(i), 100))
+		}
+		return rs
+	}
+
+	cases := []struct {
+		name  string
+		rows  []row
+		n     int
+		want  int // points
+		check func(t *testing.T, pts []chartPoint)
+	}{
+		{name: "empty", n: 10, want: 0},
+		{
+			name: "n above len(rows) keeps every tick",
+			rows: seq(3), n: 10, want: 3,
+			check: func(t *testing.T, pts []chartPoint) {
+				for i, p := range pts {
+					assert.Equal(t, float64(i), p.cpu)
+					assert.Equal(t, float64(i), p.x, "seconds since the first tick")
+					assert.Equal(t, 100.0, p.readRate)
+				}
+			},
+		},
+		{
+			name: "buckets of ceil(len/n) ticks, last one partial",
+			rows: seq(10), n: 4, want: 4,
+			check: func(t *testing.T, pts []chartPoint) {
+				assert.Equal(t, 1.0, pts[0].cpu, "mean of 0, 1, 2")
+				assert.Equal(t, 9.0, pts[3].cpu, "last bucket holds one tick")
+				assert.Equal(t, 3.0, pts[0].eCum, "energy of the bucket's last tick")
+				assert.Equal(t, t0.Add(3*time.Second), pts[0].at)
+				assert.Equal(t, 9.0, pts[3].x)
+			},
+		},
+		{
+			name: "time-weighted averages and rates",
+			rows: []row{tick(1, 1, 2, 100), tick(4, 3, 6, 300)}, n: 1, want: 1,
+			check: func(t *testing.T, pts []chartPoint) {
+				p := pts[0]
+				assert.InDelta(t, (2*1+6*3)/4.0, p.cpu, 1e-12)
+				assert.InDelta(t, (3*1+7*3)/4.0, p.total, 1e-12)
+				assert.InDelta(t, (0.2*1+0.6*3)/4.0, p.uVm, 1e-12)
+				assert.InDelta(t, 400/4.0, p.readRate, 1e-12)
+				assert.Equal(t, 4.0, p.eCum)
+			},
+		},
+		{
+			name: "zero IntervalSec weighs ticks equally and has no rates",
+			rows: []row{{PCPU: 2, ReadBytes: 100}, {PCPU: 6, ReadBytes: 300}, {PCPU: 7}}, n: 2, want: 2,
+			check: func(t *testing.T, pts []chartPoint) {
+				assert.Equal(t, 4.0, pts[0].cpu)
+				assert.Zero(t, pts[0].readRate)
+				assert.Equal(t, 1.0, pts[0].x, "untimed rows use the tick index")
+				assert.Equal(t, 2.0, pts[1].x)
+				assert.True(t, pts[0].at.IsZero())
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			pts := downsample(tc.rows, tc.n)
+			require.Len(t, pts, tc.want)
+			if tc.check != nil {
+				tc.check(t, pts)
+			}
+		})
+	}
+}
+
+func TestSvgChart_Tops(t *testing.T) {
+	series := []svgSeries{
+		{"a", "#000", []float64{1, 2, 0}},
+		{"b", "#111", []float64{3, 0, 1}},
+		{"c", "#222", []float64{0.5, 0.5, 0.5}},
+	}
+	cases := []struct {
+		name    string
+		stacked bool
+		want    [][]float64
+	}{
+		{"lines", false, [][]float64{{1, 2, 0}, {3, 0, 1}, {0.5, 0.5, 0.5}}},
+		{"stacked", true, [][]float64{{1, 2, 0}, {4, 2, 1}, {4.5, 2.5, 1.5}}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := svgChart{XS: []float64{0, 1, 2}, Stacked: tc.stacked, Series: series}
+			assert.Equal(t, tc.want, c.tops())
+		})
+	}
+}
+
+func TestSvgChart_Render(t *testing.T) {
+	c := svgChart{Title: "Power", Unit: "W", XS: []float64{0, 1, 2}, Stacked: true, Series: []svgSeries{
+		{"cpu", "#000", []float64{1, 2, 3}},
+		{"idle share", "#111", []float64{4, 4, 4}},
+	}}
+	svg := string(c.render())
+	assert.True(t, strings.HasPrefix(svg, "<svg") && strings.HasSuffix(svg, "</svg>"))
+	assert.Equal(t, 2, strings.Count(svg, "<polygon"), "one area per series")
+	assert.Contains(t, svg, ">10</text>", "y axis scaled to the stacked top of 7")
+	assert.Contains(t, svg, "Power (W)")
+
+	c.Stacked = false
+	svg = string(c.render())
+	assert.Equal(t, 2, strings.Count(svg, "<polyline"))
+	assert.Contains(t, svg, ">5</text>", "y axis scaled to the highest line")
+
+	assert.NotContains(t, string(svgChart{Title: "empty"}.render()), "<poly")
+}
+
+func TestNiceCeil(t *testing.T) {
+	for in, want := range map[float64]float64{0: 1, -3: 1, 0.7: 1, 1: 1, 1.2: 2, 3: 5, 7: 10, 420: 500} {
+		assert.Equal(t, want, niceCeil(in), "niceCeil(%g)", in)
+	}
+}
@@ -0,0 +1,44 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ja7ad/consumption/pkg/system/proc"
+)
+
+func collectors() *cobra.Command {
+	return &cobra.Command{
+		Use:   "collectors",
+		Short: "List sampling backends and whether they can run on this host",
+		Long: `List registered sampling backends in auto-selection order.
+Unavailable backends show why their capability probe rejected this host.
+
+Examples:
+  consumption collectors
+  consumption --collector procfs -- $(pidof nginx)`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			auto, autoErr := proc.Select(proc.Auto)
+
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "NAME\tSTATUS\tDESCRIPTION")
+			fmt.Fprintln(tw, "----\t------\t-----------")
+			for _, a := range proc.Available() {
+				status := "available"
+				if !a.Usable() {
+					status = "unavailable: " + a.Err.Error()
+				} else if autoErr == nil && a.Name == auto.Name {
+					status = "available (auto)"
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\n", a.Name, status, a.Description)
+			}
+			return tw.Flush()
+		},
+	}
+}
@@ -0,0 +1,333 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ja7ad/consumption/pkg/consumption"
+)
+
+// Verdicts of a diff, decided by the P_total test.
+const (
+	verdictRegressed = "regressed"
+	verdictImproved  = "improved"
+	verdictNoChange  = "no significant change"
+)
+
+// exitRegressed is the exit status of diff --fail-on-regression when the
+// verdict is "regressed".
+const exitRegressed = 4
+
+// regressionError reports a significant P_total regression.
+type regressionError struct {
+	summary string
+}
+
+func (e *regressionError) Error() string {
+	return fmt.Sprintf("energy regression (exit %d): %s", exitRegressed, e.summary)
+}
+
+func diffCmd() *cobra.Command {
+	var (
+		group  string
+		format string
+		alpha  float64
+		fail   bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "diff <base report> <head report>",
+		Short: "Compare two reports and test whether power changed significantly",
+		Long: `Compare two CSV/JSON/NDJSON reports (e.g. of a base and a head build).
+
+For each power component and the total, the per-tick samples of both reports
+are compared with Welch's t-test (unequal variances). The result shows the
+mean of each side, the change, the two-sided p-value, the confidence
+interval of the change and Hedges' g as effect size (negligible < 0.2,
+small < 0.5, medium < 0.8, large). Total energy is compared without a test:
+it is a single value per report and depends on the run length.
+
+The verdict comes from the P_total test: "regressed" or "improved" when
+p < --alpha, otherwise "no significant change". With --fail-on-regression a
+"regressed" verdict exits with status 4. Ticks within a run are not fully
+independent, so treat p-values near --alpha with care.
+
+Examples:
+  consumption diff base.json head.json
+  consumption diff base.csv head.csv --alpha 0.01 --fail-on-regression
+  consumption diff base.csv head.csv --group api --format markdown >> comment.md
+  consumption diff base.csv head.csv --format json | jq .verdict`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "text" && format != "json" && format != "markdown" {
+				return fmt.Errorf("--format %q: want text, json or markdown", format)
+			}
+			if alpha <= 0 || alpha >= 1 {
+				return errors.New("--alpha must be in (0,1)")
+			}
+			var sides [2][]row
+			for i, path := range args {
+				f, err := readReportFile(path)
+				if err != nil {
+					return err
+				}
+				rows, err := selectGroup(f.rows, group)
+				if err != nil {
+					return fmt.Errorf("%s: %w", path, err)
+				}
+				if len(rows) < 2 {
+					return fmt.Errorf("%s: need at least 2 rows, have %d", path, len(rows))
+				}
+				sides[i] = rows
+			}
+
+			d, err := diffReports(args[0], sides[0], args[1], sides[1], alpha)
+			if err != nil {
+				return err
+			}
+			switch format {
+			case "json":
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				err = enc.Encode(d)
+			case "markdown":
+				var md bytes.Buffer
+				d.writeMarkdown(&md)
+				if _, err = os.Stdout.Write(md.Bytes()); err == nil {
+					err = appendStepSummary(md.Bytes())
+				}
+			default:
+				d.print()
+			}
+			if err == nil && fail && d.Verdict == verdictRegressed {
+				err = &regressionError{summary: d.summary()}
+			}
+			return err
+		},
+	}
+	cmd.Flags().StringVar(&group, "group", "", "only use rows of this group (reports of --group runs)")
+	cmd.Flags().StringVar(&format, "format", "text", "output format: text, json or markdown (markdown is also appended to $GITHUB_STEP_SUMMARY when set)")
+	cmd.Flags().Float64Var(&alpha, "alpha", 0.05, "significance level of the tests; the confidence intervals are 1-alpha")
+	cmd.Flags().BoolVar(&fail, "fail-on-regression", false, fmt.Sprintf("exit with status %d when the verdict is %q", exitRegressed, verdictRegressed))
+	return cmd
+}
+
+// diffSide describes one report of a diff.
+type diffSide struct {
+	Path        string  `json:"path"`
+	Ticks       int     `json:"ticks"`
+	DurationSec float64 `json:"duration_sec"`
+	Profile     string  `json:"profile,omitempty"`
+}
+
+// diffMetric is one compared quantity. Test fields are nil for energy and
+// for values JSON cannot hold (constant samples give infinite t and g).
+type diffMetric struct {
+	Metric    string   `json:"metric"`
+	Unit      string   `json:"unit"`
+	Base      float64  `json:"base"`
+	Head      float64  `json:"head"`
+	Delta     float64  `json:"delta"`
+	DeltaPct  *float64 `json:"delta_pct"` // nil when base is 0
+	P         *float64 `json:"p_value,omitempty"`
+	CILow     *float64 `json:"ci_low,omitempty"`
+	CIHigh    *float64 `json:"ci_high,omitempty"`
+	HedgesG   *float64 `json:"hedges_g,omitempty"`
+	Magnitude string   `json:"effect,omitempty"`
+	tested    bool
+}
+
+// diffResult is the outcome of comparing two reports.
+type diffResult struct {
+	Base    diffSide     `json:"base"`
+	Head    diffSide     `json:"head"`
+	Test    string       `json:"test"`
+	Alpha   float64      `json:"alpha"`
+	Metrics []diffMetric `json:"metrics"`
+	Verdict string       `json:"verdict"`
+}
+
+// diffReports tests the per-tick power columns of head against base.
+func diffReports(basePath string, base []row, headPath string, head []row, alpha float64) (diffResult, error) {
+	side := func(path string, rows []row) diffSide {
+		s := diffSide{Path: path, Ticks: len(rows), Profile: reportProfile(rows)}
+		for _, r := range rows {
+			s.DurationSec += r.IntervalSec
+		}
+		return s
+	}
+	d := diffResult{Base: side(basePath, base), Head: side(headPath, head), Test: "welch_t", Alpha: alpha}
+
+	cols := []struct {
+		name string
+		f    func(row) float64
+	}{
+		{"p_cpu_w", func(r row) float64 { return r.PCPU }},
+		{"p_disk_w", func(r row) float64 { return r.PDisk }},
+		{"p_ram_w", func(r row) float64 { return r.PRAM }},
+		{"p_idle_share_w", func(r row) float64 { return r.PIdleShare }},
+		{"p_total_w", func(r row) float64 { return r.PTotal }},
+	}
+	for _, c := range cols {
+		a, b := make([]float64, len(base)), make([]float64, len(head))
+		for i, r := range base {
+			a[i] = c.f(r)
+		}
+		for i, r := range head {
+			b[i] = c.f(r)
+		}
+		w, err := consumption.WelchTest(a, b, 1-alpha)
+		if err != nil {
+			return diffResult{}, fmt.Errorf("%s: %w", c.name, err)
+		}
+		m := newDiffMetric(c.name, "W", w.MeanA, w.MeanB)
+		m.tested = true
+		m.P, m.CILow, m.CIHigh, m.HedgesG = finite(w.P), finite(w.CILow), finite(w.CIHigh), finite(w.G)
+		m.Magnitude = w.Magnitude()
+		d.Metrics = append(d.Metrics, m)
+
+		if c.name == "p_total_w" {
+			switch {
+			case w.P >= alpha:
+				d.Verdict = verdictNoChange
+			case w.Diff > 0:
+				d.Verdict = verdictRegressed
+			default:
+				d.Verdict = verdictImproved
+			}
+		}
+	}
+	eb, eh := summarizeRows(base).energy, summarizeRows(head).energy
+	d.Metrics = append(d.Metrics, newDiffMetric("energy_j", "J", eb, eh))
+	return d, nil
+}
+
+func newDiffMetric(name, unit string, base, head float64) diffMetric {
+	m := diffMetric{Metric: name, Unit: unit, Base: base, Head: head, Delta: head - base}
+	if base != 0 {
+		m.DeltaPct = finite(100 * (head - base) / base)
+	}
+	return m
+}
+
+// finite returns &v, or nil for NaN and ±Inf.
+func finite(v float64) *float64 {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil
+	}
+	return &v
+}
+
+// total returns the P_total metric.
+func (d diffResult) total() diffMetric {
+	for _, m := range d.Metrics {
+		if m.Metric == "p_total_w" {
+			return m
+		}
+	}
+	return diffMetric{}
+}
+
+// summary is the one-line verdict with the P_total evidence.
+func (d diffResult) summary() string {
+	t := d.total()
+	p := fmtP(t.P)
+	if !strings.HasPrefix(p, "<") {
+		p = "=" + p
+	}
+	s := fmt.Sprintf("%s: P_total %+.3f W (%s), p%s, Hedges' g %s (%s)",
+		d.Verdict, t.Delta, fmtPct(t.DeltaPct), p, fmtOpt("%.2f", t.HedgesG, "∞"), t.Magnitude)
+	if t.CILow != nil && t.CIHigh != nil {
+		s += fmt.Sprintf(", %g%% CI [%+.3f, %+.3f] W", 100*(1-d.Alpha), *t.CILow, *t.CIHigh)
+	}
+	return s
+}
+
+func (d diffResult) print() {
+	sideLine := func(label string, s diffSide) {
+		fmt.Printf("%s: %s (%d ticks, %s", label, s.Path, s.Ticks,
+			time.Duration(s.DurationSec*float64(time.Second)).Round(time.Millisecond))
+		if s.Profile != "" {
+			fmt.Printf(", profile %s", s.Profile)
+		}
+		fmt.Println(")")
+	}
+	fmt.Println()
+	sideLine("base", d.Base)
+	sideLine("head", d.Head)
+	fmt.Println()
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "METRIC\tBASE\tHEAD\tΔ\tΔ%\tP\tHEDGES' G")
+	for _, m := range d.Metrics {
+		p, g := "-", "-"
+		if m.tested {
+			p, g = fmtP(m.P), fmtOpt("%.2f", m.HedgesG, "∞")+" "+m.Magnitude
+		}
+		fmt.Fprintf(tw, "%s\t%.3f\t%.3f\t%+.3f\t%s\t%s\t%s\n",
+			diffLabel(m), m.Base, m.Head, m.Delta, fmtPct(m.DeltaPct), p, g)
+	}
+	_ = tw.Flush()
+	fmt.Printf("\nverdict: %s (Welch's t-test, alpha %g)\n\n", d.summary(), d.Alpha)
+}
+
+func (d diffResult) writeMarkdown(b *bytes.Buffer) {
+	fmt.Fprintf(b, "## Energy diff: %s\n\n", d.Verdict)
+	fmt.Fprintf(b, "`%s` (%d ticks) → `%s` (%d ticks)\n\n", mdCode(d.Base.Path), d.Base.Ticks, mdCode(d.Head.Path), d.Head.Ticks)
+	b.WriteString("| Metric | Base | Head | Δ | Δ% | p | Hedges' g |\n|---|---:|---:|---:|---:|---:|---|\n")
+	for _, m := range d.Metrics {
+		p, g := "–", "–"
+		if m.tested {
+			p, g = fmtP(m.P), fmtOpt("%.2f", m.HedgesG, "∞")+" "+m.Magnitude
+		}
+		label := diffLabel(m)
+		if m.Metric == "p_total_w" {
+			label = "**" + label + "**"
+		}
+		fmt.Fprintf(b, "| %s | %.3f | %.3f | %+.3f | %s | %s | %s |\n",
+			label, m.Base, m.Head, m.Delta, fmtPct(m.DeltaPct), p, g)
+	}
+	fmt.Fprintf(b, "\n**%s** (Welch's t-test, alpha %g)\n\n", mdCell(d.summary()), d.Alpha)
+}
+
+// diffLabel names a metric for tables, e.g. "P_cpu (W)".
+func diffLabel(m diffMetric) string {
+	name := strings.TrimSuffix(strings.TrimSuffix(m.Metric, "_w"), "_j")
+	switch name {
+	case "energy":
+		name = "Energy"
+	case "p_idle_share":
+		name = "P_idle_share"
+	default:
+		name = "P_" + strings.TrimPrefix(name, "p_")
+	}
+	return name + " (" + m.Unit + ")"
+}
+
+func fmtPct(v *float64) string { return fmtOpt("%+.1f%%", v, "n/a") }
+
+// fmtP formats a p-value, with "<0.001" for tiny ones.
+func fmtP(v *float64) string {
+	if v != nil && *v < 0.001 {
+		return "<0.001"
+	}
+	return fmtOpt("%.3f", v, "n/a")
+}
+
+func fmtOpt(verb string, v *float64, none string) string {
+	if v == nil {
+		return none
+	}
+	return fmt.Sprintf(verb, *v)
+}
@@ -0,0 +1,152 @@
+//go:build linux
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ja7ad/consumption/pkg/consumption"
+)
+
+// diffRows returns n one-second ticks with P_total around mean: a fixed
+// ±0.5 W zigzag, 5 W of it idle share.
+func diffRows(n int, mean float64) []row {
+	rows := make([]row, n)
+	for i := range rows {
+		p := mean + 0.5*float64(i%5-2)/2
+		rows[i] = row{PCPU: p - 5, PIdleShare: 5, PTotal: p, IntervalSec: 1}
+	}
+	return rows
+}
+
+func TestDiffReports(t *testing.T) {
+	cases := []struct {
+		name       string
+		base, head []row
+		verdict    string
+	}{
+		{"significant regression", diffRows(40, 10), diffRows(40, 11), verdictRegressed},
+		{"significant improvement", diffRows(40, 10), diffRows(40, 9), verdictImproved},
+		{"difference within the noise", diffRows(40, 10), diffRows(40, 10.02), verdictNoChange},
+		{"identical", diffRows(40, 10), diffRows(40, 10), verdictNoChange},
+	}
+	for _, tc := range cases {
+		d, err := diffReports("base.csv", tc.base, "head.csv", tc.head, 0.05)
+		require.NoError(t, err, tc.name)
+		assert.Equal(t, tc.verdict, d.Verdict, tc.name)
+		assert.True(t, strings.HasPrefix(d.summary(), tc.verdict+": P_total "), "%s: %s", tc.name, d.summary())
+
+		total := d.total()
+		require.NotNil(t, total.P, tc.name)
+		assert.Equal(t, tc.verdict == verdictNoChange, *total.P >= 0.05, "%s: p=%g", tc.name, *total.P)
+		assert.Equal(t, 40, d.Base.Ticks)
+		assert.InDelta(t, 40.0, d.Head.DurationSec, 1e-9)
+		assert.Equal(t, "energy_j", d.Metrics[len(d.Metrics)-1].Metric, "energy last, untested")
+		assert.False(t, d.Metrics[len(d.Metrics)-1].tested)
+	}
+
+	d, err := diffReports("b", diffRows(40, 10), "h", diffRows(40, 11), 0.05)
+	require.NoError(t, err)
+	total := d.total()
+	assert.InDelta(t, 1.0, total.Delta, 1e-9)
+	assert.InDelta(t, 10.0, *total.DeltaPct, 1e-9)
+	assert.Equal(t, "large", total.Magnitude)
+	assert.Contains(t, d.summary(), "p<0.001")
+	assert.Contains(t, d.summary(), "95% CI [")
+
+	// The threshold is --alpha: a small shift that passes 0.05 fails 0.0001.
+	base, head := diffRows(40, 10), diffRows(40, 10.2)
+	d, err = diffReports("b", base, "h", head, 0.05)
+	require.NoError(t, err)
+	require.Equal(t, verdictRegressed, d.Verdict, "p=%g", *d.total().P)
+	d, err = diffReports("b", base, "h", head, 0.0001)
+	require.NoError(t, err)
+	assert.Equal(t, verdictNoChange, d.Verdict, "p=%g", *d.total().P)
+}
+
+func TestDiffReports_TooFewSamples(t *testing.T) {
+	_, err := diffReports("b", diffRows(1, 10), "h", diffRows(40, 11), 0.05)
+	assert.ErrorIs(t, err, consumption.ErrTooFewSamples)
+	assert.ErrorContains(t, err, "p_cpu_w")
+	_, err = diffReports("b", diffRows(40, 10), "h", nil, 0.05)
+	assert.ErrorIs(t, err, consumption.ErrTooFewSamples)
+}
+
+// writeDiffReport writes rows as a JSON report.
+func writeDiffReport(t *testing.T, name string, rows []row) string {
+	t.Helper()
+	b, err := json.Marshal(rows)
+	require.NoError(t, err)
+	return writeReport(t, name, string(b))
+}
+
+// runDiff runs the diff command and returns its stdout and error.
+func runDiff(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	t.Setenv("GITHUB_STEP_SUMMARY", "")
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	out := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		out <- string(b)
+	}()
+
+	cmd := diffCmd()
+	cmd.SetArgs(args)
+	cmd.SilenceUsage, cmd.SilenceErrors = true, true
+	cmd.SetOut(io.Discard)
+	err = cmd.Execute()
+	_ = w.Close()
+	return <-out, err
+}
+
+func TestDiffCmd(t *testing.T) {
+	base := writeDiffReport(t, "base.json", diffRows(40, 10))
+	regressed := writeDiffReport(t, "regressed.json", diffRows(40, 11))
+	same := writeDiffReport(t, "same.json", diffRows(40, 10.02))
+	short := writeDiffReport(t, "short.json", diffRows(1, 11))
+
+	cases := []struct {
+		name    string
+		args    []string
+		status  int
+		verdict string // in the output
+		err     string
+	}{
+		{"regression", []string{base, regressed}, 0, "verdict: regressed: P_total +1.000 W (+10.0%)", ""},
+		{"regression fails the run", []string{base, regressed, "--fail-on-regression"}, exitRegressed, "verdict: regressed:", "energy regression (exit 4): regressed:"},
+		{"regression as json", []string{base, regressed, "--format", "json", "--fail-on-regression"}, exitRegressed, `"verdict": "regressed"`, ""},
+		{"regression as markdown", []string{base, regressed, "--format", "markdown"}, 0, "## Energy diff: regressed", ""},
+		{"no significant change", []string{base, same, "--fail-on-regression"}, 0, "verdict: no significant change: P_total +0.020 W (+0.2%)", ""},
+		{"improvement", []string{regressed, base, "--fail-on-regression"}, 0, "verdict: improved: P_total -1.000 W (-9.1%)", ""},
+		{"too few samples", []string{base, short}, 1, "", fmt.Sprintf("%s: need at least 2 rows, have 1", short)},
+		{"bad alpha", []string{base, same, "--alpha", "1"}, 1, "", "--alpha must be in (0,1)"},
+		{"bad format", []string{base, same, "--format", "xml"}, 1, "", `--format "xml"`},
+		{"missing report", []string{base, filepath.Join(t.TempDir(), "nope.json")}, 1, "", "no such file"},
+	}
+	for _, tc := range cases {
+		out, err := runDiff(t, tc.args...)
+		assert.Equal(t, tc.status, exitStatus(err), "%s: %v", tc.name, err)
+		if tc.err != "" {
+			assert.ErrorContains(t, err, tc.err, tc.name)
+		} else if tc.status == 0 {
+			assert.NoError(t, err, tc.name)
+		}
+		if tc.verdict != "" {
+			assert.Contains(t, out, tc.verdict, tc.name)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"os"
+	"slices"
+)
+
+func writeHTML(f *os.File, rows []row, sum reportSummary, names map[int]string) error {
+	type view struct {
+		reportSummary
+		Rows   []row
+		PIDs   []pidInfo
+		Charts []chartSet
+	}
+
+	var pidList []pidInfo
+	for pid, name := range names {
+		pidList = append(pidList, pidInfo{PID: pid, Name: name})
+	}
+	// optional: stable order
+	slices.SortFunc(pidList, func(a, b pidInfo) int {
+		switch {
+		case a.PID < b.PID:
+			return -1
+		case a.PID > b.PID:
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	var buf bytes.Buffer
+	data := view{
+		reportSummary: sum,
+		Rows:          rows,
+		PIDs:          pidList,
+		Charts:        buildCharts(rows, len(sum.Groups) > 0, sum.Uncertain),
+	}
+	if err := tpl.Execute(&buf, data); err != nil {
+		return err
+	}
+	_, err := f.Write(buf.Bytes())
+	return err
+}
+
+var tpl = template.Must(template.New("rep").Funcs(template.FuncMap{
+	"pct": func(f float64) float64 { return 100 * f },
+}).Parse(`<!doctype html>
+<html lang="en"><meta charset="utf-8">
+<title>Consumption Report</title>
+<style>
+body{font-family:system-ui,Segoe UI,Roboto,Helvetica,Arial,sans-serif;margin:20px}
+h1,h2{margin:0 0 8px}
+table{border-collapse:collapse;width:100%;font-size:14px}
+th,td{border:1px solid #ddd;padding:6px 8px;text-align:right}
+th:first-child,td:first-child{text-align:left}
+ul{margin:6px 0 14px;padding-left:20px}
+code{background:#f5f5f5;padding:2px 4px;border-radius:4px}
+.small{color:#555}
+.badge{display:inline-block;background:#eef;border:1px solid #ccd;padding:2px 6px;border-radius:6px;margin-right:6px;}
+.chart{max-width:900px;margin:0 0 12px}
+summary{cursor:pointer;font-size:1.5em;font-weight:bold;margin:0 0 8px}
+</style>
+
+<h1><a href="https://github.com/ja7ad/consumption" target="_blank" rel="noopener noreferrer" style="color:inherit;text-decoration:none;">Consumption Report</a></h1>
+
+<p class="small">
+Rows: {{len .Rows}} &nbsp;|&nbsp;
+Avg P(total): {{printf "%.3f" .Avg.PTotal}} W &nbsp;|&nbsp;
+Energy: {{printf "%.3f" .Energy}} J
+{{- if .Carbon}} &nbsp;|&nbsp;
+CO2e: {{printf "%.6f" .CO2G}} g{{end}}
+{{- if .Tariff}} &nbsp;|&nbsp;
+Cost: {{printf "%.6g" .Cost}} {{.Currency}}{{end}}
+</p>
+
+{{if .PIDs}}
+<h2>Processes</h2>
+<ul>
+{{range .PIDs}}
+  <li><span class="badge">PID {{.PID}}</span> {{.Name}}</li>
+{{end}}
+</ul>
+{{end}}
+
+<h2>Summary</h2>
+<ul>
+{{if .Profile}}<li>Profile: {{.Profile}}</li>{{end}}
+<li>Avg P(cpu): {{printf "%.3f" .Avg.PCPU}} W</li>
+<li>Avg P(disk): {{printf "%.3f" .Avg.PDisk}} W</li>
+<li>Avg P(ram): {{printf "%.3f" .Avg.PRAM}} W</li>
+<li>Avg P(total): {{printf "%.3f" .Avg.PTotal}} W</li>
+<li>Energy: {{printf "%.3f" .Energy}} J</li>
+{{if .Stats.Samples}}<li>Energy split: cpu {{printf "%.3f" .Stats.Energy.CPU}} J, disk {{printf "%.3f" .Stats.Energy.Disk}} J, ram {{printf "%.3f" .Stats.Energy.RAM}} J, idle {{printf "%.3f" .Stats.Energy.IdleShare}} J</li>
+<li>P(total) spread: min {{printf "%.3f" .Stats.PTotal.Min}} W, max {{printf "%.3f" .Stats.PTotal.Max}} W, sd {{printf "%.3f" .Stats.PTotal.StdDev}} W</li>
+<li>P(total) percentiles: p50 {{printf "%.3f" .Stats.PTotal.P50}} W, p95 {{printf "%.3f" .Stats.PTotal.P95}} W, p99 {{printf "%.3f" .Stats.PTotal.P99}} W</li>{{end}}
+{{if .Carbon}}<li>CO2e: {{printf "%.6f" .CO2G}} g ({{printf "%.1f" .Intensity}} gCO2e/kWh incl. PUE {{printf "%.2f" .PUE}})</li>{{end}}
+{{if .Tariff}}<li>Cost: {{printf "%.6g" .Cost}} {{.Currency}}</li>
+<li>Projected monthly cost: {{printf "%.2f" .MonthlyCost}} {{.Currency}} at {{printf "%.3f" .Avg.PTotal}} W</li>{{end}}
+{{if .Uncertain}}<li>Avg P(total) p5–p95: {{printf "%.3f" .PTotalBand.P5}}–{{printf "%.3f" .PTotalBand.P95}} W (n={{.Members}})</li>
+<li>Energy p5–p95: {{printf "%.3f" .EnergyBand.P5}}–{{printf "%.3f" .EnergyBand.P95}} J</li>{{end}}
+</ul>
+
+{{if .Groups}}
+<h2>Groups</h2>
+<table>
+<thead>
+<tr>
+<th>group</th><th>PIDs</th><th>P_cpu(W)</th><th>P_disk(W)</th><th>P_ram(W)</th><th>P_total(W)</th><th>E(J)</th>
+{{if .Carbon}}<th>CO2(g)</th>{{end}}
+{{if .Tariff}}<th>cost</th>{{end}}
+<th>share</th>
+</tr>
+</thead>
+<tbody>
+{{range .Groups}}
+<tr>
+<td style="text-align:left">{{.Name}}</td>
+<td>{{.PIDs}}</td>
+<td>{{printf "%.3f" .Avg.PCPU}}</td>
+<td>{{printf "%.3f" .Avg.PDisk}}</td>
+<td>{{printf "%.3f" .Avg.PRAM}}</td>
+<td>{{printf "%.3f" .Avg.PTotal}}</td>
+<td>{{printf "%.3f" .Energy}}</td>
+{{if $.Carbon}}<td>{{printf "%.6f" .CO2G}}</td>{{end}}
+{{if $.Tariff}}<td>{{printf "%.6g" .Cost}}</td>{{end}}
+<td>{{printf "%.1f" (pct .Share)}}%</td>
+</tr>
+{{end}}
+</tbody>
+</table>
+{{end}}
+
+{{if .Charts}}
+<h2>Charts</h2>
+{{range .Charts}}
+{{if .Group}}<h3>{{.Group}}</h3>{{end}}
+{{if lt .Points .Ticks}}<p class="small">{{.Ticks}} ticks averaged into {{.Points}} points.</p>{{end}}
+{{range .Charts}}<div class="chart">{{.}}</div>
+{{end}}
+{{end}}
+{{end}}
+
+<details>
+<summary>Per-tick ({{len .Rows}} rows)</summary>
+<table>
+<thead>
+<tr>
+<th>time</th>{{if .Groups}}<th>group</th>{{end}}<th>U_vm</th><th>U_proc</th>
+<th>P_cpu(W)</th><th>P_disk(W)</th><th>P_ram(W)</th><th>P_total(W)</th><th>E_cum(J)</th>
+{{if .Uncertain}}<th>P_total p5–p95(W)</th><th>E_cum p5–p95(J)</th>{{end}}
+{{if .Carbon}}<th>CO2(g)</th><th>CO2_cum(g)</th>{{end}}
+{{if .Tariff}}<th>cost</th><th>cost_cum</th>{{end}}
+<th>read B</th><th>write B</th><th>refault B</th><th>rssΔ B</th>
+</tr>
+</thead>
+<tbody>
+{{range .Rows}}
+<tr>
+<td style="text-align:left">{{.At.Format "2006-01-02 15:04:05"}}</td>
+{{if $.Groups}}<td style="text-align:left">{{.Group}}</td>{{end}}
+<td>{{printf "%.4f" .UVm}}</td>
+<td>{{printf "%.4f" .UProc}}</td>
+<td>{{printf "%.3f" .PCPU}}</td>
+<td>{{printf "%.3f" .PDisk}}</td>
+<td>{{printf "%.3f" .PRAM}}</td>
+<td>{{printf "%.3f" .PTotal}}</td>
+<td>{{printf "%.3f" .EnergyCumJ}}</td>
+{{if $.Uncertain}}<td>{{printf "%.3f" .PTotalP5}}–{{printf "%.3f" .PTotalP95}}</td><td>{{printf "%.3f" .ECumP5}}–{{printf "%.3f" .ECumP95}}</td>{{end}}
+{{if $.Carbon}}<td>{{printf "%.6f" .CO2G}}</td><td>{{printf "%.6f" .CO2CumG}}</td>{{end}}
+{{if $.Tariff}}<td>{{printf "%.6g" .Cost}}</td><td>{{printf "%.6g" .CostCum}}</td>{{end}}
+<td>{{.ReadBytes}}</td>
+<td>{{.WriteBytes}}</td>
+<td>{{.RefaultB}}</td>
+<td>{{.RSSChurnB}}</td>
+</tr>
+{{end}}
+</tbody>
+</table>
+</details>
+</html>`))
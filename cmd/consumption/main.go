@@ -3,56 +3,35 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
-	"context"
-	"encoding/csv"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"html/template"
-	"io"
 	"log/slog"
+	"maps"
 	"os"
-	"os/signal"
-	"path/filepath"
-	"slices"
-	"strconv"
 	"strings"
-	"syscall"
-	"text/tabwriter"
 	"time"
 
-	"github.com/ja7ad/consumption/pkg/system/util"
-	"github.com/ja7ad/consumption/pkg/types"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 
+	"github.com/ja7ad/consumption/pkg/carbon"
 	"github.com/ja7ad/consumption/pkg/consumption"
+	"github.com/ja7ad/consumption/pkg/profile"
 	"github.com/ja7ad/consumption/pkg/system/proc"
+	"github.com/ja7ad/consumption/pkg/tariff"
 )
 
 var Version = "dev"
 
-var (
-	csvF  *os.File
-	csvW  *csv.Writer
-	jsonF *os.File
-	htmlF *os.File
-
-	pretty bool
-	warmup int
-)
-
-type pidInfo struct {
-	PID  int
-	Name string
-}
-
 type opts struct {
 	// sampling
-	samples  int
-	interval time.Duration
-	ema      float64
+	samples   int
+	interval  time.Duration
+	ema       float64
+	collector string
+	warmup    int
+	record    string
+	groups    []string
 
 	// model
 	pIdle   float64
@@ -63,683 +42,374 @@ type opts struct {
 	eMemRef float64
 	eMemRSS float64
 	alpha   float64
+	model   string
+	curve   string
+
+	// uncertainty
+	uncertainty []string
+	mcSamples   int
+	mcSeed      uint64
+
+	// profile
+	profile    string
+	configPath string
+
+	// carbon
+	gridIntensity float64
+	gridCSV       string
+	pue           float64
+
+	// cost
+	tariffPath string
+	price      float64
+	currency   string
 
 	// outputs
+	pretty   bool
 	csvPath  string
 	jsonPath string
+	ndjson   string
 	htmlPath string
-}
-
-type row struct {
-	At          time.Time   `json:"time"`
-	UVm         float64     `json:"u_vm"`
-	UProc       float64     `json:"u_proc"`
-	PCPU        float64     `json:"p_cpu_w"`
-	PDisk       float64     `json:"p_disk_w"`
-	PRAM        float64     `json:"p_ram_w"`
-	PIdleShare  float64     `json:"p_idle_share_w"`
-	PTotal      float64     `json:"p_total_w"`
-	EnergyCumJ  float64     `json:"e_cum_j"`
-	ReadBytes   types.Bytes `json:"read_bytes"`
-	WriteBytes  types.Bytes `json:"write_bytes"`
-	RefaultB    types.Bytes `json:"refault_bytes"`
-	RSSChurnB   types.Bytes `json:"rss_churn_bytes"`
-	IntervalSec float64     `json:"interval_sec"`
+	markdown string
+	fsync    bool
+
+	// budgets
+	maxEnergy   string
+	maxAvgPower string
+	maxCPU      string
+	maxDisk     string
+	maxRAM      string
+
+	// push sinks
+	influx      string
+	influxToken string
+	statsd      string
+	graphite    string
+	pushEvery   time.Duration
 }
 
 func main() {
 	var o opts
 
 	root := &cobra.Command{
-		Use:     "consumption [PID|PID..PID]...",
+		Use:     "consumption [PID|PID..PID|name:COMM|pg:REGEX]...",
 		Short:   "Process power/energy estimation service",
 		Version: Version,
 		Long: `The consumption tool monitors Linux processes (by PID or process-tree)
 and estimates their resource-based power draw (CPU, disk I/O, RAM proxies).
 It samples utilization via /proc or cgroup (v1/v2) and applies a configurable
 model to compute instantaneous watts and cumulative joules.
-		
+
 Copyright (c) 2024 Javad Rajabzadeh Inc. All rights reserved.
-		
+
 * GitHub: https://github.com/ja7ad/consumption
 
 Examples:
   consumption -s 20 -i 1s $(pstree -p $(pidof goland) | grep -o '([0-9]\+)' | tr -d '()' | tr '\n' ' ')
-  consumption --csv out.csv --json out.json 12345 23456 30000..30032`,
-		Args: cobra.MinimumNArgs(1),
+  consumption --csv out.csv --json out.json 12345 23456 30000..30032
+  consumption --influx 'http://localhost:8086/api/v2/write?org=acme&bucket=energy' --statsd localhost:8125 name:nginx
+  consumption --record trace.bin -s 60 -- $(pidof postgres)
+  consumption --group web=name:nginx --group db=pg:^postgres -s 30
+  consumption --max-energy 500J --max-avg-power 3W -s 60 -- $(pidof my-job)
+
+Exit status is 0 on success, 3 when a --max-* budget is exceeded (the
+summary is still printed and reports are written) and 1 on any other error.`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if cmd.Flags().Changed("group") {
+				return nil
+			}
+			return cobra.MinimumNArgs(1)(cmd, args)
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return run(cmd.Context(), o, args)
+			return run(cmd.Context(), cmd.Flags(), o, args)
 		},
 		SilenceUsage:  true,
 		SilenceErrors: true,
 	}
 
 	root.AddCommand(calc())
-
-	root.Flags().BoolVar(&pretty, "pretty", true, "format output as a table instead of CSV-like lines")
-	root.Flags().IntVar(&warmup, "warmup", 1, "number of initial samples to skip from display and averages")
+	root.AddCommand(collectors())
+	root.AddCommand(replay())
+	root.AddCommand(calibrateCmd())
+	root.AddCommand(profiles())
+	root.AddCommand(serve())
+	root.AddCommand(diffCmd())
+
+	root.Flags().IntVar(&o.warmup, "warmup", 1, "number of initial samples to skip from display and averages")
 	root.Flags().IntVarP(&o.samples, "samples", "s", 5, "number of samples to collect (0 = run until Ctrl-C)")
 	root.Flags().DurationVarP(&o.interval, "interval", "i", time.Second, "sampling interval (e.g. 1s, 500ms)")
 	root.Flags().Float64Var(&o.ema, "ema", 0.5, "EMA alpha for VM utilization smoothing [0..1]")
+	root.Flags().StringVar(&o.collector, "collector", proc.Auto, "sampling backend: auto|procfs|cgroup2|... (see `consumption collectors`)")
+	root.Flags().StringVar(&o.record, "record", "", "record every raw snapshot to a binary trace file (see `consumption replay`)")
+	root.Flags().StringArrayVar(&o.groups, "group", nil, "named target NAME=SELECTOR[,SELECTOR...] (PID, A..B, name:COMM, pg:REGEX, cgroup:PATH); repeatable, groups share one U_vm reading")
 
-	root.Flags().Float64Var(&o.pIdle, "p-idle", 5.0, "idle power in Watts")
-	root.Flags().Float64Var(&o.pMax, "p-max", 20.0, "max power in Watts at 100% utilization")
-	root.Flags().Float64Var(&o.gamma, "gamma", 1.3, "CPU nonlinearity exponent")
-	root.Flags().Float64Var(&o.er, "er", 4.8e-8, "disk read energy per byte (J/B)")
-	root.Flags().Float64Var(&o.ew, "ew", 9.5e-8, "disk write energy per byte (J/B)")
-	root.Flags().Float64Var(&o.eMemRef, "e-mem-ref", 7e-10, "RAM refault energy per byte (J/B)")
-	root.Flags().Float64Var(&o.eMemRSS, "e-mem-rss", 3e-10, "RAM RSS churn energy per byte (J/B)")
-	root.Flags().Float64Var(&o.alpha, "alpha", 0.0, "fraction of idle to charge proportionally [0..1]")
-
-	root.Flags().StringVar(&o.csvPath, "csv", "", "write per-tick rows to CSV file")
-	root.Flags().StringVar(&o.jsonPath, "json", "", "write per-tick rows to JSON file")
-	root.Flags().StringVar(&o.htmlPath, "html", "", "write per-tick rows and summary to HTML file")
+	addModelFlags(root.Flags(), &o)
+	addCarbonFlags(root.Flags(), &o)
+	addTariffFlags(root.Flags(), &o)
+	addOutputFlags(root.Flags(), &o)
+	addBudgetFlags(root.Flags(), &o)
 
 	if err := root.Execute(); err != nil {
-		slog.Error(err.Error())
-		os.Exit(1)
+		code := exitStatus(err)
+		if code == 1 {
+			slog.Error(err.Error())
+		} else {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(code)
 	}
 }
 
-func calc() *cobra.Command {
-	cmd := &cobra.Command{
-		Use:   "calc <report.{csv,json}|->",
-		Short: "Calculate average power/energy from a CSV/JSON report",
-		Long: `Calculate power/energy from utilization snapshot CSV or JSON.
-
-Examples:
-  consumption calc report.csv
-  consumption calc report.json
-  cat report.json | consumption calc -`,
-		Args: cobra.ExactArgs(1),
-		RunE: func(cmd *cobra.Command, args []string) error {
-			path := args[0]
-			var r io.Reader
-			if path == "-" {
-				r = bufio.NewReader(os.Stdin)
-			} else {
-				f, err := os.Open(path)
-				if err != nil {
-					return err
-				}
-				defer f.Close()
-				r = bufio.NewReader(f)
-			}
-
-			ext := strings.ToLower(filepath.Ext(path))
-			if path == "-" {
-				// best-effort sniff: read a few bytes
-				br := bufio.NewReader(r)
-				peek, _ := br.Peek(1)
-				if len(peek) == 1 && (peek[0] == '[' || peek[0] == '{') {
-					ext = ".json"
-				} else {
-					ext = ".csv"
-				}
-				r = br
-			}
-
-			var (
-				n                       int
-				sumCPU, sumDisk, sumRAM float64
-				sumTotal, sumDt         float64
-				lastTS                  *time.Time
-			)
-
-			switch ext {
-			case ".csv":
-				cr := csv.NewReader(r)
-				cr.ReuseRecord = true
-				header, err := cr.Read()
-				if err != nil {
-					return fmt.Errorf("csv read header: %w", err)
-				}
-				idx := make(map[string]int)
-				for i, h := range header {
-					idx[strings.ToLower(strings.TrimSpace(h))] = i
-				}
-				get := func(name string) (int, bool) { i, ok := idx[name]; return i, ok }
-
-				req := []string{"p_cpu_w", "p_disk_w", "p_ram_w", "p_total_w"}
-				for _, c := range req {
-					if _, ok := get(c); !ok {
-						return fmt.Errorf("csv missing required column %q", c)
-					}
-				}
-				iCPU, _ := get("p_cpu_w")
-				iDisk, _ := get("p_disk_w")
-				iRAM, _ := get("p_ram_w")
-				iTot, _ := get("p_total_w")
-				iDt, hasDt := get("interval_sec")
-				iTime, hasTime := get("time") // RFC3339 in your writer
-
-				parseF := func(s string) float64 {
-					f, _ := strconv.ParseFloat(strings.TrimSpace(s), 64)
-					return f
-				}
-
-				for {
-					rec, err := cr.Read()
-					if err == io.EOF {
-						break
-					}
-					if err != nil {
-						return fmt.Errorf("csv read: %w", err)
-					}
-					sumCPU += parseF(rec[iCPU])
-					sumDisk += parseF(rec[iDisk])
-					sumRAM += parseF(rec[iRAM])
-					sumTotal += parseF(rec[iTot])
-					n++
-
-					if hasDt {
-						sumDt += parseF(rec[iDt])
-					} else if hasTime {
-						if ts, err := time.Parse(time.RFC3339, strings.TrimSpace(rec[iTime])); err == nil {
-							if lastTS != nil {
-								sumDt += ts.Sub(*lastTS).Seconds()
-							}
-							lastTS = &ts
-						}
-					}
-				}
-
-			case ".json":
-				dec := json.NewDecoder(r)
-				// Expect either an array of rows or a single object per line (be lenient)
-				t, err := dec.Token()
-				if err != nil {
-					return fmt.Errorf("json: %w", err)
-				}
-
-				type jrow struct {
-					At          *time.Time `json:"time"` // RFC3339 in your writer
-					PCPU        float64    `json:"p_cpu_w"`
-					PDisk       float64    `json:"p_disk_w"`
-					PRAM        float64    `json:"p_ram_w"`
-					PTotal      float64    `json:"p_total_w"`
-					IntervalSec float64    `json:"interval_sec"`
-				}
-
-				if d, ok := t.(json.Delim); ok && d == '[' {
-					for dec.More() {
-						var x jrow
-						if err := dec.Decode(&x); err != nil {
-							return fmt.Errorf("json row: %w", err)
-						}
-						sumCPU += x.PCPU
-						sumDisk += x.PDisk
-						sumRAM += x.PRAM
-						sumTotal += x.PTotal
-						n++
-
-						if x.IntervalSec > 0 {
-							sumDt += x.IntervalSec
-						} else if x.At != nil {
-							if lastTS != nil {
-								sumDt += x.At.Sub(*lastTS).Seconds()
-							}
-							lastTS = x.At
-						}
-					}
-					// consume closing ']'
-					if _, err := dec.Token(); err != nil {
-						return fmt.Errorf("json closing token: %w", err)
-					}
-				} else {
-					// fallback: NDJSON-ish (one object per line)
-					dec = json.NewDecoder(io.MultiReader(strings.NewReader(fmt.Sprintf("%v", t)), dec.Buffered()))
-					for {
-						var x jrow
-						if err := dec.Decode(&x); err != nil {
-							if err == io.EOF {
-								break
-							}
-							return fmt.Errorf("json row: %w", err)
-						}
-						sumCPU += x.PCPU
-						sumDisk += x.PDisk
-						sumRAM += x.PRAM
-						sumTotal += x.PTotal
-						n++
-						if x.IntervalSec > 0 {
-							sumDt += x.IntervalSec
-						} else if x.At != nil {
-							if lastTS != nil {
-								sumDt += x.At.Sub(*lastTS).Seconds()
-							}
-							lastTS = x.At
-						}
-					}
-				}
-
-			default:
-				return fmt.Errorf("unsupported file type: %q (use .csv, .json, or -)", ext)
-			}
-
-			if n == 0 {
-				return fmt.Errorf("no rows found")
-			}
+// exitStatus maps a command error to the exit status: exitBudget and
+// exitRegressed for failed gates, 1 for anything else.
+func exitStatus(err error) int {
+	var (
+		be *budgetError
+		re *regressionError
+	)
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &be):
+		return exitBudget
+	case errors.As(err, &re):
+		return exitRegressed
+	}
+	return 1
+}
 
-			avgCPU := sumCPU / float64(n)
-			avgDisk := sumDisk / float64(n)
-			avgRAM := sumRAM / float64(n)
-			avgTot := sumTotal / float64(n)
-
-			var approx string
-			if sumDt > 0 {
-				sec := sumDt / float64(n)
-				approx = (time.Duration(sec * float64(time.Second))).Round(1 * time.Millisecond).String()
-			} else {
-				approx = "unknown"
-			}
+// addModelFlags registers the model coefficient flags shared by run, replay and calc.
+func addModelFlags(fs *pflag.FlagSet, o *opts) {
+	fs.StringVar(&o.profile, "profile", "", "named model profile (built-in or ~/.config/consumption/profiles/<name>.{yaml,json}; see `consumption profiles`)")
+	fs.StringVar(&o.configPath, "config", "", "model profile file (YAML or JSON); explicit coefficient flags override it")
+	fs.Float64Var(&o.pIdle, "p-idle", 5.0, "idle power in Watts")
+	fs.Float64Var(&o.pMax, "p-max", 20.0, "max power in Watts at 100% utilization")
+	fs.Float64Var(&o.gamma, "gamma", 1.3, "CPU nonlinearity exponent")
+	fs.Float64Var(&o.er, "er", 4.8e-8, "disk read energy per byte (J/B)")
+	fs.Float64Var(&o.ew, "ew", 9.5e-8, "disk write energy per byte (J/B)")
+	fs.Float64Var(&o.eMemRef, "e-mem-ref", 7e-10, "RAM refault energy per byte (J/B)")
+	fs.Float64Var(&o.eMemRSS, "e-mem-rss", 3e-10, "RAM RSS churn energy per byte (J/B)")
+	fs.Float64Var(&o.alpha, "alpha", 0.0, "fraction of idle to charge proportionally [0..1]")
+	fs.StringVar(&o.model, "model", consumption.ModelPowerLaw, "CPU power model: powerlaw (p-idle, p-max, gamma) or curve (see --curve)")
+	fs.StringArrayVar(&o.uncertainty, "uncertainty", nil, "coefficient range, repeatable: NAME=MIN..MAX | NAME=±10% | NAME=normal:SD | NAME=tri:MIN..MAX (enables p5–p95 bands)")
+	fs.IntVar(&o.mcSamples, "mc-samples", consumption.DefaultEnsembleSize, "Monte Carlo ensemble size for --uncertainty")
+	fs.Uint64Var(&o.mcSeed, "mc-seed", 1, "Monte Carlo random seed")
+	fs.StringVar(&o.curve, "curve", "", "load/power table (e.g. SPECpower: \"100%, 253\" ... \"active idle, 58\"); implies --model curve")
+}
 
-			fmt.Printf("\nconsumption avg (over %d samples of ~%s):\n", n, approx)
-			fmt.Printf("- watt (cpu):    %.3f W\n", avgCPU)
-			fmt.Printf("- watt (disk):   %.3f W\n", avgDisk)
-			fmt.Printf("- watt (ram):    %.3f W\n", avgRAM)
-			fmt.Printf("- watt (total):  %.3f W\n\n", avgTot)
-			return nil
-		},
-	}
-	return cmd
+// addCarbonFlags registers the emissions flags shared by run, replay and calc.
+func addCarbonFlags(fs *pflag.FlagSet, o *opts) {
+	fs.Float64Var(&o.gridIntensity, "grid-intensity", 0, "grid carbon intensity in gCO2e/kWh (enables emissions)")
+	fs.StringVar(&o.gridCSV, "grid-intensity-csv", "", "CSV time series of grid intensity (time, intensity gCO2e/kWh)")
+	fs.Float64Var(&o.pue, "pue", 1.0, "power usage effectiveness multiplier applied to emissions (>= 1)")
 }
 
-func run(ctx context.Context, o opts, args []string) error {
-	pids, err := util.ParsePIDs(args)
-	if err != nil {
-		return err
-	}
-	if len(pids) == 0 {
-		return fmt.Errorf("no PIDs provided")
-	}
-	if o.interval <= 0 {
-		return fmt.Errorf("interval must be > 0")
-	}
-	if o.ema < 0 || o.ema > 1 {
-		return fmt.Errorf("ema must be in [0,1]")
-	}
-	if o.alpha < 0 || o.alpha > 1 {
-		return fmt.Errorf("alpha must be in [0,1]")
-	}
+// addTariffFlags registers the cost flags shared by run, replay and calc.
+func addTariffFlags(fs *pflag.FlagSet, o *opts) {
+	fs.StringVar(&o.tariffPath, "tariff", "", "electricity tariff file (YAML/JSON; flat or time-of-use bands) (enables cost)")
+	fs.Float64Var(&o.price, "price", 0, "flat electricity price per kWh (enables cost)")
+	fs.StringVar(&o.currency, "currency", "", "currency label for costs (overrides the tariff file's)")
+}
 
-	// Print a little host header like the bash script vibe
-	host, kernel, cpus, mem := util.SystemSummary()
-	fmt.Printf(_console, host, kernel, cpus, mem, time.Now().Format("2006-01-02 15:04:05"))
-
-	// Build config & components
-	cfg := consumption.Config{
-		PIdle:   o.pIdle,
-		PMax:    o.pMax,
-		Gamma:   o.gamma,
-		ER:      o.er,
-		EW:      o.ew,
-		EMemRef: o.eMemRef,
-		EMemRSS: o.eMemRSS,
-		Alpha:   o.alpha,
-	}
-	acc := consumption.New(&cfg)
+// addBudgetFlags registers the --max-* budget flags shared by run, replay and calc.
+func addBudgetFlags(fs *pflag.FlagSet, o *opts) {
+	fs.StringVar(&o.maxEnergy, "max-energy", "", "fail with exit code 3 when total energy exceeds this (e.g. 500J, 2kJ, 0.1Wh)")
+	fs.StringVar(&o.maxAvgPower, "max-avg-power", "", "fail with exit code 3 when average total power exceeds this (e.g. 3W, 500mW)")
+	fs.StringVar(&o.maxCPU, "max-cpu", "", "CPU budget: energy (e.g. 400J) or average power (e.g. 2.5W)")
+	fs.StringVar(&o.maxDisk, "max-disk", "", "disk budget: energy (e.g. 50J) or average power (e.g. 0.5W)")
+	fs.StringVar(&o.maxRAM, "max-ram", "", "RAM budget: energy (e.g. 20J) or average power (e.g. 0.2W)")
+}
 
-	col, err := proc.NewCollector(o.ema)
-	if err != nil {
-		return fmt.Errorf("collector: %w", err)
-	}
-	defer func() {
-		_ = col.Close()
-	}()
-
-	var tw *tabwriter.Writer
-	if pretty {
-		tw = newTable()
-		printTableHeader(tw)
-	} else {
-		fmt.Println("# time, U_vm, U_proc, P_cpu(W), P_disk(W), P_ram(W), P_total(W), E_cum(J)")
-	}
+// addOutputFlags registers the stdout and report file flags shared by run and replay.
+func addOutputFlags(fs *pflag.FlagSet, o *opts) {
+	fs.BoolVar(&o.pretty, "pretty", true, "format output as a table instead of CSV-like lines")
+	fs.StringVar(&o.csvPath, "csv", "", "write per-tick rows to CSV file")
+	fs.StringVar(&o.jsonPath, "json", "", "write per-tick rows to JSON file")
+	fs.StringVar(&o.ndjson, "ndjson", "", "write per-tick rows to NDJSON file (one JSON object per line)")
+	fs.BoolVar(&o.fsync, "fsync", false, "fsync the CSV/JSON/NDJSON files after every row, so a crash loses at most the row being written")
+	fs.StringVar(&o.htmlPath, "html", "", "write per-tick rows and summary to HTML file")
+	fs.StringVar(&o.markdown, "markdown", "", "write the summary and a compact per-tick table to a GitHub-flavored Markdown file (also appended to $GITHUB_STEP_SUMMARY when set)")
+	fs.StringVar(&o.influx, "influx", "", "write per-tick rows as InfluxDB line protocol to a file, or POST them to an http(s)://…/api/v2/write?org=…&bucket=… URL")
+	fs.StringVar(&o.influxToken, "influx-token", "", "InfluxDB API token for --influx URLs (default $INFLUX_TOKEN)")
+	fs.StringVar(&o.statsd, "statsd", "", "push per-tick gauges and counters to StatsD at [udp|tcp://]HOST:PORT (UDP by default)")
+	fs.StringVar(&o.graphite, "graphite", "", "push per-tick rows to Graphite plaintext at [tcp|udp://]HOST:PORT (TCP by default)")
+	fs.DurationVar(&o.pushEvery, "push-interval", 10*time.Second, "send buffered --influx and --graphite points this often (and every 500 points); 0 sends every tick")
+}
 
-	if o.csvPath != "" {
-		if err := os.MkdirAll(filepath.Dir(o.csvPath), 0o755); err == nil {
-			if f, er := os.Create(o.csvPath); er == nil {
-				csvF = f                // keep file
-				csvW = csv.NewWriter(f) // wrap writer
-				_ = csvW.Write([]string{
-					"time", "u_vm", "u_proc", "p_cpu_w", "p_disk_w", "p_ram_w", "p_idle_share_w", "p_total_w",
-					"e_cum_j", "read_bytes", "write_bytes", "refault_bytes", "rss_churn_bytes", "interval_sec",
-				})
-				csvW.Flush()
-			}
-		}
-	}
-	if o.jsonPath != "" {
-		if err := os.MkdirAll(filepath.Dir(o.jsonPath), 0o755); err == nil {
-			jsonF, _ = os.Create(o.jsonPath)
-			if jsonF != nil {
-				_, _ = jsonF.WriteString("[\n")
-			}
+// config builds the accumulator config: the --profile or --config values
+// (defaults otherwise), overridden by every coefficient flag set explicitly.
+// The returned label names the profile for reports, e.g.
+// "laptop (overrides: p-max)".
+func (o opts) config(fs *pflag.FlagSet) (consumption.Config, string, error) {
+	cfg := *consumption.DefaultConfig()
+	label := "default"
+
+	switch {
+	case o.profile != "" && o.configPath != "":
+		return consumption.Config{}, "", errors.New("use either --profile or --config, not both")
+	case o.profile != "":
+		p, err := profile.Find(o.profile)
+		if err != nil {
+			return consumption.Config{}, "", err
 		}
-	}
-	if o.htmlPath != "" {
-		if err := os.MkdirAll(filepath.Dir(o.htmlPath), 0o755); err == nil {
-			htmlF, _ = os.Create(o.htmlPath)
+		cfg, label = p.Config, p.Name
+	case o.configPath != "":
+		p, err := profile.Load(o.configPath)
+		if err != nil {
+			return consumption.Config{}, "", err
 		}
+		cfg, label = p.Config, p.Name
 	}
 
-	// We’ll collect rows for JSON/HTML finalization
-	var rows []row
-
-	// Ctrl-C handling
-	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
-	defer stop()
-
-	ticker := time.NewTicker(o.interval)
-	defer ticker.Stop()
-
-	writeN := 0 // number of rows actually written (used for JSON commas)
-
-	sampleN := 0
-	for {
-		select {
-		case <-ctx.Done():
-			slog.Info("interrupted")
-			goto END
-
-		case <-ticker.C:
-			dt := o.interval.Seconds()
-
-			snap, err := col.Sample(pids, dt)
+	var overrides []string
+	for _, name := range coefficientFlagNames {
+		if !fs.Changed(name) {
+			continue
+		}
+		overrides = append(overrides, name)
+		switch name {
+		case "p-idle":
+			cfg.PIdle = o.pIdle
+		case "p-max":
+			cfg.PMax = o.pMax
+		case "gamma":
+			cfg.Gamma = o.gamma
+		case "er":
+			cfg.ER = o.er
+		case "ew":
+			cfg.EW = o.ew
+		case "e-mem-ref":
+			cfg.EMemRef = o.eMemRef
+		case "e-mem-rss":
+			cfg.EMemRSS = o.eMemRSS
+		case "alpha":
+			cfg.Alpha = o.alpha
+		case "model":
+			cfg.Model = o.model
+		case "curve":
+			pts, err := consumption.LoadCurve(o.curve)
 			if err != nil {
-				if errorsIsAny(err, proc.ErrAllExited) {
-					fmt.Println("# All PIDs exited")
-					goto END
-				}
-				slog.Warn("sample error", "err", err)
-				continue
-			}
-
-			sampleN++
-
-			// --- Warmup: skip printing and accumulation
-			if warmup > 0 && sampleN <= warmup {
-				continue
+				return consumption.Config{}, "", err
 			}
-
-			// Only now mutate the accumulator
-			res := acc.Apply(snap)
-
-			// idle share (for CSV/JSON/HTML completeness)
-			var pidleShare float64
-			if snap.UVm > 1e-12 && cfg.Alpha > 0 {
-				share := snap.UProc / snap.UVm
-				if share < 0 {
-					share = 0
-				} else if share > 1 {
-					share = 1
-				}
-				pidleShare = cfg.Alpha * cfg.PIdle * share
+			cfg.Curve = pts
+			if !fs.Changed("model") {
+				cfg.Model = consumption.ModelCurve
 			}
-
-			now := time.Now()
-
-			// stdout
-			if pretty {
-				printTableRow(tw, now, snap.UVm, snap.UProc, res.PCPU, res.PDisk, res.PRAM, pidleShare, res.PTotal, acc.EnergyCumJ())
-			} else {
-				printCsvLike(now.Format(time.RFC3339), snap.UVm, snap.UProc, res.PCPU, res.PDisk, res.PRAM, pidleShare, res.PTotal, acc.EnergyCumJ())
+		case "uncertainty":
+			ranges := maps.Clone(cfg.Ranges)
+			if ranges == nil {
+				ranges = map[string]consumption.Dist{}
 			}
-
-			// row for files
-			r := row{
-				At:          now,
-				UVm:         util.Clamp01(snap.UVm),
-				UProc:       util.Clamp01(snap.UProc),
-				PCPU:        res.PCPU,
-				PDisk:       res.PDisk,
-				PRAM:        res.PRAM,
-				PIdleShare:  pidleShare,
-				PTotal:      res.PTotal,
-				EnergyCumJ:  acc.EnergyCumJ(),
-				ReadBytes:   snap.ReadBytes,
-				WriteBytes:  snap.WriteBytes,
-				RefaultB:    snap.RefaultBytes,
-				RSSChurnB:   snap.RSSChurnBytes,
-				IntervalSec: dt,
-			}
-			rows = append(rows, r)
-
-			// CSV row
-			if csvW != nil {
-				_ = csvW.Write([]string{
-					now.Format(time.RFC3339),
-					util.FmtFloat(r.UVm), util.FmtFloat(r.UProc),
-					util.FmtFloat(r.PCPU), util.FmtFloat(r.PDisk), util.FmtFloat(r.PRAM),
-					util.FmtFloat(r.PIdleShare),
-					util.FmtFloat(r.PTotal), util.FmtFloat(r.EnergyCumJ),
-					strconv.FormatUint(r.ReadBytes.ToUin64(), 10),
-					strconv.FormatUint(r.WriteBytes.ToUin64(), 10),
-					strconv.FormatUint(r.RefaultB.ToUin64(), 10),
-					strconv.FormatUint(r.RSSChurnB.ToUin64(), 10),
-					util.FmtFloat(r.IntervalSec),
-				})
-				csvW.Flush()
-			}
-
-			// JSON streaming (comma separated)
-			if jsonF != nil {
-				b, _ := json.MarshalIndent(r, "  ", "  ")
-				if writeN > 0 {
-					_, _ = jsonF.WriteString(",\n")
+			for _, kv := range o.uncertainty {
+				name, spec, ok := strings.Cut(kv, "=")
+				name = strings.ReplaceAll(strings.TrimSpace(name), "-", "_")
+				central, known := cfg.Coefficient(name)
+				if !ok || !known {
+					return consumption.Config{}, "", fmt.Errorf("--uncertainty %q: want NAME=SPEC with NAME one of %s",
+						kv, strings.Join(consumption.Coefficients, ", "))
 				}
-				_, _ = jsonF.Write(b)
-				writeN++
-			}
-
-			// stop condition counts only post-warmup samples
-			if o.samples > 0 && (sampleN-warmup) >= o.samples {
-				goto END
+				d, err := consumption.ParseDist(spec, *central)
+				if err != nil {
+					return consumption.Config{}, "", fmt.Errorf("--uncertainty %s: %w", name, err)
+				}
+				ranges[name] = d
 			}
+			cfg.Ranges = ranges
 		}
 	}
+	if len(overrides) > 0 {
+		label = fmt.Sprintf("%s (overrides: %s)", label, strings.Join(overrides, ", "))
+	}
 
-END:
-	// finalize files
-	if csvW != nil {
-		csvW.Flush()
+	if cfg.Alpha < 0 || cfg.Alpha > 1 {
+		return consumption.Config{}, "", fmt.Errorf("alpha must be in [0,1]")
 	}
-	if csvF != nil {
-		_ = csvF.Close()
+	if cfg.Model == consumption.ModelCurve && len(cfg.Curve) == 0 {
+		return consumption.Config{}, "", errors.New("--model curve needs --curve <file> or a profile with a curve")
 	}
-	if jsonF != nil {
-		_, _ = jsonF.WriteString("\n]\n")
-		_ = jsonF.Close()
+	if _, err := cfg.BuildModel(); err != nil {
+		return consumption.Config{}, "", err
 	}
-
-	if htmlF != nil {
-		names := util.PidNames(pids)
-
-		if err := writeHTML(htmlF, rows, acc.Averages(), acc.EnergyCumJ(), names); err != nil {
-			slog.Error("write html", "err", err)
-		}
-		_ = htmlF.Close()
+	if err := cfg.CheckRanges(); err != nil {
+		return consumption.Config{}, "", err
 	}
+	return cfg, label, nil
+}
 
-	avg := acc.Averages()
-	fmt.Println()
-	fmt.Printf("consumption avg (over %d samples of ~%s):\n", sampleN, o.interval)
-	fmt.Printf("- watt (cpu):    %.3f W\n", avg.PCPU)
-	fmt.Printf("- watt (disk):   %.3f W\n", avg.PDisk)
-	fmt.Printf("- watt (ram):    %.3f W\n", avg.PRAM)
-	fmt.Printf("- watt (total):  %.3f W\n", avg.PTotal)
-	fmt.Println()
-
-	return nil
+// layers are the optional estimates stacked on the power model; nil fields
+// are disabled.
+type layers struct {
+	carbon *carbon.Tracker
+	meter  *tariff.Meter
+	ens    *consumption.Ensemble
 }
 
-func errorsIsAny(err error, targets ...error) bool {
-	for _, t := range targets {
-		if t != nil && (errors.Is(t, err) || (t != nil && errorsIs(err, t))) {
-			return true
+// layers builds the emissions, cost and uncertainty layers for cfg.
+func (o opts) layers(cfg consumption.Config) (layers, error) {
+	var (
+		l   layers
+		err error
+	)
+	if l.carbon, err = o.carbon(); err != nil {
+		return layers{}, err
+	}
+	if l.meter, err = o.tariff(); err != nil {
+		return layers{}, err
+	}
+	if len(cfg.Ranges) > 0 {
+		if l.ens, err = consumption.NewEnsemble(&cfg, o.mcSamples, o.mcSeed); err != nil {
+			return layers{}, err
 		}
 	}
-	return false
+	return l, nil
 }
 
-func errorsIs(err, target error) bool {
-	// Go 1.20+: errors.Is; inline to avoid import noise here
-	type causer interface{ Unwrap() error }
-	for {
-		if errors.Is(err, target) {
-			return true
+// carbon builds the emissions tracker, or nil when no grid intensity is set.
+func (o opts) carbon() (*carbon.Tracker, error) {
+	var src carbon.Intensity
+	switch {
+	case o.gridIntensity < 0:
+		return nil, errors.New("grid-intensity must be >= 0")
+	case o.gridIntensity > 0 && o.gridCSV != "":
+		return nil, errors.New("use either --grid-intensity or --grid-intensity-csv, not both")
+	case o.gridCSV != "":
+		s, err := carbon.LoadSeries(o.gridCSV)
+		if err != nil {
+			return nil, err
 		}
-		x, ok := err.(causer)
-		if !ok {
-			return false
+		src = s
+	case o.gridIntensity > 0:
+		src = carbon.Static(o.gridIntensity)
+	default:
+		if o.pue != 1 {
+			return nil, errors.New("--pue needs --grid-intensity or --grid-intensity-csv")
 		}
-		err = x.Unwrap()
+		return nil, nil
 	}
+	return carbon.NewTracker(src, o.pue)
 }
 
-func writeHTML(f *os.File, rows []row, avg consumption.Result, energy float64, names map[int]string) error {
-	type view struct {
-		Rows   []row
-		Avg    consumption.Result
-		Energy float64
-		PIDs   []pidInfo
-	}
-
-	var pidList []pidInfo
-	for pid, name := range names {
-		pidList = append(pidList, pidInfo{PID: pid, Name: name})
+// tariff builds the cost meter, or nil when no price or tariff is set.
+func (o opts) tariff() (*tariff.Meter, error) {
+	var (
+		t   *tariff.Tariff
+		err error
+	)
+	switch {
+	case o.tariffPath != "" && o.price != 0:
+		return nil, errors.New("use either --tariff or --price, not both")
+	case o.tariffPath != "":
+		t, err = tariff.Load(o.tariffPath)
+	case o.price != 0:
+		t, err = tariff.Flat(o.price, "")
+	default:
+		return nil, nil
 	}
-	// optional: stable order
-	slices.SortFunc(pidList, func(a, b pidInfo) int {
-		switch {
-		case a.PID < b.PID:
-			return -1
-		case a.PID > b.PID:
-			return 1
-		default:
-			return 0
-		}
-	})
-
-	var buf bytes.Buffer
-	data := view{
-		Rows:   rows,
-		Avg:    avg,
-		Energy: energy,
-		PIDs:   pidList,
+	if err != nil {
+		return nil, err
 	}
-	if err := tpl.Execute(&buf, data); err != nil {
-		return err
+	if o.currency != "" {
+		t.Currency = o.currency
 	}
-	_, err := f.Write(buf.Bytes())
-	return err
+	return tariff.NewMeter(t), nil
 }
-
-func newTable() *tabwriter.Writer {
-	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	return tw
-}
-
-func printTableHeader(tw *tabwriter.Writer) {
-	fmt.Fprintln(tw, "TIME\tU_vm\tU_proc\tP_cpu (W)\tP_disk (W)\tP_ram (W)\tP_idle_share (W)\tP_total (W)\tE_cum (J)")
-	fmt.Fprintln(tw, "----\t----\t------\t---------\t----------\t---------\t---------------\t-----------\t---------")
-	tw.Flush()
-}
-
-func printTableRow(tw *tabwriter.Writer, ts time.Time, uvm, up, pcpu, pdisk, pram, pidle, ptotal, ecum float64) {
-	fmt.Fprintf(tw, "%s\t%.4f\t%.4f\t%.3f\t%.3f\t%.3f\t%.3f\t%.3f\t%.3f\n",
-		ts.Format("2006-01-02 15:04:05"), util.Clamp01(uvm), util.Clamp01(up),
-		pcpu, pdisk, pram, pidle, ptotal, ecum,
-	)
-	tw.Flush()
-}
-
-func printCsvLike(now string, uvm, up, pcpu, pdisk, pram, pidle, ptotal, ecum float64) {
-	fmt.Printf("%s, %.4f, %.4f, %.3f, %.3f, %.3f, %.3f, %.3f, %.3f\n",
-		now, util.Clamp01(uvm), util.Clamp01(up), pcpu, pdisk, pram, pidle, ptotal, ecum)
-}
-
-var tpl = template.Must(template.New("rep").Parse(`<!doctype html>
-<html lang="en"><meta charset="utf-8">
-<title>Consumption Report</title>
-<style>
-body{font-family:system-ui,Segoe UI,Roboto,Helvetica,Arial,sans-serif;margin:20px}
-h1,h2{margin:0 0 8px}
-table{border-collapse:collapse;width:100%;font-size:14px}
-th,td{border:1px solid #ddd;padding:6px 8px;text-align:right}
-th:first-child,td:first-child{text-align:left}
-ul{margin:6px 0 14px;padding-left:20px}
-code{background:#f5f5f5;padding:2px 4px;border-radius:4px}
-.small{color:#555}
-.badge{display:inline-block;background:#eef;border:1px solid #ccd;padding:2px 6px;border-radius:6px;margin-right:6px;}
-</style>
-
-<h1><a href="https://github.com/ja7ad/consumption" target="_blank" rel="noopener noreferrer" style="color:inherit;text-decoration:none;">Consumption Report</a></h1>
-
-<p class="small">
-Rows: {{len .Rows}} &nbsp;|&nbsp;
-Avg P(total): {{printf "%.3f" .Avg.PTotal}} W &nbsp;|&nbsp;
-Energy: {{printf "%.3f" .Energy}} J
-</p>
-
-{{if .PIDs}}
-<h2>Processes</h2>
-<ul>
-{{range .PIDs}}
-  <li><span class="badge">PID {{.PID}}</span> {{.Name}}</li>
-{{end}}
-</ul>
-{{end}}
-
-<h2>Summary</h2>
-<ul>
-<li>Avg P(cpu): {{printf "%.3f" .Avg.PCPU}} W</li>
-<li>Avg P(disk): {{printf "%.3f" .Avg.PDisk}} W</li>
-<li>Avg P(ram): {{printf "%.3f" .Avg.PRAM}} W</li>
-<li>Avg P(total): {{printf "%.3f" .Avg.PTotal}} W</li>
-<li>Energy: {{printf "%.3f" .Energy}} J</li>
-</ul>
-
-<h2>Per-tick</h2>
-<table>
-<thead>
-<tr>
-<th>time</th><th>U_vm</th><th>U_proc</th>
-<th>P_cpu(W)</th><th>P_disk(W)</th><th>P_ram(W)</th><th>P_total(W)</th><th>E_cum(J)</th>
-<th>read B</th><th>write B</th><th>refault B</th><th>rssΔ B</th>
-</tr>
-</thead>
-<tbody>
-{{range .Rows}}
-<tr>
-<td style="text-align:left">{{.At.Format "2006-01-02 15:04:05"}}</td>
-<td>{{printf "%.4f" .UVm}}</td>
-<td>{{printf "%.4f" .UProc}}</td>
-<td>{{printf "%.3f" .PCPU}}</td>
-<td>{{printf "%.3f" .PDisk}}</td>
-<td>{{printf "%.3f" .PRAM}}</td>
-<td>{{printf "%.3f" .PTotal}}</td>
-<td>{{printf "%.3f" .EnergyCumJ}}</td>
-<td>{{.ReadBytes}}</td>
-<td>{{.WriteBytes}}</td>
-<td>{{.RefaultB}}</td>
-<td>{{.RSSChurnB}}</td>
-</tr>
-{{end}}
-</tbody>
-</table>
-</html>`))
-
-const _console = `Consumption - Process Power/Energy Estimation Tool
-Copyright (c) 2024 Javad Rajabzadeh Inc. All rights reserved.
-
-* GitHub: https://github.com/ja7ad/consumption
-
-       Host: %s
-       Kernel: %s 
-       CPUs: %s
-       Mem: %s
-
-Consumption report as of %s:
-
-`
@@ -0,0 +1,232 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// markdownRows caps the per-tick table; longer series are averaged into
+// buckets like the HTML charts.
+const markdownRows = 30
+
+// writeMarkdown renders the report as GitHub-flavored Markdown: headline,
+// per-component averages, totals, processes, groups and a compact per-tick
+// table. With base set (calc with model flags), averages and totals are
+// shown as base vs sum with the relative change.
+func writeMarkdown(w io.Writer, rows []row, sum reportSummary, base *reportSummary, names map[int]string) error {
+	var b bytes.Buffer
+	series := splitGroups(rows, len(sum.Groups) > 0)
+	ticks, dur := len(rows), 0.0
+	if len(series) > 0 {
+		ticks = len(series[0].rows)
+		for _, r := range series[0].rows {
+			dur += r.IntervalSec
+		}
+	}
+
+	b.WriteString("## Energy report\n\n")
+	fmt.Fprintf(&b, "**%.3f W** average, **%.3f J** over %d ticks", sum.Avg.PTotal, sum.Energy, ticks)
+	if dur > 0 {
+		fmt.Fprintf(&b, " (%s)", time.Duration(dur*float64(time.Second)).Round(time.Millisecond))
+	}
+	if sum.Profile != "" {
+		fmt.Fprintf(&b, ", profile `%s`", mdCode(sum.Profile))
+	}
+	b.WriteString("\n\n")
+
+	if base != nil {
+		writeMarkdownComparison(&b, *base, sum)
+	} else {
+		writeMarkdownSummary(&b, sum)
+	}
+
+	if len(names) > 0 {
+		pids := make([]int, 0, len(names))
+		for pid := range names {
+			pids = append(pids, pid)
+		}
+		slices.Sort(pids)
+		fmt.Fprintf(&b, "<details><summary>Processes (%d)</summary>\n\n| PID | Name |\n|---:|---|\n", len(pids))
+		for _, pid := range pids {
+			fmt.Fprintf(&b, "| %d | %s |\n", pid, mdCell(names[pid]))
+		}
+		b.WriteString("\n</details>\n\n")
+	}
+
+	if len(sum.Groups) > 0 {
+		b.WriteString("### Groups\n\n| Group | PIDs | P_cpu (W) | P_disk (W) | P_ram (W) | P_total (W) | E (J) |")
+		align := "\n|---|---:|---:|---:|---:|---:|---:|"
+		if sum.Carbon {
+			b.WriteString(" CO2 (g) |")
+			align += "---:|"
+		}
+		if sum.Tariff {
+			b.WriteString(" Cost |")
+			align += "---:|"
+		}
+		b.WriteString(" Share |" + align + "---:|\n")
+		for _, g := range sum.Groups {
+			fmt.Fprintf(&b, "| %s | %d | %.3f | %.3f | %.3f | %.3f | %.3f |",
+				mdCell(g.Name), g.PIDs, g.Avg.PCPU, g.Avg.PDisk, g.Avg.PRAM, g.Avg.PTotal, g.Energy)
+			if sum.Carbon {
+				fmt.Fprintf(&b, " %.6f |", g.CO2G)
+			}
+			if sum.Tariff {
+				fmt.Fprintf(&b, " %.6g |", g.Cost)
+			}
+			fmt.Fprintf(&b, " %.1f%% |\n", 100*g.Share)
+		}
+		b.WriteString("\n")
+	}
+
+	for _, s := range series {
+		writeMarkdownTicks(&b, s)
+	}
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// writeMarkdownSummary writes the component table and the totals list.
+func writeMarkdownSummary(b *bytes.Buffer, s reportSummary) {
+	split := s.Stats.Samples > 0
+	if split {
+		b.WriteString("| Component | Avg power (W) | Energy (J) |\n|---|---:|---:|\n")
+	} else {
+		b.WriteString("| Component | Avg power (W) |\n|---|---:|\n")
+	}
+	e := s.Stats.Energy
+	line := func(name string, p, j float64) {
+		if split {
+			fmt.Fprintf(b, "| %s | %.3f | %.3f |\n", name, p, j)
+		} else {
+			fmt.Fprintf(b, "| %s | %.3f |\n", name, p)
+		}
+	}
+	line("CPU", s.Avg.PCPU, e.CPU)
+	line("Disk", s.Avg.PDisk, e.Disk)
+	line("RAM", s.Avg.PRAM, e.RAM)
+	if split {
+		line("Idle share", s.Avg.PIdleShare, e.IdleShare)
+	}
+	line("**Total**", s.Avg.PTotal, s.Energy)
+	b.WriteString("\n")
+
+	var items []string
+	if split {
+		p := s.Stats.PTotal
+		items = append(items,
+			fmt.Sprintf("P_total spread: min %.3f W, max %.3f W, sd %.3f W", p.Min, p.Max, p.StdDev),
+			fmt.Sprintf("P_total percentiles: p50 %.3f W, p95 %.3f W, p99 %.3f W", p.P50, p.P95, p.P99))
+	}
+	if s.Uncertain {
+		if s.PTotalBand.P95 > 0 {
+			items = append(items, fmt.Sprintf("P_total p5–p95: %.3f–%.3f W", s.PTotalBand.P5, s.PTotalBand.P95))
+		}
+		items = append(items, fmt.Sprintf("Energy p5–p95: %.3f–%.3f J", s.EnergyBand.P5, s.EnergyBand.P95))
+	}
+	if s.Carbon {
+		co2 := fmt.Sprintf("CO2e: %.6f g", s.CO2G)
+		if s.PUE > 0 {
+			co2 += fmt.Sprintf(" (%.1f gCO2e/kWh incl. PUE %.2f)", s.Intensity, s.PUE)
+		}
+		items = append(items, co2)
+	}
+	if s.Tariff {
+		items = append(items, fmt.Sprintf("Cost: %.6g %s", s.Cost, s.Currency))
+		if s.MonthlyCost > 0 {
+			items = append(items, fmt.Sprintf("Projected monthly cost: %.2f %s at %.3f W", s.MonthlyCost, s.Currency, s.Avg.PTotal))
+		}
+	}
+	for _, it := range items {
+		b.WriteString("- " + mdCell(it) + "\n")
+	}
+	if len(items) > 0 {
+		b.WriteString("\n")
+	}
+}
+
+// writeMarkdownComparison writes base vs s side by side.
+func writeMarkdownComparison(b *bytes.Buffer, base, s reportSummary) {
+	fmt.Fprintf(b, "| | original | recomputed | Δ |\n|---|---:|---:|---:|\n")
+	fmt.Fprintf(b, "| Profile | %s | %s | |\n", mdCell(base.Profile), mdCell(s.Profile))
+	line := func(name, unit, verb string, a, c float64) {
+		v := func(x float64) string { return strings.TrimSpace(fmt.Sprintf(verb+" %s", x, unit)) }
+		fmt.Fprintf(b, "| %s | %s | %s | %s |\n", name, v(a), v(c), pctDelta(a, c))
+	}
+	line("P_cpu", "W", "%.3f", base.Avg.PCPU, s.Avg.PCPU)
+	line("P_disk", "W", "%.3f", base.Avg.PDisk, s.Avg.PDisk)
+	line("P_ram", "W", "%.3f", base.Avg.PRAM, s.Avg.PRAM)
+	line("**P_total**", "W", "%.3f", base.Avg.PTotal, s.Avg.PTotal)
+	line("Energy", "J", "%.3f", base.Energy, s.Energy)
+	if base.Carbon && s.Carbon {
+		line("CO2e", "g", "%.6f", base.CO2G, s.CO2G)
+	}
+	if base.Tariff && s.Tariff {
+		line("Cost", mdCell(s.Currency), "%.6g", base.Cost, s.Cost)
+	}
+	if s.Uncertain {
+		fmt.Fprintf(b, "| Energy p5–p95 | | %.3f–%.3f J | |\n", s.EnergyBand.P5, s.EnergyBand.P95)
+	}
+	b.WriteString("\n")
+}
+
+// writeMarkdownTicks writes the per-tick table of one series, downsampled to
+// markdownRows rows and folded into a <details> block.
+func writeMarkdownTicks(b *bytes.Buffer, s rowSeries) {
+	pts := downsample(s.rows, markdownRows)
+	title := "Per-tick"
+	if s.name != "" {
+		title += " — " + mdCell(s.name)
+	}
+	if len(pts) < len(s.rows) {
+		title += fmt.Sprintf(" (%d ticks averaged into %d rows)", len(s.rows), len(pts))
+	} else {
+		title += fmt.Sprintf(" (%d ticks)", len(pts))
+	}
+	fmt.Fprintf(b, "<details><summary>%s</summary>\n\n", title)
+	b.WriteString("| Time | U_vm | U_proc | P_cpu (W) | P_disk (W) | P_ram (W) | P_total (W) | E_cum (J) |\n")
+	b.WriteString("|---|---:|---:|---:|---:|---:|---:|---:|\n")
+	for _, p := range pts {
+		at := "–"
+		if !p.at.IsZero() {
+			at = p.at.Format(time.TimeOnly)
+		}
+		fmt.Fprintf(b, "| %s | %.3f | %.3f | %.3f | %.3f | %.3f | %.3f | %.3f |\n",
+			at, p.uVm, p.uProc, p.cpu, p.disk, p.ram, p.total, p.eCum)
+	}
+	b.WriteString("\n</details>\n\n")
+}
+
+// mdCell escapes text for a Markdown table cell.
+func mdCell(s string) string {
+	return strings.NewReplacer("|", `\|`, "\r\n", " ", "\n", " ", "\r", " ", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// mdCode makes s safe inside an inline code span.
+func mdCode(s string) string { return strings.ReplaceAll(s, "`", "'") }
+
+// appendStepSummary appends md to $GITHUB_STEP_SUMMARY when it is set, so
+// GitHub Actions shows the report on the job page.
+func appendStepSummary(md []byte) error {
+	path := os.Getenv("GITHUB_STEP_SUMMARY")
+	if path == "" {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("step summary: %w", err)
+	}
+	_, err = f.Write(append(md, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
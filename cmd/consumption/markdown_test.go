@@ -0,0 +1,67 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ja7ad/consumption/pkg/consumption"
+)
+
+func TestMdCell(t *testing.T) {
+	cases := []struct{ in, want string }{
+		{"nginx", "nginx"},
+		{"a|b", `a\|b`},
+		{"line\nbreak", "line break"},
+		{"crlf\r\nend", "crlf end"},
+		{"cr\ronly", "cr only"},
+		{"<script>", "&lt;script&gt;"},
+		{"|\n|", `\| \|`},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.want, mdCell(tc.in), "mdCell(%q)", tc.in)
+	}
+}
+
+func TestWriteMarkdown_EscapesNames(t *testing.T) {
+	at := time.Date(2025, 1, 6, 12, 0, 0, 0, time.UTC)
+	group := "we|b\nx"
+	rows := []row{
+		{At: at, Group: group, IntervalSec: 1, PCPU: 1, PTotal: 2, EnergyCumJ: 2},
+		{At: at.Add(time.Second), Group: group, IntervalSec: 1, PCPU: 1, PTotal: 2, EnergyCumJ: 4},
+	}
+	sum := reportSummary{
+		Avg:    consumption.Result{PCPU: 1, PTotal: 2},
+		Energy: 4,
+		Groups: []groupSummary{{Name: group, PIDs: 1, reportSummary: reportSummary{Energy: 4}, Share: 1}},
+	}
+	var b bytes.Buffer
+	require.NoError(t, writeMarkdown(&b, rows, sum, nil, map[int]string{42: "evil|name\r\n"}))
+	md := b.String()
+
+	assert.Contains(t, md, `| 42 | evil\|name  |`)
+	assert.Contains(t, md, `| we\|b x | 1 |`)
+	assert.Contains(t, md, `<summary>Per-tick — we\|b x (2 ticks)</summary>`)
+	assert.NotContains(t, md, "we|b")
+	assert.NotContains(t, md, "evil|name")
+
+	// every table row of a table has as many cells as its header
+	var cells int
+	for _, line := range strings.Split(md, "\n") {
+		if !strings.HasPrefix(line, "|") {
+			cells = 0
+			continue
+		}
+		n := strings.Count(line, "|") - strings.Count(line, `\|`)
+		if cells == 0 {
+			cells = n
+		}
+		assert.Equal(t, cells, n, line)
+	}
+}
@@ -0,0 +1,555 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ja7ad/consumption/pkg/consumption"
+	"github.com/ja7ad/consumption/pkg/system/proc"
+	"github.com/ja7ad/consumption/pkg/system/util"
+	"github.com/ja7ad/consumption/pkg/types"
+)
+
+type pidInfo struct {
+	PID  int
+	Name string
+}
+
+type row struct {
+	At          time.Time   `json:"time"`
+	UVm         float64     `json:"u_vm"`
+	UProc       float64     `json:"u_proc"`
+	PCPU        float64     `json:"p_cpu_w"`
+	PDisk       float64     `json:"p_disk_w"`
+	PRAM        float64     `json:"p_ram_w"`
+	PIdleShare  float64     `json:"p_idle_share_w"`
+	PTotal      float64     `json:"p_total_w"`
+	EnergyCumJ  float64     `json:"e_cum_j"`
+	ReadBytes   types.Bytes `json:"read_bytes"`
+	WriteBytes  types.Bytes `json:"write_bytes"`
+	RefaultB    types.Bytes `json:"refault_bytes"`
+	RSSChurnB   types.Bytes `json:"rss_churn_bytes"`
+	IntervalSec float64     `json:"interval_sec"`
+	CO2G        float64     `json:"co2_g,omitempty"`
+	CO2CumG     float64     `json:"co2_cum_g,omitempty"`
+	Cost        float64     `json:"cost,omitempty"`
+	CostCum     float64     `json:"cost_cum,omitempty"`
+	PTotalP5    float64     `json:"p_total_p5_w,omitempty"`
+	PTotalP95   float64     `json:"p_total_p95_w,omitempty"`
+	ECumP5      float64     `json:"e_cum_p5_j,omitempty"`
+	ECumP95     float64     `json:"e_cum_p95_j,omitempty"`
+	Profile     string      `json:"profile,omitempty"`
+	Group       string      `json:"group,omitempty"`
+}
+
+var csvHeader = []string{
+	"time", "u_vm", "u_proc", "p_cpu_w", "p_disk_w", "p_ram_w", "p_idle_share_w", "p_total_w",
+	"e_cum_j", "read_bytes", "write_bytes", "refault_bytes", "rss_churn_bytes", "interval_sec",
+	"co2_g", "co2_cum_g", "cost", "cost_cum",
+	"p_total_p5_w", "p_total_p95_w", "e_cum_p5_j", "e_cum_p95_j", "profile", "group",
+}
+
+// newRow builds the per-tick row from a snapshot and its model result.
+func newRow(at time.Time, snap proc.Snapshot, res consumption.Result, energy float64) row {
+	return row{
+		At:          at,
+		UVm:         util.Clamp01(snap.UVm),
+		UProc:       util.Clamp01(snap.UProc),
+		PCPU:        res.PCPU,
+		PDisk:       res.PDisk,
+		PRAM:        res.PRAM,
+		PIdleShare:  res.PIdleShare,
+		PTotal:      res.PTotal,
+		EnergyCumJ:  energy,
+		ReadBytes:   snap.ReadBytes,
+		WriteBytes:  snap.WriteBytes,
+		RefaultB:    snap.RefaultBytes,
+		RSSChurnB:   snap.RSSChurnBytes,
+		IntervalSec: snap.TimeSec,
+	}
+}
+
+// outputs fans every row out to stdout, the optional CSV/JSON/NDJSON/HTML/
+// Markdown files and the push sinks.
+type outputs struct {
+	pretty  bool
+	profile string // model profile label stamped on every row
+	grouped bool   // rows carry a group name (see --group)
+
+	layers                    // enabled layers; decides the optional columns
+	lastE  map[string]float64 // e_cum_j of each group's previous row
+	tw     *tabwriter.Writer
+
+	csvF  *os.File
+	csvW  *csv.Writer
+	jsonF *os.File
+	jsonN int // rows written (used for JSON commas)
+	ndF   *os.File
+	fsync bool // sync the streamed files after every row
+	htmlF *os.File
+	mdF   *os.File
+	sinks []*pushSink // --influx, --statsd, --graphite
+	host  string      // host tag of pushed points
+
+	// rows kept for HTML/Markdown finalization
+	rows []row
+}
+
+// openOutputs prints the stdout header and creates the requested report files.
+// profile labels the model configuration in every report; each enabled layer
+// adds its columns, and grouped adds a group column.
+func openOutputs(o opts, profile string, l layers, grouped bool) (*outputs, error) {
+	out := &outputs{pretty: o.pretty, profile: profile, grouped: grouped, layers: l, lastE: map[string]float64{}, fsync: o.fsync}
+
+	if o.csvPath != "" {
+		f, err := createFile(o.csvPath)
+		if err != nil {
+			return nil, fmt.Errorf("csv: %w", err)
+		}
+		out.csvF = f
+		out.csvW = csv.NewWriter(f)
+		_ = out.csvW.Write(csvHeader)
+		out.csvW.Flush()
+	}
+	if o.jsonPath != "" {
+		f, err := createFile(o.jsonPath)
+		if err != nil {
+			out.close(reportSummary{}, nil)
+			return nil, fmt.Errorf("json: %w", err)
+		}
+		out.jsonF = f
+		_, _ = f.WriteString("[\n")
+	}
+	if o.ndjson != "" {
+		f, err := createFile(o.ndjson)
+		if err != nil {
+			out.close(reportSummary{}, nil)
+			return nil, fmt.Errorf("ndjson: %w", err)
+		}
+		out.ndF = f
+	}
+	if o.htmlPath != "" {
+		f, err := createFile(o.htmlPath)
+		if err != nil {
+			out.close(reportSummary{}, nil)
+			return nil, fmt.Errorf("html: %w", err)
+		}
+		out.htmlF = f
+	}
+	if o.markdown != "" {
+		f, err := createFile(o.markdown)
+		if err != nil {
+			out.close(reportSummary{}, nil)
+			return nil, fmt.Errorf("markdown: %w", err)
+		}
+		out.mdF = f
+	}
+	if err := out.openSinks(o); err != nil {
+		out.close(reportSummary{}, nil)
+		return nil, err
+	}
+
+	if out.pretty {
+		out.tw = newTable()
+		printTableHeader(out.tw, out.extraHeader())
+	} else {
+		fmt.Println(strings.Join(append([]string{
+			"# time", "U_vm", "U_proc", "P_cpu(W)", "P_disk(W)", "P_ram(W)", "P_idle_share(W)", "P_total(W)", "E_cum(J)",
+		}, out.extraHeader()...), ", "))
+	}
+	return out, nil
+}
+
+// extraHeader names the optional stdout columns (group, emissions, cost,
+// uncertainty).
+func (out *outputs) extraHeader() []string {
+	var h []string
+	if out.grouped {
+		h = append(h, "Group")
+	}
+	if out.carbon != nil {
+		h = append(h, "CO2(g)", "CO2_cum(g)")
+	}
+	if out.meter != nil {
+		h = append(h, "Cost", "Cost_cum")
+	}
+	if out.ens != nil {
+		h = append(h, "P_total p5..p95 (W)", "E_cum p5..p95 (J)")
+	}
+	return h
+}
+
+// extraValues formats r's optional stdout columns in extraHeader order.
+func (out *outputs) extraValues(r row) []string {
+	var v []string
+	if out.grouped {
+		v = append(v, r.Group)
+	}
+	if out.carbon != nil {
+		v = append(v, fmt.Sprintf("%.6f", r.CO2G), fmt.Sprintf("%.6f", r.CO2CumG))
+	}
+	if out.meter != nil {
+		v = append(v, fmt.Sprintf("%.6g", r.Cost), fmt.Sprintf("%.6g", r.CostCum))
+	}
+	if out.ens != nil {
+		v = append(v, fmt.Sprintf("%.3f..%.3f", r.PTotalP5, r.PTotalP95), fmt.Sprintf("%.3f..%.3f", r.ECumP5, r.ECumP95))
+	}
+	return v
+}
+
+// applyEnsemble runs snap through the uncertainty ensemble, if any, and
+// stores the p5–p95 bands on r.
+func (l layers) applyEnsemble(r *row, snap proc.Snapshot) {
+	if l.ens == nil {
+		return
+	}
+	p := l.ens.Apply(snap)
+	e := l.ens.EnergyCumJ()
+	r.PTotalP5, r.PTotalP95 = p.P5, p.P95
+	r.ECumP5, r.ECumP95 = e.P5, e.P95
+}
+
+func createFile(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	return os.Create(path)
+}
+
+// write prints one row to stdout and streams it to every open file. l holds
+// the emissions and cost state of the row's group.
+func (out *outputs) write(r row, l layers) {
+	r.Profile = out.profile
+	tickJ := r.EnergyCumJ - out.lastE[r.Group]
+	if l.carbon != nil {
+		r.CO2G = l.carbon.Add(r.At, tickJ)
+		r.CO2CumG = l.carbon.TotalG()
+	}
+	if l.meter != nil {
+		r.Cost = l.meter.Add(r.At, tickJ)
+		r.CostCum = l.meter.Total()
+	}
+	out.lastE[r.Group] = r.EnergyCumJ
+
+	if out.pretty {
+		printTableRow(out.tw, r, out.extraValues(r))
+	} else {
+		printCsvLike(r, out.extraValues(r))
+	}
+
+	if out.csvW != nil {
+		_ = out.csvW.Write([]string{
+			r.At.Format(time.RFC3339),
+			util.FmtFloat(r.UVm), util.FmtFloat(r.UProc),
+			util.FmtFloat(r.PCPU), util.FmtFloat(r.PDisk), util.FmtFloat(r.PRAM),
+			util.FmtFloat(r.PIdleShare),
+			util.FmtFloat(r.PTotal), util.FmtFloat(r.EnergyCumJ),
+			strconv.FormatUint(r.ReadBytes.ToUin64(), 10),
+			strconv.FormatUint(r.WriteBytes.ToUin64(), 10),
+			strconv.FormatUint(r.RefaultB.ToUin64(), 10),
+			strconv.FormatUint(r.RSSChurnB.ToUin64(), 10),
+			util.FmtFloat(r.IntervalSec),
+			fmtOptional(out.carbon != nil, r.CO2G), fmtOptional(out.carbon != nil, r.CO2CumG),
+			fmtOptional(out.meter != nil, r.Cost), fmtOptional(out.meter != nil, r.CostCum),
+			fmtOptional(out.ens != nil, r.PTotalP5), fmtOptional(out.ens != nil, r.PTotalP95),
+			fmtOptional(out.ens != nil, r.ECumP5), fmtOptional(out.ens != nil, r.ECumP95),
+			r.Profile, r.Group,
+		})
+		out.csvW.Flush()
+	}
+
+	// JSON streaming (comma separated)
+	if out.jsonF != nil {
+		b, _ := json.MarshalIndent(r, "  ", "  ")
+		if out.jsonN > 0 {
+			_, _ = out.jsonF.WriteString(",\n")
+		}
+		_, _ = out.jsonF.Write(b)
+		out.jsonN++
+	}
+	if out.ndF != nil {
+		b, _ := json.Marshal(r)
+		_, _ = out.ndF.Write(append(b, '\n'))
+	}
+	if out.fsync {
+		for _, f := range []*os.File{out.csvF, out.jsonF, out.ndF} {
+			if f != nil {
+				_ = f.Sync()
+			}
+		}
+	}
+
+	if out.htmlF != nil || out.mdF != nil {
+		out.rows = append(out.rows, r)
+	}
+	for _, s := range out.sinks {
+		s.push(out.point(r, s.profile))
+	}
+}
+
+// fmtOptional formats an optional CSV value, or "" when the feature is off.
+func fmtOptional(on bool, v float64) string {
+	if !on {
+		return ""
+	}
+	return strconv.FormatFloat(v, 'g', 6, 64)
+}
+
+// close finalizes the files; the HTML report gets the run summary.
+func (out *outputs) close(sum reportSummary, names map[int]string) {
+	if out.csvW != nil {
+		out.csvW.Flush()
+	}
+	if out.csvF != nil {
+		_ = out.csvF.Close()
+	}
+	if out.jsonF != nil {
+		_, _ = out.jsonF.WriteString("\n]\n")
+		_ = out.jsonF.Close()
+	}
+	if out.ndF != nil {
+		_ = out.ndF.Close()
+	}
+	if out.htmlF != nil {
+		if err := writeHTML(out.htmlF, out.rows, sum, names); err != nil {
+			slog.Error("write html", "err", err)
+		}
+		_ = out.htmlF.Close()
+	}
+	if out.mdF != nil {
+		var md bytes.Buffer
+		err := writeMarkdown(&md, out.rows, sum, nil, names)
+		if err == nil {
+			_, err = out.mdF.Write(md.Bytes())
+		}
+		if err == nil {
+			err = appendStepSummary(md.Bytes())
+		}
+		if err != nil {
+			slog.Error("write markdown", "err", err)
+		}
+		_ = out.mdF.Close()
+	}
+	for _, s := range out.sinks {
+		if err := s.Close(); err != nil {
+			slog.Warn("close "+s.name, "err", err)
+		}
+	}
+}
+
+// summary collects the run totals shown in the HTML report and on stdout
+// from an accumulator's stats and the layers that saw the same ticks.
+func (out *outputs) summary(st consumption.Stats, l layers) reportSummary {
+	s := reportSummary{Profile: out.profile, Avg: st.Avg, Energy: st.Energy.Total, Stats: st}
+	if l.carbon != nil {
+		s.Carbon = true
+		s.CO2G = l.carbon.TotalG()
+		s.PUE = l.carbon.PUE()
+		s.Intensity = l.carbon.AvgIntensity()
+	}
+	if l.meter != nil {
+		t := l.meter.Tariff()
+		s.Tariff = true
+		s.Cost = l.meter.Total()
+		s.Currency = t.Currency
+		s.MonthlyCost = t.MonthlyCost(st.Avg.PTotal)
+	}
+	if l.ens != nil {
+		s.Uncertain = true
+		s.Members = l.ens.Size()
+		s.PTotalBand = l.ens.AvgPTotal()
+		s.EnergyBand = l.ens.EnergyCumJ()
+	}
+	return s
+}
+
+// combine builds the summary of a grouped run: combined stats (see
+// combineStats) with summed emissions and cost, plus the per-group
+// comparison. Uncertainty bands are per group only.
+func (out *outputs) combine(st consumption.Stats, groups []groupSummary) reportSummary {
+	s := out.summary(st, layers{})
+	for i := range groups {
+		g := &groups[i]
+		if s.Energy > 0 {
+			g.Share = g.Energy / s.Energy
+		}
+		s.CO2G += g.CO2G
+		s.Cost += g.Cost
+		s.PUE, s.Currency = g.PUE, g.Currency
+	}
+	if out.carbon != nil {
+		s.Carbon = true
+		if kwh := s.Energy / types.JoulesPerKWh; kwh > 0 {
+			s.Intensity = s.CO2G / kwh
+		}
+	}
+	if out.meter != nil {
+		s.Tariff = true
+		s.MonthlyCost = out.meter.Tariff().MonthlyCost(st.Avg.PTotal)
+	}
+	s.Groups = groups
+	return s
+}
+
+// groupSummary is one line of the group comparison.
+type groupSummary struct {
+	Name string
+	PIDs int
+	reportSummary
+	Share float64 // of the combined energy [0..1]
+}
+
+// reportSummary is the end-of-run summary.
+type reportSummary struct {
+	Profile string
+	Avg     consumption.Result // time-weighted
+	Energy  float64            // J
+	Stats   consumption.Stats  // per-component energy, P_total spread
+
+	Carbon    bool
+	CO2G      float64 // gCO2e
+	PUE       float64
+	Intensity float64 // energy-weighted gCO2e/kWh, PUE included
+
+	Tariff      bool
+	Cost        float64
+	Currency    string
+	MonthlyCost float64 // at the average total power
+
+	Uncertain  bool
+	Members    int                  // Monte Carlo ensemble size
+	PTotalBand consumption.Interval // average P_total (W)
+	EnergyBand consumption.Interval // J
+
+	Groups []groupSummary // grouped runs only
+}
+
+func printSummary(n int, interval string, s reportSummary) {
+	fmt.Println()
+	fmt.Printf("consumption avg (over %d samples of ~%s, profile %s):\n", n, interval, s.Profile)
+	fmt.Printf("- watt (cpu):    %.3f W\n", s.Avg.PCPU)
+	fmt.Printf("- watt (disk):   %.3f W\n", s.Avg.PDisk)
+	fmt.Printf("- watt (ram):    %.3f W\n", s.Avg.PRAM)
+	if s.Uncertain {
+		fmt.Printf("- watt (total):  %.3f W (p5–p95 %.3f–%.3f W, n=%d)\n", s.Avg.PTotal, s.PTotalBand.P5, s.PTotalBand.P95, s.Members)
+		fmt.Printf("- energy:        %.3f J (p5–p95 %.3f–%.3f J)\n", s.Energy, s.EnergyBand.P5, s.EnergyBand.P95)
+	} else {
+		fmt.Printf("- watt (total):  %.3f W\n", s.Avg.PTotal)
+		fmt.Printf("- energy:        %.3f J\n", s.Energy)
+	}
+	if s.Stats.Samples > 0 {
+		e, p := s.Stats.Energy, s.Stats.PTotal
+		fmt.Printf("- energy split:  cpu %.3f J, disk %.3f J, ram %.3f J, idle %.3f J\n", e.CPU, e.Disk, e.RAM, e.IdleShare)
+		fmt.Printf("- total spread:  min %.3f W, max %.3f W, sd %.3f W\n", p.Min, p.Max, p.StdDev)
+		fmt.Printf("- total pctl:    p50 %.3f W, p95 %.3f W, p99 %.3f W\n", p.P50, p.P95, p.P99)
+	}
+	if s.Carbon {
+		fmt.Printf("- co2e:          %.6f g (%.1f gCO2e/kWh incl. PUE %.2f)\n", s.CO2G, s.Intensity, s.PUE)
+	}
+	if s.Tariff {
+		fmt.Printf("- cost:          %.6g %s\n", s.Cost, s.Currency)
+		fmt.Printf("- cost (month):  %.2f %s projected at %.3f W\n", s.MonthlyCost, s.Currency, s.Avg.PTotal)
+	}
+	fmt.Println()
+	if len(s.Groups) > 0 {
+		printGroups(s)
+	}
+}
+
+// printGroups prints the side-by-side comparison of a grouped run.
+func printGroups(s reportSummary) {
+	band := slices.ContainsFunc(s.Groups, func(g groupSummary) bool { return g.Uncertain })
+	head := "GROUP\tPIDS\tP_cpu (W)\tP_disk (W)\tP_ram (W)\tP_total (W)\tE (J)"
+	if band {
+		head += "\tE p5..p95 (J)"
+	}
+	if s.Carbon {
+		head += "\tCO2 (g)"
+	}
+	if s.Tariff {
+		head += "\tCost"
+	}
+
+	tw := newTable()
+	fmt.Fprintln(tw, head+"\tSHARE")
+	for _, g := range s.Groups {
+		line := fmt.Sprintf("%s\t%d\t%.3f\t%.3f\t%.3f\t%.3f\t%.3f", g.Name, g.PIDs, g.Avg.PCPU, g.Avg.PDisk, g.Avg.PRAM, g.Avg.PTotal, g.Energy)
+		if band {
+			line += fmt.Sprintf("\t%.3f..%.3f", g.EnergyBand.P5, g.EnergyBand.P95)
+		}
+		if s.Carbon {
+			line += fmt.Sprintf("\t%.6f", g.CO2G)
+		}
+		if s.Tariff {
+			line += fmt.Sprintf("\t%.6g", g.Cost)
+		}
+		fmt.Fprintf(tw, "%s\t%.1f%%\n", line, 100*g.Share)
+	}
+	tw.Flush()
+	fmt.Println()
+}
+
+func newTable() *tabwriter.Writer {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	return tw
+}
+
+func printTableHeader(tw *tabwriter.Writer, extra []string) {
+	head := "TIME\tU_vm\tU_proc\tP_cpu (W)\tP_disk (W)\tP_ram (W)\tP_idle_share (W)\tP_total (W)\tE_cum (J)"
+	dash := "----\t----\t------\t---------\t----------\t---------\t---------------\t-----------\t---------"
+	for _, h := range extra {
+		head += "\t" + h
+		dash += "\t" + strings.Repeat("-", len(h))
+	}
+	fmt.Fprintln(tw, head)
+	fmt.Fprintln(tw, dash)
+	tw.Flush()
+}
+
+func printTableRow(tw *tabwriter.Writer, r row, extra []string) {
+	fmt.Fprintf(tw, "%s\t%.4f\t%.4f\t%.3f\t%.3f\t%.3f\t%.3f\t%.3f\t%.3f",
+		r.At.Format("2006-01-02 15:04:05"), util.Clamp01(r.UVm), util.Clamp01(r.UProc),
+		r.PCPU, r.PDisk, r.PRAM, r.PIdleShare, r.PTotal, r.EnergyCumJ,
+	)
+	for _, v := range extra {
+		fmt.Fprint(tw, "\t"+v)
+	}
+	fmt.Fprintln(tw)
+	tw.Flush()
+}
+
+func printCsvLike(r row, extra []string) {
+	fmt.Printf("%s, %.4f, %.4f, %.3f, %.3f, %.3f, %.3f, %.3f, %.3f",
+		r.At.Format(time.RFC3339), util.Clamp01(r.UVm), util.Clamp01(r.UProc),
+		r.PCPU, r.PDisk, r.PRAM, r.PIdleShare, r.PTotal, r.EnergyCumJ)
+	for _, v := range extra {
+		fmt.Print(", " + v)
+	}
+	fmt.Println()
+}
+
+const _console = `Consumption - Process Power/Energy Estimation Tool
+Copyright (c) 2024 Javad Rajabzadeh Inc. All rights reserved.
+
+* GitHub: https://github.com/ja7ad/consumption
+
+       Host: %s
+       Kernel: %s 
+       CPUs: %s
+       Mem: %s
+
+Consumption report as of %s:
+
+`
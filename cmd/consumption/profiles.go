@@ -0,0 +1,60 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ja7ad/consumption/pkg/consumption"
+	"github.com/ja7ad/consumption/pkg/profile"
+)
+
+func profiles() *cobra.Command {
+	return &cobra.Command{
+		Use:   "profiles",
+		Short: "List built-in and user model profiles",
+		Long: `List the model profiles usable with --profile. User profiles are
+<name>.yaml, <name>.yml or <name>.json files in the profile directory
+(~/.config/consumption/profiles, or $CONSUMPTION_PROFILE_DIR) and shadow
+built-ins of the same name. 'consumption calibrate --out' writes one.
+
+Examples:
+  consumption profiles
+  consumption --profile laptop -- $(pidof firefox)
+  consumption calibrate --out ~/.config/consumption/profiles/mybox.json`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ps, err := profile.List()
+			if err != nil {
+				slog.Warn("some user profiles could not be read", "err", err)
+			}
+
+			if dir, err := profile.Dir(); err == nil {
+				fmt.Printf("user profile dir: %s\n\n", dir)
+			}
+
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "NAME\tSOURCE\tMODEL\tP_idle (W)\tP_max (W)\tDESCRIPTION")
+			fmt.Fprintln(tw, "----\t------\t-----\t----------\t---------\t-----------")
+			for _, p := range ps {
+				m, err := p.Config.BuildModel()
+				if err != nil {
+					fmt.Fprintf(tw, "%s\t%s\tinvalid: %v\t\t\t%s\n", p.Name, p.Source, err, p.Description)
+					continue
+				}
+				name := m.Name()
+				if pl, ok := m.(consumption.PowerLaw); ok {
+					name = fmt.Sprintf("%s (γ=%.2f)", name, pl.Gamma)
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%.2f\t%.2f\t%s\n",
+					p.Name, p.Source, name, m.Idle(), m.Power(1), p.Description)
+			}
+			return tw.Flush()
+		},
+	}
+}
@@ -0,0 +1,145 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ja7ad/consumption/pkg/export"
+)
+
+// maxPushBatch bounds the points a batching sink buffers between flushes.
+const maxPushBatch = 500
+
+// pushSink is an open --influx, --statsd or --graphite sink. A failing
+// sink never stops the run: it drops the row and warns once until it
+// recovers.
+//
+// Sinks whose points carry timestamps (line protocol, Graphite) are
+// flushed every --push-interval or maxPushBatch points, and at close, so
+// a slow endpoint does not hold up every tick. StatsD has no timestamps
+// and is flushed every tick.
+type pushSink struct {
+	export.Sink
+	name    string
+	profile bool          // tag points with the profile (line protocol only)
+	every   time.Duration // 0 flushes every point
+	pending int
+	flushed time.Time
+	failing bool
+}
+
+// openSinks opens the push sinks requested in o.
+func (out *outputs) openSinks(o opts) error {
+	out.host, _ = os.Hostname()
+	if o.influx != "" {
+		var (
+			s   export.Sink
+			err error
+		)
+		if strings.HasPrefix(o.influx, "http://") || strings.HasPrefix(o.influx, "https://") {
+			token := o.influxToken
+			if token == "" {
+				token = os.Getenv("INFLUX_TOKEN")
+			}
+			s, err = export.NewInfluxHTTP(o.influx, token)
+		} else {
+			var f *os.File
+			if f, err = createFile(o.influx); err == nil {
+				s = export.NewLineWriter(f)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("influx: %w", err)
+		}
+		out.sinks = append(out.sinks, &pushSink{Sink: s, name: "influx", profile: true, every: o.pushEvery})
+	}
+	if o.statsd != "" {
+		s, err := export.NewStatsD(o.statsd)
+		if err != nil {
+			return fmt.Errorf("statsd: %w", err)
+		}
+		out.sinks = append(out.sinks, &pushSink{Sink: s, name: "statsd"})
+	}
+	if o.graphite != "" {
+		s, err := export.NewGraphite(o.graphite)
+		if err != nil {
+			return fmt.Errorf("graphite: %w", err)
+		}
+		out.sinks = append(out.sinks, &pushSink{Sink: s, name: "graphite", every: o.pushEvery})
+	}
+	now := time.Now()
+	for _, s := range out.sinks {
+		s.flushed = now
+	}
+	return nil
+}
+
+// push writes one point and flushes when due.
+func (s *pushSink) push(p export.Point) {
+	err := s.Write(p)
+	if err == nil {
+		s.pending++
+		if s.pending >= maxPushBatch || time.Since(s.flushed) >= s.every {
+			s.pending, s.flushed = 0, time.Now()
+			err = s.Flush()
+		}
+	}
+	switch {
+	case err != nil && !s.failing:
+		slog.Warn(s.name+" push failed; dropping rows until it recovers", "err", err)
+	case err == nil && s.failing:
+		slog.Info(s.name + " push recovered")
+	}
+	s.failing = err != nil
+}
+
+// point converts r for the push sinks: host and group as tags (plus the
+// profile when withProfile), the row's numbers as fields. Per-tick byte,
+// emission and cost values are deltas; the optional fields follow the
+// enabled layers, like the CSV columns.
+func (out *outputs) point(r row, withProfile bool) export.Point {
+	p := export.Point{
+		Measurement: "consumption",
+		Tags:        []export.Tag{{Key: "host", Value: out.host}, {Key: "group", Value: r.Group}},
+		Time:        r.At,
+	}
+	if withProfile {
+		p.Tags = append(p.Tags, export.Tag{Key: "profile", Value: r.Profile})
+	}
+	f := func(key string, v float64, delta bool) {
+		p.Fields = append(p.Fields, export.Field{Key: key, Value: v, Delta: delta})
+	}
+	f("u_vm", r.UVm, false)
+	f("u_proc", r.UProc, false)
+	f("p_cpu_w", r.PCPU, false)
+	f("p_disk_w", r.PDisk, false)
+	f("p_ram_w", r.PRAM, false)
+	f("p_idle_share_w", r.PIdleShare, false)
+	f("p_total_w", r.PTotal, false)
+	f("e_cum_j", r.EnergyCumJ, false)
+	f("read_bytes", float64(r.ReadBytes), true)
+	f("write_bytes", float64(r.WriteBytes), true)
+	f("refault_bytes", float64(r.RefaultB), true)
+	f("rss_churn_bytes", float64(r.RSSChurnB), true)
+	f("interval_sec", r.IntervalSec, false)
+	if out.carbon != nil {
+		f("co2_g", r.CO2G, true)
+		f("co2_cum_g", r.CO2CumG, false)
+	}
+	if out.meter != nil {
+		f("cost", r.Cost, true)
+		f("cost_cum", r.CostCum, false)
+	}
+	if out.ens != nil {
+		f("p_total_p5_w", r.PTotalP5, false)
+		f("p_total_p95_w", r.PTotalP95, false)
+		f("e_cum_p5_j", r.ECumP5, false)
+		f("e_cum_p95_j", r.ECumP95, false)
+	}
+	return p
+}
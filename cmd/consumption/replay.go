@@ -0,0 +1,124 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/ja7ad/consumption/pkg/consumption"
+	"github.com/ja7ad/consumption/pkg/trace"
+)
+
+func replay() *cobra.Command {
+	var o opts
+
+	cmd := &cobra.Command{
+		Use:   "replay <trace.bin>",
+		Short: "Re-run the power model over a recorded trace",
+		Long: `Replay raw snapshots recorded with --record through the power model.
+
+Any model flag may differ from the original run, so coefficients can be tuned
+after the fact without re-running the workload. All normal outputs (table,
+CSV, JSON, HTML) are produced, using the recorded timestamps.
+
+By default samples flagged as warmup at record time are skipped; pass
+--warmup N to skip the first N records instead.
+
+Examples:
+  consumption replay trace.bin
+  consumption replay trace.bin --p-max 35 --gamma 1.6 --csv tuned.csv
+  consumption replay trace.bin --warmup 0 --html all.html`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runReplay(cmd.Flags(), o, args[0])
+		},
+	}
+
+	cmd.Flags().IntVar(&o.warmup, "warmup", -1, "number of initial records to skip (-1 = as recorded)")
+	addModelFlags(cmd.Flags(), &o)
+	addCarbonFlags(cmd.Flags(), &o)
+	addTariffFlags(cmd.Flags(), &o)
+	addOutputFlags(cmd.Flags(), &o)
+	addBudgetFlags(cmd.Flags(), &o)
+	return cmd
+}
+
+func runReplay(fs *pflag.FlagSet, o opts, path string) error {
+	cfg, profileName, err := o.config(fs)
+	if err != nil {
+		return err
+	}
+	budget, err := o.budget()
+	if err != nil {
+		return err
+	}
+	lay, err := o.layers(cfg)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	rd, err := trace.NewReader(bufio.NewReader(f))
+	if err != nil {
+		return err
+	}
+	meta := rd.Meta()
+	fmt.Printf(_console, meta.Host, meta.Kernel, meta.CPUs, meta.Mem, meta.Started.Format("2006-01-02 15:04:05"))
+	fmt.Printf("# replay of %s (collector %s, recorded by %s)\n\n", path, meta.Collector, meta.ToolVersion)
+
+	acc, err := consumption.NewChecked(&cfg)
+	if err != nil {
+		return err
+	}
+	out, err := openOutputs(o, profileName, lay, false)
+	if err != nil {
+		return err
+	}
+
+	n, applied := 0, 0
+	for {
+		rec, err := rd.Next()
+		if err != nil {
+			if errors.Is(err, trace.ErrTruncated) {
+				slog.Warn("trace ends with a partial record; ignoring it", "err", err)
+			} else if !errors.Is(err, io.EOF) {
+				out.close(out.summary(acc.Stats(), lay), meta.Names)
+				return err
+			}
+			break
+		}
+		n++
+
+		skip := rec.Warmup
+		if o.warmup >= 0 {
+			skip = n <= o.warmup
+		}
+		if skip {
+			continue
+		}
+
+		res := acc.Apply(rec.Snapshot)
+		applied++
+		r := newRow(rec.At, rec.Snapshot, res, acc.EnergyCumJ())
+		lay.applyEnsemble(&r, rec.Snapshot)
+		out.write(r, lay)
+	}
+
+	sum := out.summary(acc.Stats(), lay)
+	out.close(sum, meta.Names)
+	printSummary(applied, meta.Interval.String(), sum)
+	return checkBudget(budget, sum.Stats.Energy, sum.Avg)
+}
@@ -0,0 +1,424 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ja7ad/consumption/pkg/types"
+)
+
+// openReport opens a CSV/JSON/NDJSON report (or stdin for "-") and returns
+// a reader plus the detected extension.
+func openReport(path string) (io.Reader, string, func() error, error) {
+	if path == "-" {
+		// best-effort sniff: read a few bytes
+		br := bufio.NewReader(os.Stdin)
+		peek, _ := br.Peek(1)
+		ext := ".csv"
+		if len(peek) == 1 && (peek[0] == '[' || peek[0] == '{') {
+			ext = ".json"
+		}
+		return br, ext, func() error { return nil }, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return bufio.NewReader(f), strings.ToLower(filepath.Ext(path)), f.Close, nil
+}
+
+// reportFile is a decoded report.
+type reportFile struct {
+	rows      []row
+	has       map[string]bool // columns with a value in at least one row
+	truncated bool            // the input ended inside a row or before "]"
+}
+
+// readReportFile loads every row of a CSV/JSON/NDJSON report written by
+// run/replay. A report cut off mid-write (e.g. the run was killed) yields the
+// rows before the cut, with a warning saying how many were recovered.
+func readReportFile(path string) (reportFile, error) {
+	r, ext, closeFn, err := openReport(path)
+	if err != nil {
+		return reportFile{}, err
+	}
+	defer closeFn()
+	f, err := readReport(r, ext)
+	if err != nil {
+		return reportFile{}, fmt.Errorf("%s: %w", path, err)
+	}
+	if f.truncated {
+		slog.Warn("report is truncated; using the rows before the cut", "file", path, "recovered", len(f.rows))
+	}
+	return f, nil
+}
+
+// cumColumns are the running totals of a row; readReports rebases them to
+// the window and chains them across files.
+var cumColumns = []struct {
+	name string
+	col  func(*row) *float64
+}{
+	{"e_cum_j", func(r *row) *float64 { return &r.EnergyCumJ }},
+	{"co2_cum_g", func(r *row) *float64 { return &r.CO2CumG }},
+	{"cost_cum", func(r *row) *float64 { return &r.CostCum }},
+	{"e_cum_p5_j", func(r *row) *float64 { return &r.ECumP5 }},
+	{"e_cum_p95_j", func(r *row) *float64 { return &r.ECumP95 }},
+}
+
+// readReports loads several reports as one series: files are ordered by
+// their first timestamp, rows outside [from, to) are dropped (zero bounds
+// are open) and the cumulative columns are rebased so they count from the
+// start of the window and continue across files, per group. A cumulative
+// column that has no value in some file (absent, or empty in every row) is
+// cleared everywhere, so totals fall back to integrating the per-tick values.
+func readReports(paths []string, from, to string) ([]row, error) {
+	var (
+		files   = make([][]row, 0, len(paths))
+		missing = make([]bool, len(cumColumns))
+	)
+	for _, path := range paths {
+		f, err := readReportFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if len(f.rows) == 0 {
+			continue
+		}
+		for c, cc := range cumColumns {
+			missing[c] = missing[c] || !f.has[cc.name]
+		}
+		files = append(files, f.rows)
+	}
+	slices.SortStableFunc(files, func(a, b []row) int { return a[0].At.Compare(b[0].At) })
+
+	lo, hi, err := reportWindow(files, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	offset := make(map[string][]float64) // per group, end of the previous file
+	var out []row
+	for _, rows := range files {
+		before := make(map[string][]float64) // per group, cumulative before the window
+		last := make(map[string][]float64)
+		for _, r := range rows {
+			cur := make([]float64, len(cumColumns))
+			for c, cc := range cumColumns {
+				cur[c] = *cc.col(&r)
+			}
+			if (!lo.IsZero() && r.At.Before(lo)) || (!hi.IsZero() && !r.At.Before(hi)) {
+				if !lo.IsZero() && r.At.Before(lo) {
+					before[r.Group] = cur
+				}
+				continue
+			}
+			off := offset[r.Group]
+			for c, cc := range cumColumns {
+				if b := before[r.Group]; b != nil {
+					*cc.col(&r) -= b[c]
+				}
+				if off != nil {
+					*cc.col(&r) += off[c]
+				}
+			}
+			last[r.Group] = cur
+			out = append(out, r)
+		}
+		for g, cur := range last {
+			end := make([]float64, len(cumColumns))
+			for c := range cumColumns {
+				end[c] = cur[c]
+				if b := before[g]; b != nil {
+					end[c] -= b[c]
+				}
+				if off := offset[g]; off != nil {
+					end[c] += off[c]
+				}
+			}
+			offset[g] = end
+		}
+	}
+	for i := range out {
+		for c, cc := range cumColumns {
+			if missing[c] {
+				*cc.col(&out[i]) = 0
+			}
+		}
+	}
+	return out, nil
+}
+
+// reportWindow resolves --from/--to. A bound is an RFC 3339 timestamp, a
+// local "2006-01-02 15:04:05", a time of day on the report's first day, or a
+// duration offset from the report's first row (e.g. 5m).
+func reportWindow(files [][]row, from, to string) (lo, hi time.Time, err error) {
+	if from == "" && to == "" {
+		return lo, hi, nil
+	}
+	var start time.Time
+	for _, rows := range files {
+		for _, r := range rows {
+			if r.At.IsZero() {
+				return lo, hi, errors.New("--from/--to need timestamps, but the report has rows without time")
+			}
+		}
+		if start.IsZero() || rows[0].At.Before(start) {
+			start = rows[0].At
+		}
+	}
+	parse := func(flag, s string) (time.Time, error) {
+		if s == "" {
+			return time.Time{}, nil
+		}
+		if d, err := time.ParseDuration(s); err == nil {
+			return start.Add(d), nil
+		}
+		if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			return t, nil
+		}
+		for _, layout := range []string{time.DateTime, "2006-01-02T15:04:05"} {
+			if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+				return t, nil
+			}
+		}
+		if t, err := time.Parse(time.TimeOnly, s); err == nil {
+			day := start.Local()
+			return time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.Local), nil
+		}
+		return time.Time{}, fmt.Errorf("%s %q: want an RFC 3339 time, \"2006-01-02 15:04:05\", \"15:04:05\" or an offset like 5m", flag, s)
+	}
+	if lo, err = parse("--from", from); err != nil {
+		return lo, hi, err
+	}
+	if hi, err = parse("--to", to); err != nil {
+		return lo, hi, err
+	}
+	if !lo.IsZero() && !hi.IsZero() && !lo.Before(hi) {
+		return lo, hi, fmt.Errorf("--from %s is not before --to %s", lo.Format(time.RFC3339), hi.Format(time.RFC3339))
+	}
+	return lo, hi, nil
+}
+
+// readReport decodes rows from a CSV or JSON report; JSON may be an array, an
+// array missing its end, or one object per line (NDJSON). truncated reports
+// an incomplete last row or a missing "]"; the complete rows are returned.
+// Missing interval_sec values are derived from timestamps via fillIntervals.
+func readReport(r io.Reader, ext string) (f reportFile, err error) {
+	switch ext {
+	case ".csv":
+		f, err = readCSVRows(r)
+	case ".json", ".ndjson", ".jsonl":
+		f, err = readJSONRows(r)
+	default:
+		return f, fmt.Errorf("unsupported file type: %q (use .csv, .json, .ndjson, or -)", ext)
+	}
+	if err != nil {
+		return reportFile{}, err
+	}
+	fillIntervals(f.rows)
+	return f, nil
+}
+
+// readCSVRows decodes CSV rows by header name. A short or malformed last
+// record is a row torn by a crash: the input is truncated there. A column
+// has a value once a row has a non-empty field in it.
+func readCSVRows(r io.Reader) (reportFile, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err == io.EOF {
+		return reportFile{}, nil // empty, like an empty JSON report
+	}
+	if err != nil {
+		return reportFile{}, fmt.Errorf("csv read header: %w", err)
+	}
+	idx := make(map[string]int)
+	for i, h := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(h))
+		idx[header[i]] = i
+	}
+
+	for _, c := range []string{"p_cpu_w", "p_disk_w", "p_ram_w", "p_total_w"} {
+		if _, ok := idx[c]; !ok {
+			return reportFile{}, fmt.Errorf("csv missing required column %q", c)
+		}
+	}
+
+	var rec []string
+	str := func(name string) string {
+		if i, ok := idx[name]; ok && i < len(rec) {
+			return strings.TrimSpace(rec[i])
+		}
+		return ""
+	}
+	f64 := func(name string) float64 {
+		f, _ := strconv.ParseFloat(str(name), 64)
+		return f
+	}
+	u64 := func(name string) types.Bytes {
+		u, _ := strconv.ParseUint(str(name), 10, 64)
+		return types.ToBytes(u)
+	}
+
+	f := reportFile{has: make(map[string]bool)}
+	for {
+		rec, err = cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err == nil && len(rec) != len(header) {
+			line, _ := cr.FieldPos(0)
+			err = fmt.Errorf("line %d: %d fields, header has %d", line, len(rec), len(header))
+		}
+		if err != nil {
+			if _, next := cr.Read(); next == io.EOF {
+				f.truncated = true
+				return f, nil
+			}
+			return reportFile{}, fmt.Errorf("csv read: %w", err)
+		}
+		for i, v := range rec {
+			if strings.TrimSpace(v) != "" {
+				f.has[header[i]] = true
+			}
+		}
+		x := row{
+			UVm:         f64("u_vm"),
+			UProc:       f64("u_proc"),
+			PCPU:        f64("p_cpu_w"),
+			PDisk:       f64("p_disk_w"),
+			PRAM:        f64("p_ram_w"),
+			PIdleShare:  f64("p_idle_share_w"),
+			PTotal:      f64("p_total_w"),
+			EnergyCumJ:  f64("e_cum_j"),
+			ReadBytes:   u64("read_bytes"),
+			WriteBytes:  u64("write_bytes"),
+			RefaultB:    u64("refault_bytes"),
+			RSSChurnB:   u64("rss_churn_bytes"),
+			IntervalSec: f64("interval_sec"),
+			CO2G:        f64("co2_g"),
+			CO2CumG:     f64("co2_cum_g"),
+			Cost:        f64("cost"),
+			CostCum:     f64("cost_cum"),
+			PTotalP5:    f64("p_total_p5_w"),
+			PTotalP95:   f64("p_total_p95_w"),
+			ECumP5:      f64("e_cum_p5_j"),
+			ECumP95:     f64("e_cum_p95_j"),
+			Profile:     str("profile"),
+			Group:       str("group"),
+		}
+		if ts, err := time.Parse(time.RFC3339, str("time")); err == nil {
+			x.At = ts
+		}
+		f.rows = append(f.rows, x)
+	}
+	return f, nil
+}
+
+// readJSONRows decodes an array of rows or a stream of row objects. Input
+// that ends inside a row, or an array without its closing "]", is truncated.
+// A column has a value once a row has its key; zero totals are omitted when
+// writing JSON, so a key absent from some rows is not a missing column.
+func readJSONRows(r io.Reader) (reportFile, error) {
+	dec := json.NewDecoder(r)
+	t, err := dec.Token()
+	if err == io.EOF {
+		return reportFile{}, nil
+	}
+	if err != nil {
+		return reportFile{}, fmt.Errorf("json: %w", err)
+	}
+	array := t == json.Delim('[')
+	if !array {
+		// not an array: restart on a stream of objects (NDJSON)
+		if t != json.Delim('{') {
+			return reportFile{}, fmt.Errorf("json: want an array or objects, got %v", t)
+		}
+		dec = json.NewDecoder(io.MultiReader(strings.NewReader("{"), dec.Buffered(), r))
+	}
+
+	f := reportFile{has: make(map[string]bool)}
+	for {
+		if array && !dec.More() {
+			break
+		}
+		var raw json.RawMessage
+		err := dec.Decode(&raw)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if cut(err) {
+				f.truncated = true
+				return f, nil
+			}
+			return reportFile{}, fmt.Errorf("json row %d: %w", len(f.rows)+1, err)
+		}
+		var (
+			x    row
+			keys map[string]json.RawMessage
+		)
+		if err := json.Unmarshal(raw, &x); err != nil {
+			return reportFile{}, fmt.Errorf("json row %d: %w", len(f.rows)+1, err)
+		}
+		_ = json.Unmarshal(raw, &keys)
+		for k, v := range keys {
+			if string(v) != "null" {
+				f.has[k] = true
+			}
+		}
+		f.rows = append(f.rows, x)
+	}
+	if array {
+		if _, err := dec.Token(); err != nil {
+			if cut(err) {
+				f.truncated = true
+				return f, nil
+			}
+			return reportFile{}, fmt.Errorf("json closing token: %w", err)
+		}
+	}
+	return f, nil
+}
+
+// cut reports whether a decode error means the input ended early. The
+// decoder reports some of these as a syntax error rather than
+// io.ErrUnexpectedEOF.
+func cut(err error) bool {
+	var se *json.SyntaxError
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.As(err, &se) && strings.Contains(se.Error(), "unexpected end of JSON input")
+}
+
+// fillIntervals derives interval_sec from consecutive timestamps for rows that
+// lack it. The first row borrows the next row's spacing.
+func fillIntervals(rows []row) {
+	for i := range rows {
+		if rows[i].IntervalSec > 0 {
+			continue
+		}
+		switch {
+		case i > 0 && !rows[i].At.IsZero() && !rows[i-1].At.IsZero():
+			rows[i].IntervalSec = rows[i].At.Sub(rows[i-1].At).Seconds()
+		case i+1 < len(rows) && !rows[i].At.IsZero() && !rows[i+1].At.IsZero():
+			rows[i].IntervalSec = rows[i+1].At.Sub(rows[i].At).Seconds()
+		}
+		if rows[i].IntervalSec < 0 {
+			rows[i].IntervalSec = 0
+		}
+	}
+}
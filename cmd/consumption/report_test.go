@@ -0,0 +1,303 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// captureWarnings sends slog output to the returned buffer for the test.
+func captureWarnings(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &buf
+}
+
+// writeReport writes content to a file named name in a temp dir.
+func writeReport(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+const (
+	testCSVHeader = "time,p_cpu_w,p_disk_w,p_ram_w,p_total_w,e_cum_j,interval_sec\n"
+	testCSVRows   = "2025-03-01T10:00:01Z,1,0.1,0.2,8,8,1\n" +
+		"2025-03-01T10:00:02Z,2,0.1,0.2,9,17,1\n" +
+		"2025-03-01T10:00:03Z,3,0.1,0.2,10,27,1\n"
+	testJSONRow1 = `{"time":"2025-03-01T10:00:01Z","p_total_w":8,"e_cum_j":8,"interval_sec":1}`
+	testJSONRow2 = `{"time":"2025-03-01T10:00:02Z","p_total_w":9,"e_cum_j":17,"interval_sec":1}`
+	testJSONRow3 = `{"time":"2025-03-01T10:00:03Z","p_total_w":10,"e_cum_j":27,"interval_sec":1}`
+)
+
+func TestReadReportFile(t *testing.T) {
+	cases := []struct {
+		name, file, content string
+		rows                int
+		truncated           bool
+		err                 string
+	}{
+		{name: "csv", file: "r.csv", content: testCSVHeader + testCSVRows, rows: 3},
+		{name: "csv torn last line", file: "r.csv", content: testCSVHeader + testCSVRows + "2025-03-01T10:00:04Z,4,0.", rows: 3, truncated: true},
+		{name: "csv torn inside a quote", file: "r.csv", content: testCSVHeader + testCSVRows + `2025-03-01T10:00:04Z,"4`, rows: 3, truncated: true},
+		{name: "csv short line mid-file", file: "r.csv", content: testCSVHeader + "2025-03-01T10:00:01Z,1\n" + testCSVRows, err: "line 2: 2 fields, header has 7"},
+		{name: "csv without power columns", file: "r.csv", content: "time,u_vm\n2025-03-01T10:00:01Z,0.5\n", err: `missing required column "p_cpu_w"`},
+		{name: "csv empty", file: "r.csv", content: ""},
+		{name: "csv header only", file: "r.csv", content: testCSVHeader},
+
+		{name: "json array", file: "r.json", content: "[" + testJSONRow1 + "," + testJSONRow2 + "," + testJSONRow3 + "]", rows: 3},
+		{name: "json array cut mid-object", file: "r.json", content: "[" + testJSONRow1 + "," + testJSONRow2 + "," + testJSONRow3[:20], rows: 2, truncated: true},
+		{name: "json array missing ]", file: "r.json", content: "[" + testJSONRow1 + "," + testJSONRow2 + "," + testJSONRow3 + "\n", rows: 3, truncated: true},
+		{name: "json array cut after a comma", file: "r.json", content: "[" + testJSONRow1 + ",", rows: 1, truncated: true},
+		{name: "json bad row mid-file", file: "r.json", content: "[" + testJSONRow1 + `,{"p_total_w":"x"},` + testJSONRow3 + "]", err: "json row 2"},
+		{name: "json scalar", file: "r.json", content: "42", err: "want an array or objects"},
+		{name: "json empty", file: "r.json", content: ""},
+		{name: "json empty array", file: "r.json", content: "[]"},
+
+		{name: "ndjson", file: "r.ndjson", content: testJSONRow1 + "\n" + testJSONRow2 + "\n" + testJSONRow3 + "\n", rows: 3},
+		{name: "ndjson without final newline", file: "r.jsonl", content: testJSONRow1 + "\n" + testJSONRow2, rows: 2},
+		{name: "ndjson cut mid-object", file: "r.ndjson", content: testJSONRow1 + "\n" + testJSONRow2 + "\n" + testJSONRow3[:30], rows: 2, truncated: true},
+
+		{name: "unknown extension", file: "r.txt", content: "x", err: `unsupported file type: ".txt"`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			logs := captureWarnings(t)
+			path := writeReport(t, tc.file, tc.content)
+			f, err := readReportFile(path)
+			rows := f.rows
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				assert.Contains(t, err.Error(), path, "errors name the file")
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, rows, tc.rows)
+
+			// readCSVRows/readJSONRows flag the cut that readReportFile warns about
+			g, err := readReport(strings.NewReader(tc.content), filepath.Ext(tc.file))
+			require.NoError(t, err)
+			assert.Equal(t, tc.truncated, g.truncated)
+			if tc.truncated {
+				assert.Contains(t, logs.String(), "report is truncated")
+				assert.Contains(t, logs.String(), fmt.Sprintf("recovered=%d", tc.rows))
+			} else {
+				assert.Empty(t, logs.String())
+			}
+			for i, r := range rows {
+				assert.Equal(t, float64(8+i), r.PTotal, "row %d", i)
+				assert.Equal(t, 1.0, r.IntervalSec, "row %d", i)
+			}
+		})
+	}
+}
+
+func TestReadReport_FillsIntervalsFromTimestamps(t *testing.T) {
+	in := "time,p_cpu_w,p_disk_w,p_ram_w,p_total_w\n" +
+		"2025-03-01T10:00:00Z,1,0,0,5\n2025-03-01T10:00:02Z,1,0,0,5\n2025-03-01T10:00:05Z,1,0,0,5\n"
+	f, err := readReport(strings.NewReader(in), ".csv")
+	require.NoError(t, err)
+	assert.False(t, f.truncated)
+	rows := f.rows
+	require.Len(t, rows, 3)
+	assert.Equal(t, []float64{2, 2, 3}, []float64{rows[0].IntervalSec, rows[1].IntervalSec, rows[2].IntervalSec})
+}
+
+func TestCut(t *testing.T) {
+	var v map[string]any
+	endErr := json.Unmarshal([]byte(`{"a":`), &v)
+	badErr := json.Unmarshal([]byte(`{"a":}`), &v)
+	require.Error(t, endErr)
+	require.Error(t, badErr)
+
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"eof", io.EOF, true},
+		{"unexpected eof", io.ErrUnexpectedEOF, true},
+		{"wrapped unexpected eof", fmt.Errorf("row 3: %w", io.ErrUnexpectedEOF), true},
+		{"syntax error at the end", endErr, true},
+		{"syntax error mid-input", badErr, false},
+		{"other", errors.New("boom"), false},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.want, cut(tc.err), tc.name)
+	}
+}
+
+// groupedCSV builds a two-group report; each line is "time,group,e_cum_j,co2_cum_g".
+func groupedCSV(lines ...string) string {
+	var b strings.Builder
+	b.WriteString("time,group,p_cpu_w,p_disk_w,p_ram_w,p_total_w,interval_sec,e_cum_j,co2_cum_g\n")
+	for _, l := range lines {
+		f := strings.Split(l, ",")
+		fmt.Fprintf(&b, "2025-03-01T%sZ,%s,1,0,0,5,1,%s,%s\n", f[0], f[1], f[2], f[3])
+	}
+	return b.String()
+}
+
+// cums returns the e_cum_j and co2_cum_g columns of group g.
+func cums(rows []row, g string) (energy, co2 []float64) {
+	for _, r := range rows {
+		if r.Group == g {
+			energy = append(energy, r.EnergyCumJ)
+			co2 = append(co2, r.CO2CumG)
+		}
+	}
+	return energy, co2
+}
+
+func TestReadReports_RebasesPerGroupAcrossFiles(t *testing.T) {
+	// The second run restarts its totals; the files are passed out of order.
+	first := writeReport(t, "a.csv", groupedCSV(
+		"10:00:00,api,100,1.0", "10:00:00,db,50,0.5",
+		"10:00:01,api,110,1.1", "10:00:01,db,55,0.55",
+		"10:00:02,api,120,1.2", "10:00:02,db,60,0.6",
+	))
+	second := writeReport(t, "b.csv", groupedCSV(
+		"10:01:00,api,5,0.05", "10:01:00,db,2,0.02",
+		"10:01:01,api,15,0.15", "10:01:01,db,4,0.04",
+	))
+
+	rows, err := readReports([]string{second, first}, "", "")
+	require.NoError(t, err)
+	require.Len(t, rows, 10)
+	assert.True(t, rows[0].At.Before(rows[9].At), "files are ordered by time")
+
+	api, apiCO2 := cums(rows, "api")
+	db, _ := cums(rows, "db")
+	assert.Equal(t, []float64{100, 110, 120, 125, 135}, api)
+	assert.Equal(t, []float64{50, 55, 60, 62, 64}, db)
+	assert.InDeltaSlice(t, []float64{1.0, 1.1, 1.2, 1.25, 1.35}, apiCO2, 1e-9)
+
+	// A window counts from its start, in each group, and still chains files.
+	rows, err = readReports([]string{first, second}, "1s", "")
+	require.NoError(t, err)
+	api, _ = cums(rows, "api")
+	db, _ = cums(rows, "db")
+	assert.Equal(t, []float64{10, 20, 25, 35}, api)
+	assert.Equal(t, []float64{5, 10, 12, 14}, db)
+
+	// Rows at or after --to are dropped.
+	rows, err = readReports([]string{first, second}, "10:00:01", "10:01:01")
+	require.NoError(t, err)
+	api, _ = cums(rows, "api")
+	assert.Equal(t, []float64{10, 20, 25}, api)
+}
+
+func TestReadReports_MissingCumulativeColumns(t *testing.T) {
+	withCO2 := writeReport(t, "a.csv", groupedCSV(
+		"10:00:00,api,10,0.1", "10:00:00,db,5,0.05",
+		"10:00:01,api,20,0.2", "10:00:01,db,0,0.05",
+	))
+	// The same columns, but this run had no grid intensity: co2 is empty.
+	noCO2 := writeReport(t, "b.csv", groupedCSV(
+		"10:01:00,api,5,", "10:01:00,db,3,",
+	))
+	// A JSON report omits zero totals, and has no co2 key at all.
+	jsonNoCO2 := writeReport(t, "c.json", `[`+
+		`{"time":"2025-03-01T10:02:00Z","group":"api","p_total_w":5,"interval_sec":1},`+
+		`{"time":"2025-03-01T10:02:00Z","group":"db","p_total_w":5,"interval_sec":1,"e_cum_j":1}]`)
+
+	// The last row of a file ends on a zero total (db was idle so far): the
+	// column is still present and kept.
+	rows, err := readReports([]string{withCO2}, "", "")
+	require.NoError(t, err)
+	api, apiCO2 := cums(rows, "api")
+	assert.Equal(t, []float64{10, 20}, api)
+	assert.Equal(t, []float64{0.1, 0.2}, apiCO2)
+
+	// co2_cum_g is empty in one file: cleared everywhere, energy is kept.
+	rows, err = readReports([]string{withCO2, noCO2}, "", "")
+	require.NoError(t, err)
+	api, apiCO2 = cums(rows, "api")
+	db, _ := cums(rows, "db")
+	assert.Equal(t, []float64{10, 20, 25}, api)
+	assert.Equal(t, []float64{5, 0, 3}, db)
+	assert.Equal(t, []float64{0, 0, 0}, apiCO2)
+
+	// e_cum_j is present in the JSON file (db carries it), co2 is not.
+	rows, err = readReports([]string{withCO2, jsonNoCO2}, "", "")
+	require.NoError(t, err)
+	api, apiCO2 = cums(rows, "api")
+	db, _ = cums(rows, "db")
+	assert.Equal(t, []float64{10, 20, 20}, api)
+	assert.Equal(t, []float64{5, 0, 1}, db)
+	assert.Equal(t, []float64{0, 0, 0}, apiCO2)
+}
+
+func TestReportWindow(t *testing.T) {
+	prev := time.Local
+	time.Local = time.UTC
+	t.Cleanup(func() { time.Local = prev })
+
+	at := func(s string) time.Time {
+		ts, err := time.Parse(time.RFC3339, s)
+		require.NoError(t, err)
+		return ts
+	}
+	files := [][]row{
+		{{At: at("2025-03-01T10:05:00Z")}, {At: at("2025-03-01T10:06:00Z")}},
+		{{At: at("2025-03-01T10:00:00Z")}, {At: at("2025-03-01T10:01:00Z")}},
+	}
+	cases := []struct {
+		from, to string
+		lo, hi   string // RFC 3339, "" for open
+		err      string
+	}{
+		{},
+		{from: "90s", lo: "2025-03-01T10:01:30Z"},
+		{to: "5m", hi: "2025-03-01T10:05:00Z"},
+		{from: "2025-03-01T10:02:00+01:00", lo: "2025-03-01T09:02:00Z"},
+		{from: "2025-03-01 10:03:00", to: "2025-03-01T10:04:00", lo: "2025-03-01T10:03:00Z", hi: "2025-03-01T10:04:00Z"},
+		{from: "10:00:30", to: "10:05:30", lo: "2025-03-01T10:00:30Z", hi: "2025-03-01T10:05:30Z"},
+		{from: "yesterday", err: `--from "yesterday": want an RFC 3339 time`},
+		{to: "10h61", err: `--to "10h61"`},
+		{from: "5m", to: "1m", err: "is not before --to"},
+		{from: "1m", to: "1m", err: "is not before --to"},
+	}
+	for _, tc := range cases {
+		name := tc.from + ".." + tc.to
+		lo, hi, err := reportWindow(files, tc.from, tc.to)
+		if tc.err != "" {
+			assert.ErrorContains(t, err, tc.err, name)
+			continue
+		}
+		require.NoError(t, err, name)
+		for _, b := range []struct {
+			got  time.Time
+			want string
+		}{{lo, tc.lo}, {hi, tc.hi}} {
+			if b.want == "" {
+				assert.True(t, b.got.IsZero(), name)
+			} else {
+				assert.True(t, at(b.want).Equal(b.got), "%s: got %s, want %s", name, b.got, b.want)
+			}
+		}
+	}
+
+	// Offsets and times of day need timestamps.
+	_, _, err := reportWindow([][]row{{{}}}, "1m", "")
+	assert.ErrorContains(t, err, "need timestamps")
+	_, _, err = reportWindow([][]row{{{}}}, "", "")
+	assert.NoError(t, err, "no window, no timestamps needed")
+}
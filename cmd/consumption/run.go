@@ -0,0 +1,311 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/signal"
+	"runtime"
+	"syscall"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"github.com/ja7ad/consumption/pkg/consumption"
+	"github.com/ja7ad/consumption/pkg/export"
+	"github.com/ja7ad/consumption/pkg/system/proc"
+	"github.com/ja7ad/consumption/pkg/system/util"
+	"github.com/ja7ad/consumption/pkg/trace"
+)
+
+// target is one measured set of PIDs (a --group, or the positional PIDs)
+// with its own accumulator and optional layers.
+type target struct {
+	proc.Group
+	acc    *consumption.Accumulator
+	lay    layers
+	exited bool
+}
+
+func run(ctx context.Context, fs *pflag.FlagSet, o opts, args []string) error {
+	groups, err := parseGroups(o.groups, args)
+	if err != nil {
+		return err
+	}
+	grouped := len(o.groups) > 0
+	if o.interval <= 0 {
+		return fmt.Errorf("interval must be > 0")
+	}
+	if o.ema < 0 || o.ema > 1 {
+		return fmt.Errorf("ema must be in [0,1]")
+	}
+	if grouped && o.record != "" {
+		return errors.New("--record does not support --group yet")
+	}
+	budget, err := o.budget()
+	if err != nil {
+		return err
+	}
+
+	// Build config & components
+	cfg, profileName, err := o.config(fs)
+	if err != nil {
+		return err
+	}
+	targets := make([]*target, len(groups))
+	for i, g := range groups {
+		lay, err := o.layers(cfg)
+		if err != nil {
+			return err
+		}
+		acc, err := consumption.NewChecked(&cfg)
+		if err != nil {
+			return err
+		}
+		targets[i] = &target{Group: g, acc: acc, lay: lay}
+	}
+
+	backend, err := proc.Select(o.collector)
+	if err != nil {
+		return fmt.Errorf("collector: %w", err)
+	}
+	col, err := backend.New(o.ema)
+	if err != nil {
+		return fmt.Errorf("collector: %w", err)
+	}
+	defer func() {
+		_ = col.Close()
+	}()
+	sample := func(dt float64) ([]proc.GroupSnapshot, error) {
+		snap, err := col.Sample(groups[0].PIDs, dt)
+		return []proc.GroupSnapshot{{Snapshot: snap, Err: err}}, err
+	}
+	if grouped {
+		gc, ok := col.(proc.GroupCollector)
+		if !ok {
+			return fmt.Errorf("collector %s cannot sample --group targets", backend.Name)
+		}
+		sample = func(dt float64) ([]proc.GroupSnapshot, error) { return gc.SampleGroups(groups, dt) }
+	}
+
+	// Print a little host header like the bash script vibe
+	started := time.Now()
+	host, kernel, cpus, mem := util.SystemSummary()
+	fmt.Printf(_console, host, kernel, cpus, mem, started.Format("2006-01-02 15:04:05"))
+
+	var pids []int
+	for _, g := range groups {
+		pids = append(pids, g.PIDs...)
+	}
+	names := util.PidNames(pids)
+
+	var rec *trace.Writer
+	if o.record != "" {
+		rec, err = trace.Create(o.record, trace.Meta{
+			ToolVersion: Version,
+			Host:        host,
+			Kernel:      kernel,
+			CPUs:        cpus,
+			Mem:         mem,
+			NumCPU:      runtime.NumCPU(),
+			Collector:   backend.Name,
+			Interval:    o.interval,
+			EMA:         o.ema,
+			PIDs:        pids,
+			Names:       names,
+			Started:     started,
+		})
+		if err != nil {
+			return fmt.Errorf("record: %w", err)
+		}
+		defer func() {
+			if err := rec.Close(); err != nil {
+				slog.Error("record", "err", err)
+			}
+		}()
+	}
+
+	out, err := openOutputs(o, profileName, targets[0].lay, grouped)
+	if err != nil {
+		return err
+	}
+
+	// Ctrl-C handling
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	ticker := time.NewTicker(o.interval)
+	defer ticker.Stop()
+
+	sampleN := 0
+	combined := consumption.NewSeries() // per-tick P_total summed over groups
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("interrupted")
+			goto END
+
+		case <-ticker.C:
+			dt := o.interval.Seconds()
+
+			snaps, err := sample(dt)
+			if err != nil {
+				if errorsIsAny(err, proc.ErrAllExited) {
+					fmt.Println("# All PIDs exited")
+					goto END
+				}
+				slog.Warn("sample error", "err", err)
+				continue
+			}
+
+			sampleN++
+			now := time.Now()
+			inWarmup := o.warmup > 0 && sampleN <= o.warmup
+
+			// Raw snapshots are recorded before warmup filtering so replay can re-decide.
+			if rec != nil {
+				if err := rec.Write(trace.Record{At: now, Warmup: inWarmup, Snapshot: snaps[0].Snapshot}); err != nil {
+					slog.Warn("record", "err", err)
+				}
+			}
+
+			// --- Warmup: skip printing and accumulation
+			if inWarmup {
+				continue
+			}
+
+			var tickW float64
+			for i, t := range targets {
+				if gs := snaps[i]; gs.Err != nil {
+					if errors.Is(gs.Err, proc.ErrAllExited) && !t.exited {
+						t.exited = true
+						fmt.Printf("# All PIDs of group %s exited\n", t.Name)
+					}
+					continue
+				}
+
+				// Only now mutate the accumulator
+				snap := snaps[i].Snapshot
+				res := t.acc.Apply(snap)
+				tickW += res.PTotal
+
+				r := newRow(now, snap, res, t.acc.EnergyCumJ())
+				r.Group = t.Name
+				t.lay.applyEnsemble(&r, snap)
+				out.write(r, t.lay)
+			}
+			combined.Add(tickW, dt)
+
+			// stop condition counts only post-warmup samples
+			if o.samples > 0 && (sampleN-o.warmup) >= o.samples {
+				goto END
+			}
+		}
+	}
+
+END:
+	sum := out.summary(targets[0].acc.Stats(), targets[0].lay)
+	if grouped {
+		parts := make([]groupSummary, len(targets))
+		stats := make([]consumption.Stats, len(targets))
+		for i, t := range targets {
+			stats[i] = t.acc.Stats()
+			parts[i] = groupSummary{Name: t.Name, PIDs: len(t.PIDs), reportSummary: out.summary(stats[i], t.lay)}
+		}
+		sum = out.combine(combineStats(stats, combined), parts)
+	}
+	out.close(sum, names)
+	printSummary(sampleN, o.interval.String(), sum)
+
+	return checkBudget(budget, sum.Stats.Energy, sum.Avg)
+}
+
+// combineStats sums the stats of groups measured over the same ticks. Average
+// powers are the summed energies over the longest group duration (groups whose
+// PIDs exited early count as drawing nothing afterwards); the spread is that
+// of the per-tick sum.
+func combineStats(groups []consumption.Stats, sum *consumption.Series) consumption.Stats {
+	var st consumption.Stats
+	for _, g := range groups {
+		st.Samples = max(st.Samples, g.Samples)
+		st.DurationSec = max(st.DurationSec, g.DurationSec)
+		st.Energy.CPU += g.Energy.CPU
+		st.Energy.Disk += g.Energy.Disk
+		st.Energy.RAM += g.Energy.RAM
+		st.Energy.IdleShare += g.Energy.IdleShare
+		st.Energy.Total += g.Energy.Total
+	}
+	if d := st.DurationSec; d > 0 {
+		st.Avg = consumption.Result{
+			PCPU:       st.Energy.CPU / d,
+			PDisk:      st.Energy.Disk / d,
+			PRAM:       st.Energy.RAM / d,
+			PIdleShare: st.Energy.IdleShare / d,
+			PTotal:     st.Energy.Total / d,
+		}
+	}
+	st.PTotal = sum.Spread()
+	return st
+}
+
+// parseGroups resolves --group NAME=SELECTOR[,SELECTOR...] definitions, or
+// the positional PIDs as a single unnamed group when there are none.
+func parseGroups(defs, args []string) ([]proc.Group, error) {
+	if len(defs) == 0 {
+		pids, err := util.ResolvePIDs(args)
+		if err != nil {
+			return nil, err
+		}
+		if len(pids) == 0 {
+			return nil, fmt.Errorf("no PIDs provided")
+		}
+		return []proc.Group{{PIDs: pids}}, nil
+	}
+	if len(args) > 0 {
+		return nil, errors.New("use either PIDs or --group, not both")
+	}
+
+	groups := make([]proc.Group, 0, len(defs))
+	for _, def := range defs {
+		t, err := export.ParseTarget(def)
+		if err != nil {
+			return nil, fmt.Errorf("--group: %w", err)
+		}
+		pids, err := util.ResolvePIDs(t.Selectors)
+		if err != nil {
+			return nil, fmt.Errorf("--group %s: %w", t.Name, err)
+		}
+		groups = append(groups, proc.Group{Name: t.Name, PIDs: pids})
+	}
+	if err := proc.ValidateGroups(groups); err != nil {
+		return nil, fmt.Errorf("--group: %w", err)
+	}
+	return groups, nil
+}
+
+func errorsIsAny(err error, targets ...error) bool {
+	for _, t := range targets {
+		if t != nil && (errors.Is(t, err) || (t != nil && errorsIs(err, t))) {
+			return true
+		}
+	}
+	return false
+}
+
+func errorsIs(err, target error) bool {
+	// Go 1.20+: errors.Is; inline to avoid import noise here
+	type causer interface{ Unwrap() error }
+	for {
+		if errors.Is(err, target) {
+			return true
+		}
+		x, ok := err.(causer)
+		if !ok {
+			return false
+		}
+		err = x.Unwrap()
+	}
+}
@@ -0,0 +1,272 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/ja7ad/consumption/pkg/export"
+	"github.com/ja7ad/consumption/pkg/system/proc"
+)
+
+type serveOpts struct {
+	listen  string
+	targets []string
+
+	// OTLP push
+	otlpEndpoint string
+	otlpHeaders  []string
+	otlpResource []string
+	otlpInterval time.Duration
+	otlpBatch    int
+}
+
+func serve() *cobra.Command {
+	var (
+		o opts
+		s serveOpts
+	)
+
+	cmd := &cobra.Command{
+		Use:   "serve --target NAME=SELECTOR[,SELECTOR...]...",
+		Short: "Sample targets continuously and export Prometheus or OTLP metrics",
+		Long: `Sample named targets until stopped and serve their estimates on /metrics
+in the Prometheus text format, push them to an OpenTelemetry receiver over
+OTLP/HTTP (JSON), or both.
+
+Selectors are re-resolved on every tick, so processes that start later or
+restart are followed: PID, A..B, name:COMM, pg:REGEX, or cgroup:PATH (a cgroup
+v2 path, relative to /sys/fs/cgroup, including its descendants). A process
+matching several targets counts for the first one only. The first tick only
+sets baselines.
+
+Metrics (per target unless noted):
+  consumption_energy_joules_total{component}   cpu, disk, ram, idle; they add up to the total
+  consumption_power_watts{component}           over the last tick
+  consumption_utilization_ratio                process CPU share of the VM [0..1]
+  consumption_io_bytes_total{direction}        read, write
+  consumption_target_processes, consumption_target_up,
+  consumption_target_resolve_failures_total
+  consumption_vm_utilization_ratio             host-wide
+  consumption_collector_*                      info, up, ticks, errors, tick duration, last tick time
+
+With --otlp-endpoint, every --otlp-interval the targets are collected and,
+once --otlp-batch collections are pending, posted as consumption.energy
+(cumulative sum, J), consumption.power (gauge, W) and consumption.utilization
+(gauge). Each target is a resource with host.name, os.type, os.version,
+consumption.cgroup.version and consumption.target; the gauges carry
+process.pid and process.executable.name when unambiguous. Failed requests (network errors,
+429, 502-504) are retried with exponential backoff in the background, without
+delaying collection. The standard
+OTEL_EXPORTER_OTLP_METRICS_ENDPOINT, OTEL_EXPORTER_OTLP_ENDPOINT,
+OTEL_EXPORTER_OTLP_HEADERS and OTEL_RESOURCE_ATTRIBUTES variables are used
+when the flags are not set. Pass --listen "" to push only.
+
+The default collector is procfs: cgroup2 moves the sampled processes into its
+own leaf cgroup, which would take them out of their service's cgroup.
+
+Examples:
+  consumption serve --target web=name:nginx --target db=cgroup:system.slice/postgresql.service
+  consumption serve --listen 127.0.0.1:9877 -i 5s --profile xeon --target api=pg:^api-
+  consumption serve --listen "" --otlp-endpoint http://otel:4318/v1/metrics --otlp-header "Authorization=Bearer $TOKEN" --target web=name:nginx`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runServe(cmd.Context(), cmd.Flags(), o, s)
+		},
+	}
+
+	cmd.Flags().StringVar(&s.listen, "listen", ":9877", "address to serve /metrics on")
+	cmd.Flags().StringVar(&s.otlpEndpoint, "otlp-endpoint", "", "OTLP/HTTP metrics URL to push to, e.g. http://localhost:4318/v1/metrics")
+	cmd.Flags().StringArrayVar(&s.otlpHeaders, "otlp-header", nil, "header KEY=VALUE sent with every OTLP request; repeatable")
+	cmd.Flags().StringArrayVar(&s.otlpResource, "otlp-resource", nil, "extra resource attribute KEY=VALUE; repeatable")
+	cmd.Flags().DurationVar(&s.otlpInterval, "otlp-interval", 30*time.Second, "how often to collect for OTLP")
+	cmd.Flags().IntVar(&s.otlpBatch, "otlp-batch", 1, "collections per OTLP request")
+	cmd.Flags().StringArrayVar(&s.targets, "target", nil, "named target NAME=SELECTOR[,SELECTOR...] (PID, A..B, name:COMM, pg:REGEX, cgroup:PATH); repeatable")
+	cmd.Flags().DurationVarP(&o.interval, "interval", "i", 10*time.Second, "sampling interval")
+	cmd.Flags().Float64Var(&o.ema, "ema", 0.5, "EMA alpha for VM utilization smoothing [0..1]")
+	cmd.Flags().StringVar(&o.collector, "collector", proc.ProcFS, "sampling backend (procfs leaves processes in their cgroups)")
+	addModelFlags(cmd.Flags(), &o)
+	return cmd
+}
+
+func runServe(ctx context.Context, fs *pflag.FlagSet, o opts, s serveOpts) error {
+	if len(s.targets) == 0 {
+		return errors.New("at least one --target is needed")
+	}
+	otlpCfg, err := s.otlp()
+	if err != nil {
+		return err
+	}
+	if s.listen == "" && otlpCfg == nil {
+		return errors.New("nothing to export: set --listen and/or --otlp-endpoint")
+	}
+	if o.interval <= 0 {
+		return fmt.Errorf("interval must be > 0")
+	}
+	if o.ema < 0 || o.ema > 1 {
+		return fmt.Errorf("ema must be in [0,1]")
+	}
+	cfg, profileName, err := o.config(fs)
+	if err != nil {
+		return err
+	}
+
+	targets := make([]export.Target, len(s.targets))
+	cgroupSel := false
+	for i, def := range s.targets {
+		if targets[i], err = export.ParseTarget(def); err != nil {
+			return fmt.Errorf("--target: %w", err)
+		}
+		for _, sel := range targets[i].Selectors {
+			cgroupSel = cgroupSel || strings.HasPrefix(sel, "cgroup:")
+		}
+	}
+
+	backend, err := proc.Select(o.collector)
+	if err != nil {
+		return fmt.Errorf("collector: %w", err)
+	}
+	if cgroupSel && backend.Name == proc.Cgroup2 {
+		return errors.New("cgroup: targets need --collector procfs (cgroup2 would move their processes)")
+	}
+	col, err := backend.New(o.ema)
+	if err != nil {
+		return fmt.Errorf("collector: %w", err)
+	}
+	defer func() {
+		_ = col.Close()
+	}()
+	m, err := export.NewMonitor(col, backend.Name, &cfg, targets)
+	if err != nil {
+		return err
+	}
+	var otlp *export.OTLPExporter
+	if otlpCfg != nil {
+		if otlp, err = export.NewOTLPExporter(m, *otlpCfg); err != nil {
+			return err
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if err := m.Tick(o.interval.Seconds()); err != nil {
+		slog.Warn("sample error", "err", err)
+	}
+	go func() { _ = m.Run(ctx, o.interval) }()
+	slog.Info("sampling", "targets", len(targets), "collector", backend.Name, "profile", profileName, "interval", o.interval)
+
+	pushed := make(chan error, 1)
+	if otlp != nil {
+		go func() { pushed <- otlp.Run(ctx, s.otlpInterval) }()
+		slog.Info("pushing OTLP metrics", "endpoint", otlpCfg.Endpoint, "every", s.otlpInterval, "batch", otlpCfg.BatchSize)
+	} else {
+		close(pushed)
+	}
+	if s.listen == "" {
+		<-ctx.Done()
+		slog.Info("interrupted")
+		return <-pushed
+	}
+
+	ln, err := net.Listen("tcp", s.listen)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m.Handler())
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, "consumption %s: metrics at /metrics\n", Version)
+	})
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	slog.Info("serving metrics", "addr", "http://"+ln.Addr().String()+"/metrics")
+	errc := make(chan error, 1)
+	go func() { errc <- srv.Serve(ln) }()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	slog.Info("interrupted")
+	shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return errors.Join(srv.Shutdown(shutdown), <-pushed)
+}
+
+// otlp builds the OTLP exporter config from the flags, falling back to the
+// standard OTEL_* environment variables; nil when no endpoint is set.
+func (s serveOpts) otlp() (*export.OTLPConfig, error) {
+	endpoint := s.otlpEndpoint
+	if endpoint == "" {
+		endpoint = os.Getenv("OTEL_EXPORTER_OTLP_METRICS_ENDPOINT")
+	}
+	if endpoint == "" {
+		if base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); base != "" {
+			endpoint = strings.TrimSuffix(base, "/") + "/v1/metrics"
+		}
+	}
+	if endpoint == "" {
+		return nil, nil
+	}
+	if s.otlpInterval <= 0 {
+		return nil, errors.New("otlp-interval must be > 0")
+	}
+
+	cfg := &export.OTLPConfig{Endpoint: endpoint, Version: Version, BatchSize: s.otlpBatch}
+	var err error
+	if cfg.Headers, err = kvsOrEnv("--otlp-header", s.otlpHeaders, "OTEL_EXPORTER_OTLP_HEADERS"); err != nil {
+		return nil, err
+	}
+	if cfg.Resource, err = kvsOrEnv("--otlp-resource", s.otlpResource, "OTEL_RESOURCE_ATTRIBUTES"); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// kvsOrEnv parses KEY=VALUE flag items or, when there are none, the
+// comma-separated, percent-encoded list in the environment variable env.
+func kvsOrEnv(flag string, items []string, env string) (map[string]string, error) {
+	encoded := false
+	if len(items) == 0 {
+		v := os.Getenv(env)
+		if v == "" {
+			return nil, nil
+		}
+		items, encoded, flag = strings.Split(v, ","), true, env
+	}
+	out := make(map[string]string, len(items))
+	for _, it := range items {
+		k, v, ok := strings.Cut(it, "=")
+		k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("%s %q: want KEY=VALUE", flag, it)
+		}
+		if encoded {
+			if u, err := url.PathUnescape(v); err == nil {
+				v = u
+			}
+		}
+		out[k] = v
+	}
+	return out, nil
+}
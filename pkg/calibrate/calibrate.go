@@ -0,0 +1,162 @@
+//go:build linux
+
+// Package calibrate fits the power model coefficients (consumption.Config)
+// against a reference power measurement.
+//
+// A calibration run executes controlled stress phases (idle, CPU at several
+// utilization levels, disk write, disk read, memory churn) while sampling the
+// calibrating process with a proc.Collector and reading a Reference (RAPL,
+// battery power_now, or a wattmeter CSV) over the same windows. Fit then
+// solves for the coefficients by least squares.
+package calibrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ja7ad/consumption/pkg/system/proc"
+)
+
+// Window is one sampling interval of a calibration run.
+type Window struct {
+	Phase    string
+	Level    float64
+	From, To time.Time
+	Snapshot proc.Snapshot
+	Watts    float64 // reference power over [From, To]
+}
+
+// Options configures Run.
+type Options struct {
+	Collector proc.Collector
+	PIDs      []int // processes generating the load (usually os.Getpid())
+	Reference Reference
+	Interval  time.Duration
+	// OnWindow, if set, is called for every kept window (after Watts is known
+	// for live references).
+	OnWindow func(Window)
+	// OnPhase, if set, is called when a phase starts.
+	OnPhase func(Phase)
+}
+
+// Run executes the phases in order and returns one Window per interval.
+// The first interval of each phase is discarded to let the load settle.
+// Offline references are resolved after all phases finish.
+func Run(ctx context.Context, phases []Phase, o Options) ([]Window, error) {
+	if o.Collector == nil || o.Reference == nil {
+		return nil, errors.New("calibrate: collector and reference are required")
+	}
+	if o.Interval <= 0 {
+		return nil, proc.ErrBadDt
+	}
+	if err := o.Reference.Start(); err != nil {
+		return nil, err
+	}
+
+	var out []Window
+	prev := time.Now()
+	for _, ph := range phases {
+		if o.OnPhase != nil {
+			o.OnPhase(ph)
+		}
+		pctx, cancel := context.WithTimeout(ctx, ph.Duration)
+		errc := make(chan error, 1)
+		if ph.Load != nil {
+			go func() { errc <- ph.Load(pctx, ph.Level) }()
+		} else {
+			close(errc)
+		}
+
+		ticker := time.NewTicker(o.Interval)
+		first := true
+	loop:
+		for {
+			select {
+			case <-pctx.Done():
+				break loop
+			case now := <-ticker.C:
+				snap, err := o.Collector.Sample(o.PIDs, now.Sub(prev).Seconds())
+				if err != nil {
+					ticker.Stop()
+					cancel()
+					return out, err
+				}
+				w := Window{Phase: ph.Name, Level: ph.Level, From: prev, To: now, Snapshot: snap}
+				if o.Reference.Live() {
+					if w.Watts, err = o.Reference.Power(prev, now); err != nil {
+						ticker.Stop()
+						cancel()
+						return out, fmt.Errorf("reference %s: %w", o.Reference.Name(), err)
+					}
+				}
+				prev = now
+				if first {
+					first = false
+					continue
+				}
+				out = append(out, w)
+				if o.OnWindow != nil && o.Reference.Live() {
+					o.OnWindow(w)
+				}
+			}
+		}
+		ticker.Stop()
+		cancel()
+		if err := <-errc; err != nil {
+			return out, err
+		}
+		if ctx.Err() != nil {
+			return out, ctx.Err()
+		}
+	}
+
+	if !o.Reference.Live() {
+		if err := ResolveOffline(out, o.Reference); err != nil {
+			return out, err
+		}
+		if o.OnWindow != nil {
+			for _, w := range out {
+				o.OnWindow(w)
+			}
+		}
+	}
+	return out, nil
+}
+
+// ResolveOffline fills Watts for every window from an offline reference.
+func ResolveOffline(ws []Window, ref Reference) error {
+	for i := range ws {
+		w, err := ref.Power(ws[i].From, ws[i].To)
+		if err != nil {
+			return fmt.Errorf("reference %s: %w", ref.Name(), err)
+		}
+		ws[i].Watts = w
+	}
+	return nil
+}
+
+// Samples converts windows into per-second fit samples, skipping empty windows.
+func Samples(ws []Window) []Sample {
+	out := make([]Sample, 0, len(ws))
+	for _, w := range ws {
+		dt := w.Snapshot.TimeSec
+		if dt <= 0 {
+			dt = w.To.Sub(w.From).Seconds()
+		}
+		if dt <= 0 {
+			continue
+		}
+		s := w.Snapshot
+		out = append(out, Sample{
+			UVm:        s.UVm,
+			ReadBps:    float64(s.ReadBytes) / dt,
+			WriteBps:   float64(s.WriteBytes) / dt,
+			RefaultBps: float64(s.RefaultBytes) / dt,
+			RSSBps:     float64(s.RSSChurnBytes) / dt,
+			Watts:      w.Watts,
+		})
+	}
+	return out
+}
@@ -0,0 +1,95 @@
+//go:build linux
+
+package calibrate
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ja7ad/consumption/pkg/consumption"
+	"github.com/ja7ad/consumption/pkg/system/proc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// levelCollector reports the current phase level as U_vm.
+type levelCollector struct{ level *float64 }
+
+func (c levelCollector) Sample(_ []int, dt float64) (proc.Snapshot, error) {
+	return proc.Snapshot{TimeSec: dt, UVm: *c.level, UProc: *c.level}, nil
+}
+func (levelCollector) Close() error { return nil }
+
+// linearRef returns 5 + 10·level watts.
+type linearRef struct{ level *float64 }
+
+func (linearRef) Name() string { return "fake" }
+func (linearRef) Live() bool   { return true }
+func (linearRef) Start() error { return nil }
+func (r linearRef) Power(_, _ time.Time) (float64, error) {
+	return 5 + 10**r.level, nil
+}
+
+func TestRun_PhasesAndFit(t *testing.T) {
+	var level float64
+	var phases []Phase
+	for _, l := range []float64{0, 0.3, 0.6, 1} {
+		phases = append(phases, Phase{Name: "synthetic", Level: l, Duration: 120 * time.Millisecond})
+	}
+
+	var seen []string
+	ws, err := Run(context.Background(), phases, Options{
+		Collector: levelCollector{&level},
+		PIDs:      []int{os.Getpid()},
+		Reference: linearRef{&level},
+		Interval:  20 * time.Millisecond,
+		OnPhase:   func(p Phase) { level = p.Level; seen = append(seen, p.Name) },
+	})
+	require.NoError(t, err)
+	assert.Len(t, seen, len(phases))
+	require.NotEmpty(t, ws)
+	for _, w := range ws {
+		assert.True(t, w.To.After(w.From))
+	}
+
+	res, err := Fit(Samples(ws), *defaultBase(), FitOptions{})
+	require.NoError(t, err)
+	assert.InDelta(t, 5, res.Config.PIdle, 1e-6)
+	assert.InDelta(t, 15, res.Config.PMax, 1e-6)
+}
+
+func TestRun_RealLoadsSmoke(t *testing.T) {
+	if testing.Short() {
+		t.Skip("short mode")
+	}
+	col, err := proc.NewCollectorByName(proc.ProcFS, 0)
+	require.NoError(t, err)
+	defer col.Close()
+
+	d := 150 * time.Millisecond
+	dir := t.TempDir()
+	phases := []Phase{
+		{Name: "cpu", Level: 0.5, Duration: d, Load: CPULoad(1)},
+		{Name: "disk-write", Level: 0.5, Duration: d, Load: DiskWriteLoad(dir)},
+		{Name: "disk-read", Level: 0.5, Duration: d, Load: DiskReadLoad(dir, 4<<20)},
+		{Name: "mem-churn", Level: 0.5, Duration: d, Load: MemChurnLoad(4 << 20)},
+	}
+	var level float64
+	ws, err := Run(context.Background(), phases, Options{
+		Collector: col,
+		PIDs:      []int{os.Getpid()},
+		Reference: linearRef{&level},
+		Interval:  50 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	assert.NotEmpty(t, ws)
+}
+
+func TestRun_RequiresCollectorAndReference(t *testing.T) {
+	_, err := Run(context.Background(), nil, Options{})
+	assert.Error(t, err)
+}
+
+func defaultBase() *consumption.Config { return consumption.DefaultConfig() }
@@ -0,0 +1,330 @@
+//go:build linux
+
+package calibrate
+
+import (
+	"errors"
+	"math"
+
+	"github.com/ja7ad/consumption/pkg/consumption"
+	"github.com/ja7ad/consumption/pkg/system/util"
+)
+
+// ErrTooFewSamples means the fit has fewer usable windows than unknowns.
+var ErrTooFewSamples = errors.New("calibrate: too few samples")
+
+// Coefficient names as reported in FitResult.Fitted/Fixed.
+const (
+	CoefPIdle   = "p_idle"
+	CoefPMax    = "p_max"
+	CoefGamma   = "gamma"
+	CoefER      = "er"
+	CoefEW      = "ew"
+	CoefEMemRef = "e_mem_ref"
+	CoefEMemRSS = "e_mem_rss"
+)
+
+// Sample is one observation for the fit: VM utilization and per-second byte
+// rates against the reference power over the same window.
+type Sample struct {
+	UVm        float64 // [0,1]
+	ReadBps    float64 // bytes/s
+	WriteBps   float64 // bytes/s
+	RefaultBps float64 // bytes/s
+	RSSBps     float64 // bytes/s
+	Watts      float64 // reference power (W)
+}
+
+// FitOptions bounds the gamma grid search. Zero values use defaults.
+type FitOptions struct {
+	GammaMin  float64 // default 0.5
+	GammaMax  float64 // default 3.0
+	GammaStep float64 // default 0.01
+}
+
+// FitResult is the fitted configuration plus goodness-of-fit statistics.
+type FitResult struct {
+	Config consumption.Config
+	Fitted []string // coefficients estimated from data
+	Fixed  []string // coefficients with no signal, kept from the base config
+	N      int
+	R2     float64
+	RMSE   float64
+	MAE    float64
+	MaxErr float64
+}
+
+// Fit estimates PIdle, PMax, Gamma, ER, EW, EMemRef and EMemRSS by least
+// squares against the reference power, using the system-level model
+//
+//	W ≈ PIdle + (PMax-PIdle)·U_vm^γ + ER·r + EW·w + EMemRef·ref + EMemRSS·rss
+//
+// where r, w, ref, rss are byte rates. γ is found by grid search; for each γ
+// the remaining coefficients are solved by non-negative linear least squares.
+// Byte-rate columns that never vary are left at their base values (Fixed).
+// Alpha is policy, not physics, and is copied from base.
+func Fit(samples []Sample, base consumption.Config, opt FitOptions) (FitResult, error) {
+	if opt.GammaMin <= 0 {
+		opt.GammaMin = 0.5
+	}
+	if opt.GammaMax <= opt.GammaMin {
+		opt.GammaMax = 3.0
+	}
+	if opt.GammaStep <= 0 {
+		opt.GammaStep = 0.01
+	}
+
+	// Column layout: 0=intercept(PIdle) 1=U^γ(PMax-PIdle) 2=r 3=w 4=ref 5=rss
+	names := []string{CoefPIdle, CoefPMax, CoefER, CoefEW, CoefEMemRef, CoefEMemRSS}
+	active := []bool{true, true, true, true, true, true}
+	byteCol := func(s Sample, j int) float64 {
+		switch j {
+		case 2:
+			return s.ReadBps
+		case 3:
+			return s.WriteBps
+		case 4:
+			return s.RefaultBps
+		default:
+			return s.RSSBps
+		}
+	}
+
+	var res FitResult
+	for j := 2; j < 6; j++ {
+		varies := false
+		for _, s := range samples {
+			if byteCol(s, j) > 0 {
+				varies = true
+				break
+			}
+		}
+		if !varies {
+			active[j] = false
+			res.Fixed = append(res.Fixed, names[j])
+		}
+	}
+	if !hasUtilSpread(samples) {
+		return FitResult{}, errors.New("calibrate: U_vm does not vary; cannot separate idle and dynamic power")
+	}
+
+	unknowns := 1 // gamma
+	for _, a := range active {
+		if a {
+			unknowns++
+		}
+	}
+	if len(samples) < unknowns+1 {
+		return FitResult{}, ErrTooFewSamples
+	}
+
+	design := func(gamma float64) [][]float64 {
+		X := make([][]float64, len(samples))
+		for i, s := range samples {
+			X[i] = []float64{1, util.Pow(util.Clamp01(s.UVm), gamma),
+				byteCol(s, 2), byteCol(s, 3), byteCol(s, 4), byteCol(s, 5)}
+		}
+		return X
+	}
+	y := make([]float64, len(samples))
+	for i, s := range samples {
+		y[i] = s.Watts
+	}
+
+	bestSSE := math.Inf(1)
+	var bestBeta []float64
+	var bestGamma float64
+	for g := opt.GammaMin; g <= opt.GammaMax+1e-9; g += opt.GammaStep {
+		X := design(g)
+		beta, ok := nnls(X, y, active)
+		if !ok {
+			continue
+		}
+		if sse := sumSq(residuals(X, y, beta)); sse < bestSSE {
+			bestSSE, bestBeta, bestGamma = sse, beta, g
+		}
+	}
+	if bestBeta == nil {
+		return FitResult{}, errors.New("calibrate: least squares failed (singular design)")
+	}
+
+	cfg := base
+	cfg.PIdle = bestBeta[0]
+	cfg.PMax = bestBeta[0] + bestBeta[1]
+	cfg.Gamma = bestGamma
+	if active[2] {
+		cfg.ER = bestBeta[2]
+	}
+	if active[3] {
+		cfg.EW = bestBeta[3]
+	}
+	if active[4] {
+		cfg.EMemRef = bestBeta[4]
+	}
+	if active[5] {
+		cfg.EMemRSS = bestBeta[5]
+	}
+	res.Config = cfg
+	res.Fitted = []string{CoefPIdle, CoefPMax, CoefGamma}
+	for j := 2; j < 6; j++ {
+		if active[j] {
+			res.Fitted = append(res.Fitted, names[j])
+		}
+	}
+
+	// Goodness of fit
+	r := residuals(design(bestGamma), y, bestBeta)
+	var mean float64
+	for _, v := range y {
+		mean += v
+	}
+	mean /= float64(len(y))
+	var sst, sae float64
+	for i, v := range y {
+		sst += (v - mean) * (v - mean)
+		sae += math.Abs(r[i])
+		res.MaxErr = math.Max(res.MaxErr, math.Abs(r[i]))
+	}
+	res.N = len(samples)
+	res.RMSE = math.Sqrt(bestSSE / float64(len(y)))
+	res.MAE = sae / float64(len(y))
+	if sst > 0 {
+		res.R2 = 1 - bestSSE/sst
+	}
+	return res, nil
+}
+
+func hasUtilSpread(samples []Sample) bool {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, s := range samples {
+		lo = math.Min(lo, s.UVm)
+		hi = math.Max(hi, s.UVm)
+	}
+	return hi-lo > 0.05
+}
+
+// nnls solves min ||Xβ - y|| subject to β ≥ 0 over the active columns by a
+// simple active-set loop: solve, drop the most negative coefficient, repeat.
+func nnls(X [][]float64, y []float64, active []bool) ([]float64, bool) {
+	act := append([]bool(nil), active...)
+	for {
+		beta, ok := lstsq(X, y, act)
+		if !ok {
+			return nil, false
+		}
+		worst, worstJ := 0.0, -1
+		for j, b := range beta {
+			if act[j] && b < worst {
+				worst, worstJ = b, j
+			}
+		}
+		if worstJ < 0 {
+			return beta, true
+		}
+		act[worstJ] = false
+	}
+}
+
+// lstsq solves the normal equations (XᵀX)β = Xᵀy restricted to active columns.
+// Columns are scaled to unit max to keep J/byte-sized coefficients well conditioned.
+func lstsq(X [][]float64, y []float64, active []bool) ([]float64, bool) {
+	var cols []int
+	for j, a := range active {
+		if a {
+			cols = append(cols, j)
+		}
+	}
+	k := len(cols)
+	if k == 0 {
+		return make([]float64, len(active)), true
+	}
+
+	scale := make([]float64, k)
+	for c, j := range cols {
+		for _, row := range X {
+			scale[c] = math.Max(scale[c], math.Abs(row[j]))
+		}
+		if scale[c] == 0 {
+			return nil, false
+		}
+	}
+
+	A := make([][]float64, k)
+	b := make([]float64, k)
+	for p := range A {
+		A[p] = make([]float64, k)
+	}
+	for i, row := range X {
+		for p, jp := range cols {
+			xp := row[jp] / scale[p]
+			b[p] += xp * y[i]
+			for q, jq := range cols {
+				A[p][q] += xp * row[jq] / scale[q]
+			}
+		}
+	}
+
+	sol, ok := solve(A, b)
+	if !ok {
+		return nil, false
+	}
+	beta := make([]float64, len(active))
+	for c, j := range cols {
+		beta[j] = sol[c] / scale[c]
+	}
+	return beta, true
+}
+
+// solve performs Gaussian elimination with partial pivoting on a small system.
+func solve(A [][]float64, b []float64) ([]float64, bool) {
+	n := len(b)
+	for col := 0; col < n; col++ {
+		piv := col
+		for r := col + 1; r < n; r++ {
+			if math.Abs(A[r][col]) > math.Abs(A[piv][col]) {
+				piv = r
+			}
+		}
+		if math.Abs(A[piv][col]) < 1e-12 {
+			return nil, false
+		}
+		A[col], A[piv] = A[piv], A[col]
+		b[col], b[piv] = b[piv], b[col]
+		for r := col + 1; r < n; r++ {
+			f := A[r][col] / A[col][col]
+			for c := col; c < n; c++ {
+				A[r][c] -= f * A[col][c]
+			}
+			b[r] -= f * b[col]
+		}
+	}
+	x := make([]float64, n)
+	for r := n - 1; r >= 0; r-- {
+		s := b[r]
+		for c := r + 1; c < n; c++ {
+			s -= A[r][c] * x[c]
+		}
+		x[r] = s / A[r][r]
+	}
+	return x, true
+}
+
+func residuals(X [][]float64, y, beta []float64) []float64 {
+	r := make([]float64, len(y))
+	for i, row := range X {
+		var p float64
+		for j, v := range row {
+			p += v * beta[j]
+		}
+		r[i] = y[i] - p
+	}
+	return r
+}
+
+func sumSq(v []float64) float64 {
+	var s float64
+	for _, x := range v {
+		s += x * x
+	}
+	return s
+}
@@ -0,0 +1,117 @@
+//go:build linux
+
+package calibrate
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/ja7ad/consumption/pkg/consumption"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func synth(cfg consumption.Config, noise float64, seed int64) []Sample {
+	rng := rand.New(rand.NewSource(seed))
+	var out []Sample
+	for i := 0; i < 60; i++ {
+		s := Sample{UVm: float64(i%11) / 10}
+		switch i % 4 {
+		case 1:
+			s.ReadBps = float64(20+i) * 1e6
+		case 2:
+			s.WriteBps = float64(10+i) * 1e6
+		case 3:
+			s.RefaultBps = float64(50+i) * 1e6
+			s.RSSBps = float64(30+(i*7)%13) * 1e6
+		}
+		s.Watts = cfg.PIdle + (cfg.PMax-cfg.PIdle)*math.Pow(s.UVm, cfg.Gamma) +
+			cfg.ER*s.ReadBps + cfg.EW*s.WriteBps + cfg.EMemRef*s.RefaultBps + cfg.EMemRSS*s.RSSBps +
+			noise*rng.NormFloat64()
+		out = append(out, s)
+	}
+	return out
+}
+
+func TestFit_RecoversKnownCoefficients_WithLogs(t *testing.T) {
+	truth := consumption.Config{PIdle: 7, PMax: 42, Gamma: 1.6, ER: 5e-8, EW: 1.2e-7, EMemRef: 2e-9, EMemRSS: 8e-10}
+	res, err := Fit(synth(truth, 0, 1), *consumption.DefaultConfig(), FitOptions{})
+	require.NoError(t, err)
+
+	assert.InDelta(t, truth.PIdle, res.Config.PIdle, 1e-3)
+	assert.InDelta(t, truth.PMax, res.Config.PMax, 1e-3)
+	assert.InDelta(t, truth.Gamma, res.Config.Gamma, 1e-6)
+	assert.InDelta(t, truth.ER, res.Config.ER, 1e-11)
+	assert.InDelta(t, truth.EW, res.Config.EW, 1e-11)
+	assert.InDelta(t, truth.EMemRef, res.Config.EMemRef, 1e-12)
+	assert.InDelta(t, truth.EMemRSS, res.Config.EMemRSS, 1e-12)
+	assert.InDelta(t, 1.0, res.R2, 1e-9)
+	assert.Empty(t, res.Fixed)
+
+	t.Logf("fit: %+v R2=%.6f RMSE=%.6f", res.Config, res.R2, res.RMSE)
+}
+
+func TestFit_NoisyDataStaysClose(t *testing.T) {
+	truth := consumption.Config{PIdle: 5, PMax: 20, Gamma: 1.3, ER: 4.8e-8, EW: 9.5e-8, EMemRef: 7e-10, EMemRSS: 3e-10}
+	res, err := Fit(synth(truth, 0.05, 2), *consumption.DefaultConfig(), FitOptions{})
+	require.NoError(t, err)
+
+	assert.InDelta(t, truth.PIdle, res.Config.PIdle, 0.2)
+	assert.InDelta(t, truth.PMax, res.Config.PMax, 0.5)
+	assert.InDelta(t, truth.Gamma, res.Config.Gamma, 0.1)
+	assert.Greater(t, res.R2, 0.99)
+	assert.Greater(t, res.RMSE, 0.0)
+	assert.GreaterOrEqual(t, res.MaxErr, res.MAE)
+}
+
+func TestFit_UnidentifiableColumnsKeptFromBase(t *testing.T) {
+	base := *consumption.DefaultConfig()
+	base.Alpha = 0.3
+	var samples []Sample
+	for i := 0; i <= 10; i++ {
+		u := float64(i) / 10
+		samples = append(samples, Sample{UVm: u, Watts: 4 + 10*u})
+	}
+	res, err := Fit(samples, base, FitOptions{})
+	require.NoError(t, err)
+
+	assert.InDelta(t, 4, res.Config.PIdle, 1e-6)
+	assert.InDelta(t, 14, res.Config.PMax, 1e-6)
+	assert.InDelta(t, 1.0, res.Config.Gamma, 1e-6)
+	assert.Equal(t, base.ER, res.Config.ER)
+	assert.Equal(t, base.EMemRSS, res.Config.EMemRSS)
+	assert.Equal(t, 0.3, res.Config.Alpha)
+	assert.ElementsMatch(t, []string{CoefER, CoefEW, CoefEMemRef, CoefEMemRSS}, res.Fixed)
+	assert.Equal(t, []string{CoefPIdle, CoefPMax, CoefGamma}, res.Fitted)
+}
+
+func TestFit_NonNegative(t *testing.T) {
+	// Reads coincide with lower power: unconstrained LS would give ER < 0.
+	var samples []Sample
+	for i := 0; i <= 20; i++ {
+		u := float64(i%11) / 10
+		s := Sample{UVm: u, Watts: 5 + 10*u}
+		if i%3 == 0 {
+			s.ReadBps = 1e8
+			s.Watts -= 1
+		}
+		samples = append(samples, s)
+	}
+	res, err := Fit(samples, *consumption.DefaultConfig(), FitOptions{})
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, res.Config.ER, 0.0)
+	assert.GreaterOrEqual(t, res.Config.PIdle, 0.0)
+}
+
+func TestFit_Errors(t *testing.T) {
+	_, err := Fit([]Sample{{UVm: 0.1, Watts: 1}, {UVm: 0.9, Watts: 2}}, consumption.Config{}, FitOptions{})
+	assert.ErrorIs(t, err, ErrTooFewSamples)
+
+	flat := make([]Sample, 10)
+	for i := range flat {
+		flat[i] = Sample{UVm: 0.5, Watts: 10}
+	}
+	_, err = Fit(flat, consumption.Config{}, FitOptions{})
+	assert.Error(t, err)
+}
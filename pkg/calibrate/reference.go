@@ -0,0 +1,327 @@
+//go:build linux
+
+package calibrate
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNoReference means no usable power reference was found on this host.
+var ErrNoReference = errors.New("calibrate: no power reference available")
+
+// Reference measures actual power to fit the model against.
+//
+// Live references (RAPL, battery) must be read at the end of each window, in
+// order; Power(from, to) returns the average watts over [from, to]. Offline
+// references (wattmeter CSV) may be queried at any time after the run.
+type Reference interface {
+	Name() string
+	Live() bool
+	// Start takes the baseline reading; called once before the first window.
+	Start() error
+	Power(from, to time.Time) (float64, error)
+}
+
+// NewReference parses a reference spec:
+//
+//	auto          RAPL if readable, else battery
+//	rapl          /sys/class/powercap intel-rapl package domains
+//	battery       /sys/class/power_supply/BAT*/power_now (must be discharging)
+//	csv:<path>    wattmeter log with time and watts columns
+func NewReference(spec string) (Reference, error) {
+	switch {
+	case spec == "" || spec == "auto":
+		if r, err := NewRAPL(""); err == nil {
+			return r, nil
+		}
+		if r, err := NewBattery(""); err == nil {
+			return r, nil
+		}
+		return nil, ErrNoReference
+	case spec == "rapl":
+		return NewRAPL("")
+	case spec == "battery":
+		return NewBattery("")
+	case strings.HasPrefix(spec, "csv:"):
+		return NewCSVReference(strings.TrimPrefix(spec, "csv:")), nil
+	default:
+		return nil, fmt.Errorf("calibrate: unknown reference %q (auto|rapl|battery|csv:<path>)", spec)
+	}
+}
+
+// ---- RAPL ----
+
+// RAPL reads cumulative package energy from the powercap interface.
+type RAPL struct {
+	domains []raplDomain
+	prev    []uint64
+}
+
+type raplDomain struct {
+	energy   string // .../energy_uj
+	maxRange uint64 // wrap-around range in µJ
+}
+
+// NewRAPL discovers top-level package domains (intel-rapl:N) under root
+// ("" = /sys/class/powercap). Sub-domains (core, dram) are excluded because
+// they are already included in the package counter.
+func NewRAPL(root string) (*RAPL, error) {
+	if root == "" {
+		root = "/sys/class/powercap"
+	}
+	dirs, _ := filepath.Glob(filepath.Join(root, "intel-rapl:*"))
+	r := &RAPL{}
+	for _, d := range dirs {
+		if strings.Count(filepath.Base(d), ":") != 1 {
+			continue
+		}
+		p := filepath.Join(d, "energy_uj")
+		if _, err := readUint(p); err != nil {
+			continue
+		}
+		mr, _ := readUint(filepath.Join(d, "max_energy_range_uj"))
+		r.domains = append(r.domains, raplDomain{energy: p, maxRange: mr})
+	}
+	if len(r.domains) == 0 {
+		return nil, fmt.Errorf("%w: no readable intel-rapl package domain under %s", ErrNoReference, root)
+	}
+	return r, nil
+}
+
+func (r *RAPL) Name() string { return "rapl" }
+func (r *RAPL) Live() bool   { return true }
+
+func (r *RAPL) Start() error {
+	r.prev = make([]uint64, len(r.domains))
+	for i, d := range r.domains {
+		v, err := readUint(d.energy)
+		if err != nil {
+			return err
+		}
+		r.prev[i] = v
+	}
+	return nil
+}
+
+func (r *RAPL) Power(from, to time.Time) (float64, error) {
+	dt := to.Sub(from).Seconds()
+	if dt <= 0 {
+		return 0, errors.New("calibrate: empty window")
+	}
+	var uj float64
+	for i, d := range r.domains {
+		v, err := readUint(d.energy)
+		if err != nil {
+			return 0, err
+		}
+		delta := v - r.prev[i]
+		if v < r.prev[i] { // counter wrapped
+			delta = d.maxRange - r.prev[i] + v
+		}
+		r.prev[i] = v
+		uj += float64(delta)
+	}
+	return uj / 1e6 / dt, nil
+}
+
+// ---- battery ----
+
+// Battery reads instantaneous discharge power from a power_supply node.
+// Readings are only meaningful while running on battery.
+type Battery struct {
+	dir string
+}
+
+// NewBattery uses dir, or the first /sys/class/power_supply/BAT* when empty.
+func NewBattery(dir string) (*Battery, error) {
+	if dir == "" {
+		m, _ := filepath.Glob("/sys/class/power_supply/BAT*")
+		if len(m) == 0 {
+			return nil, fmt.Errorf("%w: no battery under /sys/class/power_supply", ErrNoReference)
+		}
+		dir = m[0]
+	}
+	b := &Battery{dir: dir}
+	if _, err := b.read(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b *Battery) Name() string { return "battery" }
+func (b *Battery) Live() bool   { return true }
+
+func (b *Battery) Start() error {
+	if s, err := os.ReadFile(filepath.Join(b.dir, "status")); err == nil {
+		if st := strings.TrimSpace(string(s)); st != "Discharging" {
+			return fmt.Errorf("calibrate: battery status is %q; unplug AC to calibrate against it", st)
+		}
+	}
+	return nil
+}
+
+func (b *Battery) Power(_, _ time.Time) (float64, error) { return b.read() }
+
+// read prefers power_now (µW) and falls back to current_now·voltage_now (µA·µV).
+func (b *Battery) read() (float64, error) {
+	if v, err := readUint(filepath.Join(b.dir, "power_now")); err == nil {
+		return float64(v) / 1e6, nil
+	}
+	i, err1 := readUint(filepath.Join(b.dir, "current_now"))
+	u, err2 := readUint(filepath.Join(b.dir, "voltage_now"))
+	if err1 != nil || err2 != nil {
+		return 0, fmt.Errorf("%w: %s has neither power_now nor current_now/voltage_now", ErrNoReference, b.dir)
+	}
+	return float64(i) / 1e6 * float64(u) / 1e6, nil
+}
+
+// ---- wattmeter CSV ----
+
+// CSVReference averages readings from an external wattmeter log.
+//
+// The file needs a header with a time column (time|timestamp|ts) holding
+// RFC3339 or Unix seconds, and a power column (watts|w|power|power_w).
+// It is loaded lazily on the first Power call, so it may still be written
+// by the meter while calibration runs.
+type CSVReference struct {
+	path   string
+	points []wattPoint
+	loaded bool
+}
+
+type wattPoint struct {
+	at    time.Time
+	watts float64
+}
+
+func NewCSVReference(path string) *CSVReference { return &CSVReference{path: path} }
+
+func (c *CSVReference) Name() string { return "csv:" + c.path }
+func (c *CSVReference) Live() bool   { return false }
+func (c *CSVReference) Start() error { return nil }
+
+// Power averages all readings inside [from, to]; if none fall inside, the
+// nearest reading is used.
+func (c *CSVReference) Power(from, to time.Time) (float64, error) {
+	if !c.loaded {
+		f, err := os.Open(c.path)
+		if err != nil {
+			return 0, err
+		}
+		pts, err := parseWattCSV(f)
+		_ = f.Close()
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", c.path, err)
+		}
+		c.points, c.loaded = pts, true
+	}
+	if len(c.points) == 0 {
+		return 0, fmt.Errorf("%s: no readings", c.path)
+	}
+
+	i := sort.Search(len(c.points), func(i int) bool { return !c.points[i].at.Before(from) })
+	var sum float64
+	n := 0
+	for j := i; j < len(c.points) && !c.points[j].at.After(to); j++ {
+		sum += c.points[j].watts
+		n++
+	}
+	if n > 0 {
+		return sum / float64(n), nil
+	}
+
+	// nearest neighbour to the window midpoint
+	mid := from.Add(to.Sub(from) / 2)
+	best := c.points[0]
+	for _, p := range c.points[max(0, i-1):min(len(c.points), i+1)] {
+		if absDur(p.at.Sub(mid)) < absDur(best.at.Sub(mid)) {
+			best = p
+		}
+	}
+	if absDur(best.at.Sub(mid)) > 10*to.Sub(from) {
+		return 0, fmt.Errorf("%s: no reading near %s", c.path, mid.Format(time.RFC3339))
+	}
+	return best.watts, nil
+}
+
+func parseWattCSV(r io.Reader) ([]wattPoint, error) {
+	cr := csv.NewReader(bufio.NewReader(r))
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("csv header: %w", err)
+	}
+	iT, iW := -1, -1
+	for i, h := range header {
+		switch strings.ToLower(strings.TrimSpace(h)) {
+		case "time", "timestamp", "ts":
+			iT = i
+		case "watts", "w", "power", "power_w":
+			iW = i
+		}
+	}
+	if iT < 0 || iW < 0 {
+		return nil, errors.New("csv needs time and watts columns")
+	}
+
+	var pts []wattPoint
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if iT >= len(rec) || iW >= len(rec) {
+			continue
+		}
+		at, err := parseTime(strings.TrimSpace(rec[iT]))
+		if err != nil {
+			continue
+		}
+		w, err := strconv.ParseFloat(strings.TrimSpace(rec[iW]), 64)
+		if err != nil {
+			continue
+		}
+		pts = append(pts, wattPoint{at: at, watts: w})
+	}
+	sort.Slice(pts, func(i, j int) bool { return pts[i].at.Before(pts[j].at) })
+	return pts, nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	sec, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, int64(sec*1e9)), nil
+}
+
+func readUint(path string) (uint64, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+}
+
+func absDur(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
@@ -0,0 +1,122 @@
+//go:build linux
+
+package calibrate
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+}
+
+func TestRAPL_FakeSysfs(t *testing.T) {
+	root := t.TempDir()
+	pkg := filepath.Join(root, "intel-rapl:0")
+	writeFile(t, filepath.Join(pkg, "energy_uj"), "1000000\n")
+	writeFile(t, filepath.Join(pkg, "max_energy_range_uj"), "10000000\n")
+	// sub-domain must be ignored (already included in the package)
+	writeFile(t, filepath.Join(root, "intel-rapl:0:0", "energy_uj"), "999\n")
+
+	r, err := NewRAPL(root)
+	require.NoError(t, err)
+	require.Len(t, r.domains, 1)
+	require.NoError(t, r.Start())
+
+	t0 := time.Now()
+	writeFile(t, filepath.Join(pkg, "energy_uj"), "3000000\n") // +2 J
+	w, err := r.Power(t0, t0.Add(2*time.Second))
+	require.NoError(t, err)
+	assert.InDelta(t, 1.0, w, 1e-9)
+
+	writeFile(t, filepath.Join(pkg, "energy_uj"), "1000000\n") // wrapped: +8 J
+	w, err = r.Power(t0, t0.Add(4*time.Second))
+	require.NoError(t, err)
+	assert.InDelta(t, 2.0, w, 1e-9)
+
+	_, err = NewRAPL(t.TempDir())
+	assert.ErrorIs(t, err, ErrNoReference)
+}
+
+func TestBattery_FakeSysfs(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "power_now"), "12500000\n")
+	writeFile(t, filepath.Join(dir, "status"), "Discharging\n")
+
+	b, err := NewBattery(dir)
+	require.NoError(t, err)
+	require.NoError(t, b.Start())
+	w, err := b.Power(time.Time{}, time.Time{})
+	require.NoError(t, err)
+	assert.InDelta(t, 12.5, w, 1e-9)
+
+	writeFile(t, filepath.Join(dir, "status"), "Charging\n")
+	assert.Error(t, b.Start())
+
+	// current × voltage fallback
+	dir2 := t.TempDir()
+	writeFile(t, filepath.Join(dir2, "current_now"), "1000000\n")
+	writeFile(t, filepath.Join(dir2, "voltage_now"), "11000000\n")
+	b2, err := NewBattery(dir2)
+	require.NoError(t, err)
+	w, err = b2.Power(time.Time{}, time.Time{})
+	require.NoError(t, err)
+	assert.InDelta(t, 11.0, w, 1e-9)
+}
+
+func TestCSVReference_AveragesWindow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "meter.csv")
+	t0 := time.Date(2025, 5, 1, 10, 0, 0, 0, time.UTC)
+	var b strings.Builder
+	b.WriteString("timestamp,watts\n")
+	for i := 0; i < 10; i++ {
+		b.WriteString(t0.Add(time.Duration(i) * time.Second).Format(time.RFC3339))
+		b.WriteString(",")
+		b.WriteString([]string{"10", "20"}[i%2])
+		b.WriteString("\n")
+	}
+	b.WriteString("garbage,row\n")
+	writeFile(t, path, b.String())
+
+	ref, err := NewReference("csv:" + path)
+	require.NoError(t, err)
+	assert.False(t, ref.Live())
+
+	w, err := ref.Power(t0, t0.Add(3*time.Second)) // 10,20,10,20
+	require.NoError(t, err)
+	assert.InDelta(t, 15.0, w, 1e-9)
+
+	// between readings → nearest
+	w, err = ref.Power(t0.Add(1200*time.Millisecond), t0.Add(1400*time.Millisecond))
+	require.NoError(t, err)
+	assert.InDelta(t, 20.0, w, 1e-9)
+
+	// far outside the log
+	_, err = ref.Power(t0.Add(time.Hour), t0.Add(time.Hour+time.Second))
+	assert.Error(t, err)
+}
+
+func TestCSVReference_UnixSeconds(t *testing.T) {
+	pts, err := parseWattCSV(strings.NewReader("time,power_w\n1700000000.5,3.5\n1700000001,4.5\n"))
+	require.NoError(t, err)
+	require.Len(t, pts, 2)
+	assert.Equal(t, int64(1700000000), pts[0].at.Unix())
+	assert.Equal(t, 4.5, pts[1].watts)
+
+	_, err = parseWattCSV(strings.NewReader("a,b\n1,2\n"))
+	assert.Error(t, err)
+}
+
+func TestNewReference_Unknown(t *testing.T) {
+	_, err := NewReference("wattmeter9000")
+	assert.Error(t, err)
+}
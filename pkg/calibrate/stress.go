@@ -0,0 +1,190 @@
+//go:build linux
+
+package calibrate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Load generates a controlled workload at a duty-cycle level in [0,1] until
+// ctx is cancelled.
+type Load func(ctx context.Context, level float64) error
+
+// Phase is one calibration step: a workload held at a fixed level.
+type Phase struct {
+	Name     string
+	Level    float64
+	Duration time.Duration
+	Load     Load // nil means idle
+}
+
+const (
+	dutyPeriod = 50 * time.Millisecond
+	chunkSize  = 1 << 20
+)
+
+// DefaultPlan returns idle, CPU (25/50/75/100%), disk-write, disk-read and
+// memory-churn phases, each lasting d. Disk phases use scratch files in dir.
+func DefaultPlan(d time.Duration, dir string) []Phase {
+	cpu := CPULoad(runtime.NumCPU())
+	plan := []Phase{{Name: "idle", Duration: d}}
+	for _, lvl := range []float64{0.25, 0.5, 0.75, 1} {
+		plan = append(plan, Phase{Name: "cpu", Level: lvl, Duration: d, Load: cpu})
+	}
+	for _, lvl := range []float64{0.5, 1} {
+		plan = append(plan, Phase{Name: "disk-write", Level: lvl, Duration: d, Load: DiskWriteLoad(dir)})
+	}
+	for _, lvl := range []float64{0.5, 1} {
+		plan = append(plan, Phase{Name: "disk-read", Level: lvl, Duration: d, Load: DiskReadLoad(dir, 64<<20)})
+	}
+	for _, lvl := range []float64{0.5, 1} {
+		plan = append(plan, Phase{Name: "mem-churn", Level: lvl, Duration: d, Load: MemChurnLoad(32 << 20)})
+	}
+	return plan
+}
+
+// CPULoad spins `workers` goroutines, each busy for level×period of every period.
+func CPULoad(workers int) Load {
+	return func(ctx context.Context, level float64) error {
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				runtime.LockOSThread()
+				defer runtime.UnlockOSThread()
+				x := 1.0
+				dutyCycle(ctx, level, func() error {
+					for j := 0; j < 10000; j++ {
+						x = x*1.0000001 + 1e-9
+					}
+					return nil
+				})
+				_ = x
+			}()
+		}
+		wg.Wait()
+		return nil
+	}
+}
+
+// DiskWriteLoad writes and fsyncs 1 MiB chunks to a scratch file in dir.
+func DiskWriteLoad(dir string) Load {
+	return func(ctx context.Context, level float64) error {
+		f, err := os.CreateTemp(dir, "consumption-calib-w-*")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(f.Name())
+		defer f.Close()
+
+		buf := make([]byte, chunkSize)
+		for i := range buf {
+			buf[i] = byte(i * 31)
+		}
+		var written int64
+		return dutyCycle(ctx, level, func() error {
+			if written >= 256<<20 { // keep the file bounded
+				if _, err := f.Seek(0, io.SeekStart); err != nil {
+					return err
+				}
+				written = 0
+			}
+			n, err := f.Write(buf)
+			written += int64(n)
+			if err != nil {
+				return err
+			}
+			return f.Sync()
+		})
+	}
+}
+
+// DiskReadLoad creates a scratch file of size bytes in dir, then reads it in
+// 1 MiB chunks, dropping it from the page cache before every pass so reads
+// reach the device.
+func DiskReadLoad(dir string, size int64) Load {
+	return func(ctx context.Context, level float64) error {
+		f, err := os.CreateTemp(dir, "consumption-calib-r-*")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(f.Name())
+		defer f.Close()
+
+		buf := make([]byte, chunkSize)
+		for off := int64(0); off < size; off += chunkSize {
+			if _, err := f.Write(buf); err != nil {
+				return err
+			}
+		}
+		if err := f.Sync(); err != nil {
+			return err
+		}
+
+		fd := int(f.Fd())
+		var off int64
+		return dutyCycle(ctx, level, func() error {
+			if off == 0 {
+				_ = unix.Fadvise(fd, 0, 0, unix.FADV_DONTNEED)
+			}
+			n, err := f.ReadAt(buf, off)
+			off += int64(n)
+			if err == io.EOF || off >= size {
+				off = 0
+				return nil
+			}
+			return err
+		})
+	}
+}
+
+// MemChurnLoad repeatedly allocates, touches and releases a block of size
+// bytes, returning it to the OS so RSS rises and falls.
+func MemChurnLoad(size int) Load {
+	return func(ctx context.Context, level float64) error {
+		page := os.Getpagesize()
+		return dutyCycle(ctx, level, func() error {
+			b := make([]byte, size)
+			for i := 0; i < len(b); i += page {
+				b[i] = 1
+			}
+			debug.FreeOSMemory()
+			return nil
+		})
+	}
+}
+
+// dutyCycle calls work repeatedly for level×dutyPeriod, then sleeps for the
+// rest of the period, until ctx is done.
+func dutyCycle(ctx context.Context, level float64, work func() error) error {
+	if level <= 0 {
+		<-ctx.Done()
+		return nil
+	}
+	busy := time.Duration(level * float64(dutyPeriod))
+	for ctx.Err() == nil {
+		start := time.Now()
+		for time.Since(start) < busy && ctx.Err() == nil {
+			if err := work(); err != nil {
+				return fmt.Errorf("calibrate: load: %w", err)
+			}
+		}
+		if rest := dutyPeriod - time.Since(start); rest > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(rest):
+			}
+		}
+	}
+	return nil
+}
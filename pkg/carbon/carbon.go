@@ -0,0 +1,214 @@
+// Package carbon converts estimated energy into greenhouse-gas emissions
+// (grams of CO2-equivalent).
+//
+// For a tick ending at time t with energy E (J):
+//
+//	gCO2e = E / 3.6e6 · PUE · I(t)
+//
+// where I(t) is the grid carbon intensity in gCO2e/kWh at t (a Static value
+// or a Series loaded from CSV) and PUE is the data-centre power usage
+// effectiveness (1 = no facility overhead).
+package carbon
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ja7ad/consumption/pkg/types"
+)
+
+var (
+	ErrBadPUE    = errors.New("carbon: PUE must be >= 1")
+	ErrBadSeries = errors.New("carbon: invalid intensity series")
+)
+
+// Intensity reports grid carbon intensity in gCO2e/kWh at a point in time.
+type Intensity interface {
+	At(t time.Time) float64
+}
+
+// Static is a constant grid intensity in gCO2e/kWh.
+type Static float64
+
+// At implements Intensity.
+func (s Static) At(time.Time) float64 { return float64(s) }
+
+// Point is one sample of a Series.
+type Point struct {
+	At        time.Time
+	Intensity float64 // gCO2e/kWh
+}
+
+// Series is a step-wise intensity time series: each point applies from its
+// timestamp until the next one. Times before the first point use the first
+// value; times after the last use the last value.
+type Series struct {
+	points []Point
+}
+
+// NewSeries sorts points by time. At least one point is required and
+// intensities must be non-negative.
+func NewSeries(points []Point) (*Series, error) {
+	if len(points) == 0 {
+		return nil, fmt.Errorf("%w: no points", ErrBadSeries)
+	}
+	ps := slices.Clone(points)
+	slices.SortStableFunc(ps, func(a, b Point) int { return a.At.Compare(b.At) })
+	for _, p := range ps {
+		if p.Intensity < 0 {
+			return nil, fmt.Errorf("%w: negative intensity %g at %s", ErrBadSeries, p.Intensity, p.At.Format(time.RFC3339))
+		}
+	}
+	return &Series{points: ps}, nil
+}
+
+// At implements Intensity.
+func (s *Series) At(t time.Time) float64 {
+	// first index with At > t; the point before it is in effect
+	i, _ := slices.BinarySearchFunc(s.points, t, func(p Point, t time.Time) int {
+		if p.At.After(t) {
+			return 1
+		}
+		return -1
+	})
+	if i == 0 {
+		return s.points[0].Intensity
+	}
+	return s.points[i-1].Intensity
+}
+
+// Len returns the number of points.
+func (s *Series) Len() int { return len(s.points) }
+
+// LoadSeries reads an intensity CSV file; see ParseSeries.
+func LoadSeries(path string) (*Series, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	s, err := ParseSeries(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// ParseSeries reads a CSV with a header naming a time column ("time",
+// "timestamp", "datetime" or "from") and an intensity column ("intensity",
+// "gco2_kwh", "carbon_intensity" or "value"). Times are RFC3339 or Unix
+// seconds. Without a recognised header the first two columns are used.
+func ParseSeries(r io.Reader) (*Series, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	cr.Comment = '#'
+
+	recs, err := cr.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadSeries, err)
+	}
+	if len(recs) == 0 {
+		return nil, fmt.Errorf("%w: empty", ErrBadSeries)
+	}
+
+	ti, ii := 0, 1
+	if _, err := parseTime(recs[0][0]); err != nil {
+		ti, ii = -1, -1
+		for i, h := range recs[0] {
+			switch strings.ToLower(strings.TrimSpace(h)) {
+			case "time", "timestamp", "datetime", "from":
+				ti = i
+			case "intensity", "gco2_kwh", "carbon_intensity", "value":
+				ii = i
+			}
+		}
+		if ti < 0 || ii < 0 {
+			return nil, fmt.Errorf("%w: header needs time and intensity columns, got %v", ErrBadSeries, recs[0])
+		}
+		recs = recs[1:]
+	}
+
+	points := make([]Point, 0, len(recs))
+	for n, rec := range recs {
+		if ti >= len(rec) || ii >= len(rec) {
+			return nil, fmt.Errorf("%w: row %d has %d columns", ErrBadSeries, n+1, len(rec))
+		}
+		at, err := parseTime(strings.TrimSpace(rec[ti]))
+		if err != nil {
+			return nil, fmt.Errorf("%w: row %d: time %q", ErrBadSeries, n+1, rec[ti])
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(rec[ii]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: row %d: intensity %q", ErrBadSeries, n+1, rec[ii])
+		}
+		points = append(points, Point{At: at, Intensity: v})
+	}
+	return NewSeries(points)
+}
+
+// Tracker accumulates emissions tick by tick.
+type Tracker struct {
+	src    Intensity
+	pue    float64
+	totalG float64
+	totalJ float64
+}
+
+// NewTracker returns a tracker applying intensity src and the given PUE
+// (0 means 1).
+func NewTracker(src Intensity, pue float64) (*Tracker, error) {
+	if pue == 0 {
+		pue = 1
+	}
+	if pue < 1 {
+		return nil, fmt.Errorf("%w, got %g", ErrBadPUE, pue)
+	}
+	return &Tracker{src: src, pue: pue}, nil
+}
+
+// Grams converts energy spent at time at into gCO2e without accumulating.
+func (t *Tracker) Grams(at time.Time, joules float64) float64 {
+	return joules / types.JoulesPerKWh * t.pue * t.src.At(at)
+}
+
+// Add accounts a tick's energy (J) ending at time at and returns its gCO2e.
+func (t *Tracker) Add(at time.Time, joules float64) float64 {
+	g := t.Grams(at, joules)
+	t.totalG += g
+	t.totalJ += joules
+	return g
+}
+
+// TotalG returns the accumulated emissions in gCO2e.
+func (t *Tracker) TotalG() float64 { return t.totalG }
+
+// AvgIntensity returns the energy-weighted intensity seen so far in
+// gCO2e/kWh, including PUE.
+func (t *Tracker) AvgIntensity() float64 {
+	if t.totalJ <= 0 {
+		return 0
+	}
+	return t.totalG / (t.totalJ / types.JoulesPerKWh)
+}
+
+// PUE returns the multiplier in use.
+func (t *Tracker) PUE() float64 { return t.pue }
+
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	sec, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, int64(sec*1e9)), nil
+}
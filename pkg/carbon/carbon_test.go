@@ -0,0 +1,94 @@
+package carbon
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ja7ad/consumption/pkg/types"
+)
+
+func TestTracker_Static(t *testing.T) {
+	tr, err := NewTracker(Static(400), 1.5)
+	require.NoError(t, err)
+
+	// 3.6 MJ = 1 kWh → 400 g · 1.5
+	g := tr.Add(time.Now(), types.JoulesPerKWh)
+	assert.InDelta(t, 600.0, g, 1e-9)
+	tr.Add(time.Now(), types.JoulesPerKWh/2)
+	assert.InDelta(t, 900.0, tr.TotalG(), 1e-9)
+	assert.InDelta(t, 600.0, tr.AvgIntensity(), 1e-9)
+	assert.Equal(t, 1.5, tr.PUE())
+
+	tr, err = NewTracker(Static(400), 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, tr.PUE())
+
+	_, err = NewTracker(Static(400), 0.8)
+	assert.ErrorIs(t, err, ErrBadPUE)
+}
+
+func TestSeries_StepWise(t *testing.T) {
+	t0 := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s, err := NewSeries([]Point{
+		{At: t0.Add(time.Hour), Intensity: 200},
+		{At: t0, Intensity: 100},
+		{At: t0.Add(2 * time.Hour), Intensity: 300},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, s.Len())
+
+	assert.Equal(t, 100.0, s.At(t0.Add(-time.Hour)))
+	assert.Equal(t, 100.0, s.At(t0))
+	assert.Equal(t, 100.0, s.At(t0.Add(59*time.Minute)))
+	assert.Equal(t, 200.0, s.At(t0.Add(time.Hour)))
+	assert.Equal(t, 300.0, s.At(t0.Add(5*time.Hour)))
+
+	_, err = NewSeries(nil)
+	assert.ErrorIs(t, err, ErrBadSeries)
+	_, err = NewSeries([]Point{{At: t0, Intensity: -1}})
+	assert.ErrorIs(t, err, ErrBadSeries)
+}
+
+func TestParseSeries(t *testing.T) {
+	in := `# exported from the grid operator
+from,to,intensity
+2025-01-01T00:00:00Z,2025-01-01T00:30:00Z,120
+2025-01-01T00:30:00Z,2025-01-01T01:00:00Z,180
+`
+	s, err := ParseSeries(strings.NewReader(in))
+	require.NoError(t, err)
+	assert.Equal(t, 2, s.Len())
+	assert.Equal(t, 180.0, s.At(time.Date(2025, 1, 1, 0, 45, 0, 0, time.UTC)))
+
+	// headerless, Unix seconds
+	s, err = ParseSeries(strings.NewReader("1735689600,50\n1735693200,70\n"))
+	require.NoError(t, err)
+	assert.Equal(t, 70.0, s.At(time.Unix(1735693200+10, 0)))
+
+	for name, in := range map[string]string{
+		"empty":      "",
+		"no columns": "a,b\n1,2\n",
+		"bad value":  "time,intensity\n2025-01-01T00:00:00Z,x\n",
+		"bad time":   "time,intensity\nyesterday,5\n",
+	} {
+		_, err := ParseSeries(strings.NewReader(in))
+		assert.ErrorIs(t, err, ErrBadSeries, name)
+	}
+}
+
+func TestTracker_Series(t *testing.T) {
+	t0 := time.Unix(1_700_000_000, 0)
+	s, err := NewSeries([]Point{{At: t0, Intensity: 100}, {At: t0.Add(time.Minute), Intensity: 500}})
+	require.NoError(t, err)
+	tr, err := NewTracker(s, 1)
+	require.NoError(t, err)
+
+	tr.Add(t0.Add(30*time.Second), types.JoulesPerKWh)
+	tr.Add(t0.Add(90*time.Second), types.JoulesPerKWh)
+	assert.InDelta(t, 600.0, tr.TotalG(), 1e-9)
+	assert.InDelta(t, 300.0, tr.AvgIntensity(), 1e-9)
+}
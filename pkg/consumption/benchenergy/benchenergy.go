@@ -0,0 +1,283 @@
+//go:build linux
+
+// Package benchenergy reports the estimated energy per operation of Go
+// benchmarks, next to ns/op:
+//
+//	func BenchmarkEncode(b *testing.B) {
+//		m := benchenergy.Start(b, nil)
+//		for b.Loop() {
+//			encode(input)
+//		}
+//		m.Stop()
+//	}
+//
+// Start samples the benchmark process with a proc.Collector while the
+// benchmark goroutine sleeps (the idle baseline), then keeps sampling every
+// Interval until Stop. The samples go through a consumption.Accumulator;
+// Stop subtracts the baseline power over the loop duration and reports the
+// rest divided by b.N as "J/op". The baseline removes what the process
+// draws without doing the work (runtime background activity, the sampler
+// itself), so J/op reflects the measured code. It is measured once per
+// benchmark name, PIDs and Config and reused for the following b.N rounds.
+//
+// Estimates come from the model, not a meter: compare J/op of runs on the
+// same host with the same coefficients, e.g. with benchstat.
+package benchenergy
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ja7ad/consumption/pkg/consumption"
+	"github.com/ja7ad/consumption/pkg/system/proc"
+)
+
+// Defaults for Options.
+const (
+	DefaultInterval = 100 * time.Millisecond
+	DefaultBaseline = 500 * time.Millisecond
+)
+
+// Options configures Start. The zero value (or nil) samples the current
+// process with the procfs collector and the default model coefficients.
+type Options struct {
+	// Config holds the model coefficients; nil means the defaults.
+	Config *consumption.Config
+	// Collector samples PIDs; nil means a procfs collector owned (and
+	// closed) by the Meter. A caller-owned collector is not closed.
+	Collector proc.Collector
+	// PIDs are the processes to measure; empty means os.Getpid().
+	PIDs []int
+	// Interval is the sampling period; 0 means DefaultInterval.
+	Interval time.Duration
+	// Baseline is how long to measure the idle process; 0 means
+	// DefaultBaseline, negative disables baselining.
+	Baseline time.Duration
+}
+
+// Result is the energy of one timed loop.
+type Result struct {
+	N         int           // b.N
+	Duration  time.Duration // sampled loop time
+	Energy    float64       // J estimated over the loop
+	Idle      float64       // J the baseline power accounts for over Duration
+	BaselineW float64       // idle power of the process (W)
+	Stats     consumption.Stats
+}
+
+// Net returns the energy above the idle baseline, never negative.
+func (r Result) Net() float64 { return math.Max(r.Energy-r.Idle, 0) }
+
+// PerOp returns Net divided by N (J/op).
+func (r Result) PerOp() float64 {
+	if r.N <= 0 {
+		return 0
+	}
+	return r.Net() / float64(r.N)
+}
+
+// Meter samples one benchmark run between Start and Stop.
+type Meter struct {
+	b         *testing.B
+	col       proc.Collector
+	own       bool
+	pids      []int
+	interval  time.Duration
+	acc       *consumption.Accumulator
+	baselineW float64
+
+	done chan struct{}
+	wg   sync.WaitGroup
+	mu   sync.Mutex // guards last and err
+	last time.Time
+	err  error
+}
+
+// baselines caches the idle samples per benchmark; see baselineKey.
+var baselines = struct {
+	sync.Mutex
+	snaps map[string][]proc.Snapshot
+}{snaps: make(map[string][]proc.Snapshot)}
+
+// Start measures the idle baseline (first call per benchmark name, PIDs
+// and Config only),
+// resets the benchmark timer and starts sampling. Call Stop after the
+// timed loop. Setup failures end the benchmark with b.Fatal.
+func Start(b *testing.B, o *Options) *Meter {
+	b.Helper()
+	if o == nil {
+		o = &Options{}
+	}
+	acc, err := consumption.NewChecked(o.Config)
+	if err != nil {
+		b.Fatalf("benchenergy: %v", err)
+	}
+	m := &Meter{
+		b:        b,
+		col:      o.Collector,
+		pids:     o.PIDs,
+		interval: o.Interval,
+		acc:      acc,
+		done:     make(chan struct{}),
+	}
+	if len(m.pids) == 0 {
+		m.pids = []int{os.Getpid()}
+	}
+	if m.interval <= 0 {
+		m.interval = DefaultInterval
+	}
+	if m.col == nil {
+		col, err := proc.NewCollectorByName(proc.ProcFS, 0)
+		if err != nil {
+			b.Fatalf("benchenergy: %v", err)
+		}
+		m.col, m.own = col, true
+	}
+
+	// Deltas of the first sample reach back to the previous use of the
+	// collector (or the process start); drop them.
+	m.last = time.Now()
+	if _, err := m.sample(); err != nil {
+		m.close()
+		b.Fatalf("benchenergy: %v", err)
+	}
+
+	if o.Baseline >= 0 {
+		d := o.Baseline
+		if d == 0 {
+			d = DefaultBaseline
+		}
+		snaps, err := m.baseline(baselineKey(b.Name(), m.pids, o.Config), d)
+		if err != nil {
+			m.close()
+			b.Fatalf("benchenergy: baseline: %v", err)
+		}
+		idle := consumption.New(o.Config)
+		for _, s := range snaps {
+			idle.Apply(s)
+		}
+		m.baselineW = idle.Averages().PTotal
+	}
+
+	// Start the loop's accounting now, not at the end of the baseline.
+	if _, err := m.sample(); err != nil {
+		m.close()
+		b.Fatalf("benchenergy: %v", err)
+	}
+	m.wg.Add(1)
+	go m.loop()
+	b.ResetTimer()
+	return m
+}
+
+// Stop stops the timer and the sampler, takes a last sample covering the
+// rest of the loop and reports J/op. It returns the details.
+func (m *Meter) Stop() Result {
+	m.b.Helper()
+	m.b.StopTimer()
+	close(m.done)
+	m.wg.Wait()
+	snap, err := m.sample()
+	if err == nil {
+		m.acc.Apply(snap)
+	}
+	m.close()
+
+	m.mu.Lock()
+	if m.err != nil {
+		err = m.err
+	}
+	m.mu.Unlock()
+	if err != nil {
+		m.b.Fatalf("benchenergy: %v", err)
+	}
+
+	st := m.acc.Stats()
+	r := Result{
+		N:         m.b.N,
+		Duration:  time.Duration(st.DurationSec * float64(time.Second)),
+		Energy:    st.Energy.Total,
+		Idle:      m.baselineW * st.DurationSec,
+		BaselineW: m.baselineW,
+		Stats:     st,
+	}
+	m.b.ReportMetric(r.PerOp(), "J/op")
+	return r
+}
+
+// baselineKey identifies a cached baseline: the same benchmark name may be
+// measured for other PIDs or with other coefficients.
+func baselineKey(name string, pids []int, cfg *consumption.Config) string {
+	key := fmt.Sprintf("%s|%v", name, pids)
+	if cfg != nil {
+		key += fmt.Sprintf("|%+v", *cfg)
+	}
+	return key
+}
+
+// baseline returns the cached idle samples for key, measuring them for d
+// on first use.
+func (m *Meter) baseline(key string, d time.Duration) ([]proc.Snapshot, error) {
+	baselines.Lock()
+	defer baselines.Unlock()
+	if snaps, ok := baselines.snaps[key]; ok {
+		return snaps, nil
+	}
+	var snaps []proc.Snapshot
+	for end := time.Now().Add(d); time.Now().Before(end); {
+		time.Sleep(min(m.interval, time.Until(end)))
+		s, err := m.sample()
+		if err != nil {
+			return nil, err
+		}
+		snaps = append(snaps, s)
+	}
+	baselines.snaps[key] = snaps
+	return snaps, nil
+}
+
+func (m *Meter) loop() {
+	defer m.wg.Done()
+	t := time.NewTicker(m.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-t.C:
+			snap, err := m.sample()
+			if err != nil {
+				m.mu.Lock()
+				if m.err == nil {
+					m.err = err
+				}
+				m.mu.Unlock()
+				continue
+			}
+			m.acc.Apply(snap)
+		}
+	}
+}
+
+// sample reads the collector over the time since the previous sample.
+func (m *Meter) sample() (proc.Snapshot, error) {
+	m.mu.Lock()
+	now := time.Now()
+	dt := now.Sub(m.last).Seconds()
+	m.last = now
+	m.mu.Unlock()
+	if dt <= 0 {
+		dt = 1e-6
+	}
+	return m.col.Sample(m.pids, dt)
+}
+
+func (m *Meter) close() {
+	if m.own {
+		_ = m.col.Close()
+	}
+}
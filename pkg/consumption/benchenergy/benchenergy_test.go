@@ -0,0 +1,116 @@
+//go:build linux
+
+package benchenergy
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ja7ad/consumption/pkg/consumption"
+	"github.com/ja7ad/consumption/pkg/system/proc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// busyCollector reports U_proc 0.5 while busy is set, else 0.05, with the
+// VM at 0.6.
+type busyCollector struct {
+	busy   *atomic.Bool
+	closed atomic.Bool
+}
+
+func (c *busyCollector) Sample(_ []int, dt float64) (proc.Snapshot, error) {
+	u := 0.05
+	if c.busy.Load() {
+		u = 0.5
+	}
+	return proc.Snapshot{TimeSec: dt, UVm: 0.6, UProc: u}, nil
+}
+
+func (c *busyCollector) Close() error { c.closed.Store(true); return nil }
+
+func TestMeter(t *testing.T) {
+	var busy atomic.Bool
+	col := &busyCollector{busy: &busy}
+	var last Result
+	br := testing.Benchmark(func(b *testing.B) {
+		m := Start(b, &Options{Collector: col, Interval: 5 * time.Millisecond, Baseline: 20 * time.Millisecond})
+		busy.Store(true)
+		for b.Loop() {
+			time.Sleep(100 * time.Microsecond)
+		}
+		busy.Store(false)
+		last = m.Stop()
+	})
+
+	require.Positive(t, br.N)
+	assert.Equal(t, br.N, last.N)
+	assert.Positive(t, last.BaselineW)
+	assert.Positive(t, last.Energy)
+	assert.Greater(t, last.Energy, last.Idle, "busy loop draws more than idle")
+	assert.InDelta(t, last.BaselineW*last.Duration.Seconds(), last.Idle, 1e-9)
+	assert.InDelta(t, last.Net()/float64(last.N), br.Extra["J/op"], 1e-12)
+	assert.False(t, col.closed.Load(), "caller-owned collector stays open")
+}
+
+func TestMeter_IdleLoopNetsZero(t *testing.T) {
+	var busy atomic.Bool
+	col := &busyCollector{busy: &busy}
+	br := testing.Benchmark(func(b *testing.B) {
+		m := Start(b, &Options{Collector: col, Interval: 5 * time.Millisecond, Baseline: 20 * time.Millisecond})
+		for b.Loop() {
+			time.Sleep(100 * time.Microsecond)
+		}
+		r := m.Stop()
+		assert.InDelta(b, r.Idle, r.Energy, 1e-6*max(r.Energy, 1))
+	})
+	assert.InDelta(t, 0, br.Extra["J/op"], 1e-9)
+}
+
+func TestMeter_NoBaseline(t *testing.T) {
+	var busy atomic.Bool
+	busy.Store(true)
+	col := &busyCollector{busy: &busy}
+	br := testing.Benchmark(func(b *testing.B) {
+		m := Start(b, &Options{Collector: col, Interval: 5 * time.Millisecond, Baseline: -1})
+		for b.Loop() {
+			time.Sleep(100 * time.Microsecond)
+		}
+		r := m.Stop()
+		assert.Zero(b, r.BaselineW)
+		assert.Equal(b, r.Energy, r.Net())
+	})
+	assert.Positive(t, br.Extra["J/op"])
+}
+
+func TestResult_PerOp(t *testing.T) {
+	r := Result{N: 4, Energy: 10, Idle: 2}
+	assert.Equal(t, 8.0, r.Net())
+	assert.Equal(t, 2.0, r.PerOp())
+
+	assert.Zero(t, Result{N: 4, Energy: 1, Idle: 2}.Net(), "net is never negative")
+	assert.Zero(t, Result{Energy: 1}.PerOp())
+}
+
+func TestBaselineKey(t *testing.T) {
+	cfg := &consumption.Config{PMax: 30}
+	k := baselineKey("BenchmarkX", []int{1}, cfg)
+	assert.Equal(t, k, baselineKey("BenchmarkX", []int{1}, &consumption.Config{PMax: 30}))
+	assert.NotEqual(t, k, baselineKey("BenchmarkX", []int{2}, cfg))
+	assert.NotEqual(t, k, baselineKey("BenchmarkX", []int{1}, &consumption.Config{PMax: 40}))
+	assert.NotEqual(t, k, baselineKey("BenchmarkX", []int{1}, nil))
+	assert.NotEqual(t, k, baselineKey("BenchmarkY", []int{1}, cfg))
+}
+
+func BenchmarkSpin(b *testing.B) {
+	m := Start(b, nil)
+	var x uint64
+	for b.Loop() {
+		for i := range 10000 {
+			x += uint64(i) * x
+		}
+	}
+	m.Stop()
+	_ = x
+}
@@ -0,0 +1,125 @@
+//go:build linux
+
+package consumption
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ja7ad/consumption/pkg/types"
+)
+
+// Budget caps a run's energy and average power, in total and per component.
+// Zero limits are not checked.
+type Budget struct {
+	Energy   Energy // J; Total and per component
+	AvgPower Result // W; PTotal and per component
+}
+
+// Breach is one limit a run exceeded.
+type Breach struct {
+	Metric   string // e.g. "energy", "cpu energy", "avg power", "ram avg power"
+	Unit     string // "J" or "W"
+	Measured float64
+	Limit    float64
+}
+
+func (b Breach) String() string {
+	return fmt.Sprintf("%s %.3f %s exceeds budget %.3f %s (+%.1f%%)",
+		b.Metric, b.Measured, b.Unit, b.Limit, b.Unit, 100*(b.Measured/b.Limit-1))
+}
+
+// IsZero reports whether no limit is set.
+func (b Budget) IsZero() bool { return b == Budget{} }
+
+// Check compares a run's energy and time-weighted average power with the
+// budget and returns every exceeded limit, totals first.
+func (b Budget) Check(energy Energy, avg Result) []Breach {
+	var out []Breach
+	check := func(metric, unit string, measured, limit float64) {
+		if limit > 0 && measured > limit {
+			out = append(out, Breach{Metric: metric, Unit: unit, Measured: measured, Limit: limit})
+		}
+	}
+	check("energy", "J", energy.Total, b.Energy.Total)
+	check("avg power", "W", avg.PTotal, b.AvgPower.PTotal)
+	check("cpu energy", "J", energy.CPU, b.Energy.CPU)
+	check("cpu avg power", "W", avg.PCPU, b.AvgPower.PCPU)
+	check("disk energy", "J", energy.Disk, b.Energy.Disk)
+	check("disk avg power", "W", avg.PDisk, b.AvgPower.PDisk)
+	check("ram energy", "J", energy.RAM, b.Energy.RAM)
+	check("ram avg power", "W", avg.PRAM, b.AvgPower.PRAM)
+	return out
+}
+
+// energyUnits and powerUnits map unit suffixes (any case) to Joules and
+// Watts.
+var (
+	energyUnits = map[string]float64{"j": 1, "kj": 1e3, "wh": types.JoulesPerWh, "kwh": types.JoulesPerKWh}
+	powerUnits  = map[string]float64{"w": 1, "mw": 1e-3, "kw": 1e3}
+)
+
+// ParseEnergy parses an energy such as "500J", "1.5kJ", "2Wh" or "0.1kWh"
+// into Joules; a bare number is Joules.
+func ParseEnergy(s string) (float64, error) {
+	v, unit, err := parseQuantity(s)
+	if err != nil || unit == "" {
+		return v, err
+	}
+	f, ok := energyUnits[strings.ToLower(unit)]
+	if !ok {
+		return 0, fmt.Errorf("energy %q: unknown unit %q (use J, kJ, Wh or kWh)", s, unit)
+	}
+	return v * f, nil
+}
+
+// ParsePower parses a power such as "3W", "500mW" or "1.2kW" into Watts; a
+// bare number is Watts.
+func ParsePower(s string) (float64, error) {
+	v, unit, err := parseQuantity(s)
+	if err != nil || unit == "" {
+		return v, err
+	}
+	f, ok := powerUnits[strings.ToLower(unit)]
+	if !ok {
+		return 0, fmt.Errorf("power %q: unknown unit %q (use W, mW or kW)", s, unit)
+	}
+	return v * f, nil
+}
+
+// ParseLimit parses either an energy or a power and reports which one it
+// is from the unit; a bare number is rejected as ambiguous.
+func ParseLimit(s string) (v float64, energy bool, err error) {
+	_, unit, err := parseQuantity(s)
+	if err != nil {
+		return 0, false, err
+	}
+	if strings.HasSuffix(strings.ToLower(unit), "w") {
+		v, err = ParsePower(s)
+		return v, false, err
+	}
+	if unit == "" {
+		return 0, false, fmt.Errorf("limit %q: add a unit (J, kJ, Wh, kWh for energy; W, mW, kW for power)", s)
+	}
+	v, err = ParseEnergy(s)
+	return v, true, err
+}
+
+// parseQuantity splits "1.5 kWh" into 1.5 and "kWh". The number must be
+// positive.
+func parseQuantity(s string) (float64, string, error) {
+	t := strings.TrimSpace(s)
+	i := strings.IndexFunc(t, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.' && r != '+' && r != '-' && r != 'e' && r != 'E'
+	})
+	num, unit := t, ""
+	if i >= 0 {
+		num, unit = t[:i], strings.TrimSpace(t[i:])
+	}
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil || v <= 0 {
+		return 0, "", fmt.Errorf("%q: want a positive number with an optional unit", s)
+	}
+	return v, unit, nil
+}
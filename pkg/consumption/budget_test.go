@@ -0,0 +1,62 @@
+//go:build linux
+
+package consumption
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEnergyAndPower(t *testing.T) {
+	for in, want := range map[string]float64{"500J": 500, "500": 500, "1.5 kJ": 1500, "2Wh": 7200, "0.1kWh": 360000, "1e3j": 1000} {
+		got, err := ParseEnergy(in)
+		require.NoError(t, err, in)
+		assert.InDelta(t, want, got, 1e-9, in)
+	}
+	for in, want := range map[string]float64{"3W": 3, "3": 3, "500mW": 0.5, "1.2kw": 1200} {
+		got, err := ParsePower(in)
+		require.NoError(t, err, in)
+		assert.InDelta(t, want, got, 1e-9, in)
+	}
+	for _, bad := range []string{"", "J", "-1J", "0", "5 furlongs", "3W"} {
+		_, err := ParseEnergy(bad)
+		assert.Error(t, err, bad)
+	}
+	_, err := ParsePower("2Wh")
+	assert.ErrorContains(t, err, `unknown unit "Wh"`)
+}
+
+func TestParseLimit(t *testing.T) {
+	v, energy, err := ParseLimit("200J")
+	require.NoError(t, err)
+	assert.True(t, energy)
+	assert.Equal(t, 200.0, v)
+
+	v, energy, err = ParseLimit("250mW")
+	require.NoError(t, err)
+	assert.False(t, energy)
+	assert.Equal(t, 0.25, v)
+
+	_, _, err = ParseLimit("200")
+	assert.ErrorContains(t, err, "add a unit")
+}
+
+func TestBudget_Check(t *testing.T) {
+	assert.True(t, Budget{}.IsZero())
+	energy := Energy{CPU: 400, Disk: 50, RAM: 10, Total: 460}
+	avg := Result{PCPU: 2.5, PDisk: 0.3, PRAM: 0.1, PTotal: 2.9}
+
+	assert.Empty(t, Budget{}.Check(energy, avg))
+	assert.Empty(t, Budget{Energy: Energy{Total: 460}, AvgPower: Result{PTotal: 3}}.Check(energy, avg), "limits are inclusive")
+
+	b := Budget{Energy: Energy{Total: 400, Disk: 100}, AvgPower: Result{PTotal: 3, PCPU: 2}}
+	assert.False(t, b.IsZero())
+	got := b.Check(energy, avg)
+	assert.Equal(t, []Breach{
+		{Metric: "energy", Unit: "J", Measured: 460, Limit: 400},
+		{Metric: "cpu avg power", Unit: "W", Measured: 2.5, Limit: 2},
+	}, got)
+	assert.Equal(t, "energy 460.000 J exceeds budget 400.000 J (+15.0%)", got[0].String())
+}
@@ -0,0 +1,169 @@
+//go:build linux
+
+package consumption
+
+import (
+	"errors"
+	"math"
+)
+
+// ErrTooFewSamples is returned by WelchTest when a side has fewer than two
+// samples.
+var ErrTooFewSamples = errors.New("consumption: need at least 2 samples per side")
+
+// Welch is the result of Welch's unequal-variance t-test of sample B
+// against sample A (e.g. per-tick power of a head run against a base run).
+type Welch struct {
+	NA, NB       int
+	MeanA, MeanB float64
+	SDA, SDB     float64 // sample standard deviations
+	Diff         float64 // MeanB - MeanA
+	T            float64
+	DF           float64 // Welch–Satterthwaite degrees of freedom
+	P            float64 // two-sided p-value
+	Conf         float64 // confidence level of CILow..CIHigh
+	CILow        float64 // confidence interval of Diff
+	CIHigh       float64
+	G            float64 // Hedges' g: Diff over the pooled SD, small-sample corrected
+}
+
+// WelchTest compares the means of a and b. conf is the confidence level of
+// the interval for the difference (e.g. 0.95). When both samples are
+// constant, T, G and the interval are 0 for equal means and infinite
+// otherwise, with P 1 or 0.
+func WelchTest(a, b []float64, conf float64) (Welch, error) {
+	if len(a) < 2 || len(b) < 2 {
+		return Welch{}, ErrTooFewSamples
+	}
+	ma, va := meanVar(a)
+	mb, vb := meanVar(b)
+	na, nb := float64(len(a)), float64(len(b))
+	w := Welch{
+		NA: len(a), NB: len(b),
+		MeanA: ma, MeanB: mb,
+		SDA: math.Sqrt(va), SDB: math.Sqrt(vb),
+		Diff: mb - ma,
+		Conf: conf,
+	}
+
+	sa, sb := va/na, vb/nb
+	se := math.Sqrt(sa + sb)
+	pooled := math.Sqrt(((na-1)*va + (nb-1)*vb) / (na + nb - 2))
+	if se == 0 {
+		w.DF = na + nb - 2
+		w.P = 1
+		w.CILow, w.CIHigh = w.Diff, w.Diff
+		if w.Diff != 0 {
+			w.T = math.Copysign(math.Inf(1), w.Diff)
+			w.G = w.T
+			w.P = 0
+		}
+		return w, nil
+	}
+	w.T = w.Diff / se
+	w.DF = (sa + sb) * (sa + sb) / (sa*sa/(na-1) + sb*sb/(nb-1))
+	w.P = 2 * studentTail(math.Abs(w.T), w.DF)
+	q := studentQuantile(1-(1-conf)/2, w.DF)
+	w.CILow, w.CIHigh = w.Diff-q*se, w.Diff+q*se
+	w.G = w.Diff / pooled * (1 - 3/(4*(na+nb)-9))
+	return w, nil
+}
+
+// Magnitude labels |G| by Cohen's conventions: negligible (< 0.2), small
+// (< 0.5), medium (< 0.8) or large.
+func (w Welch) Magnitude() string {
+	switch g := math.Abs(w.G); {
+	case g < 0.2:
+		return "negligible"
+	case g < 0.5:
+		return "small"
+	case g < 0.8:
+		return "medium"
+	}
+	return "large"
+}
+
+// meanVar returns the mean and the unbiased sample variance of xs.
+func meanVar(xs []float64) (mean, variance float64) {
+	var m2 float64
+	for i, x := range xs {
+		d := x - mean
+		mean += d / float64(i+1)
+		m2 += d * (x - mean)
+	}
+	return mean, m2 / float64(len(xs)-1)
+}
+
+// studentTail returns P(T > t) for t >= 0 and Student's t with df degrees
+// of freedom.
+func studentTail(t, df float64) float64 {
+	return 0.5 * regIncBeta(df/2, 0.5, df/(df+t*t))
+}
+
+// studentQuantile returns the p-quantile (p > 0.5) of Student's t by
+// bisection on studentTail.
+func studentQuantile(p, df float64) float64 {
+	lo, hi := 0.0, 1.0
+	for studentTail(hi, df) > 1-p {
+		hi *= 2
+	}
+	for range 100 {
+		mid := (lo + hi) / 2
+		if studentTail(mid, df) > 1-p {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return (lo + hi) / 2
+}
+
+// regIncBeta is the regularized incomplete beta function I_x(a, b),
+// evaluated with Lentz's continued fraction.
+func regIncBeta(a, b, x float64) float64 {
+	switch {
+	case x <= 0:
+		return 0
+	case x >= 1:
+		return 1
+	case x > (a+1)/(a+b+2):
+		return 1 - regIncBeta(b, a, 1-x)
+	}
+	la, _ := math.Lgamma(a)
+	lb, _ := math.Lgamma(b)
+	lab, _ := math.Lgamma(a + b)
+	front := math.Exp(lab - la - lb + a*math.Log(x) + b*math.Log(1-x))
+
+	const tiny = 1e-300
+	c, d := 1.0, 1-(a+b)*x/(a+1)
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	f := d
+	for m := 1; m <= 300; m++ {
+		fm := float64(m)
+		for i := range 2 {
+			var num float64
+			if i == 0 {
+				num = fm * (b - fm) * x / ((a + 2*fm - 1) * (a + 2*fm))
+			} else {
+				num = -(a + fm) * (a + b + fm) * x / ((a + 2*fm) * (a + 2*fm + 1))
+			}
+			d = 1 + num*d
+			if math.Abs(d) < tiny {
+				d = tiny
+			}
+			c = 1 + num/c
+			if math.Abs(c) < tiny {
+				c = tiny
+			}
+			d = 1 / d
+			f *= c * d
+		}
+		if math.Abs(c*d-1) < 1e-15 {
+			break
+		}
+	}
+	return front * f / a
+}
@@ -0,0 +1,74 @@
+//go:build linux
+
+package consumption
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStudentT(t *testing.T) {
+	// closed forms: df=1 is Cauchy, df=2 has P(T>t) = 1/2 - t/(2·sqrt(t²+2))
+	assert.InDelta(t, 0.25, studentTail(1, 1), 1e-12)
+	assert.InDelta(t, 0.5-2/(2*math.Sqrt(6)), studentTail(2, 2), 1e-12)
+	assert.InDelta(t, 0.5, studentTail(0, 7), 1e-12)
+	assert.InDelta(t, 0.07338803477, 2*studentTail(2, 10), 1e-9)
+
+	assert.InDelta(t, 12.7062047, studentQuantile(0.975, 1), 1e-6)
+	assert.InDelta(t, 2.228138852, studentQuantile(0.975, 10), 1e-8)
+	assert.InDelta(t, 1.959963985, studentQuantile(0.975, 1e7), 1e-5)
+}
+
+func TestWelchTest(t *testing.T) {
+	w, err := WelchTest([]float64{1, 2, 3, 4}, []float64{2, 4, 6, 8}, 0.95)
+	require.NoError(t, err)
+	assert.Equal(t, 2.5, w.MeanA)
+	assert.Equal(t, 5.0, w.MeanB)
+	assert.Equal(t, 2.5, w.Diff)
+	assert.InDelta(t, math.Sqrt(3), w.T, 1e-12)
+	assert.InDelta(t, 4.411764705882, w.DF, 1e-9)
+	assert.InDelta(t, 0.151580505, w.P, 1e-7)
+	assert.Less(t, w.CILow, 0.0, "not significant: the interval spans 0")
+	assert.InDelta(t, w.Diff, (w.CILow+w.CIHigh)/2, 1e-12)
+	assert.InDelta(t, 2.5/math.Sqrt((3*5.0/3+3*20.0/3)/6)*(1-3/23.0), w.G, 1e-12)
+	assert.Equal(t, "large", w.Magnitude())
+
+	// swapping sides flips the sign only
+	r, err := WelchTest([]float64{2, 4, 6, 8}, []float64{1, 2, 3, 4}, 0.95)
+	require.NoError(t, err)
+	assert.InDelta(t, -w.T, r.T, 1e-12)
+	assert.InDelta(t, w.P, r.P, 1e-12)
+
+	// a clear shift in noisy samples
+	var a, b []float64
+	for i := range 200 {
+		n := math.Sin(float64(i) * 1.7)
+		a = append(a, 10+n)
+		b = append(b, 10.5+n)
+	}
+	w, err = WelchTest(a, b, 0.99)
+	require.NoError(t, err)
+	assert.Less(t, w.P, 1e-6)
+	assert.Greater(t, w.CILow, 0.0)
+	assert.Equal(t, "medium", w.Magnitude())
+}
+
+func TestWelchTest_Degenerate(t *testing.T) {
+	_, err := WelchTest([]float64{1}, []float64{1, 2}, 0.95)
+	require.ErrorIs(t, err, ErrTooFewSamples)
+
+	w, err := WelchTest([]float64{3, 3}, []float64{3, 3, 3}, 0.95)
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, w.P)
+	assert.Zero(t, w.G)
+	assert.Equal(t, "negligible", w.Magnitude())
+
+	w, err = WelchTest([]float64{3, 3}, []float64{4, 4}, 0.95)
+	require.NoError(t, err)
+	assert.Zero(t, w.P)
+	assert.True(t, math.IsInf(w.T, 1))
+	assert.Equal(t, 1.0, w.CILow)
+}
@@ -4,20 +4,27 @@ package consumption
 
 import (
 	"math"
+	"sync"
 
 	"github.com/ja7ad/consumption/pkg/system/proc"
 	"github.com/ja7ad/consumption/pkg/system/util"
 )
 
-// Accumulator keeps running energy and averages.
+// Accumulator keeps running energy and statistics. It is safe for
+// concurrent use; see State, Restore and Merge for checkpointing.
 type Accumulator struct {
-	cfg        *Config
+	cfg   *Config
+	model Model
+
+	mu         sync.Mutex
 	energyCumJ float64
 	count      int
-	sumPCPU    float64
-	sumPDisk   float64
-	sumPRAM    float64
-	sumPTotal  float64
+	durSec     float64 // sum of (clamped) tick lengths
+
+	// per-component energy (J)
+	eCPU, eDisk, eRAM, eIdle float64
+
+	total powerStats // P_total, time-weighted
 }
 
 // New creates an accumulator with the given config.
@@ -27,12 +34,35 @@ type Accumulator struct {
 //   - EMemRef/EMemRSS: zero is treated as an intentional "disable" and respected.
 //   - Negative values are treated as "unset" and defaulted.
 //   - PIdle/PMax/Gamma/ER/EW must be > 0 to override defaults.
+//   - Model/Curve select the power model (see Config.BuildModel); an invalid
+//     selection falls back to the power law. Use NewChecked to reject it.
 func New(cfg *Config) *Accumulator {
+	merged := mergeConfig(cfg)
+	m, err := merged.BuildModel()
+	if err != nil {
+		m = nil
+	}
+	return newAccumulator(merged, m)
+}
+
+// NewChecked is New, but returns an error instead of falling back to the
+// power law when cfg selects an invalid Model/Curve.
+func NewChecked(cfg *Config) (*Accumulator, error) {
+	merged := mergeConfig(cfg)
+	m, err := merged.BuildModel()
+	if err != nil {
+		return nil, err
+	}
+	return newAccumulator(merged, m), nil
+}
+
+// mergeConfig overrides the defaults with the set fields of cfg (see New).
+func mergeConfig(cfg *Config) *Config {
 	base := _defaultConfig()
 
 	// No user cfg: use defaults as-is.
 	if cfg == nil {
-		return &Accumulator{cfg: base}
+		return base
 	}
 
 	merged := *base
@@ -72,7 +102,33 @@ func New(cfg *Config) *Accumulator {
 		merged.PMax = merged.PIdle
 	}
 
-	return &Accumulator{cfg: &merged}
+	merged.Model = cfg.Model
+	merged.Curve = cfg.Curve
+	return &merged
+}
+
+// NewWithModel creates an accumulator that uses m for CPU power instead of
+// the model selected by cfg. The remaining coefficients are merged as in New.
+func NewWithModel(cfg *Config, m Model) *Accumulator {
+	a := New(cfg)
+	if m != nil {
+		a.model = m
+	}
+	return a
+}
+
+func newAccumulator(cfg *Config, m Model) *Accumulator {
+	if m == nil {
+		m = PowerLaw{PIdle: cfg.PIdle, PMax: cfg.PMax, Gamma: cfg.Gamma}
+	}
+	return &Accumulator{cfg: cfg, model: m, total: newPowerStats()}
+}
+
+// Model returns the power model in use.
+func (a *Accumulator) Model() Model {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.model
 }
 
 // Apply runs the model on a single snapshot (one tick), returns the power split,
@@ -82,11 +138,39 @@ func New(cfg *Config) *Accumulator {
 //
 //	E_cum += P_total * dt
 func (a *Accumulator) Apply(snap proc.Snapshot) Result {
+	res := a.Estimate(snap)
+	dt := math.Max(snap.TimeSec, 1e-6)
+
+	// Update cumulatives/statistics
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.energyCumJ += res.PTotal * dt
+	a.count++
+	a.durSec += dt
+	a.eCPU += res.PCPU * dt
+	a.eDisk += res.PDisk * dt
+	a.eRAM += res.PRAM * dt
+	a.eIdle += res.PIdleShare * dt
+	a.total.add(res.PTotal, dt)
+
+	return res
+}
+
+// Estimate runs the model on a snapshot like Apply but leaves the running
+// totals untouched, e.g. to cost a single request. It is safe for
+// concurrent use.
+func (a *Accumulator) Estimate(snap proc.Snapshot) Result {
+	// Restore may set up cfg and model; read them under the lock.
+	a.mu.Lock()
+	cfg, model := a.cfg, a.model
+	a.mu.Unlock()
+
 	uvm := util.Clamp01(snap.UVm)
 	up := util.Clamp01(snap.UProc)
 
 	// CPU dynamic power at VM level
-	pdyn := (a.cfg.PMax - a.cfg.PIdle) * util.Pow(uvm, a.cfg.Gamma)
+	pidle := model.Idle()
+	pdyn := math.Max(model.Power(uvm)-pidle, 0)
 
 	// Attribute dynamic CPU power by share
 	var pcpu float64
@@ -96,44 +180,55 @@ func (a *Accumulator) Apply(snap proc.Snapshot) Result {
 
 	// Disk + RAM power from energy / dt
 	dt := math.Max(snap.TimeSec, 1e-6)
-	edisk := a.cfg.ER*float64(snap.ReadBytes) + a.cfg.EW*float64(snap.WriteBytes)
+	edisk := cfg.ER*float64(snap.ReadBytes) + cfg.EW*float64(snap.WriteBytes)
 	pdisk := edisk / dt
 
-	eram := a.cfg.EMemRef*float64(snap.RefaultBytes) + a.cfg.EMemRSS*float64(snap.RSSChurnBytes)
+	eram := cfg.EMemRef*float64(snap.RefaultBytes) + cfg.EMemRSS*float64(snap.RSSChurnBytes)
 	pram := eram / dt
 
-	// Optional idle share
-	var pidleShare float64
-	if uvm > 1e-12 && a.cfg.Alpha > 0 {
-		pidleShare = a.cfg.Alpha * a.cfg.PIdle * (up / uvm)
-	}
+	pidleShare := IdleShare(cfg.Alpha, pidle, uvm, up)
 
 	ptot := pcpu + pdisk + pram + pidleShare
 
-	// Update cumulatives/averages
-	a.energyCumJ += ptot * dt
-	a.count++
-	a.sumPCPU += pcpu
-	a.sumPDisk += pdisk
-	a.sumPRAM += pram
-	a.sumPTotal += ptot
+	return Result{PCPU: pcpu, PDisk: pdisk, PRAM: pram, PIdleShare: pidleShare, PTotal: ptot}
+}
 
-	return Result{PCPU: pcpu, PDisk: pdisk, PRAM: pram, PTotal: ptot}
+// IdleShare is the idle-attribution policy: alpha·pidle scaled by the
+// process's share of VM utilization, capped at 1 so a process is never
+// charged more than the whole idle power. Utilizations are clamped to
+// [0..1]; an idle VM (uvm ≈ 0) gets no share.
+func IdleShare(alpha, pidle, uvm, uproc float64) float64 {
+	uvm, uproc = util.Clamp01(uvm), util.Clamp01(uproc)
+	if uvm <= 1e-12 || alpha <= 0 {
+		return 0
+	}
+	return alpha * pidle * math.Min(uproc/uvm, 1)
 }
 
 // EnergyCumJ returns cumulative energy in Joules.
-func (a *Accumulator) EnergyCumJ() float64 { return a.energyCumJ }
+func (a *Accumulator) EnergyCumJ() float64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.energyCumJ
+}
 
-// Averages returns average powers over all applied samples.
+// Averages returns time-weighted average powers over all applied samples,
+// i.e. each component's energy divided by the elapsed time.
 func (a *Accumulator) Averages() Result {
-	if a.count == 0 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.averages()
+}
+
+func (a *Accumulator) averages() Result {
+	if a.count == 0 || a.durSec <= 0 {
 		return Result{}
 	}
-	n := float64(a.count)
 	return Result{
-		PCPU:   a.sumPCPU / n,
-		PDisk:  a.sumPDisk / n,
-		PRAM:   a.sumPRAM / n,
-		PTotal: a.sumPTotal / n,
+		PCPU:       a.eCPU / a.durSec,
+		PDisk:      a.eDisk / a.durSec,
+		PRAM:       a.eRAM / a.durSec,
+		PIdleShare: a.eIdle / a.durSec,
+		PTotal:     a.energyCumJ / a.durSec,
 	}
 }
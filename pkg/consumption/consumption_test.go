@@ -43,7 +43,7 @@ func expect(cfg *Config, s proc.Snapshot) (pcpu, pdisk, pram, ptotal float64) {
 
 	var pidleShare float64
 	if uvm > 1e-12 && cfg.Alpha > 0 {
-		pidleShare = cfg.Alpha * cfg.PIdle * (up / uvm)
+		pidleShare = cfg.Alpha * cfg.PIdle * math.Min(up/uvm, 1)
 	}
 
 	ptotal = pcpu + pdisk + pram + pidleShare
@@ -189,3 +189,34 @@ func ExampleAccumulator_logging() {
 	r := acc.Apply(s)
 	fmt.Printf("P(cpu)=%.3fW P(total)=%.3fW E=%.3fJ\n", r.PCPU, r.PTotal, acc.EnergyCumJ())
 }
+
+func TestConsumption_IdleShareInResult_WithLogs(t *testing.T) {
+	acc := New(&Config{PIdle: 6, PMax: 20, Gamma: 1, Alpha: 0.5})
+
+	// U_proc > U_vm (sampling skew): the idle share is capped at alpha·P_idle
+	res := acc.Apply(proc.Snapshot{TimeSec: 2, UVm: 0.2, UProc: 0.3})
+	t.Logf("result: %+v", res)
+	assert.InDelta(t, 3.0, res.PIdleShare, 1e-12)
+	assert.InDelta(t, res.PCPU+res.PDisk+res.PRAM+res.PIdleShare, res.PTotal, 1e-12)
+
+	res = acc.Apply(proc.Snapshot{TimeSec: 2, UVm: 0.4, UProc: 0.1})
+	assert.InDelta(t, 0.75, res.PIdleShare, 1e-12)
+	assert.InDelta(t, (3.0+0.75)/2, acc.Averages().PIdleShare, 1e-12)
+	assert.InDelta(t, (3.0+0.75)*2, acc.Stats().Energy.IdleShare, 1e-12)
+
+	assert.Equal(t, 0.0, IdleShare(0.5, 6, 0, 0.3))
+	assert.Equal(t, 0.0, IdleShare(0, 6, 0.5, 0.3))
+	assert.Equal(t, 3.0, IdleShare(0.5, 6, 1.5, 2))
+}
+
+func TestConsumption_EstimateLeavesTotals(t *testing.T) {
+	acc := New(&Config{PIdle: 6, PMax: 20, Gamma: 1, Alpha: 0.5})
+	snap := proc.Snapshot{TimeSec: 2, UVm: 0.4, UProc: 0.1, WriteBytes: 1 << 20}
+
+	est := acc.Estimate(snap)
+	assert.Zero(t, acc.EnergyCumJ())
+	assert.Zero(t, acc.Stats().Samples)
+
+	assert.Equal(t, est, acc.Apply(snap))
+	assert.InDelta(t, est.PTotal*2, acc.EnergyCumJ(), 1e-12)
+}
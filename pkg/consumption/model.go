@@ -7,17 +7,86 @@ package consumption
 //   - ER/EW: Joules per byte (disk read/write)
 //   - EMemRef/EMemRSS: Joules per byte (RAM proxies)
 //   - Alpha: fraction of idle to charge to process share [0..1]
+//
+// Model selects the CPU power curve: ModelPowerLaw (default, uses PIdle,
+// PMax and Gamma) or ModelCurve (piecewise-linear over Curve; PIdle, PMax
+// and Gamma are then ignored).
+//
+// Ranges optionally gives a coefficient (keyed by its JSON name, e.g.
+// "p_max") a distribution around the value above; see Ensemble.
 type Config struct {
-	PIdle   float64
-	PMax    float64
-	Gamma   float64
-	ER      float64
-	EW      float64
-	EMemRef float64
-	EMemRSS float64
-	Alpha   float64
+	PIdle   float64 `json:"p_idle" yaml:"p_idle"`
+	PMax    float64 `json:"p_max" yaml:"p_max"`
+	Gamma   float64 `json:"gamma" yaml:"gamma"`
+	ER      float64 `json:"er" yaml:"er"`
+	EW      float64 `json:"ew" yaml:"ew"`
+	EMemRef float64 `json:"e_mem_ref" yaml:"e_mem_ref"`
+	EMemRSS float64 `json:"e_mem_rss" yaml:"e_mem_rss"`
+	Alpha   float64 `json:"alpha" yaml:"alpha"`
+
+	Model string       `json:"model,omitempty" yaml:"model,omitempty"`
+	Curve []CurvePoint `json:"curve,omitempty" yaml:"curve,omitempty"`
+
+	Ranges map[string]Dist `json:"ranges,omitempty" yaml:"ranges,omitempty"`
 }
 
+// Coefficient names usable as Config.Ranges keys.
+var Coefficients = []string{"p_idle", "p_max", "gamma", "er", "ew", "e_mem_ref", "e_mem_rss", "alpha"}
+
+// Coefficient returns a pointer to the field named by its JSON name.
+func (c *Config) Coefficient(name string) (*float64, bool) {
+	switch name {
+	case "p_idle":
+		return &c.PIdle, true
+	case "p_max":
+		return &c.PMax, true
+	case "gamma":
+		return &c.Gamma, true
+	case "er":
+		return &c.ER, true
+	case "ew":
+		return &c.EW, true
+	case "e_mem_ref":
+		return &c.EMemRef, true
+	case "e_mem_rss":
+		return &c.EMemRSS, true
+	case "alpha":
+		return &c.Alpha, true
+	}
+	return nil, false
+}
+
+// Distribution kinds accepted in Dist.Kind.
+const (
+	DistUniform    = "uniform"    // Min..Max
+	DistNormal     = "normal"     // mean = coefficient value, StdDev; truncated at 0
+	DistTriangular = "triangular" // Min..Max, mode = coefficient value
+)
+
+// Dist is the uncertainty of one coefficient.
+type Dist struct {
+	Kind   string  `json:"kind" yaml:"kind"`
+	Min    float64 `json:"min,omitempty" yaml:"min,omitempty"`
+	Max    float64 `json:"max,omitempty" yaml:"max,omitempty"`
+	StdDev float64 `json:"stddev,omitempty" yaml:"stddev,omitempty"`
+}
+
+// Model names accepted in Config.Model.
+const (
+	ModelPowerLaw = "powerlaw"
+	ModelCurve    = "curve"
+)
+
+// CurvePoint is one row of a load/power table, e.g. a SPECpower result:
+// machine power in Watts at a CPU load fraction in [0..1].
+type CurvePoint struct {
+	Load  float64 `json:"load" yaml:"load"`
+	Watts float64 `json:"watts" yaml:"watts"`
+}
+
+// DefaultConfig returns a fresh copy of the built-in default coefficients.
+func DefaultConfig() *Config { return _defaultConfig() }
+
 // _defaultConfig returns a Config pre-filled with reasonable default coefficients.
 // These are the same values you used in your shell experiments.
 func _defaultConfig() *Config {
@@ -34,9 +103,11 @@ func _defaultConfig() *Config {
 }
 
 // Result is the instantaneous power breakdown for one snapshot.
+// PTotal = PCPU + PDisk + PRAM + PIdleShare.
 type Result struct {
-	PCPU   float64 // W
-	PDisk  float64 // W
-	PRAM   float64 // W
-	PTotal float64 // W
+	PCPU       float64 // W, dynamic CPU power attributed to the process
+	PDisk      float64 // W
+	PRAM       float64 // W
+	PIdleShare float64 // W, idle power charged via Alpha (see IdleShare)
+	PTotal     float64 // W
 }
@@ -0,0 +1,222 @@
+//go:build linux
+
+package consumption
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ja7ad/consumption/pkg/system/util"
+)
+
+var (
+	ErrUnknownModel = errors.New("consumption: unknown model")
+	ErrBadCurve     = errors.New("consumption: invalid load curve")
+)
+
+// Model maps VM CPU utilization to machine power. The Accumulator charges
+// Power(u)-Idle() as dynamic CPU power and uses Idle() for the optional idle
+// share.
+type Model interface {
+	// Name identifies the model (ModelPowerLaw, ModelCurve, ...).
+	Name() string
+	// Idle returns power at 0% load in Watts.
+	Idle() float64
+	// Power returns power at utilization u in [0..1] in Watts.
+	Power(u float64) float64
+}
+
+// PowerLaw is the default model: P(u) = PIdle + (PMax-PIdle)·u^γ.
+type PowerLaw struct {
+	PIdle float64
+	PMax  float64
+	Gamma float64
+}
+
+// Name, Idle and Power implement Model.
+func (PowerLaw) Name() string    { return ModelPowerLaw }
+func (m PowerLaw) Idle() float64 { return m.PIdle }
+func (m PowerLaw) Power(u float64) float64 {
+	return m.PIdle + (m.PMax-m.PIdle)*util.Pow(util.Clamp01(u), m.Gamma)
+}
+
+// Curve interpolates linearly between measured load points. Loads below the
+// first or above the last point take that point's power.
+type Curve struct {
+	points []CurvePoint
+}
+
+// NewCurve validates and sorts points: at least two, loads in [0..1] and
+// unique, watts non-negative.
+func NewCurve(points []CurvePoint) (*Curve, error) {
+	if len(points) < 2 {
+		return nil, fmt.Errorf("%w: need at least 2 points, got %d", ErrBadCurve, len(points))
+	}
+	ps := slices.Clone(points)
+	slices.SortFunc(ps, func(a, b CurvePoint) int {
+		switch {
+		case a.Load < b.Load:
+			return -1
+		case a.Load > b.Load:
+			return 1
+		default:
+			return 0
+		}
+	})
+	for i, p := range ps {
+		if p.Load < 0 || p.Load > 1 {
+			return nil, fmt.Errorf("%w: load %g outside [0,1]", ErrBadCurve, p.Load)
+		}
+		if p.Watts < 0 {
+			return nil, fmt.Errorf("%w: negative watts %g at load %g", ErrBadCurve, p.Watts, p.Load)
+		}
+		if i > 0 && p.Load == ps[i-1].Load {
+			return nil, fmt.Errorf("%w: duplicate load %g", ErrBadCurve, p.Load)
+		}
+	}
+	return &Curve{points: ps}, nil
+}
+
+func (*Curve) Name() string    { return ModelCurve }
+func (c *Curve) Idle() float64 { return c.Power(0) }
+
+// Points returns a copy of the sorted curve points.
+func (c *Curve) Points() []CurvePoint { return slices.Clone(c.points) }
+
+// Power interpolates the curve at utilization u.
+func (c *Curve) Power(u float64) float64 {
+	u = util.Clamp01(u)
+	ps := c.points
+	if u <= ps[0].Load {
+		return ps[0].Watts
+	}
+	for i := 1; i < len(ps); i++ {
+		if u <= ps[i].Load {
+			a, b := ps[i-1], ps[i]
+			return a.Watts + (b.Watts-a.Watts)*(u-a.Load)/(b.Load-a.Load)
+		}
+	}
+	return ps[len(ps)-1].Watts
+}
+
+// BuildModel returns the power model described by c.
+func (c Config) BuildModel() (Model, error) {
+	switch c.Model {
+	case "", ModelPowerLaw:
+		return PowerLaw{PIdle: c.PIdle, PMax: c.PMax, Gamma: c.Gamma}, nil
+	case ModelCurve:
+		return NewCurve(c.Curve)
+	default:
+		return nil, fmt.Errorf("%w: %q (want %s|%s)", ErrUnknownModel, c.Model, ModelPowerLaw, ModelCurve)
+	}
+}
+
+// LoadCurve reads a load/power table file; see ParseCurve.
+func LoadCurve(path string) ([]CurvePoint, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	ps, err := ParseCurve(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return ps, nil
+}
+
+// ParseCurve reads a two-column load/power table, one point per line,
+// separated by commas, tabs or spaces. Blank lines, '#' comments and a
+// non-numeric header line are skipped. Loads may be fractions (0.1), or
+// percentages (10% or 10 when any load exceeds 1); "idle" and "active idle"
+// mean 0. This matches the SPECpower_ssj2008 "target load / average active
+// power" table:
+//
+//	target load, watts
+//	100%, 253
+//	90%,  233
+//	...
+//	active idle, 58
+func ParseCurve(r io.Reader) ([]CurvePoint, error) {
+	type raw struct {
+		load    float64
+		percent bool
+		watts   float64
+	}
+	var (
+		rows    []raw
+		percent bool
+		header  bool
+		lineNo  int
+	)
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		lineNo++
+		line := strings.TrimSpace(sc.Text())
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		if line == "" {
+			continue
+		}
+
+		var loadS, wattS string
+		if i := strings.LastIndexAny(line, ",\t "); i >= 0 {
+			loadS = strings.TrimSpace(strings.TrimRight(line[:i], ",\t "))
+			wattS = strings.TrimSpace(line[i+1:])
+		}
+		watts, werr := strconv.ParseFloat(strings.TrimSuffix(strings.ToLower(wattS), "w"), 64)
+
+		var x raw
+		switch l := strings.ToLower(loadS); {
+		case l == "idle" || l == "active idle":
+			x.load = 0
+		case strings.HasSuffix(l, "%"):
+			v, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(l, "%")), 64)
+			if err != nil {
+				werr = err
+			}
+			x.load, x.percent = v, true
+		default:
+			v, err := strconv.ParseFloat(l, 64)
+			if err != nil {
+				werr = err
+			}
+			x.load = v
+		}
+		if werr != nil {
+			if len(rows) == 0 && !header {
+				header = true
+				continue
+			}
+			return nil, fmt.Errorf("%w: line %d: %q", ErrBadCurve, lineNo, sc.Text())
+		}
+		x.watts = watts
+		if x.percent || x.load > 1 {
+			percent = true
+		}
+		rows = append(rows, x)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	out := make([]CurvePoint, 0, len(rows))
+	for _, x := range rows {
+		load := x.load
+		if x.percent || percent {
+			load /= 100
+		}
+		out = append(out, CurvePoint{Load: load, Watts: x.watts})
+	}
+	if _, err := NewCurve(out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,140 @@
+//go:build linux
+
+package consumption
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ja7ad/consumption/pkg/system/proc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPowerLaw_MatchesFormula(t *testing.T) {
+	m := PowerLaw{PIdle: 5, PMax: 20, Gamma: 1.3}
+	assert.Equal(t, ModelPowerLaw, m.Name())
+	assert.InDelta(t, 5.0, m.Idle(), 1e-12)
+	assert.InDelta(t, 5.0, m.Power(0), 1e-12)
+	assert.InDelta(t, 20.0, m.Power(1), 1e-12)
+	assert.InDelta(t, 20.0, m.Power(1.7), 1e-12) // clamped
+}
+
+func TestCurve_Interpolates(t *testing.T) {
+	c, err := NewCurve([]CurvePoint{{1, 250}, {0, 60}, {0.5, 160}})
+	require.NoError(t, err)
+	assert.Equal(t, ModelCurve, c.Name())
+	assert.Equal(t, 0.0, c.Points()[0].Load) // sorted
+
+	assert.InDelta(t, 60.0, c.Idle(), 1e-12)
+	assert.InDelta(t, 110.0, c.Power(0.25), 1e-12)
+	assert.InDelta(t, 205.0, c.Power(0.75), 1e-12)
+	assert.InDelta(t, 250.0, c.Power(2), 1e-12)
+
+	// Curves that do not start at 0 hold the edge value.
+	c, err = NewCurve([]CurvePoint{{0.1, 80}, {0.9, 200}})
+	require.NoError(t, err)
+	assert.InDelta(t, 80.0, c.Power(0), 1e-12)
+	assert.InDelta(t, 200.0, c.Power(1), 1e-12)
+}
+
+func TestNewCurve_Invalid(t *testing.T) {
+	for name, ps := range map[string][]CurvePoint{
+		"too few":   {{0, 1}},
+		"range":     {{0, 1}, {1.5, 2}},
+		"negative":  {{0, -1}, {1, 2}},
+		"duplicate": {{0, 1}, {0.5, 2}, {0.5, 3}},
+	} {
+		_, err := NewCurve(ps)
+		assert.ErrorIs(t, err, ErrBadCurve, name)
+	}
+}
+
+func TestParseCurve_SPECpowerTable(t *testing.T) {
+	in := `# SPECpower_ssj2008 summary
+target load, average active power (W)
+100%, 253
+90%,  233
+80%,  214
+70%,  196
+60%,  180
+50%,  165
+40%,  150
+30%,  134
+20%,  118
+10%,  101
+active idle, 58
+`
+	ps, err := ParseCurve(strings.NewReader(in))
+	require.NoError(t, err)
+	require.Len(t, ps, 11)
+	assert.Equal(t, CurvePoint{Load: 1, Watts: 253}, ps[0])
+	assert.Equal(t, CurvePoint{Load: 0, Watts: 58}, ps[10])
+
+	// Bare numbers above 1 are percentages; fractions stay as-is.
+	ps, err = ParseCurve(strings.NewReader("0 50\n50 120\n100 200\n"))
+	require.NoError(t, err)
+	assert.InDelta(t, 0.5, ps[1].Load, 1e-12)
+	ps, err = ParseCurve(strings.NewReader("0\t50\n0.5\t120W\n1\t200\n"))
+	require.NoError(t, err)
+	assert.InDelta(t, 0.5, ps[1].Load, 1e-12)
+	assert.InDelta(t, 120.0, ps[1].Watts, 1e-12)
+
+	_, err = ParseCurve(strings.NewReader("load,watts\n0,50\nbogus,1\n"))
+	assert.ErrorIs(t, err, ErrBadCurve)
+}
+
+func TestConfig_BuildModel(t *testing.T) {
+	m, err := Config{PIdle: 5, PMax: 20, Gamma: 1.3}.BuildModel()
+	require.NoError(t, err)
+	assert.Equal(t, PowerLaw{PIdle: 5, PMax: 20, Gamma: 1.3}, m)
+
+	m, err = Config{Model: ModelCurve, Curve: []CurvePoint{{0, 10}, {1, 30}}}.BuildModel()
+	require.NoError(t, err)
+	assert.Equal(t, ModelCurve, m.Name())
+
+	_, err = Config{Model: ModelCurve}.BuildModel()
+	assert.ErrorIs(t, err, ErrBadCurve)
+	_, err = Config{Model: "cubic"}.BuildModel()
+	assert.ErrorIs(t, err, ErrUnknownModel)
+}
+
+func TestNewChecked(t *testing.T) {
+	_, err := NewChecked(&Config{Model: "cubic"})
+	assert.ErrorIs(t, err, ErrUnknownModel)
+	_, err = NewChecked(&Config{Model: ModelCurve})
+	assert.ErrorIs(t, err, ErrBadCurve)
+	assert.Equal(t, ModelPowerLaw, New(&Config{Model: "cubic"}).Model().Name(), "New falls back")
+
+	acc, err := NewChecked(&Config{Model: ModelCurve, Curve: []CurvePoint{{0, 10}, {1, 30}}})
+	require.NoError(t, err)
+	assert.Equal(t, ModelCurve, acc.Model().Name())
+	acc, err = NewChecked(nil)
+	require.NoError(t, err)
+	assert.Equal(t, ModelPowerLaw, acc.Model().Name())
+}
+
+func TestAccumulator_CurveModel_WithLogs(t *testing.T) {
+	cfg := &Config{
+		ER: 4.8e-8, EW: 9.5e-8, Alpha: 0.5,
+		Model: ModelCurve,
+		Curve: []CurvePoint{{0, 60}, {0.5, 160}, {1, 250}},
+	}
+	acc := New(cfg)
+	require.Equal(t, ModelCurve, acc.Model().Name())
+
+	// U_vm=0.25 → VM power 110 W, dynamic 50 W; process owns half of it.
+	res := acc.Apply(proc.Snapshot{TimeSec: 1, UVm: 0.25, UProc: 0.125})
+	t.Logf("P_cpu=%.3f P_total=%.3f", res.PCPU, res.PTotal)
+	assert.InDelta(t, 25.0, res.PCPU, 1e-9)
+	assert.InDelta(t, 25.0+0.5*60*0.5, res.PTotal, 1e-9) // + alpha·idle·share
+
+	// Invalid selection falls back to the power law.
+	acc = New(&Config{Model: ModelCurve})
+	assert.Equal(t, ModelPowerLaw, acc.Model().Name())
+
+	// NewWithModel overrides the config's model.
+	acc = NewWithModel(nil, PowerLaw{PIdle: 1, PMax: 11, Gamma: 1})
+	res = acc.Apply(proc.Snapshot{TimeSec: 1, UVm: 1, UProc: 1})
+	assert.InDelta(t, 10.0, res.PCPU, 1e-9)
+}
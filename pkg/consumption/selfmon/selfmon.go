@@ -0,0 +1,398 @@
+//go:build linux
+
+// Package selfmon lets a Go service estimate its own energy without a
+// sidecar:
+//
+//	mon, err := selfmon.Start(selfmon.Options{Children: true})
+//	if err != nil {
+//		return err
+//	}
+//	defer mon.Stop()
+//	...
+//	log.Printf("%.2f W, %.1f J so far", mon.Watts(), mon.Joules())
+//
+// A background goroutine samples os.Getpid() (and, with Children, every
+// descendant, re-resolved each tick) with the procfs collector and feeds a
+// consumption.Accumulator. Results are available through getters, Read
+// (named metrics in the style of runtime/metrics), an expvar variable and
+// an optional per-tick callback.
+//
+// The procfs collector only reads /proc: the process is never moved into a
+// cgroup, unlike the cgroup2 collector, which a service must not use on
+// itself. A tick costs a handful of small /proc reads per process, so the
+// default 1s interval keeps the overhead negligible.
+package selfmon
+
+import (
+	"expvar"
+	"fmt"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ja7ad/consumption/pkg/consumption"
+	"github.com/ja7ad/consumption/pkg/system/proc"
+)
+
+// DefaultInterval is the sampling period when Options.Interval is 0.
+const DefaultInterval = time.Second
+
+// DefaultExpvar is the expvar name when Options.Expvar is empty.
+const DefaultExpvar = "consumption"
+
+// Options configures Start. The zero value samples the current process
+// every second with the default coefficients and publishes expvar
+// "consumption".
+type Options struct {
+	// Config holds the model coefficients; nil means the defaults.
+	Config *consumption.Config
+	// Interval is the sampling period; 0 means DefaultInterval.
+	Interval time.Duration
+	// Children adds every descendant of the process. Children that exit
+	// between two ticks lose the CPU time they used since the last tick.
+	Children bool
+	// Collector samples the processes; nil means a procfs collector owned
+	// (and closed) by the Monitor. It must not move processes, so do not
+	// pass the cgroup2 collector.
+	Collector proc.Collector
+	// Expvar names the expvar variable; "" means DefaultExpvar and "-"
+	// disables publishing.
+	Expvar string
+	// OnSample, if set, is called from the sampling goroutine after every
+	// tick. It should return quickly.
+	OnSample func(Sample)
+}
+
+// Sample is the state after one tick.
+type Sample struct {
+	Time     time.Time
+	PIDs     int                // processes sampled
+	Power    consumption.Result // W over the last tick
+	Energy   consumption.Energy // J since Start
+	Snapshot proc.Snapshot
+}
+
+// Monitor samples the process in the background between Start and Stop.
+// Its getters are safe for concurrent use.
+type Monitor struct {
+	col      proc.Collector
+	own      bool
+	pid      int
+	children bool
+	interval time.Duration
+	expvar   string
+	onSample func(Sample)
+	acc      *consumption.Accumulator
+	started  time.Time
+
+	mu      sync.Mutex
+	last    Sample
+	ticks   uint64
+	errs    uint64
+	lastErr error
+
+	done     chan struct{}
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+	stopErr  error
+}
+
+// Start primes the collector, publishes the expvar variable and starts
+// sampling. Stop releases everything.
+func Start(o Options) (*Monitor, error) {
+	acc, err := consumption.NewChecked(o.Config)
+	if err != nil {
+		return nil, err
+	}
+	m := &Monitor{
+		col:      o.Collector,
+		pid:      os.Getpid(),
+		children: o.Children,
+		interval: o.Interval,
+		expvar:   o.Expvar,
+		onSample: o.OnSample,
+		acc:      acc,
+		done:     make(chan struct{}),
+	}
+	if m.interval <= 0 {
+		m.interval = DefaultInterval
+	}
+	if m.expvar == "" {
+		m.expvar = DefaultExpvar
+	}
+	if m.col == nil {
+		col, err := proc.NewCollectorByName(proc.ProcFS, 0)
+		if err != nil {
+			return nil, err
+		}
+		m.col, m.own = col, true
+	}
+
+	// The first sample only sets the collector's baselines.
+	m.started = time.Now()
+	if _, err := m.col.Sample(m.pids(), m.interval.Seconds()); err != nil {
+		m.closeCollector()
+		return nil, fmt.Errorf("selfmon: %w", err)
+	}
+	if m.expvar != "-" {
+		if err := publish(m.expvar, m); err != nil {
+			m.closeCollector()
+			return nil, err
+		}
+	}
+	m.wg.Add(1)
+	go m.run()
+	return m, nil
+}
+
+// Stop ends sampling, withdraws the expvar value and closes an owned
+// collector. It is safe to call more than once.
+func (m *Monitor) Stop() error {
+	m.stopOnce.Do(func() {
+		close(m.done)
+		m.wg.Wait()
+		if m.expvar != "-" {
+			unpublish(m.expvar, m)
+		}
+		m.stopErr = m.closeCollector()
+	})
+	return m.stopErr
+}
+
+// Watts returns the total power over the last tick.
+func (m *Monitor) Watts() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.last.Power.PTotal
+}
+
+// Joules returns the energy since Start.
+func (m *Monitor) Joules() float64 { return m.acc.EnergyCumJ() }
+
+// Last returns the state after the last tick.
+func (m *Monitor) Last() Sample {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.last
+}
+
+// Stats returns the running statistics since Start.
+func (m *Monitor) Stats() consumption.Stats { return m.acc.Stats() }
+
+// Err returns the error of the last tick, nil when it succeeded.
+func (m *Monitor) Err() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lastErr
+}
+
+func (m *Monitor) run() {
+	defer m.wg.Done()
+	t := time.NewTicker(m.interval)
+	defer t.Stop()
+	prev := time.Now()
+	for {
+		select {
+		case <-m.done:
+			return
+		case now := <-t.C:
+			m.tick(now, now.Sub(prev).Seconds())
+			prev = now
+		}
+	}
+}
+
+func (m *Monitor) tick(now time.Time, dt float64) {
+	pids := m.pids()
+	snap, err := m.col.Sample(pids, dt)
+	if err != nil {
+		m.mu.Lock()
+		m.errs++
+		m.lastErr = err
+		m.mu.Unlock()
+		return
+	}
+	res := m.acc.Apply(snap)
+	s := Sample{Time: now, PIDs: len(pids), Power: res, Energy: m.acc.Stats().Energy, Snapshot: snap}
+	m.mu.Lock()
+	m.last = s
+	m.ticks++
+	m.lastErr = nil
+	m.mu.Unlock()
+	if m.onSample != nil {
+		m.onSample(s)
+	}
+}
+
+// pids returns the processes to sample this tick.
+func (m *Monitor) pids() []int {
+	if m.children {
+		return proc.ReadProcTree(m.pid)
+	}
+	return []int{m.pid}
+}
+
+func (m *Monitor) closeCollector() error {
+	if m.own {
+		return m.col.Close()
+	}
+	return nil
+}
+
+// Metric is one named value for Read. Names follow runtime/metrics:
+// "/energy/total:joules", "/power/cpu:watts", ...
+type Metric struct {
+	Name  string
+	Value float64 // NaN for unknown names
+}
+
+// Description describes a metric Read supports.
+type Description struct {
+	Name        string
+	Description string
+	Cumulative  bool
+}
+
+var descriptions = []Description{
+	{"/energy/cpu:joules", "CPU energy since Start.", true},
+	{"/energy/disk:joules", "Disk I/O energy since Start.", true},
+	{"/energy/ram:joules", "Memory energy since Start.", true},
+	{"/energy/idle-share:joules", "Charged share of the idle power since Start.", true},
+	{"/energy/total:joules", "Total energy since Start.", true},
+	{"/power/cpu:watts", "CPU power over the last tick.", false},
+	{"/power/disk:watts", "Disk I/O power over the last tick.", false},
+	{"/power/ram:watts", "Memory power over the last tick.", false},
+	{"/power/idle-share:watts", "Charged share of the idle power over the last tick.", false},
+	{"/power/total:watts", "Total power over the last tick.", false},
+	{"/power/average:watts", "Time-weighted average total power since Start.", false},
+	{"/sampler/pids:processes", "Processes sampled at the last tick.", false},
+	{"/sampler/ticks:ticks", "Successful ticks since Start.", true},
+	{"/sampler/errors:errors", "Failed ticks since Start.", true},
+}
+
+// All returns the metrics Read supports.
+func All() []Description { return append([]Description(nil), descriptions...) }
+
+// Read fills the Value of each metric by name, like runtime/metrics.Read.
+func (m *Monitor) Read(ms []Metric) {
+	st := m.acc.Stats()
+	m.mu.Lock()
+	p, pids, ticks, errs := m.last.Power, m.last.PIDs, m.ticks, m.errs
+	m.mu.Unlock()
+	for i := range ms {
+		v := math.NaN()
+		switch ms[i].Name {
+		case "/energy/cpu:joules":
+			v = st.Energy.CPU
+		case "/energy/disk:joules":
+			v = st.Energy.Disk
+		case "/energy/ram:joules":
+			v = st.Energy.RAM
+		case "/energy/idle-share:joules":
+			v = st.Energy.IdleShare
+		case "/energy/total:joules":
+			v = st.Energy.Total
+		case "/power/cpu:watts":
+			v = p.PCPU
+		case "/power/disk:watts":
+			v = p.PDisk
+		case "/power/ram:watts":
+			v = p.PRAM
+		case "/power/idle-share:watts":
+			v = p.PIdleShare
+		case "/power/total:watts":
+			v = p.PTotal
+		case "/power/average:watts":
+			v = st.Avg.PTotal
+		case "/sampler/pids:processes":
+			v = float64(pids)
+		case "/sampler/ticks:ticks":
+			v = float64(ticks)
+		case "/sampler/errors:errors":
+			v = float64(errs)
+		}
+		ms[i].Value = v
+	}
+}
+
+// expvarValue is the JSON published under Options.Expvar.
+type expvarValue struct {
+	Watts      components `json:"watts"`
+	Joules     components `json:"joules"`
+	AvgWatts   float64    `json:"avg_watts"`
+	PIDs       int        `json:"pids"`
+	Ticks      uint64     `json:"ticks"`
+	Errors     uint64     `json:"errors"`
+	LastError  string     `json:"last_error,omitempty"`
+	UptimeSec  float64    `json:"uptime_sec"`
+	IntervalMs int64      `json:"interval_ms"`
+}
+
+type components struct {
+	CPU       float64 `json:"cpu"`
+	Disk      float64 `json:"disk"`
+	RAM       float64 `json:"ram"`
+	IdleShare float64 `json:"idle_share"`
+	Total     float64 `json:"total"`
+}
+
+func (m *Monitor) expvarValue() expvarValue {
+	st := m.acc.Stats()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, e := m.last.Power, st.Energy
+	v := expvarValue{
+		Watts:      components{p.PCPU, p.PDisk, p.PRAM, p.PIdleShare, p.PTotal},
+		Joules:     components{e.CPU, e.Disk, e.RAM, e.IdleShare, e.Total},
+		AvgWatts:   st.Avg.PTotal,
+		PIDs:       m.last.PIDs,
+		Ticks:      m.ticks,
+		Errors:     m.errs,
+		UptimeSec:  time.Since(m.started).Seconds(),
+		IntervalMs: m.interval.Milliseconds(),
+	}
+	if m.lastErr != nil {
+		v.LastError = m.lastErr.Error()
+	}
+	return v
+}
+
+// published maps expvar names to the running Monitor. expvar cannot remove
+// a variable, so a name stays registered and reads null between monitors.
+var published = struct {
+	sync.Mutex
+	current map[string]*Monitor
+}{current: make(map[string]*Monitor)}
+
+func publish(name string, m *Monitor) error {
+	published.Lock()
+	defer published.Unlock()
+	cur, ours := published.current[name]
+	switch {
+	case cur != nil:
+		return fmt.Errorf("selfmon: expvar %q is used by a running monitor", name)
+	case !ours && expvar.Get(name) != nil:
+		return fmt.Errorf("selfmon: expvar %q is already published", name)
+	case !ours:
+		expvar.Publish(name, expvar.Func(func() any {
+			published.Lock()
+			m := published.current[name]
+			published.Unlock()
+			if m == nil {
+				return nil
+			}
+			return m.expvarValue()
+		}))
+	}
+	published.current[name] = m
+	return nil
+}
+
+func unpublish(name string, m *Monitor) {
+	published.Lock()
+	defer published.Unlock()
+	if published.current[name] == m {
+		published.current[name] = nil
+	}
+}
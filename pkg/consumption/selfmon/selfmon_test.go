@@ -0,0 +1,135 @@
+//go:build linux
+
+package selfmon
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"math"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ja7ad/consumption/pkg/system/proc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCollector reports a steady load and records the PIDs it was asked for.
+type fakeCollector struct {
+	pids   atomic.Value // []int
+	fail   atomic.Bool
+	closed atomic.Bool
+}
+
+func (c *fakeCollector) Sample(pids []int, dt float64) (proc.Snapshot, error) {
+	c.pids.Store(pids)
+	if c.fail.Load() {
+		return proc.Snapshot{}, errors.New("boom")
+	}
+	return proc.Snapshot{TimeSec: dt, UVm: 0.5, UProc: 0.25, WriteBytes: 1 << 20}, nil
+}
+
+func (c *fakeCollector) Close() error { c.closed.Store(true); return nil }
+
+func TestMonitor(t *testing.T) {
+	col := &fakeCollector{}
+	var calls atomic.Int64
+	mon, err := Start(Options{
+		Collector: col,
+		Interval:  5 * time.Millisecond,
+		Expvar:    "selfmon_test",
+		OnSample:  func(Sample) { calls.Add(1) },
+	})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool { return calls.Load() >= 3 }, 2*time.Second, time.Millisecond)
+	assert.Positive(t, mon.Watts())
+	assert.Positive(t, mon.Joules())
+	assert.NoError(t, mon.Err())
+
+	last := mon.Last()
+	assert.Equal(t, 1, last.PIDs)
+	assert.Equal(t, []int{os.Getpid()}, col.pids.Load())
+	assert.Positive(t, last.Power.PDisk)
+	assert.InDelta(t, last.Energy.Total, last.Energy.CPU+last.Energy.Disk+last.Energy.RAM+last.Energy.IdleShare, 1e-9)
+
+	ms := []Metric{{Name: "/energy/total:joules"}, {Name: "/power/total:watts"}, {Name: "/sampler/ticks:ticks"}, {Name: "/nope:x"}}
+	mon.Read(ms)
+	assert.Positive(t, ms[0].Value)
+	assert.Positive(t, ms[1].Value)
+	assert.GreaterOrEqual(t, ms[2].Value, 3.0)
+	assert.True(t, math.IsNaN(ms[3].Value))
+
+	var v expvarValue
+	require.NoError(t, json.Unmarshal([]byte(expvar.Get("selfmon_test").String()), &v))
+	assert.Positive(t, v.Joules.Total)
+	assert.Equal(t, int64(5), v.IntervalMs)
+
+	_, err = Start(Options{Collector: col, Expvar: "selfmon_test"})
+	require.Error(t, err, "name in use")
+
+	require.NoError(t, mon.Stop())
+	require.NoError(t, mon.Stop(), "Stop is idempotent")
+	assert.False(t, col.closed.Load(), "caller-owned collector stays open")
+	assert.Equal(t, "null", expvar.Get("selfmon_test").String())
+
+	n := calls.Load()
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, n, calls.Load(), "no ticks after Stop")
+
+	again, err := Start(Options{Collector: col, Interval: 5 * time.Millisecond, Expvar: "selfmon_test"})
+	require.NoError(t, err, "name is reusable after Stop")
+	require.NoError(t, again.Stop())
+}
+
+func TestMonitor_Errors(t *testing.T) {
+	col := &fakeCollector{}
+	mon, err := Start(Options{Collector: col, Interval: 5 * time.Millisecond, Expvar: "-"})
+	require.NoError(t, err)
+	defer mon.Stop()
+
+	col.fail.Store(true)
+	require.Eventually(t, func() bool { return mon.Err() != nil }, 2*time.Second, time.Millisecond)
+	ms := []Metric{{Name: "/sampler/errors:errors"}}
+	mon.Read(ms)
+	assert.Positive(t, ms[0].Value)
+
+	col.fail.Store(false)
+	require.Eventually(t, func() bool { return mon.Err() == nil }, 2*time.Second, time.Millisecond)
+}
+
+func TestMonitor_PrimeFailure(t *testing.T) {
+	col := &fakeCollector{}
+	col.fail.Store(true)
+	_, err := Start(Options{Collector: col, Expvar: "selfmon_prime"})
+	require.Error(t, err)
+	assert.Nil(t, expvar.Get("selfmon_prime"), "nothing published on failure")
+}
+
+func TestMonitor_ProcfsChildren(t *testing.T) {
+	mon, err := Start(Options{Interval: 10 * time.Millisecond, Children: true, Expvar: "-"})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return mon.Last().PIDs >= 1 }, 2*time.Second, time.Millisecond)
+	require.NoError(t, mon.Stop())
+	assert.NoError(t, mon.Err())
+	assert.GreaterOrEqual(t, mon.Joules(), 0.0)
+}
+
+func TestAll(t *testing.T) {
+	ds := All()
+	require.NotEmpty(t, ds)
+	ms := make([]Metric, len(ds))
+	for i, d := range ds {
+		ms[i].Name = d.Name
+	}
+	m, err := Start(Options{Collector: &fakeCollector{}, Interval: time.Hour, Expvar: "-"})
+	require.NoError(t, err)
+	defer m.Stop()
+	m.Read(ms)
+	for _, x := range ms {
+		assert.False(t, math.IsNaN(x.Value), x.Name)
+	}
+}
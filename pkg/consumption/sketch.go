@@ -0,0 +1,145 @@
+package consumption
+
+import (
+	"errors"
+	"math"
+	"slices"
+)
+
+// DefaultSketchAccuracy is the relative accuracy of a Sketch made with
+// NewSketch(0): quantiles are within ±1% of the true value.
+const DefaultSketchAccuracy = 0.01
+
+// maxSketchBins bounds a Sketch's memory. With 1% accuracy it covers about
+// 17 decades of values before the lowest bins are merged.
+const maxSketchBins = 2048
+
+// ErrSketchAccuracy is returned when merging sketches of different accuracy:
+// their bin indices are on different scales.
+var ErrSketchAccuracy = errors.New("consumption: sketches of different accuracy")
+
+// sketchMinValue is the smallest value given its own bin; smaller values,
+// including zero, share one bin.
+const sketchMinValue = 1e-9
+
+// Sketch is a bounded, mergeable quantile sketch for non-negative values
+// (a DDSketch with logarithmic bins). Values carry weights, so quantiles
+// can be time-weighted. The zero value is not usable; use NewSketch.
+type Sketch struct {
+	gamma float64
+	logG  float64
+	bins  map[int]float64
+	zero  float64 // weight of values < sketchMinValue
+	total float64
+	count int
+	min   float64
+	max   float64
+}
+
+// NewSketch returns an empty sketch with the given relative accuracy in
+// (0, 1); other values select DefaultSketchAccuracy.
+func NewSketch(relAcc float64) *Sketch {
+	if relAcc <= 0 || relAcc >= 1 {
+		relAcc = DefaultSketchAccuracy
+	}
+	g := (1 + relAcc) / (1 - relAcc)
+	return &Sketch{gamma: g, logG: math.Log(g), bins: map[int]float64{}, min: math.Inf(1), max: math.Inf(-1)}
+}
+
+// Add records v with weight w. Negative values count as 0; non-positive
+// weights are ignored.
+func (s *Sketch) Add(v, w float64) {
+	if w <= 0 || math.IsNaN(v) {
+		return
+	}
+	v = math.Max(v, 0)
+	s.count++
+	s.total += w
+	s.min = math.Min(s.min, v)
+	s.max = math.Max(s.max, v)
+	if v < sketchMinValue {
+		s.zero += w
+		return
+	}
+	s.bins[int(math.Ceil(math.Log(v)/s.logG))] += w
+	if len(s.bins) > maxSketchBins {
+		s.collapse()
+	}
+}
+
+// collapse merges the lowest bins until the sketch is back under its limit.
+func (s *Sketch) collapse() {
+	keys := s.keys()
+	excess := len(keys) - maxSketchBins
+	for _, k := range keys[:excess] {
+		s.bins[keys[excess]] += s.bins[k]
+		delete(s.bins, k)
+	}
+}
+
+func (s *Sketch) keys() []int {
+	keys := make([]int, 0, len(s.bins))
+	for k := range s.bins {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// Count returns the number of values added.
+func (s *Sketch) Count() int { return s.count }
+
+// Weight returns the sum of weights added.
+func (s *Sketch) Weight() float64 { return s.total }
+
+// Quantile returns the weighted q-quantile (q in [0, 1]), or 0 when empty.
+// q <= 0 and q >= 1 return the exact minimum and maximum.
+func (s *Sketch) Quantile(q float64) float64 {
+	if s.total == 0 {
+		return 0
+	}
+	switch {
+	case q <= 0:
+		return s.min
+	case q >= 1:
+		return s.max
+	}
+	rank := q * s.total
+	cum := s.zero
+	if cum >= rank && s.zero > 0 {
+		return s.min
+	}
+	v := s.max
+	for _, k := range s.keys() {
+		cum += s.bins[k]
+		if cum >= rank {
+			// midpoint of (gamma^(k-1), gamma^k] in relative terms
+			v = 2 * math.Pow(s.gamma, float64(k)) / (s.gamma + 1)
+			break
+		}
+	}
+	return math.Min(math.Max(v, s.min), s.max)
+}
+
+// Merge adds o's contents to s. Both must use the same accuracy; otherwise
+// s is left unchanged and ErrSketchAccuracy is returned.
+func (s *Sketch) Merge(o *Sketch) error {
+	if o == nil || o.count == 0 {
+		return nil
+	}
+	if o.gamma != s.gamma {
+		return ErrSketchAccuracy
+	}
+	for k, w := range o.bins {
+		s.bins[k] += w
+	}
+	s.zero += o.zero
+	s.total += o.total
+	s.count += o.count
+	s.min = math.Min(s.min, o.min)
+	s.max = math.Max(s.max, o.max)
+	if len(s.bins) > maxSketchBins {
+		s.collapse()
+	}
+	return nil
+}
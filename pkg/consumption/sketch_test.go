@@ -0,0 +1,66 @@
+package consumption
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSketch_RelativeAccuracy(t *testing.T) {
+	s := NewSketch(0)
+	r := rand.New(rand.NewPCG(1, 2))
+	xs := make([]float64, 10000)
+	for i := range xs {
+		xs[i] = math.Exp(r.NormFloat64()) * 10 // log-normal around 10 W
+		s.Add(xs[i], 1)
+	}
+	slices.Sort(xs)
+	require.Equal(t, len(xs), s.Count())
+
+	for _, q := range []float64{0.5, 0.95, 0.99} {
+		exact := quantile(xs, q)
+		assert.InEpsilon(t, exact, s.Quantile(q), 0.02, "q=%g", q)
+	}
+	assert.Equal(t, xs[0], s.Quantile(0))
+	assert.Equal(t, xs[len(xs)-1], s.Quantile(1))
+}
+
+func TestSketch_WeightsAndZeros(t *testing.T) {
+	s := NewSketch(0)
+	assert.Equal(t, 0.0, s.Quantile(0.5))
+
+	s.Add(0, 1)  // 1 s idle
+	s.Add(10, 9) // 9 s at 10 W
+	s.Add(-3, 0) // ignored: no weight
+	assert.Equal(t, 2, s.Count())
+	assert.Equal(t, 10.0, s.Weight())
+	assert.Equal(t, 0.0, s.Quantile(0.05))
+	assert.InEpsilon(t, 10.0, s.Quantile(0.5), 0.01)
+}
+
+func TestSketch_BoundedAndMerge(t *testing.T) {
+	a, b := NewSketch(0), NewSketch(0)
+	var top float64
+	for i := -30000; i < 30000; i++ { // 30 decades
+		top = math.Pow(10, float64(i)/2000)
+		a.Add(top, 1)
+	}
+	assert.LessOrEqual(t, len(a.bins), maxSketchBins)
+	assert.Equal(t, top, a.Quantile(1))
+	assert.InEpsilon(t, 1.0, a.Quantile(0.5), 0.01) // merged bins are all below the median
+
+	b.Add(5, 1)
+	require.NoError(t, b.Merge(a))
+	assert.Equal(t, a.Count()+1, b.Count())
+	assert.LessOrEqual(t, len(b.bins), maxSketchBins)
+
+	c := NewSketch(0.05)
+	c.Add(5, 1)
+	require.ErrorIs(t, c.Merge(a), ErrSketchAccuracy)
+	assert.Equal(t, 1, c.Count())
+	require.NoError(t, c.Merge(NewSketch(0)), "empty sketches merge regardless of accuracy")
+}
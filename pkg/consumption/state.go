@@ -0,0 +1,349 @@
+//go:build linux
+
+package consumption
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// StateVersion is the version written by State and the binary/JSON
+// encodings. Restore accepts this version only.
+const StateVersion = 1
+
+var (
+	ErrStateVersion = errors.New("consumption: unsupported state version")
+	ErrBadState     = errors.New("consumption: invalid state")
+	ErrNoConfig     = errors.New("consumption: accumulator has no config; build it with New")
+)
+
+// stateMagic prefixes the binary encoding.
+var stateMagic = [4]byte{'C', 'A', 'C', 'C'}
+
+// State is a checkpoint of an Accumulator's running totals. It does not
+// include the coefficients: restore it into an accumulator built by New
+// with the same Config to keep results consistent.
+type State struct {
+	Version     int     `json:"version"`
+	Samples     int     `json:"samples"`
+	DurationSec float64 `json:"duration_sec"`
+
+	EnergyJ float64     `json:"energy_j"`
+	CPUJ    float64     `json:"cpu_j"`
+	DiskJ   float64     `json:"disk_j"`
+	RAMJ    float64     `json:"ram_j"`
+	IdleJ   float64     `json:"idle_share_j"`
+	PTotal  MomentState `json:"p_total"`
+	PTotalQ SketchState `json:"p_total_sketch"`
+}
+
+// MomentState is the weighted running mean/variance of a power series.
+type MomentState struct {
+	Weight float64 `json:"weight"`
+	Mean   float64 `json:"mean"`
+	M2     float64 `json:"m2"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+}
+
+// SketchState is the serialized form of a Sketch.
+type SketchState struct {
+	Gamma  float64         `json:"gamma"`
+	Bins   map[int]float64 `json:"bins,omitempty"`
+	Zero   float64         `json:"zero,omitempty"`
+	Weight float64         `json:"weight"`
+	Count  int             `json:"count"`
+	Min    float64         `json:"min"`
+	Max    float64         `json:"max"`
+}
+
+// State returns a checkpoint of the running totals.
+func (a *Accumulator) State() State {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return State{
+		Version:     StateVersion,
+		Samples:     a.count,
+		DurationSec: a.durSec,
+		EnergyJ:     a.energyCumJ,
+		CPUJ:        a.eCPU,
+		DiskJ:       a.eDisk,
+		RAMJ:        a.eRAM,
+		IdleJ:       a.eIdle,
+		PTotal:      a.total.state(),
+		PTotalQ:     a.total.sketch.state(),
+	}
+}
+
+// Restore replaces the running totals with st. The coefficients are not
+// part of st, so a zero Accumulator is rejected with ErrNoConfig.
+func (a *Accumulator) Restore(st State) error {
+	if st.Version != StateVersion {
+		return fmt.Errorf("%w: %d (want %d)", ErrStateVersion, st.Version, StateVersion)
+	}
+	if err := st.validate(); err != nil {
+		return err
+	}
+	sk, err := st.PTotalQ.sketch()
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.cfg == nil {
+		return ErrNoConfig
+	}
+	a.count = st.Samples
+	a.durSec = st.DurationSec
+	a.energyCumJ = st.EnergyJ
+	a.eCPU, a.eDisk, a.eRAM, a.eIdle = st.CPUJ, st.DiskJ, st.RAMJ, st.IdleJ
+	a.total = newPowerStats()
+	a.total.restore(st.PTotal)
+	a.total.sketch = sk
+	return nil
+}
+
+func (st State) validate() error {
+	if st.Samples < 0 || st.DurationSec < 0 || st.PTotal.Weight < 0 {
+		return fmt.Errorf("%w: negative counters", ErrBadState)
+	}
+	for _, v := range []float64{st.DurationSec, st.EnergyJ, st.CPUJ, st.DiskJ, st.RAMJ, st.IdleJ,
+		st.PTotal.Weight, st.PTotal.Mean, st.PTotal.M2, st.PTotal.Min, st.PTotal.Max} {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Errorf("%w: non-finite value", ErrBadState)
+		}
+	}
+	return nil
+}
+
+// Merge adds o's totals to a, e.g. to combine shards that saw disjoint
+// ticks. The coefficients of a are kept; a zero Accumulator takes o's.
+// Merging sketches of different accuracy fails and leaves a unchanged.
+func (a *Accumulator) Merge(o *Accumulator) error {
+	if o == nil {
+		return nil
+	}
+	o.mu.Lock()
+	cfg, model := o.cfg, o.model
+	o.mu.Unlock()
+	if cfg == nil {
+		return nil // a zero Accumulator has nothing to merge
+	}
+	st := o.State()
+	sk, err := st.PTotalQ.sketch()
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.cfg == nil {
+		a.cfg, a.model = cfg, model
+		a.total = newPowerStats()
+		a.total.sketch = sk
+	} else if err := a.total.sketch.Merge(sk); err != nil {
+		return err
+	}
+	a.count += st.Samples
+	a.durSec += st.DurationSec
+	a.energyCumJ += st.EnergyJ
+	a.eCPU += st.CPUJ
+	a.eDisk += st.DiskJ
+	a.eRAM += st.RAMJ
+	a.eIdle += st.IdleJ
+	a.total.merge(st.PTotal)
+	return nil
+}
+
+// MarshalJSON encodes the accumulator's State.
+func (a *Accumulator) MarshalJSON() ([]byte, error) { return json.Marshal(a.State()) }
+
+// UnmarshalJSON restores a State written by MarshalJSON.
+func (a *Accumulator) UnmarshalJSON(b []byte) error {
+	var st State
+	if err := json.Unmarshal(b, &st); err != nil {
+		return err
+	}
+	return a.Restore(st)
+}
+
+// MarshalBinary encodes the accumulator's State compactly.
+func (a *Accumulator) MarshalBinary() ([]byte, error) { return a.State().MarshalBinary() }
+
+// UnmarshalBinary restores a State written by MarshalBinary.
+func (a *Accumulator) UnmarshalBinary(b []byte) error {
+	var st State
+	if err := st.UnmarshalBinary(b); err != nil {
+		return err
+	}
+	return a.Restore(st)
+}
+
+// stateHeader is the fixed-size part of the binary encoding.
+type stateHeader struct {
+	Samples     int64
+	DurationSec float64
+	EnergyJ     float64
+	CPUJ        float64
+	DiskJ       float64
+	RAMJ        float64
+	IdleJ       float64
+	PTotal      MomentState
+
+	Gamma   float64
+	Zero    float64
+	SWeight float64
+	SCount  int64
+	SMin    float64
+	SMax    float64
+	NBins   uint32
+}
+
+type stateBin struct {
+	Key    int32
+	Weight float64
+}
+
+// MarshalBinary encodes st as magic, version, a fixed little-endian header
+// and the sketch bins sorted by key.
+func (st State) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(stateMagic[:])
+	h := stateHeader{
+		Samples: int64(st.Samples), DurationSec: st.DurationSec,
+		EnergyJ: st.EnergyJ, CPUJ: st.CPUJ, DiskJ: st.DiskJ, RAMJ: st.RAMJ, IdleJ: st.IdleJ,
+		PTotal: st.PTotal,
+		Gamma:  st.PTotalQ.Gamma, Zero: st.PTotalQ.Zero, SWeight: st.PTotalQ.Weight,
+		SCount: int64(st.PTotalQ.Count), SMin: st.PTotalQ.Min, SMax: st.PTotalQ.Max,
+		NBins: uint32(len(st.PTotalQ.Bins)),
+	}
+	keys := make([]int, 0, len(st.PTotalQ.Bins))
+	for k := range st.PTotalQ.Bins {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	bins := make([]stateBin, len(keys))
+	for i, k := range keys {
+		bins[i] = stateBin{Key: int32(k), Weight: st.PTotalQ.Bins[k]}
+	}
+	for _, v := range []any{uint16(st.Version), h, bins} {
+		if err := binary.Write(&buf, binary.LittleEndian, v); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a State written by MarshalBinary.
+func (st *State) UnmarshalBinary(b []byte) error {
+	r := bytes.NewReader(b)
+	var magic [4]byte
+	if _, err := r.Read(magic[:]); err != nil || magic != stateMagic {
+		return fmt.Errorf("%w: bad magic", ErrBadState)
+	}
+	var ver uint16
+	if err := binary.Read(r, binary.LittleEndian, &ver); err != nil {
+		return fmt.Errorf("%w: %v", ErrBadState, err)
+	}
+	if ver != StateVersion {
+		return fmt.Errorf("%w: %d (want %d)", ErrStateVersion, ver, StateVersion)
+	}
+	var h stateHeader
+	if err := binary.Read(r, binary.LittleEndian, &h); err != nil {
+		return fmt.Errorf("%w: %v", ErrBadState, err)
+	}
+	if h.NBins > maxSketchBins {
+		return fmt.Errorf("%w: %d sketch bins", ErrBadState, h.NBins)
+	}
+	bins := make([]stateBin, h.NBins)
+	if err := binary.Read(r, binary.LittleEndian, bins); err != nil {
+		return fmt.Errorf("%w: %v", ErrBadState, err)
+	}
+	*st = State{
+		Version: int(ver), Samples: int(h.Samples), DurationSec: h.DurationSec,
+		EnergyJ: h.EnergyJ, CPUJ: h.CPUJ, DiskJ: h.DiskJ, RAMJ: h.RAMJ, IdleJ: h.IdleJ,
+		PTotal: h.PTotal,
+		PTotalQ: SketchState{
+			Gamma: h.Gamma, Zero: h.Zero, Weight: h.SWeight,
+			Count: int(h.SCount), Min: h.SMin, Max: h.SMax,
+			Bins: make(map[int]float64, len(bins)),
+		},
+	}
+	for _, bn := range bins {
+		st.PTotalQ.Bins[int(bn.Key)] = bn.Weight
+	}
+	return nil
+}
+
+func (p *powerStats) state() MomentState {
+	if p.w <= 0 {
+		return MomentState{}
+	}
+	return MomentState{Weight: p.w, Mean: p.mean, M2: p.m2, Min: p.min, Max: p.max}
+}
+
+func (p *powerStats) restore(m MomentState) {
+	if m.Weight <= 0 {
+		return
+	}
+	p.w, p.mean, p.m2, p.min, p.max = m.Weight, m.Mean, m.M2, m.Min, m.Max
+}
+
+// merge combines two weighted moment sets (Chan et al.).
+func (p *powerStats) merge(m MomentState) {
+	if m.Weight <= 0 {
+		return
+	}
+	w := p.w + m.Weight
+	d := m.Mean - p.mean
+	p.m2 += m.M2 + d*d*p.w*m.Weight/w
+	p.mean += d * m.Weight / w
+	p.w = w
+	p.min = math.Min(p.min, m.Min)
+	p.max = math.Max(p.max, m.Max)
+}
+
+// state returns s in serializable form; an empty sketch has Min = Max = 0.
+func (s *Sketch) state() SketchState {
+	st := SketchState{Gamma: s.gamma, Zero: s.zero, Weight: s.total, Count: s.count}
+	if s.count > 0 {
+		st.Min, st.Max = s.min, s.max
+		st.Bins = make(map[int]float64, len(s.bins))
+		for k, w := range s.bins {
+			st.Bins[k] = w
+		}
+	}
+	return st
+}
+
+// sketch rebuilds a Sketch from st. Weights and values must be finite and
+// non-negative.
+func (st SketchState) sketch() (*Sketch, error) {
+	if st.Gamma <= 1 || math.IsInf(st.Gamma, 0) || len(st.Bins) > maxSketchBins || st.Count < 0 {
+		return nil, fmt.Errorf("%w: sketch", ErrBadState)
+	}
+	bad := func(v float64) bool { return v < 0 || math.IsNaN(v) || math.IsInf(v, 0) }
+	if bad(st.Zero) || bad(st.Weight) || bad(st.Min) || bad(st.Max) {
+		return nil, fmt.Errorf("%w: sketch totals", ErrBadState)
+	}
+	for _, w := range st.Bins {
+		if bad(w) {
+			return nil, fmt.Errorf("%w: sketch bin weight", ErrBadState)
+		}
+	}
+	s := &Sketch{gamma: st.Gamma, logG: math.Log(st.Gamma), bins: make(map[int]float64, len(st.Bins)),
+		zero: st.Zero, total: st.Weight, count: st.Count, min: math.Inf(1), max: math.Inf(-1)}
+	for k, w := range st.Bins {
+		s.bins[k] = w
+	}
+	if st.Count > 0 {
+		s.min, s.max = st.Min, st.Max
+	}
+	return s, nil
+}
@@ -0,0 +1,199 @@
+//go:build linux
+
+package consumption
+
+import (
+	"encoding/json"
+	"math"
+	"sync"
+	"testing"
+
+	"github.com/ja7ad/consumption/pkg/system/proc"
+	"github.com/ja7ad/consumption/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func stateSnaps() []proc.Snapshot {
+	var out []proc.Snapshot
+	for i := range 40 {
+		out = append(out, proc.Snapshot{
+			TimeSec: 0.5 + float64(i%3)*0.25, UVm: 0.2 + 0.02*float64(i%10), UProc: 0.1 + 0.01*float64(i%7),
+			ReadBytes: types.Bytes(100_000 * (i % 4)), RSSChurnBytes: types.Bytes(50_000 * (i % 5)),
+		})
+	}
+	return out
+}
+
+func TestAccumulator_StateRoundTrip(t *testing.T) {
+	cfg := &Config{PIdle: 5, PMax: 20, Gamma: 1.3, ER: 4.8e-8, EW: 9.5e-8, EMemRSS: 3e-10, Alpha: 0.3}
+	snaps := stateSnaps()
+
+	// reference: one uninterrupted accumulator
+	ref := New(cfg)
+	for _, s := range snaps {
+		ref.Apply(s)
+	}
+
+	// checkpoint halfway, restore into a fresh accumulator and continue
+	for name, codec := range map[string]struct {
+		enc func(*Accumulator) ([]byte, error)
+		dec func(*Accumulator, []byte) error
+	}{
+		"json":   {func(a *Accumulator) ([]byte, error) { return json.Marshal(a) }, func(a *Accumulator, b []byte) error { return json.Unmarshal(b, a) }},
+		"binary": {(*Accumulator).MarshalBinary, (*Accumulator).UnmarshalBinary},
+	} {
+		a := New(cfg)
+		for _, s := range snaps[:20] {
+			a.Apply(s)
+		}
+		b, err := codec.enc(a)
+		require.NoError(t, err, name)
+
+		restored := New(cfg)
+		require.NoError(t, codec.dec(restored, b), name)
+		assert.Equal(t, a.Stats(), restored.Stats(), name)
+
+		for _, s := range snaps[20:] {
+			restored.Apply(s)
+		}
+		want, got := ref.Stats(), restored.Stats()
+		assert.Equal(t, want.Samples, got.Samples, name)
+		assert.InDelta(t, want.Energy.Total, got.Energy.Total, 1e-9, name)
+		assert.InDelta(t, want.PTotal.StdDev, got.PTotal.StdDev, 1e-9, name)
+		assert.Equal(t, want.PTotal.P95, got.PTotal.P95, name)
+	}
+}
+
+func TestAccumulator_RestoreRejects(t *testing.T) {
+	a := New(nil)
+	st := a.State()
+	st.Version = 99
+	assert.ErrorIs(t, a.Restore(st), ErrStateVersion)
+
+	b, err := New(nil).MarshalBinary()
+	require.NoError(t, err)
+	assert.ErrorIs(t, a.UnmarshalBinary(b[:10]), ErrBadState)
+	assert.ErrorIs(t, a.UnmarshalBinary([]byte("nope")), ErrBadState)
+	b[4] = 99 // version
+	assert.ErrorIs(t, a.UnmarshalBinary(b), ErrStateVersion)
+
+	st = a.State()
+	st.Samples = -1
+	assert.ErrorIs(t, a.Restore(st), ErrBadState)
+
+	// a zero Accumulator has no coefficients to continue with
+	var z Accumulator
+	assert.ErrorIs(t, z.Restore(New(nil).State()), ErrNoConfig)
+	assert.Nil(t, z.cfg)
+
+	// corrupt sketches are rejected
+	src := New(nil)
+	for _, s := range stateSnaps() {
+		src.Apply(s)
+	}
+	var k int
+	for k = range src.State().PTotalQ.Bins {
+		break
+	}
+	for name, corrupt := range map[string]func(*SketchState){
+		"nan bin":      func(q *SketchState) { q.Bins[k] = math.NaN() },
+		"negative bin": func(q *SketchState) { q.Bins[k] = -1 },
+		"inf zero":     func(q *SketchState) { q.Zero = math.Inf(1) },
+		"nan weight":   func(q *SketchState) { q.Weight = math.NaN() },
+		"negative min": func(q *SketchState) { q.Min = -1 },
+		"inf max":      func(q *SketchState) { q.Max = math.Inf(1) },
+	} {
+		st := src.State()
+		corrupt(&st.PTotalQ)
+		assert.ErrorIs(t, a.Restore(st), ErrBadState, name)
+	}
+}
+
+func TestAccumulator_Merge(t *testing.T) {
+	snaps := stateSnaps()
+	ref, a, b := New(nil), New(nil), New(nil)
+	for i, s := range snaps {
+		ref.Apply(s)
+		if i%2 == 0 {
+			a.Apply(s)
+		} else {
+			b.Apply(s)
+		}
+	}
+	require.NoError(t, a.Merge(b))
+
+	want, got := ref.Stats(), a.Stats()
+	assert.Equal(t, want.Samples, got.Samples)
+	assert.InDelta(t, want.DurationSec, got.DurationSec, 1e-9)
+	assert.InDelta(t, want.Energy.Total, got.Energy.Total, 1e-9)
+	assert.InDelta(t, want.Energy.Disk, got.Energy.Disk, 1e-9)
+	assert.InDelta(t, want.Avg.PTotal, got.Avg.PTotal, 1e-9)
+	assert.InDelta(t, want.PTotal.Mean, got.PTotal.Mean, 1e-9)
+	assert.InDelta(t, want.PTotal.StdDev, got.PTotal.StdDev, 1e-9)
+	assert.Equal(t, want.PTotal.Min, got.PTotal.Min)
+	assert.Equal(t, want.PTotal.Max, got.PTotal.Max)
+	assert.Equal(t, want.PTotal.P50, got.PTotal.P50)
+}
+
+func TestAccumulator_Concurrent(t *testing.T) {
+	a := New(nil)
+	s := proc.Snapshot{TimeSec: 1, UVm: 0.5, UProc: 0.25}
+	want := New(nil).Apply(s).PTotal
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for range 500 {
+				a.Apply(s)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range 500 {
+				_ = a.EnergyCumJ()
+				_ = a.Stats()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 4000, a.Stats().Samples)
+	assert.InDelta(t, 4000*want, a.EnergyCumJ(), 1e-6)
+}
+
+func TestAccumulator_MergeIntoZero(t *testing.T) {
+	src := New(&Config{PIdle: 5, PMax: 20, Gamma: 1.3})
+	for _, s := range stateSnaps() {
+		src.Apply(s)
+	}
+	var z Accumulator
+	require.NoError(t, z.Merge(&Accumulator{}), "a zero source adds nothing")
+	assert.Nil(t, z.cfg)
+
+	require.NoError(t, z.Merge(src))
+	assert.Equal(t, src.Stats(), z.Stats())
+	assert.Equal(t, src.cfg, z.cfg, "a zero receiver takes the source's coefficients")
+
+	snap := proc.Snapshot{TimeSec: 1, UVm: 0.5, UProc: 0.5}
+	assert.Equal(t, src.Estimate(snap), z.Estimate(snap))
+}
+
+func TestAccumulator_MergeSketchAccuracy(t *testing.T) {
+	a, b := New(nil), New(nil)
+	snap := proc.Snapshot{TimeSec: 1, UVm: 0.5, UProc: 0.5}
+	a.Apply(snap)
+	b.Apply(snap)
+	b.total.sketch = NewSketch(0.05)
+	b.total.sketch.Add(10, 1)
+
+	want := a.State()
+	require.ErrorIs(t, a.Merge(b), ErrSketchAccuracy)
+	assert.Equal(t, want, a.State(), "a failed merge changes nothing")
+
+	// a zero receiver adopts the source's sketch accuracy instead
+	var z Accumulator
+	require.NoError(t, z.Merge(b))
+	assert.Equal(t, b.total.sketch.gamma, z.total.sketch.gamma)
+}
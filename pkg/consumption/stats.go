@@ -0,0 +1,114 @@
+//go:build linux
+
+package consumption
+
+import "math"
+
+// Stats summarizes everything an Accumulator has seen. Averages, spread and
+// percentiles are weighted by tick length, so uneven intervals do not skew
+// them.
+type Stats struct {
+	Samples     int
+	DurationSec float64
+
+	Avg    Result // time-weighted average power (W)
+	Energy Energy // cumulative energy (J)
+	PTotal Spread // distribution of per-tick P_total (W)
+}
+
+// Energy is cumulative energy per component in Joules. IdleShare is the
+// idle power charged via Alpha; Total is the sum of all components.
+type Energy struct {
+	CPU       float64
+	Disk      float64
+	RAM       float64
+	IdleShare float64
+	Total     float64
+}
+
+// Spread describes a time-weighted power distribution. Percentiles come
+// from a Sketch and are accurate to DefaultSketchAccuracy.
+type Spread struct {
+	Min    float64
+	Max    float64
+	Mean   float64
+	StdDev float64 // population
+	P50    float64
+	P95    float64
+	P99    float64
+}
+
+// Stats returns the running statistics.
+func (a *Accumulator) Stats() Stats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return Stats{
+		Samples:     a.count,
+		DurationSec: a.durSec,
+		Avg:         a.averages(),
+		Energy: Energy{
+			CPU:       a.eCPU,
+			Disk:      a.eDisk,
+			RAM:       a.eRAM,
+			IdleShare: a.eIdle,
+			Total:     a.energyCumJ,
+		},
+		PTotal: a.total.spread(),
+	}
+}
+
+// Series accumulates the same time-weighted spread as Stats.PTotal for any
+// power series, e.g. the per-tick sum of several accumulators. It is not
+// safe for concurrent use.
+type Series struct {
+	p powerStats
+}
+
+// NewSeries returns an empty series.
+func NewSeries() *Series { return &Series{p: newPowerStats()} }
+
+// Add records watts held for dtSec seconds; dtSec <= 0 is ignored.
+func (s *Series) Add(watts, dtSec float64) {
+	if dtSec > 0 {
+		s.p.add(watts, dtSec)
+	}
+}
+
+// Spread returns the statistics so far.
+func (s *Series) Spread() Spread { return s.p.spread() }
+
+// powerStats is a weighted Welford accumulator plus a quantile sketch.
+type powerStats struct {
+	w, mean, m2 float64
+	min, max    float64
+	sketch      *Sketch
+}
+
+func newPowerStats() powerStats {
+	return powerStats{min: math.Inf(1), max: math.Inf(-1), sketch: NewSketch(0)}
+}
+
+func (p *powerStats) add(v, w float64) {
+	p.w += w
+	d := v - p.mean
+	p.mean += d * w / p.w
+	p.m2 += w * d * (v - p.mean)
+	p.min = math.Min(p.min, v)
+	p.max = math.Max(p.max, v)
+	p.sketch.Add(v, w)
+}
+
+func (p *powerStats) spread() Spread {
+	if p.w <= 0 {
+		return Spread{}
+	}
+	return Spread{
+		Min:    p.min,
+		Max:    p.max,
+		Mean:   p.mean,
+		StdDev: math.Sqrt(math.Max(p.m2/p.w, 0)),
+		P50:    p.sketch.Quantile(0.50),
+		P95:    p.sketch.Quantile(0.95),
+		P99:    p.sketch.Quantile(0.99),
+	}
+}
@@ -0,0 +1,76 @@
+//go:build linux
+
+package consumption
+
+import (
+	"math"
+	"testing"
+
+	"github.com/ja7ad/consumption/pkg/system/proc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccumulator_Stats_TimeWeighted_WithLogs(t *testing.T) {
+	cfg := &Config{PIdle: 5, PMax: 20, Gamma: 1, ER: 1e-6, EMemRSS: 1e-6, Alpha: 0.5}
+	acc := New(cfg)
+
+	// a short busy tick and a long quiet one
+	snaps := []proc.Snapshot{
+		{TimeSec: 1, UVm: 1, UProc: 1, ReadBytes: 1_000_000},
+		{TimeSec: 9, UVm: 0.1, UProc: 0.1, RSSChurnBytes: 900_000},
+	}
+	var res []Result
+	for _, s := range snaps {
+		res = append(res, acc.Apply(s))
+	}
+	st := acc.Stats()
+	t.Logf("stats: %+v", st)
+
+	require.Equal(t, 2, st.Samples)
+	assert.InDelta(t, 10.0, st.DurationSec, 1e-12)
+
+	// per-component energy adds up to the total
+	e := st.Energy
+	assert.InDelta(t, 15.0+9*1.5, e.CPU, 1e-9)
+	assert.InDelta(t, 1.0, e.Disk, 1e-9)
+	assert.InDelta(t, 0.9, e.RAM, 1e-9)
+	assert.InDelta(t, 2.5+9*2.5, e.IdleShare, 1e-9)
+	assert.InDelta(t, e.CPU+e.Disk+e.RAM+e.IdleShare, e.Total, 1e-9)
+	assert.InDelta(t, acc.EnergyCumJ(), e.Total, 1e-12)
+
+	// time-weighted, not the plain mean of the two ticks
+	want := (res[0].PTotal*1 + res[1].PTotal*9) / 10
+	assert.InDelta(t, want, st.Avg.PTotal, 1e-9)
+	assert.InDelta(t, want, st.PTotal.Mean, 1e-9)
+	assert.NotEqual(t, (res[0].PTotal+res[1].PTotal)/2, st.Avg.PTotal)
+
+	sd := math.Sqrt((1*math.Pow(res[0].PTotal-want, 2) + 9*math.Pow(res[1].PTotal-want, 2)) / 10)
+	assert.InDelta(t, sd, st.PTotal.StdDev, 1e-9)
+	assert.Equal(t, res[1].PTotal, st.PTotal.Min)
+	assert.Equal(t, res[0].PTotal, st.PTotal.Max)
+
+	// 90% of the time is spent in the quiet tick
+	assert.InEpsilon(t, res[1].PTotal, st.PTotal.P50, 0.01)
+	assert.InEpsilon(t, res[0].PTotal, st.PTotal.P95, 0.01)
+	assert.InEpsilon(t, res[0].PTotal, st.PTotal.P99, 0.01)
+}
+
+func TestAccumulator_Stats_Empty(t *testing.T) {
+	st := New(nil).Stats()
+	assert.Equal(t, Stats{}, st)
+}
+
+func TestSeries(t *testing.T) {
+	s := NewSeries()
+	assert.Equal(t, Spread{}, s.Spread())
+	s.Add(10, 3)
+	s.Add(2, 1)
+	s.Add(99, 0) // ignored
+	sp := s.Spread()
+	assert.InDelta(t, 8.0, sp.Mean, 1e-12)
+	assert.InDelta(t, math.Sqrt(12), sp.StdDev, 1e-12)
+	assert.Equal(t, 2.0, sp.Min)
+	assert.Equal(t, 10.0, sp.Max)
+	assert.InEpsilon(t, 10.0, sp.P50, 0.01)
+}
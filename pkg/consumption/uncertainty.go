@@ -0,0 +1,264 @@
+//go:build linux
+
+package consumption
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ja7ad/consumption/pkg/system/proc"
+)
+
+var (
+	ErrBadDist  = errors.New("consumption: invalid distribution")
+	ErrNoRanges = errors.New("consumption: no coefficient ranges")
+)
+
+// DefaultEnsembleSize is the Monte Carlo ensemble size used when n <= 0.
+const DefaultEnsembleSize = 1000
+
+// ParseDist parses a compact distribution spec around central:
+//
+//	18..25         uniform on [18, 25]
+//	±10% or +-10%  uniform on central·[0.9, 1.1]
+//	±2             uniform on [central-2, central+2]
+//	normal:0.1     normal, mean central, stddev 0.1
+//	normal:10%     normal, stddev 10% of central
+//	tri:18..25     triangular on [18, 25] with mode central
+func ParseDist(spec string, central float64) (Dist, error) {
+	s := strings.TrimSpace(spec)
+	bad := func(why string) (Dist, error) {
+		return Dist{}, fmt.Errorf("%w: %q: %s", ErrBadDist, spec, why)
+	}
+
+	amount := func(v string) (float64, error) {
+		if p, ok := strings.CutSuffix(v, "%"); ok {
+			f, err := strconv.ParseFloat(p, 64)
+			return math.Abs(central) * f / 100, err
+		}
+		return strconv.ParseFloat(v, 64)
+	}
+	bounds := func(v string) (float64, float64, error) {
+		lo, hi, ok := strings.Cut(v, "..")
+		if !ok {
+			return 0, 0, errors.New("want MIN..MAX")
+		}
+		a, err := strconv.ParseFloat(strings.TrimSpace(lo), 64)
+		if err != nil {
+			return 0, 0, err
+		}
+		b, err := strconv.ParseFloat(strings.TrimSpace(hi), 64)
+		return a, b, err
+	}
+
+	var d Dist
+	switch {
+	case strings.HasPrefix(s, "normal:"):
+		sd, err := amount(strings.TrimPrefix(s, "normal:"))
+		if err != nil {
+			return bad(err.Error())
+		}
+		d = Dist{Kind: DistNormal, StdDev: sd}
+	case strings.HasPrefix(s, "tri:"):
+		a, b, err := bounds(strings.TrimPrefix(s, "tri:"))
+		if err != nil {
+			return bad(err.Error())
+		}
+		d = Dist{Kind: DistTriangular, Min: a, Max: b}
+	case strings.HasPrefix(s, "±") || strings.HasPrefix(s, "+-"):
+		w, err := amount(strings.TrimPrefix(strings.TrimPrefix(s, "±"), "+-"))
+		if err != nil {
+			return bad(err.Error())
+		}
+		d = Dist{Kind: DistUniform, Min: central - w, Max: central + w}
+	default:
+		a, b, err := bounds(s)
+		if err != nil {
+			return bad(err.Error())
+		}
+		d = Dist{Kind: DistUniform, Min: a, Max: b}
+	}
+	if err := d.validate(central); err != nil {
+		return Dist{}, fmt.Errorf("%q: %w", spec, err)
+	}
+	return d, nil
+}
+
+func (d Dist) validate(central float64) error {
+	switch d.Kind {
+	case DistUniform:
+		if d.Min > d.Max {
+			return fmt.Errorf("%w: min %g > max %g", ErrBadDist, d.Min, d.Max)
+		}
+	case DistTriangular:
+		if d.Min > d.Max {
+			return fmt.Errorf("%w: min %g > max %g", ErrBadDist, d.Min, d.Max)
+		}
+		if central < d.Min || central > d.Max {
+			return fmt.Errorf("%w: mode %g outside [%g, %g]", ErrBadDist, central, d.Min, d.Max)
+		}
+	case DistNormal:
+		if d.StdDev <= 0 {
+			return fmt.Errorf("%w: stddev must be > 0", ErrBadDist)
+		}
+	default:
+		return fmt.Errorf("%w: unknown kind %q (want %s|%s|%s)", ErrBadDist, d.Kind, DistUniform, DistNormal, DistTriangular)
+	}
+	return nil
+}
+
+// Sample draws one value; central is the coefficient's nominal value.
+// Results are never negative.
+func (d Dist) Sample(r *rand.Rand, central float64) float64 {
+	var v float64
+	switch d.Kind {
+	case DistUniform:
+		v = d.Min + r.Float64()*(d.Max-d.Min)
+	case DistNormal:
+		v = central + r.NormFloat64()*d.StdDev
+	case DistTriangular:
+		a, b, c := d.Min, d.Max, central
+		if b == a {
+			v = a
+			break
+		}
+		u := r.Float64()
+		if f := (c - a) / (b - a); u < f {
+			v = a + math.Sqrt(u*(b-a)*(c-a))
+		} else {
+			v = b - math.Sqrt((1-u)*(b-a)*(b-c))
+		}
+	default:
+		v = central
+	}
+	return math.Max(v, 0)
+}
+
+// CheckRanges validates every entry of c.Ranges against its coefficient.
+func (c Config) CheckRanges() error {
+	for name, d := range c.Ranges {
+		p, ok := c.Coefficient(name)
+		if !ok {
+			return fmt.Errorf("%w: unknown coefficient %q (want one of %s)", ErrBadDist, name, strings.Join(Coefficients, ", "))
+		}
+		if c.Model == ModelCurve && (name == "p_idle" || name == "p_max" || name == "gamma") {
+			return fmt.Errorf("%w: %s range needs the %s model", ErrBadDist, name, ModelPowerLaw)
+		}
+		if err := d.validate(*p); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Interval is a central estimate with a p5–p95 band.
+type Interval struct {
+	P5  float64
+	P50 float64
+	P95 float64
+}
+
+// Ensemble propagates coefficient uncertainty by Monte Carlo: every member
+// is an Accumulator whose coefficients were drawn once from Config.Ranges
+// and which then sees the same snapshot stream as the nominal model.
+type Ensemble struct {
+	members []*Accumulator
+	buf     []float64
+}
+
+// NewEnsemble draws n member configurations (DefaultEnsembleSize if n <= 0)
+// from cfg.Ranges using a deterministic seed.
+func NewEnsemble(cfg *Config, n int, seed uint64) (*Ensemble, error) {
+	if cfg == nil || len(cfg.Ranges) == 0 {
+		return nil, ErrNoRanges
+	}
+	if err := cfg.CheckRanges(); err != nil {
+		return nil, err
+	}
+	if n <= 0 {
+		n = DefaultEnsembleSize
+	}
+
+	// stable draw order regardless of map iteration
+	names := make([]string, 0, len(cfg.Ranges))
+	for name := range cfg.Ranges {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	// Members start from the config New would use, so defaults are filled
+	// once and sampled zeros stay zero instead of reverting to defaults.
+	base := *New(cfg).cfg
+	base.Ranges = nil
+
+	r := rand.New(rand.NewPCG(seed, seed^0x9e3779b97f4a7c15))
+	e := &Ensemble{members: make([]*Accumulator, n), buf: make([]float64, n)}
+	for i := range e.members {
+		m := base
+		for _, name := range names {
+			p, _ := m.Coefficient(name)
+			central, _ := base.Coefficient(name)
+			*p = cfg.Ranges[name].Sample(r, *central)
+		}
+		m.Alpha = math.Min(m.Alpha, 1)
+		m.PMax = math.Max(m.PMax, m.PIdle)
+		model, err := m.BuildModel()
+		if err != nil {
+			model = nil
+		}
+		e.members[i] = newAccumulator(&m, model)
+	}
+	return e, nil
+}
+
+// Size returns the number of members.
+func (e *Ensemble) Size() int { return len(e.members) }
+
+// Apply feeds snap to every member and returns the spread of P_total (W).
+func (e *Ensemble) Apply(snap proc.Snapshot) Interval {
+	for i, m := range e.members {
+		e.buf[i] = m.Apply(snap).PTotal
+	}
+	return quantiles(e.buf)
+}
+
+// EnergyCumJ returns the spread of cumulative energy (J).
+func (e *Ensemble) EnergyCumJ() Interval {
+	for i, m := range e.members {
+		e.buf[i] = m.EnergyCumJ()
+	}
+	return quantiles(e.buf)
+}
+
+// AvgPTotal returns the spread of average P_total (W).
+func (e *Ensemble) AvgPTotal() Interval {
+	for i, m := range e.members {
+		e.buf[i] = m.Averages().PTotal
+	}
+	return quantiles(e.buf)
+}
+
+// quantiles sorts xs in place and returns its 5th, 50th and 95th
+// percentiles (linear interpolation between order statistics).
+func quantiles(xs []float64) Interval {
+	slices.Sort(xs)
+	return Interval{P5: quantile(xs, 0.05), P50: quantile(xs, 0.50), P95: quantile(xs, 0.95)}
+}
+
+func quantile(sorted []float64, q float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	pos := q * float64(len(sorted)-1)
+	i := int(pos)
+	if i+1 >= len(sorted) {
+		return sorted[len(sorted)-1]
+	}
+	f := pos - float64(i)
+	return sorted[i]*(1-f) + sorted[i+1]*f
+}
@@ -0,0 +1,117 @@
+//go:build linux
+
+package consumption
+
+import (
+	"math/rand/v2"
+	"testing"
+
+	"github.com/ja7ad/consumption/pkg/system/proc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDist(t *testing.T) {
+	cases := map[string]Dist{
+		"18..25":     {Kind: DistUniform, Min: 18, Max: 25},
+		"±10%":       {Kind: DistUniform, Min: 18, Max: 22},
+		"+-2":        {Kind: DistUniform, Min: 18, Max: 22},
+		"normal:0.5": {Kind: DistNormal, StdDev: 0.5},
+		"normal:5%":  {Kind: DistNormal, StdDev: 1},
+		"tri:15..30": {Kind: DistTriangular, Min: 15, Max: 30},
+		" 20 .. 20 ": {Kind: DistUniform, Min: 20, Max: 20},
+	}
+	for spec, want := range cases {
+		got, err := ParseDist(spec, 20)
+		require.NoError(t, err, spec)
+		assert.InDelta(t, want.Min, got.Min, 1e-12, spec)
+		assert.InDelta(t, want.Max, got.Max, 1e-12, spec)
+		assert.InDelta(t, want.StdDev, got.StdDev, 1e-12, spec)
+		assert.Equal(t, want.Kind, got.Kind, spec)
+	}
+
+	for _, spec := range []string{"25..18", "normal:0", "tri:21..30", "lots", "normal:x"} {
+		_, err := ParseDist(spec, 20)
+		assert.ErrorIs(t, err, ErrBadDist, spec)
+	}
+}
+
+func TestDist_SampleStaysInBounds(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	uni := Dist{Kind: DistUniform, Min: 18, Max: 25}
+	tri := Dist{Kind: DistTriangular, Min: 18, Max: 25}
+	norm := Dist{Kind: DistNormal, StdDev: 10}
+	var sumTri float64
+	for range 5000 {
+		v := uni.Sample(r, 20)
+		assert.True(t, v >= 18 && v <= 25)
+		v = tri.Sample(r, 20)
+		assert.True(t, v >= 18 && v <= 25)
+		sumTri += v
+		assert.GreaterOrEqual(t, norm.Sample(r, 1), 0.0) // truncated
+	}
+	assert.InDelta(t, (18+25+20)/3.0, sumTri/5000, 0.1) // triangular mean
+}
+
+func TestConfig_CheckRanges(t *testing.T) {
+	cfg := *DefaultConfig()
+	cfg.Ranges = map[string]Dist{"p_max": {Kind: DistUniform, Min: 18, Max: 25}}
+	require.NoError(t, cfg.CheckRanges())
+
+	cfg.Ranges = map[string]Dist{"watts": {Kind: DistUniform}}
+	assert.ErrorIs(t, cfg.CheckRanges(), ErrBadDist)
+
+	cfg.Model, cfg.Curve = ModelCurve, []CurvePoint{{0, 1}, {1, 2}}
+	cfg.Ranges = map[string]Dist{"gamma": {Kind: DistNormal, StdDev: 0.1}}
+	assert.ErrorIs(t, cfg.CheckRanges(), ErrBadDist)
+}
+
+func TestEnsemble_BracketsNominal_WithLogs(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Ranges = map[string]Dist{
+		"p_max": {Kind: DistUniform, Min: 15, Max: 25},
+		"gamma": {Kind: DistTriangular, Min: 1.1, Max: 1.6},
+		"ew":    {Kind: DistNormal, StdDev: 2e-8},
+	}
+	ens, err := NewEnsemble(cfg, 500, 42)
+	require.NoError(t, err)
+	assert.Equal(t, 500, ens.Size())
+	nominal := New(cfg)
+
+	const MB = 1 << 20
+	snaps := []proc.Snapshot{
+		{TimeSec: 1, UVm: 0.3, UProc: 0.2, WriteBytes: 4 * MB},
+		{TimeSec: 1, UVm: 0.6, UProc: 0.5, WriteBytes: 1 * MB},
+		{TimeSec: 1, UVm: 0.9, UProc: 0.8},
+	}
+	for i, s := range snaps {
+		band := ens.Apply(s)
+		res := nominal.Apply(s)
+		t.Logf("tick %d: P_total %.3f W (p5 %.3f, p50 %.3f, p95 %.3f)", i, res.PTotal, band.P5, band.P50, band.P95)
+		assert.Less(t, band.P5, res.PTotal)
+		assert.Greater(t, band.P95, res.PTotal)
+		assert.LessOrEqual(t, band.P5, band.P50)
+		assert.LessOrEqual(t, band.P50, band.P95)
+	}
+	e := ens.EnergyCumJ()
+	assert.Less(t, e.P5, nominal.EnergyCumJ())
+	assert.Greater(t, e.P95, nominal.EnergyCumJ())
+	avg := ens.AvgPTotal()
+	assert.Less(t, avg.P5, avg.P95)
+
+	// Same seed, same draws.
+	again, err := NewEnsemble(cfg, 500, 42)
+	require.NoError(t, err)
+	assert.Equal(t, ens.Apply(snaps[0]), again.Apply(snaps[0]))
+
+	_, err = NewEnsemble(DefaultConfig(), 10, 1)
+	assert.ErrorIs(t, err, ErrNoRanges)
+}
+
+func TestQuantile(t *testing.T) {
+	q := quantiles([]float64{5, 1, 4, 2, 3})
+	assert.InDelta(t, 1.2, q.P5, 1e-12)
+	assert.InDelta(t, 3.0, q.P50, 1e-12)
+	assert.InDelta(t, 4.8, q.P95, 1e-12)
+	assert.Equal(t, Interval{}, quantiles(nil))
+}
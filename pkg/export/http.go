@@ -0,0 +1,453 @@
+//go:build linux
+
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/ja7ad/consumption/pkg/consumption"
+	"github.com/ja7ad/consumption/pkg/system/proc"
+	"github.com/ja7ad/consumption/pkg/system/util"
+)
+
+// UnmatchedRoute labels requests without a route (no ServeMux pattern).
+const UnmatchedRoute = "unmatched"
+
+// HTTPOptions configures NewHTTPMeter.
+type HTTPOptions struct {
+	// Config holds the model coefficients; nil means the defaults.
+	Config *consumption.Config
+	// Route names the route of a served request; nil means r.Pattern (set
+	// by http.ServeMux), or UnmatchedRoute when empty. Keep the number of
+	// routes bounded: raw URL paths make one series per path.
+	Route func(*http.Request) string
+	// Interval is the period of the whole-VM utilization sampling the
+	// model needs; 0 means one second.
+	Interval time.Duration
+	// CPU selects how Middleware measures the CPU time of a request; the
+	// zero value is CPUShare.
+	CPU CPUAccounting
+}
+
+// CPUAccounting selects how Middleware measures the CPU time of a request.
+type CPUAccounting int
+
+const (
+	// CPUShare splits the process CPU time evenly among the requests in
+	// flight, so each request is charged its share for the wall time it
+	// runs. It needs no thread locking and includes work handlers hand to
+	// other goroutines, but also spreads CPU time unrelated to requests
+	// (GC, background goroutines) over them.
+	CPUShare CPUAccounting = iota
+	// CPUThread reads the CPU clock of the OS thread serving the request,
+	// with the goroutine locked to it until the handler returns. It is
+	// exact for the handler goroutine, but runs one OS thread per request
+	// in flight: see Middleware.
+	CPUThread
+)
+
+// RouteStats is the cumulative cost of one route.
+type RouteStats struct {
+	Route    string
+	Requests uint64
+	Errors   uint64  // 5xx responses
+	CPUSec   float64 // handler CPU time
+	WallSec  float64 // handler wall time
+	// Energy is split into the CPU power attributed to the requests and
+	// their share of the idle power (Config.Alpha); Total adds both.
+	Energy consumption.Energy
+}
+
+// JoulesPerRequest returns the average energy of one request.
+func (s RouteStats) JoulesPerRequest() float64 {
+	if s.Requests == 0 {
+		return 0
+	}
+	return s.Energy.Total / float64(s.Requests)
+}
+
+// HTTPMeter attributes energy to HTTP requests. Middleware measures the
+// CPU time of each handler (see CPUAccounting) and costs it with the model
+// at the current VM utilization:
+//
+//	U_proc = cpu / (NumCPU · wall),  U_vm = max(U_vm sampled, U_proc)
+//	E      = (P_cpu + P_idle_share)(U_vm, U_proc) · wall
+//
+// Disk and memory activity is not attributed.
+type HTTPMeter struct {
+	acc   *consumption.Accumulator
+	route func(*http.Request) string
+	nproc float64
+	cpu   CPUAccounting
+	share cpuShares
+	uvm   atomic.Uint64 // math.Float64bits of the last U_vm
+
+	mu     sync.Mutex
+	routes map[string]*RouteStats
+
+	done      chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+}
+
+// NewHTTPMeter starts the VM utilization sampler. Close stops it.
+func NewHTTPMeter(o HTTPOptions) (*HTTPMeter, error) {
+	acc, err := consumption.NewChecked(o.Config)
+	if err != nil {
+		return nil, err
+	}
+	active, total, err := proc.ReadSystemCPU()
+	if err != nil {
+		return nil, err
+	}
+	m := &HTTPMeter{
+		acc:    acc,
+		route:  o.Route,
+		nproc:  float64(runtime.NumCPU()),
+		cpu:    o.CPU,
+		routes: make(map[string]*RouteStats),
+		done:   make(chan struct{}),
+	}
+	if m.route == nil {
+		m.route = func(r *http.Request) string { return r.Pattern }
+	}
+	interval := o.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	m.wg.Add(1)
+	go m.sampleVM(interval, active, total)
+	return m, nil
+}
+
+// Close stops the sampler. The collected stats stay readable.
+func (m *HTTPMeter) Close() error {
+	m.closeOnce.Do(func() {
+		close(m.done)
+		m.wg.Wait()
+	})
+	return nil
+}
+
+func (m *HTTPMeter) sampleVM(interval time.Duration, active, total uint64) {
+	defer m.wg.Done()
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-t.C:
+			a, tot, err := proc.ReadSystemCPU()
+			if err != nil {
+				continue
+			}
+			u := util.SafeDiv(float64(util.DeltaU64(a, active)), float64(util.DeltaU64(tot, total)))
+			m.uvm.Store(math.Float64bits(util.Clamp01(u)))
+			active, total = a, tot
+		}
+	}
+}
+
+// UVm returns the VM utilization of the last sampling tick.
+func (m *HTTPMeter) UVm() float64 { return math.Float64frombits(m.uvm.Load()) }
+
+// Middleware measures every request served by next.
+//
+// With CPUThread, each in-flight request keeps its OS thread locked until
+// the handler returns, including while it blocks on network I/O, so the
+// process runs one thread per concurrent request. The Go runtime crashes
+// the program beyond debug.SetMaxThreads (10000 by default): do not wrap
+// streaming, long-poll or websocket handlers, or servers that hold that
+// many slow clients, in that mode.
+func (m *HTTPMeter) Middleware(next http.Handler) http.Handler {
+	if m.cpu != CPUThread {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sw := &statusWriter{ResponseWriter: w}
+			per0 := m.share.begin()
+			start := time.Now()
+			defer func() {
+				cpu := m.share.end(per0)
+				m.Observe(m.route(r), cpu, time.Since(start).Seconds(), sw.status())
+			}()
+			next.ServeHTTP(sw, r)
+		})
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w}
+		runtime.LockOSThread()
+		cpu0 := threadCPU()
+		start := time.Now()
+		defer func() {
+			cpu := threadCPU() - cpu0
+			wall := time.Since(start).Seconds()
+			runtime.UnlockOSThread()
+			m.Observe(m.route(r), cpu, wall, sw.status())
+		}()
+		next.ServeHTTP(sw, r)
+	})
+}
+
+// Observe records a request of route that used cpuSec of CPU time over
+// wallSec and answered with status. Middleware calls it; use it directly
+// to account work measured elsewhere.
+//
+// Middleware with CPUThread passes the CPU time of the handler goroutine
+// only: CPU used by goroutines the handler starts is not counted. With
+// CPUShare it is, but spread over every request in flight.
+func (m *HTTPMeter) Observe(route string, cpuSec, wallSec float64, status int) {
+	if route == "" {
+		route = UnmatchedRoute
+	}
+	cpuSec, wallSec = math.Max(cpuSec, 0), math.Max(wallSec, 0)
+	var res consumption.Result
+	if wallSec > 0 {
+		up := util.Clamp01(cpuSec / (m.nproc * wallSec))
+		res = m.acc.Estimate(proc.Snapshot{TimeSec: wallSec, UVm: math.Max(m.UVm(), up), UProc: up})
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.routes[route]
+	if s == nil {
+		s = &RouteStats{Route: route}
+		m.routes[route] = s
+	}
+	s.Requests++
+	if status >= 500 {
+		s.Errors++
+	}
+	s.CPUSec += cpuSec
+	s.WallSec += wallSec
+	s.Energy.CPU += res.PCPU * wallSec
+	s.Energy.IdleShare += res.PIdleShare * wallSec
+	s.Energy.Total = s.Energy.CPU + s.Energy.IdleShare
+}
+
+// Routes returns every route seen so far, most energy first.
+func (m *HTTPMeter) Routes() []RouteStats {
+	m.mu.Lock()
+	out := make([]RouteStats, 0, len(m.routes))
+	for _, s := range m.routes {
+		out = append(out, *s)
+	}
+	m.mu.Unlock()
+	slices.SortFunc(out, func(a, b RouteStats) int {
+		if c := cmp.Compare(b.Energy.Total, a.Energy.Total); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Route, b.Route)
+	})
+	return out
+}
+
+// httpSummary is the JSON served by SummaryHandler.
+type httpSummary struct {
+	UVm    float64        `json:"vm_utilization"`
+	Joules float64        `json:"joules"`
+	Routes []routeSummary `json:"routes"`
+}
+
+type routeSummary struct {
+	Route            string  `json:"route"`
+	Requests         uint64  `json:"requests"`
+	Errors           uint64  `json:"errors"`
+	CPUSec           float64 `json:"cpu_seconds"`
+	WallSec          float64 `json:"wall_seconds"`
+	Joules           float64 `json:"joules"`
+	JoulesCPU        float64 `json:"joules_cpu"`
+	JoulesIdle       float64 `json:"joules_idle"`
+	JoulesPerRequest float64 `json:"joules_per_request"`
+}
+
+// WriteSummary writes the per-route totals as JSON, most energy first.
+func (m *HTTPMeter) WriteSummary(w io.Writer) error {
+	s := httpSummary{UVm: m.UVm(), Routes: []routeSummary{}}
+	for _, r := range m.Routes() {
+		s.Joules += r.Energy.Total
+		s.Routes = append(s.Routes, routeSummary{
+			Route:            r.Route,
+			Requests:         r.Requests,
+			Errors:           r.Errors,
+			CPUSec:           r.CPUSec,
+			WallSec:          r.WallSec,
+			Joules:           r.Energy.Total,
+			JoulesCPU:        r.Energy.CPU,
+			JoulesIdle:       r.Energy.IdleShare,
+			JoulesPerRequest: r.JoulesPerRequest(),
+		})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+// SummaryHandler serves WriteSummary, e.g. on /debug/energy.
+func (m *HTTPMeter) SummaryHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var buf bytes.Buffer
+		if err := m.WriteSummary(&buf); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(buf.Bytes())
+	})
+}
+
+// WritePrometheus writes the per-route totals in the Prometheus text
+// exposition format.
+func (m *HTTPMeter) WritePrometheus(w io.Writer) error {
+	routes := m.Routes()
+	var p promWriter
+
+	p.family("consumption_http_requests_total", "counter", "HTTP requests served.")
+	for _, r := range routes {
+		p.sample("consumption_http_requests_total", float64(r.Requests), "route", r.Route)
+	}
+	p.family("consumption_http_server_errors_total", "counter", "HTTP requests answered with a 5xx status.")
+	for _, r := range routes {
+		p.sample("consumption_http_server_errors_total", float64(r.Errors), "route", r.Route)
+	}
+	p.family("consumption_http_cpu_seconds_total", "counter", "Handler CPU time.")
+	for _, r := range routes {
+		p.sample("consumption_http_cpu_seconds_total", r.CPUSec, "route", r.Route)
+	}
+	p.family("consumption_http_duration_seconds_total", "counter", "Handler wall time.")
+	for _, r := range routes {
+		p.sample("consumption_http_duration_seconds_total", r.WallSec, "route", r.Route)
+	}
+	p.family("consumption_http_energy_joules_total", "counter", "Estimated energy of the requests by component (cpu, idle).")
+	for _, r := range routes {
+		p.sample("consumption_http_energy_joules_total", r.Energy.CPU, "route", r.Route, "component", "cpu")
+		p.sample("consumption_http_energy_joules_total", r.Energy.IdleShare, "route", r.Route, "component", "idle")
+	}
+	p.family("consumption_http_vm_utilization_ratio", "gauge", "Whole-VM CPU utilization used to cost requests [0..1].")
+	p.sample("consumption_http_vm_utilization_ratio", m.UVm())
+
+	_, err := w.Write(p.buf.Bytes())
+	return err
+}
+
+// MetricsHandler serves WritePrometheus, e.g. on /metrics.
+func (m *HTTPMeter) MetricsHandler() http.Handler { return promHandler(m.WritePrometheus) }
+
+// cpuShares splits the process CPU time among the requests in flight. per
+// is the CPU time charged to each request that was in flight throughout:
+// between two events (a request starting or ending) the process CPU time
+// is divided by the number of requests in flight. A request is charged
+// per(end) - per(begin).
+type cpuShares struct {
+	mu   sync.Mutex
+	n    int     // requests in flight
+	last float64 // process CPU time at the last event
+	per  float64
+}
+
+// settle charges the CPU time since the last event. c.mu is held.
+func (c *cpuShares) settle() {
+	now := cpuClock(unix.CLOCK_PROCESS_CPUTIME_ID)
+	if c.n > 0 {
+		c.per += math.Max(now-c.last, 0) / float64(c.n)
+	}
+	c.last = now
+}
+
+// begin registers a request and returns the per value to pass to end.
+func (c *cpuShares) begin() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.settle()
+	c.n++
+	return c.per
+}
+
+// end unregisters a request and returns the CPU time charged to it.
+func (c *cpuShares) end(per0 float64) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.settle()
+	c.n--
+	return c.per - per0
+}
+
+// threadCPU returns the CPU time of the calling OS thread in seconds.
+func threadCPU() float64 { return cpuClock(unix.CLOCK_THREAD_CPUTIME_ID) }
+
+// cpuClock reads a CPU-time clock in seconds, 0 on error.
+func cpuClock(id int32) float64 {
+	var ts unix.Timespec
+	if err := unix.ClockGettime(id, &ts); err != nil {
+		return 0
+	}
+	return float64(ts.Nano()) / 1e9
+}
+
+// statusWriter records the response status. It implements http.Flusher
+// and http.Hijacker for handlers that assert them; Unwrap keeps
+// http.ResponseController working (deadlines, full duplex).
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusWriter) Flush() {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Hijack passes through to the underlying connection, e.g. for websocket
+// upgrades. A hijacked request counts as 101 Switching Protocols unless
+// the handler wrote a status first.
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil && w.code == 0 {
+		w.code = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// status returns the recorded status, 200 when the handler wrote nothing.
+func (w *statusWriter) status() int {
+	if w.code == 0 {
+		return http.StatusOK
+	}
+	return w.code
+}
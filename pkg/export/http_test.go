@@ -0,0 +1,265 @@
+//go:build linux
+
+package export
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+
+	"github.com/ja7ad/consumption/pkg/consumption"
+	"github.com/ja7ad/consumption/pkg/system/proc"
+)
+
+func newTestHTTPMeter(t *testing.T, o HTTPOptions) *HTTPMeter {
+	t.Helper()
+	m, err := NewHTTPMeter(o)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = m.Close() })
+	return m
+}
+
+func spin(d time.Duration) {
+	var x uint64
+	for end := time.Now().Add(d); time.Now().Before(end); {
+		for i := range 1000 {
+			x += uint64(i) ^ x
+		}
+	}
+	_ = x
+}
+
+func get(t *testing.T, url string) (int, string) {
+	t.Helper()
+	resp, err := http.Get(url)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(b)
+}
+
+func TestHTTPMeter_Middleware(t *testing.T) {
+	for name, mode := range map[string]CPUAccounting{"share": CPUShare, "thread": CPUThread} {
+		t.Run(name, func(t *testing.T) { testMiddleware(t, mode) })
+	}
+}
+
+func testMiddleware(t *testing.T, mode CPUAccounting) {
+	m := newTestHTTPMeter(t, HTTPOptions{Interval: 10 * time.Millisecond, CPU: mode})
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /busy", func(w http.ResponseWriter, _ *http.Request) {
+		spin(30 * time.Millisecond)
+		_, _ = io.WriteString(w, "ok")
+	})
+	mux.HandleFunc("GET /sleep", func(w http.ResponseWriter, _ *http.Request) {
+		time.Sleep(30 * time.Millisecond)
+	})
+	mux.HandleFunc("GET /fail", func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "no", http.StatusServiceUnavailable)
+	})
+	srv := httptest.NewServer(m.Middleware(mux))
+	defer srv.Close()
+
+	for range 3 {
+		code, body := get(t, srv.URL+"/busy")
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, "ok", body)
+	}
+	get(t, srv.URL+"/sleep")
+	code, _ := get(t, srv.URL+"/fail")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	code, _ = get(t, srv.URL+"/nope")
+	require.Equal(t, http.StatusNotFound, code)
+
+	routes := map[string]RouteStats{}
+	for _, r := range m.Routes() {
+		routes[r.Route] = r
+	}
+	require.Len(t, routes, 4)
+
+	busy, sleep := routes["GET /busy"], routes["GET /sleep"]
+	assert.Equal(t, uint64(3), busy.Requests)
+	assert.Greater(t, busy.CPUSec, 0.05, "three 30ms spins")
+	assert.GreaterOrEqual(t, busy.WallSec, busy.CPUSec*0.9)
+	assert.Positive(t, busy.Energy.CPU)
+	assert.InDelta(t, busy.Energy.CPU+busy.Energy.IdleShare, busy.Energy.Total, 1e-12)
+	assert.InDelta(t, busy.Energy.Total/3, busy.JoulesPerRequest(), 1e-12)
+
+	assert.Less(t, sleep.CPUSec, busy.CPUSec/3, "sleeping uses little CPU")
+	assert.Less(t, sleep.Energy.Total, busy.Energy.Total/3)
+
+	assert.Equal(t, uint64(1), routes["GET /fail"].Errors)
+	assert.Zero(t, busy.Errors)
+	assert.Equal(t, uint64(1), routes[UnmatchedRoute].Requests)
+
+	assert.Equal(t, "GET /busy", m.Routes()[0].Route, "most energy first")
+}
+
+func TestHTTPMeter_SpawnedGoroutines(t *testing.T) {
+	// The handler's work runs on another goroutine: only CPUShare sees it.
+	cpuOf := func(mode CPUAccounting) float64 {
+		m := newTestHTTPMeter(t, HTTPOptions{CPU: mode})
+		h := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				spin(40 * time.Millisecond)
+			}()
+			<-done
+		}))
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		return m.Routes()[0].CPUSec
+	}
+	share, thread := cpuOf(CPUShare), cpuOf(CPUThread)
+	assert.Greater(t, share, 0.01)
+	assert.Less(t, thread, share/4)
+}
+
+func TestCPUShares(t *testing.T) {
+	var c cpuShares
+	a := c.begin()
+	cpu0 := cpuClock(unix.CLOCK_PROCESS_CPUTIME_ID)
+	spin(20 * time.Millisecond)
+	b := c.begin() // from here on, a and b share the process CPU time
+	spin(20 * time.Millisecond)
+	cpuA := c.end(a)
+	spin(20 * time.Millisecond)
+	cpuB := c.end(b)
+	total := cpuClock(unix.CLOCK_PROCESS_CPUTIME_ID) - cpu0
+
+	assert.Positive(t, cpuA)
+	assert.Positive(t, cpuB)
+	assert.InDelta(t, total, cpuA+cpuB, 0.002, "every CPU second is charged once")
+	assert.Zero(t, c.n)
+
+	// with nothing in flight, CPU time is charged to no one
+	spin(5 * time.Millisecond)
+	assert.Less(t, c.end(c.begin()), 0.001)
+}
+
+func TestHTTPMeter_Observe(t *testing.T) {
+	cfg := &consumption.Config{PIdle: 6, PMax: 20, Gamma: 1, Alpha: 0.5}
+	m := newTestHTTPMeter(t, HTTPOptions{Config: cfg, Interval: time.Hour})
+
+	m.Observe("a", 0.5, 1, 200)
+	m.Observe("", 0, 0, 500)
+
+	up := 0.5 / m.nproc
+	want := consumption.New(cfg).Estimate(proc.Snapshot{TimeSec: 1, UVm: up, UProc: up})
+	rs := m.Routes()
+	require.Len(t, rs, 2)
+	assert.Equal(t, "a", rs[0].Route)
+	assert.InDelta(t, want.PCPU, rs[0].Energy.CPU, 1e-12)
+	assert.InDelta(t, want.PIdleShare, rs[0].Energy.IdleShare, 1e-12)
+	assert.InDelta(t, 3.0, rs[0].Energy.IdleShare, 1e-12, "alone on the VM: the whole alpha·P_idle")
+
+	assert.Equal(t, UnmatchedRoute, rs[1].Route)
+	assert.Zero(t, rs[1].Energy.Total)
+	assert.Equal(t, uint64(1), rs[1].Errors)
+}
+
+func TestHTTPMeter_Handlers(t *testing.T) {
+	m := newTestHTTPMeter(t, HTTPOptions{
+		Interval: time.Hour,
+		Route:    func(r *http.Request) string { return strings.TrimPrefix(r.URL.Path, "/") },
+	})
+	m.Observe(`odd "route"`, 0.2, 0.4, 200)
+	m.Observe("b", 0.1, 0.4, 200)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m.MetricsHandler())
+	mux.Handle("/energy", m.SummaryHandler())
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	code, body := get(t, srv.URL+"/metrics")
+	require.Equal(t, http.StatusOK, code)
+	for _, line := range []string{
+		"# TYPE consumption_http_requests_total counter",
+		`consumption_http_requests_total{route="odd \"route\""} 1`,
+		`consumption_http_cpu_seconds_total{route="b"} 0.1`,
+		`consumption_http_duration_seconds_total{route="b"} 0.4`,
+		`consumption_http_energy_joules_total{route="b",component="cpu"} `,
+		`consumption_http_energy_joules_total{route="b",component="idle"} `,
+		`consumption_http_server_errors_total{route="b"} 0`,
+		"consumption_http_vm_utilization_ratio 0",
+	} {
+		assert.Contains(t, body, line)
+	}
+
+	code, body = get(t, srv.URL+"/energy")
+	require.Equal(t, http.StatusOK, code)
+	var sum httpSummary
+	require.NoError(t, json.Unmarshal([]byte(body), &sum))
+	require.Len(t, sum.Routes, 2)
+	assert.Equal(t, `odd "route"`, sum.Routes[0].Route)
+	assert.InDelta(t, sum.Routes[0].Joules+sum.Routes[1].Joules, sum.Joules, 1e-12)
+	assert.InDelta(t, sum.Routes[1].JoulesCPU+sum.Routes[1].JoulesIdle, sum.Routes[1].Joules, 1e-12)
+
+	resp, err := http.Post(srv.URL+"/energy", "text/plain", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+
+	// the custom Route sees the request path
+	h := m.Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/c", nil))
+	assert.True(t, slices.ContainsFunc(m.Routes(), func(r RouteStats) bool { return r.Route == "c" }))
+}
+
+func TestHTTPMeter_Flush(t *testing.T) {
+	m := newTestHTTPMeter(t, HTTPOptions{Interval: time.Hour})
+	h := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		require.NoError(t, http.NewResponseController(w).Flush())
+	}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.True(t, rec.Flushed)
+}
+
+func TestHTTPMeter_UVm(t *testing.T) {
+	m := newTestHTTPMeter(t, HTTPOptions{Interval: 5 * time.Millisecond})
+	done := make(chan struct{})
+	go func() { spin(100 * time.Millisecond); close(done) }()
+	require.Eventually(t, func() bool { return m.UVm() > 0 }, 2*time.Second, 5*time.Millisecond)
+	<-done
+	require.NoError(t, m.Close())
+	require.NoError(t, m.Close(), "Close is idempotent")
+}
+
+func TestHTTPMeter_Hijack(t *testing.T) {
+	m := newTestHTTPMeter(t, HTTPOptions{Interval: time.Hour})
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /ws", func(w http.ResponseWriter, _ *http.Request) {
+		hj, ok := w.(http.Hijacker)
+		require.True(t, ok)
+		conn, rw, err := hj.Hijack()
+		require.NoError(t, err)
+		defer conn.Close()
+		_, _ = rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: close\r\n\r\n")
+		_ = rw.Flush()
+	})
+	srv := httptest.NewServer(m.Middleware(mux))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/ws")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+
+	// the handler may still be returning when the client has read the response
+	require.Eventually(t, func() bool { return len(m.Routes()) == 1 }, time.Second, time.Millisecond)
+	rs := m.Routes()
+	assert.Equal(t, "GET /ws", rs[0].Route)
+	assert.Zero(t, rs[0].Errors)
+}
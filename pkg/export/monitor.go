@@ -0,0 +1,267 @@
+//go:build linux
+
+// Package export samples named targets continuously and publishes their
+// energy estimates to monitoring systems.
+//
+// A Monitor owns one Accumulator per target and drives a
+// proc.GroupCollector, so every target of a tick shares one U_vm reading.
+// Exporters read its state through Targets and Health.
+package export
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ja7ad/consumption/pkg/consumption"
+	"github.com/ja7ad/consumption/pkg/system/proc"
+	"github.com/ja7ad/consumption/pkg/system/util"
+)
+
+var (
+	ErrNoTargets = errors.New("export: no targets")
+	ErrBadTarget = errors.New("export: invalid target")
+)
+
+// Target is a named set of processes. Its selectors (see util.ResolvePIDs:
+// PIDs, ranges, name:, pg:, cgroup:) are re-resolved on every tick, so
+// processes that start or exit are followed.
+type Target struct {
+	Name      string
+	Selectors []string
+}
+
+// ParseTarget parses NAME=SELECTOR[,SELECTOR...].
+func ParseTarget(def string) (Target, error) {
+	name, sel, _ := strings.Cut(def, "=")
+	name = strings.TrimSpace(name)
+	var sels []string
+	for _, s := range strings.Split(sel, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			sels = append(sels, s)
+		}
+	}
+	if name == "" || len(sels) == 0 {
+		return Target{}, fmt.Errorf("%w: %q: want NAME=SELECTOR[,SELECTOR...]", ErrBadTarget, def)
+	}
+	return Target{Name: name, Selectors: sels}, nil
+}
+
+// TargetStats is a target's state after the last tick.
+type TargetStats struct {
+	Name string
+	// PIDs are the processes resolved at the last tick.
+	PIDs []int
+	// Up is true when at least one of them was alive and sampled.
+	Up bool
+	// Last is the power over the last tick and Snapshot its raw sample;
+	// both are zero while the target is down.
+	Last     consumption.Result
+	Snapshot proc.Snapshot
+	// Energy and the byte counters are cumulative since the Monitor started.
+	Energy     consumption.Energy
+	ReadBytes  uint64
+	WriteBytes uint64
+	// ResolveFailures counts selectors that failed or matched nothing.
+	ResolveFailures uint64
+}
+
+// Health describes the sampling loop.
+type Health struct {
+	Collector string
+	// Ticks and Errors count successful and failed ticks.
+	Ticks  uint64
+	Errors uint64
+	// LastError is the error of the last tick, empty when it succeeded.
+	LastError    string
+	LastTick     time.Time
+	LastDuration time.Duration
+	// UVm is the VM utilization of the last tick that sampled a target.
+	UVm float64
+}
+
+// Monitor samples targets on demand (Tick) or periodically (Run). It is
+// safe for concurrent use; ticks are serialized.
+type Monitor struct {
+	col     proc.GroupCollector
+	resolve func(sel []string) ([]int, error)
+
+	tickMu sync.Mutex
+	primed bool // the first sample only sets the collector's baselines
+
+	mu      sync.Mutex
+	targets []*targetState
+	health  Health
+}
+
+type targetState struct {
+	Target
+	acc *consumption.Accumulator
+	st  TargetStats
+}
+
+// NewMonitor builds a monitor over col, which must implement
+// proc.GroupCollector. name labels the collector in Health. The caller
+// keeps ownership of col.
+func NewMonitor(col proc.Collector, name string, cfg *consumption.Config, targets []Target) (*Monitor, error) {
+	gc, ok := col.(proc.GroupCollector)
+	if !ok {
+		return nil, fmt.Errorf("export: collector %s cannot sample several targets", name)
+	}
+	if len(targets) == 0 {
+		return nil, ErrNoTargets
+	}
+	m := &Monitor{col: gc, resolve: util.ResolvePIDs, health: Health{Collector: name}}
+	seen := map[string]bool{}
+	for _, t := range targets {
+		switch {
+		case t.Name == "" || len(t.Selectors) == 0:
+			return nil, fmt.Errorf("%w: %q needs a name and selectors", ErrBadTarget, t.Name)
+		case seen[t.Name]:
+			return nil, fmt.Errorf("%w: duplicate target %q", ErrBadTarget, t.Name)
+		}
+		seen[t.Name] = true
+		acc, err := consumption.NewChecked(cfg)
+		if err != nil {
+			return nil, err
+		}
+		m.targets = append(m.targets, &targetState{Target: t, acc: acc, st: TargetStats{Name: t.Name}})
+	}
+	return m, nil
+}
+
+// Tick resolves the targets and samples them over the last dtSec seconds.
+// Targets without live processes are marked down; an error is returned only
+// when the collector fails. The first tick only primes the collector.
+func (m *Monitor) Tick(dtSec float64) error {
+	m.tickMu.Lock()
+	defer m.tickMu.Unlock()
+
+	start := time.Now()
+	groups, owner, pids, failures := m.resolveAll()
+
+	var (
+		snaps []proc.GroupSnapshot
+		err   error
+	)
+	if len(groups) > 0 {
+		snaps, err = m.col.SampleGroups(groups, dtSec)
+		if errors.Is(err, proc.ErrAllExited) {
+			err = nil
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h := &m.health
+	h.LastDuration = time.Since(start)
+	for i, t := range m.targets {
+		t.st.PIDs = pids[i]
+		t.st.ResolveFailures += failures[i]
+		t.st.Up = false
+		t.st.Last, t.st.Snapshot = consumption.Result{}, proc.Snapshot{}
+	}
+	if err != nil {
+		h.Errors++
+		h.LastError = err.Error()
+		return err
+	}
+	h.Ticks++
+	h.LastTick = start
+	h.LastError = ""
+
+	for j, gs := range snaps {
+		if gs.Err != nil {
+			continue
+		}
+		h.UVm = gs.UVm
+		t := m.targets[owner[j]]
+		t.st.Up = true
+		if !m.primed {
+			continue
+		}
+		t.st.Last = t.acc.Apply(gs.Snapshot)
+		t.st.Snapshot = gs.Snapshot
+		t.st.ReadBytes += uint64(gs.ReadBytes)
+		t.st.WriteBytes += uint64(gs.WriteBytes)
+	}
+	m.primed = m.primed || snaps != nil
+	return nil
+}
+
+// resolveAll resolves every target's selectors one by one, so one selector
+// matching nothing does not hide the others. A PID claimed by an earlier
+// target is skipped. owner maps each group back to its target.
+func (m *Monitor) resolveAll() (groups []proc.Group, owner []int, pids [][]int, failures []uint64) {
+	pids = make([][]int, len(m.targets))
+	failures = make([]uint64, len(m.targets))
+	claimed := map[int]bool{}
+	for i, t := range m.targets {
+		var mine []int
+		for _, sel := range t.Selectors {
+			got, err := m.resolve([]string{sel})
+			if err != nil {
+				failures[i]++
+				continue
+			}
+			for _, pid := range got {
+				if !claimed[pid] {
+					claimed[pid] = true
+					mine = append(mine, pid)
+				}
+			}
+		}
+		pids[i] = mine
+		if len(mine) > 0 {
+			groups = append(groups, proc.Group{Name: t.Name, PIDs: mine})
+			owner = append(owner, i)
+		}
+	}
+	return groups, owner, pids, failures
+}
+
+// Run ticks every interval, using the measured time between ticks, until
+// ctx is done. Tick errors are logged and sampling continues.
+func (m *Monitor) Run(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		return errors.New("export: interval must be > 0")
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	last := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			dt := now.Sub(last).Seconds()
+			last = now
+			if err := m.Tick(dt); err != nil {
+				slog.Warn("sample error", "err", err)
+			}
+		}
+	}
+}
+
+// Targets returns the state of every target, in configuration order.
+func (m *Monitor) Targets() []TargetStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]TargetStats, len(m.targets))
+	for i, t := range m.targets {
+		out[i] = t.st
+		out[i].Energy = t.acc.Stats().Energy
+	}
+	return out
+}
+
+// Health returns the state of the sampling loop.
+func (m *Monitor) Health() Health {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.health
+}
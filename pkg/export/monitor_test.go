@@ -0,0 +1,198 @@
+//go:build linux
+
+package export
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ja7ad/consumption/pkg/consumption"
+	"github.com/ja7ad/consumption/pkg/system/proc"
+)
+
+// fakeGroups returns canned snapshots by group name; groups without one
+// report ErrAllExited.
+type fakeGroups struct {
+	snaps map[string]proc.Snapshot
+	err   error
+	calls [][]proc.Group
+}
+
+func (f *fakeGroups) Sample([]int, float64) (proc.Snapshot, error) { return proc.Snapshot{}, nil }
+func (f *fakeGroups) Close() error                                 { return nil }
+
+func (f *fakeGroups) SampleGroups(groups []proc.Group, dt float64) ([]proc.GroupSnapshot, error) {
+	f.calls = append(f.calls, groups)
+	if f.err != nil {
+		return nil, f.err
+	}
+	out := make([]proc.GroupSnapshot, len(groups))
+	alive := 0
+	for i, g := range groups {
+		s, ok := f.snaps[g.Name]
+		out[i] = proc.GroupSnapshot{Name: g.Name}
+		if !ok {
+			out[i].Err = proc.ErrAllExited
+			continue
+		}
+		s.TimeSec = dt
+		out[i].Snapshot = s
+		alive++
+	}
+	if alive == 0 {
+		return out, proc.ErrAllExited
+	}
+	return out, nil
+}
+
+// stubResolve maps each selector to fixed PIDs; unknown selectors fail.
+func stubResolve(m map[string][]int) func([]string) ([]int, error) {
+	return func(sel []string) ([]int, error) {
+		pids, ok := m[sel[0]]
+		if !ok {
+			return nil, fmt.Errorf("no process matches %q", sel[0])
+		}
+		return pids, nil
+	}
+}
+
+func newTestMonitor(t *testing.T, col *fakeGroups, res map[string][]int, targets ...Target) *Monitor {
+	t.Helper()
+	m, err := NewMonitor(col, "fake", consumption.DefaultConfig(), targets)
+	require.NoError(t, err)
+	m.resolve = stubResolve(res)
+	return m
+}
+
+type plainCollector struct{}
+
+func (plainCollector) Sample([]int, float64) (proc.Snapshot, error) { return proc.Snapshot{}, nil }
+func (plainCollector) Close() error                                 { return nil }
+
+func TestParseTarget(t *testing.T) {
+	got, err := ParseTarget(" web = name:nginx, cgroup:system.slice/nginx.service ,")
+	require.NoError(t, err)
+	assert.Equal(t, Target{Name: "web", Selectors: []string{"name:nginx", "cgroup:system.slice/nginx.service"}}, got)
+
+	for _, bad := range []string{"web", "=1", "web=", "web= , "} {
+		_, err := ParseTarget(bad)
+		assert.ErrorIs(t, err, ErrBadTarget, bad)
+	}
+}
+
+func TestNewMonitor_Rejects(t *testing.T) {
+	cfg := consumption.DefaultConfig()
+	web := Target{Name: "web", Selectors: []string{"1"}}
+
+	_, err := NewMonitor(plainCollector{}, "plain", cfg, []Target{web})
+	assert.ErrorContains(t, err, "cannot sample several targets")
+	_, err = NewMonitor(&fakeGroups{}, "fake", cfg, nil)
+	assert.ErrorIs(t, err, ErrNoTargets)
+	_, err = NewMonitor(&fakeGroups{}, "fake", cfg, []Target{web, web})
+	assert.ErrorIs(t, err, ErrBadTarget)
+	_, err = NewMonitor(&fakeGroups{}, "fake", cfg, []Target{{Name: "x"}})
+	assert.ErrorIs(t, err, ErrBadTarget)
+	_, err = NewMonitor(&fakeGroups{}, "fake", &consumption.Config{Model: "cubic"}, []Target{web})
+	assert.ErrorIs(t, err, consumption.ErrUnknownModel)
+}
+
+func TestMonitor_TickPrimesThenAccumulates(t *testing.T) {
+	snap := proc.Snapshot{UVm: 0.5, UProc: 0.25, ReadBytes: 1000, WriteBytes: 3000}
+	col := &fakeGroups{snaps: map[string]proc.Snapshot{"web": snap}}
+	m := newTestMonitor(t, col, map[string][]int{"name:nginx": {10, 11}},
+		Target{Name: "web", Selectors: []string{"name:nginx"}})
+
+	// First tick: collector baselines only.
+	require.NoError(t, m.Tick(2))
+	ts := m.Targets()
+	require.Len(t, ts, 1)
+	assert.True(t, ts[0].Up)
+	assert.Equal(t, []int{10, 11}, ts[0].PIDs)
+	assert.Zero(t, ts[0].Energy.Total)
+	assert.Zero(t, ts[0].ReadBytes)
+
+	require.NoError(t, m.Tick(2))
+	require.NoError(t, m.Tick(2))
+	snap.TimeSec = 2
+	want := consumption.New(consumption.DefaultConfig()).Apply(snap)
+
+	ts = m.Targets()
+	assert.Equal(t, want, ts[0].Last)
+	assert.InDelta(t, 4*want.PTotal, ts[0].Energy.Total, 1e-9)
+	assert.InDelta(t, 4*want.PCPU, ts[0].Energy.CPU, 1e-9)
+	assert.Equal(t, uint64(2000), ts[0].ReadBytes)
+	assert.Equal(t, uint64(6000), ts[0].WriteBytes)
+
+	h := m.Health()
+	assert.Equal(t, "fake", h.Collector)
+	assert.Equal(t, uint64(3), h.Ticks)
+	assert.Equal(t, 0.5, h.UVm)
+	assert.False(t, h.LastTick.IsZero())
+}
+
+func TestMonitor_ResolvesPerSelectorAndClaimsPIDsOnce(t *testing.T) {
+	col := &fakeGroups{snaps: map[string]proc.Snapshot{"a": {UVm: 0.5, UProc: 0.1}}}
+	m := newTestMonitor(t, col,
+		map[string][]int{"1": {1}, "1..2": {1, 2}, "3": {3}},
+		Target{Name: "a", Selectors: []string{"1", "name:gone"}},
+		Target{Name: "b", Selectors: []string{"1..2"}},
+		Target{Name: "c", Selectors: []string{"3"}},
+		Target{Name: "d", Selectors: []string{"name:gone"}},
+	)
+
+	require.NoError(t, m.Tick(1))
+	require.Len(t, col.calls, 1)
+	assert.Equal(t, []proc.Group{
+		{Name: "a", PIDs: []int{1}},
+		{Name: "b", PIDs: []int{2}},
+		{Name: "c", PIDs: []int{3}},
+	}, col.calls[0], "d resolves to nothing; pid 1 stays with a")
+
+	ts := m.Targets()
+	assert.Equal(t, []bool{true, false, false, false}, []bool{ts[0].Up, ts[1].Up, ts[2].Up, ts[3].Up})
+	assert.Equal(t, [][]int{{1}, {2}, {3}, nil}, [][]int{ts[0].PIDs, ts[1].PIDs, ts[2].PIDs, ts[3].PIDs})
+	assert.Equal(t, uint64(1), ts[0].ResolveFailures)
+	assert.Equal(t, uint64(1), ts[3].ResolveFailures)
+}
+
+func TestMonitor_DownTargetsAndCollectorErrors(t *testing.T) {
+	col := &fakeGroups{snaps: map[string]proc.Snapshot{}}
+	m := newTestMonitor(t, col, map[string][]int{"1": {1}},
+		Target{Name: "a", Selectors: []string{"1"}})
+
+	// Every process exited: not an error, the target is just down.
+	require.NoError(t, m.Tick(1))
+	assert.False(t, m.Targets()[0].Up)
+	assert.Equal(t, uint64(1), m.Health().Ticks)
+
+	col.err = errors.New("boom")
+	require.ErrorContains(t, m.Tick(1), "boom")
+	h := m.Health()
+	assert.Equal(t, uint64(1), h.Errors)
+	assert.Equal(t, "boom", h.LastError)
+
+	col.err = nil
+	require.NoError(t, m.Tick(1))
+	assert.Empty(t, m.Health().LastError)
+}
+
+func TestMonitor_Run(t *testing.T) {
+	col := &fakeGroups{snaps: map[string]proc.Snapshot{"a": {UVm: 1, UProc: 1}}}
+	m := newTestMonitor(t, col, map[string][]int{"1": {1}},
+		Target{Name: "a", Selectors: []string{"1"}})
+
+	require.Error(t, m.Run(context.Background(), 0))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- m.Run(ctx, 5*time.Millisecond) }()
+	require.Eventually(t, func() bool { return m.Targets()[0].Energy.Total > 0 }, time.Second, 5*time.Millisecond)
+	cancel()
+	require.NoError(t, <-done)
+}
@@ -0,0 +1,470 @@
+//go:build linux
+
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ja7ad/consumption/pkg/system/cgroup"
+	"github.com/ja7ad/consumption/pkg/system/util"
+)
+
+// OTLP defaults.
+const (
+	DefaultOTLPRetries    = 5
+	DefaultOTLPBackoff    = 500 * time.Millisecond
+	DefaultOTLPMaxBackoff = 30 * time.Second
+	DefaultOTLPTimeout    = 10 * time.Second
+)
+
+// otlpMaxPending bounds the pending collections, in batches, while Run's
+// sender is busy retrying; older collections are discarded first.
+const otlpMaxPending = 16
+
+// otlpScopeName is the instrumentation scope of exported metrics.
+const otlpScopeName = "github.com/ja7ad/consumption"
+
+// OTLPConfig configures an OTLPExporter. Zero fields take the defaults.
+type OTLPConfig struct {
+	// Endpoint is the full metrics URL, e.g. http://localhost:4318/v1/metrics.
+	Endpoint string
+	// Headers are sent with every request, e.g. for authentication.
+	Headers map[string]string
+	// Resource adds attributes to every resource, next to the built-in
+	// host.name, os.type, os.version (kernel release) and
+	// consumption.cgroup.version.
+	Resource map[string]string
+	// Version is reported as the instrumentation scope version.
+	Version string
+	// BatchSize is the number of collections sent per request (default 1).
+	BatchSize int
+	// MaxRetries bounds the retries of a failed request; negative disables
+	// retries.
+	MaxRetries int
+	// Backoff is the first retry delay, doubled per retry up to MaxBackoff.
+	// A Retry-After header from the receiver takes precedence.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Timeout bounds each attempt.
+	Timeout time.Duration
+	Client  *http.Client
+}
+
+// OTLPStats counts the exporter's requests.
+type OTLPStats struct {
+	Requests uint64 // attempts, including retries
+	Retries  uint64
+	Sent     uint64 // batches accepted by the receiver
+	Dropped  uint64 // batches given up on
+	Rejected uint64 // data points the receiver reported as rejected
+	// Discarded counts collections Run threw away, oldest first, because
+	// too many were pending while a flush was retrying.
+	Discarded uint64
+}
+
+// OTLPExporter pushes a Monitor's targets to an OTLP/HTTP receiver, using
+// the JSON encoding. Each target is a resource carrying its name
+// (consumption.target); it reports
+//
+//	consumption.energy       cumulative monotonic sum, J, by component
+//	consumption.power        gauge, W, by component, over the last tick
+//	consumption.utilization  gauge, 1, process CPU share of the VM
+//
+// The gauges also carry the processes (process.pid and
+// process.executable.name when unambiguous). They are kept off the
+// resource so that a restarted process does not start a new energy series
+// with an already-accumulated counter.
+//
+// Batches that still fail after the retries are dropped: the energy sums
+// are cumulative, so the next batch carries the totals.
+type OTLPExporter struct {
+	m     *Monitor
+	cfg   OTLPConfig
+	host  []otlpKV
+	start time.Time
+
+	mu    sync.Mutex
+	batch []otlpCollection
+	stats OTLPStats
+}
+
+type otlpCollection struct {
+	at      time.Time
+	targets []TargetStats
+}
+
+// NewOTLPExporter builds an exporter of m's targets.
+func NewOTLPExporter(m *Monitor, cfg OTLPConfig) (*OTLPExporter, error) {
+	if !strings.HasPrefix(cfg.Endpoint, "http://") && !strings.HasPrefix(cfg.Endpoint, "https://") {
+		return nil, fmt.Errorf("export: otlp endpoint %q: want an http(s) URL", cfg.Endpoint)
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 1
+	}
+	switch {
+	case cfg.MaxRetries == 0:
+		cfg.MaxRetries = DefaultOTLPRetries
+	case cfg.MaxRetries < 0:
+		cfg.MaxRetries = 0
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = DefaultOTLPBackoff
+	}
+	if cfg.MaxBackoff < cfg.Backoff {
+		cfg.MaxBackoff = max(DefaultOTLPMaxBackoff, cfg.Backoff)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultOTLPTimeout
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{}
+	}
+
+	host, kernel, _, _ := util.SystemSummary()
+	cg, _, _ := cgroup.Detect()
+	attrs := []otlpKV{
+		strAttr("host.name", host),
+		strAttr("os.type", "linux"),
+		strAttr("os.version", kernel),
+		strAttr("consumption.cgroup.version", cg.String()),
+	}
+	for _, k := range slices.Sorted(maps.Keys(cfg.Resource)) {
+		attrs = append(attrs, strAttr(k, cfg.Resource[k]))
+	}
+	return &OTLPExporter{m: m, cfg: cfg, host: attrs, start: time.Now()}, nil
+}
+
+// Collect records the monitor's current state and flushes once BatchSize
+// collections are pending.
+func (e *OTLPExporter) Collect(ctx context.Context) error {
+	if !e.record() {
+		return nil
+	}
+	return e.Flush(ctx)
+}
+
+// record appends the monitor's current state to the pending collections,
+// discarding the oldest beyond otlpMaxPending batches, and reports whether
+// a batch is full.
+func (e *OTLPExporter) record() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.batch = append(e.batch, otlpCollection{at: time.Now(), targets: e.m.Targets()})
+	if n := len(e.batch) - otlpMaxPending*e.cfg.BatchSize; n > 0 {
+		e.batch = slices.Delete(e.batch, 0, n)
+		e.stats.Discarded += uint64(n)
+	}
+	return len(e.batch) >= e.cfg.BatchSize
+}
+
+// Flush sends the pending collections, retrying with backoff.
+func (e *OTLPExporter) Flush(ctx context.Context) error {
+	e.mu.Lock()
+	batch := e.batch
+	e.batch = nil
+	e.mu.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(e.request(batch))
+	if err != nil {
+		return err
+	}
+	err = e.send(ctx, body)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err != nil {
+		e.stats.Dropped++
+		return err
+	}
+	e.stats.Sent++
+	return nil
+}
+
+// Run collects every interval until ctx is done, then flushes what is
+// pending. Full batches are sent from a separate goroutine, so a slow or
+// unreachable receiver does not delay collection; export errors are logged
+// and collection continues.
+func (e *OTLPExporter) Run(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("export: otlp interval must be > 0")
+	}
+	full := make(chan struct{}, 1)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for range full {
+			if err := e.Flush(ctx); err != nil {
+				slog.Warn("otlp export", "err", err)
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			close(full)
+			wg.Wait()
+			fctx, cancel := context.WithTimeout(context.Background(), e.cfg.Timeout)
+			defer cancel()
+			return e.Flush(fctx)
+		case <-ticker.C:
+			if e.record() {
+				select {
+				case full <- struct{}{}:
+				default: // a flush is already due; it takes the whole batch
+				}
+			}
+		}
+	}
+}
+
+// Stats returns the request counters.
+func (e *OTLPExporter) Stats() OTLPStats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.stats
+}
+
+// send posts body, retrying network errors and 429/502/503/504 responses.
+func (e *OTLPExporter) send(ctx context.Context, body []byte) error {
+	backoff := e.cfg.Backoff
+	for attempt := 0; ; attempt++ {
+		retry, wait, err := e.post(ctx, body)
+		if err == nil || !retry || attempt >= e.cfg.MaxRetries {
+			return err
+		}
+		if wait <= 0 {
+			wait = backoff
+			backoff = min(2*backoff, e.cfg.MaxBackoff)
+		}
+		e.mu.Lock()
+		e.stats.Retries++
+		e.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// post makes one attempt. wait is the receiver's Retry-After, if any.
+func (e *OTLPExporter) post(ctx context.Context, body []byte) (retry bool, wait time.Duration, err error) {
+	e.mu.Lock()
+	e.stats.Requests++
+	e.mu.Unlock()
+
+	actx, cancel := context.WithTimeout(ctx, e.cfg.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(actx, http.MethodPost, e.cfg.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return false, 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.cfg.Client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, 0, fmt.Errorf("export: otlp: %w", err)
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+
+	switch code := resp.StatusCode; {
+	case code >= 200 && code < 300:
+		var ps struct {
+			PartialSuccess struct {
+				RejectedDataPoints json.Number `json:"rejectedDataPoints"`
+				ErrorMessage       string      `json:"errorMessage"`
+			} `json:"partialSuccess"`
+		}
+		if json.Unmarshal(msg, &ps) == nil {
+			if n, _ := ps.PartialSuccess.RejectedDataPoints.Int64(); n > 0 {
+				e.mu.Lock()
+				e.stats.Rejected += uint64(n)
+				e.mu.Unlock()
+				slog.Warn("otlp receiver rejected data points", "n", n, "msg", ps.PartialSuccess.ErrorMessage)
+			}
+		}
+		return false, 0, nil
+	case code == http.StatusTooManyRequests, code == http.StatusBadGateway,
+		code == http.StatusServiceUnavailable, code == http.StatusGatewayTimeout:
+		if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && s >= 0 {
+			wait = min(time.Duration(s)*time.Second, e.cfg.MaxBackoff)
+		}
+		return true, wait, fmt.Errorf("export: otlp: %s", resp.Status)
+	default:
+		return false, 0, fmt.Errorf("export: otlp: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+}
+
+// request builds an ExportMetricsServiceRequest with one resource per
+// target in batch.
+func (e *OTLPExporter) request(batch []otlpCollection) otlpRequest {
+	var (
+		req   otlpRequest
+		index = map[string]int{}
+	)
+	start := nanos(e.start)
+	for _, c := range batch {
+		at := nanos(c.at)
+		for _, t := range c.targets {
+			attrs := e.resource(t)
+			key, _ := json.Marshal(attrs)
+			i, ok := index[string(key)]
+			if !ok {
+				i = len(req.ResourceMetrics)
+				index[string(key)] = i
+				req.ResourceMetrics = append(req.ResourceMetrics, newOTLPResourceMetrics(attrs, e.cfg.Version))
+			}
+			ms := req.ResourceMetrics[i].ScopeMetrics[0].Metrics
+			procs := e.processAttrs(t)
+			for _, c := range components(t.Energy.CPU, t.Energy.Disk, t.Energy.RAM, t.Energy.IdleShare) {
+				ms[0].Sum.DataPoints = append(ms[0].Sum.DataPoints, otlpPoint{
+					Attributes: []otlpKV{strAttr("component", c.name)}, StartTimeUnixNano: start, TimeUnixNano: at, AsDouble: c.v})
+			}
+			for _, c := range components(t.Last.PCPU, t.Last.PDisk, t.Last.PRAM, t.Last.PIdleShare) {
+				ms[1].Gauge.DataPoints = append(ms[1].Gauge.DataPoints, otlpPoint{
+					Attributes: append([]otlpKV{strAttr("component", c.name)}, procs...), TimeUnixNano: at, AsDouble: c.v})
+			}
+			ms[2].Gauge.DataPoints = append(ms[2].Gauge.DataPoints, otlpPoint{Attributes: procs, TimeUnixNano: at, AsDouble: t.Snapshot.UProc})
+		}
+	}
+	return req
+}
+
+// resource returns the attributes of target t. They do not depend on its
+// processes, so the resource stays the same across restarts.
+func (e *OTLPExporter) resource(t TargetStats) []otlpKV {
+	return append(slices.Clone(e.host), strAttr("consumption.target", t.Name))
+}
+
+// processAttrs returns the gauge attributes describing t's processes.
+func (e *OTLPExporter) processAttrs(t TargetStats) []otlpKV {
+	var attrs []otlpKV
+	if len(t.PIDs) == 1 {
+		attrs = append(attrs, intAttr("process.pid", int64(t.PIDs[0])))
+	}
+	names := util.PidNames(t.PIDs)
+	var exe string
+	for i, pid := range t.PIDs {
+		if i == 0 {
+			exe = names[pid]
+		} else if names[pid] != exe {
+			exe = ""
+			break
+		}
+	}
+	if exe != "" {
+		attrs = append(attrs, strAttr("process.executable.name", exe))
+	}
+	return attrs
+}
+
+func newOTLPResourceMetrics(attrs []otlpKV, version string) otlpResourceMetrics {
+	return otlpResourceMetrics{
+		Resource: otlpResource{Attributes: attrs},
+		ScopeMetrics: []otlpScopeMetrics{{
+			Scope: otlpScope{Name: otlpScopeName, Version: version},
+			Metrics: []otlpMetric{
+				{Name: "consumption.energy", Unit: "J", Description: "Estimated energy by component since start.",
+					Sum: &otlpSum{AggregationTemporality: otlpCumulative, IsMonotonic: true}},
+				{Name: "consumption.power", Unit: "W", Description: "Estimated power by component over the last tick.",
+					Gauge: &otlpGauge{}},
+				{Name: "consumption.utilization", Unit: "1", Description: "Target CPU utilization, normalized to all CPUs.",
+					Gauge: &otlpGauge{}},
+			},
+		}},
+	}
+}
+
+// OTLP JSON encoding (opentelemetry-proto, metrics/v1). 64-bit integers are
+// strings and enums are numbers, as the OTLP/HTTP JSON mapping requires.
+
+const otlpCumulative = 2 // AGGREGATION_TEMPORALITY_CUMULATIVE
+
+type otlpRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKV `json:"attributes"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type otlpMetric struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Unit        string     `json:"unit,omitempty"`
+	Gauge       *otlpGauge `json:"gauge,omitempty"`
+	Sum         *otlpSum   `json:"sum,omitempty"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpPoint `json:"dataPoints"`
+}
+
+type otlpSum struct {
+	DataPoints             []otlpPoint `json:"dataPoints"`
+	AggregationTemporality int         `json:"aggregationTemporality"`
+	IsMonotonic            bool        `json:"isMonotonic"`
+}
+
+type otlpPoint struct {
+	Attributes        []otlpKV `json:"attributes,omitempty"`
+	StartTimeUnixNano string   `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string   `json:"timeUnixNano"`
+	AsDouble          float64  `json:"asDouble"`
+}
+
+type otlpKV struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+func strAttr(k, v string) otlpKV { return otlpKV{Key: k, Value: otlpAnyValue{StringValue: &v}} }
+
+func intAttr(k string, v int64) otlpKV {
+	s := strconv.FormatInt(v, 10)
+	return otlpKV{Key: k, Value: otlpAnyValue{IntValue: &s}}
+}
+
+func nanos(t time.Time) string { return strconv.FormatInt(t.UnixNano(), 10) }
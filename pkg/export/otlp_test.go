@@ -0,0 +1,267 @@
+//go:build linux
+
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ja7ad/consumption/pkg/system/proc"
+)
+
+// receiver is a stand-in OTLP/HTTP endpoint. Each request takes the next
+// status from codes (200 once they run out).
+type receiver struct {
+	mu      sync.Mutex
+	codes   []int
+	headers http.Header
+	bodies  []otlpRequest
+	reply   string
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	code := http.StatusOK
+	if len(r.codes) > 0 {
+		code, r.codes = r.codes[0], r.codes[1:]
+	}
+	r.headers = req.Header.Clone()
+	b, _ := io.ReadAll(req.Body)
+	var body otlpRequest
+	if json.Unmarshal(b, &body) == nil && code == http.StatusOK {
+		r.bodies = append(r.bodies, body)
+	}
+	if code == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", "0")
+	}
+	w.WriteHeader(code)
+	_, _ = io.WriteString(w, r.reply)
+}
+
+func (r *receiver) received() []otlpRequest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.bodies
+}
+
+func newOTLPTest(t *testing.T, rc *receiver, cfg OTLPConfig) (*OTLPExporter, *Monitor) {
+	t.Helper()
+	srv := httptest.NewServer(rc)
+	t.Cleanup(srv.Close)
+
+	col := &fakeGroups{snaps: map[string]proc.Snapshot{"self": {UVm: 0.5, UProc: 0.25, WriteBytes: 4096}}}
+	m := newTestMonitor(t, col, map[string][]int{"self": {os.Getpid()}},
+		Target{Name: "self", Selectors: []string{"self"}},
+		Target{Name: "down", Selectors: []string{"name:gone"}},
+	)
+	require.NoError(t, m.Tick(1))
+	require.NoError(t, m.Tick(1))
+
+	cfg.Endpoint = srv.URL + "/v1/metrics"
+	cfg.Backoff = time.Millisecond
+	e, err := NewOTLPExporter(m, cfg)
+	require.NoError(t, err)
+	return e, m
+}
+
+func attrMap(kvs []otlpKV) map[string]string {
+	out := map[string]string{}
+	for _, kv := range kvs {
+		switch {
+		case kv.Value.StringValue != nil:
+			out[kv.Key] = *kv.Value.StringValue
+		case kv.Value.IntValue != nil:
+			out[kv.Key] = *kv.Value.IntValue
+		}
+	}
+	return out
+}
+
+func TestOTLP_PayloadResourcesAndBatching(t *testing.T) {
+	rc := &receiver{}
+	e, m := newOTLPTest(t, rc, OTLPConfig{
+		Headers:   map[string]string{"Authorization": "Bearer t0k"},
+		Resource:  map[string]string{"deployment.environment": "test"},
+		Version:   "v1.2.3",
+		BatchSize: 2,
+	})
+	ctx := context.Background()
+
+	require.NoError(t, e.Collect(ctx))
+	assert.Empty(t, rc.received(), "batch not full yet")
+	require.NoError(t, e.Collect(ctx))
+	require.Len(t, rc.received(), 1)
+	assert.Equal(t, "application/json", rc.headers.Get("Content-Type"))
+	assert.Equal(t, "Bearer t0k", rc.headers.Get("Authorization"))
+
+	req := rc.received()[0]
+	require.Len(t, req.ResourceMetrics, 2, "one resource per target")
+
+	self := req.ResourceMetrics[0]
+	res := attrMap(self.Resource.Attributes)
+	host, _ := os.Hostname()
+	assert.Equal(t, host, res["host.name"])
+	assert.Equal(t, "linux", res["os.type"])
+	assert.NotEmpty(t, res["os.version"])
+	assert.Contains(t, res, "consumption.cgroup.version")
+	assert.Equal(t, "test", res["deployment.environment"])
+	assert.Equal(t, "self", res["consumption.target"])
+	assert.NotContains(t, res, "process.pid", "processes are on the gauges")
+
+	down := attrMap(req.ResourceMetrics[1].Resource.Attributes)
+	assert.Equal(t, "down", down["consumption.target"])
+
+	sm := self.ScopeMetrics[0]
+	assert.Equal(t, otlpScope{Name: otlpScopeName, Version: "v1.2.3"}, sm.Scope)
+	require.Len(t, sm.Metrics, 3)
+	energy, power, util := sm.Metrics[0], sm.Metrics[1], sm.Metrics[2]
+
+	assert.Equal(t, "consumption.energy", energy.Name)
+	assert.Equal(t, "J", energy.Unit)
+	require.NotNil(t, energy.Sum)
+	assert.Equal(t, otlpCumulative, energy.Sum.AggregationTemporality)
+	assert.True(t, energy.Sum.IsMonotonic)
+	require.Len(t, energy.Sum.DataPoints, 8, "4 components x 2 collections")
+	want := m.Targets()[0]
+	p := energy.Sum.DataPoints[0]
+	assert.Equal(t, map[string]string{"component": "cpu"}, attrMap(p.Attributes))
+	assert.InDelta(t, want.Energy.CPU, p.AsDouble, 1e-12)
+	assert.NotEmpty(t, p.StartTimeUnixNano)
+	assert.LessOrEqual(t, p.StartTimeUnixNano, p.TimeUnixNano)
+
+	assert.Equal(t, "W", power.Unit)
+	require.NotNil(t, power.Gauge)
+	assert.Len(t, power.Gauge.DataPoints, 8)
+	pa := attrMap(power.Gauge.DataPoints[1].Attributes)
+	assert.Equal(t, "disk", pa["component"])
+	assert.Equal(t, strconv.Itoa(os.Getpid()), pa["process.pid"])
+	assert.NotEmpty(t, pa["process.executable.name"])
+	assert.InDelta(t, want.Last.PDisk, power.Gauge.DataPoints[1].AsDouble, 1e-12)
+
+	require.NotNil(t, util.Gauge)
+	require.Len(t, util.Gauge.DataPoints, 2)
+	assert.Equal(t, 0.25, util.Gauge.DataPoints[0].AsDouble)
+	assert.Equal(t, strconv.Itoa(os.Getpid()), attrMap(util.Gauge.DataPoints[0].Attributes)["process.pid"])
+
+	assert.Equal(t, OTLPStats{Requests: 1, Sent: 1}, e.Stats())
+}
+
+func TestOTLP_ResourceStableAcrossRestarts(t *testing.T) {
+	e, err := NewOTLPExporter(nil, OTLPConfig{Endpoint: "http://localhost/v1/metrics"})
+	require.NoError(t, err)
+	now := time.Now()
+	req := e.request([]otlpCollection{
+		{at: now, targets: []TargetStats{{Name: "web", PIDs: []int{os.Getpid()}}}},
+		{at: now.Add(time.Second), targets: []TargetStats{{Name: "web", PIDs: []int{os.Getpid(), os.Getppid()}}}},
+	})
+	require.Len(t, req.ResourceMetrics, 1, "a changed process set keeps the resource")
+	ms := req.ResourceMetrics[0].ScopeMetrics[0].Metrics
+	assert.Len(t, ms[0].Sum.DataPoints, 8)
+	util := ms[2].Gauge.DataPoints
+	require.Len(t, util, 2)
+	assert.Equal(t, strconv.Itoa(os.Getpid()), attrMap(util[0].Attributes)["process.pid"])
+	assert.NotContains(t, attrMap(util[1].Attributes), "process.pid")
+}
+
+func TestOTLP_RetriesWithBackoff(t *testing.T) {
+	rc := &receiver{codes: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusBadGateway}}
+	e, _ := newOTLPTest(t, rc, OTLPConfig{})
+
+	require.NoError(t, e.Collect(context.Background()))
+	assert.Len(t, rc.received(), 1)
+	assert.Equal(t, OTLPStats{Requests: 4, Retries: 3, Sent: 1}, e.Stats())
+}
+
+func TestOTLP_GivesUp(t *testing.T) {
+	rc := &receiver{codes: []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable}}
+	e, _ := newOTLPTest(t, rc, OTLPConfig{MaxRetries: 2})
+	require.ErrorContains(t, e.Collect(context.Background()), "503")
+	assert.Equal(t, OTLPStats{Requests: 3, Retries: 2, Dropped: 1}, e.Stats())
+
+	// Permanent errors are not retried; the next batch goes through.
+	rc.codes = []int{http.StatusBadRequest}
+	rc.reply = "bad metric"
+	require.ErrorContains(t, e.Collect(context.Background()), "400 Bad Request: bad metric")
+	require.NoError(t, e.Collect(context.Background()))
+	assert.Equal(t, OTLPStats{Requests: 5, Retries: 2, Sent: 1, Dropped: 2}, e.Stats())
+
+	// Retries stop when the context ends.
+	rc.codes = []int{http.StatusBadGateway}
+	e.cfg.Backoff = time.Hour
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	require.ErrorIs(t, e.Collect(ctx), context.Canceled)
+}
+
+func TestOTLP_PartialSuccessAndNetworkErrors(t *testing.T) {
+	rc := &receiver{reply: `{"partialSuccess":{"rejectedDataPoints":"3","errorMessage":"too old"}}`}
+	e, _ := newOTLPTest(t, rc, OTLPConfig{})
+	require.NoError(t, e.Collect(context.Background()))
+	assert.Equal(t, uint64(3), e.Stats().Rejected)
+
+	dead, err := NewOTLPExporter(e.m, OTLPConfig{Endpoint: "http://127.0.0.1:1/v1/metrics", MaxRetries: 1, Backoff: time.Millisecond})
+	require.NoError(t, err)
+	require.Error(t, dead.Collect(context.Background()))
+	assert.Equal(t, OTLPStats{Requests: 2, Retries: 1, Dropped: 1}, dead.Stats())
+
+	_, err = NewOTLPExporter(e.m, OTLPConfig{Endpoint: "localhost:4318"})
+	assert.ErrorContains(t, err, "want an http(s) URL")
+}
+
+func TestOTLP_RunFlushesOnStop(t *testing.T) {
+	rc := &receiver{}
+	e, _ := newOTLPTest(t, rc, OTLPConfig{BatchSize: 1000})
+	require.Error(t, e.Run(context.Background(), 0))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- e.Run(ctx, 5*time.Millisecond) }()
+	time.Sleep(30 * time.Millisecond)
+	assert.Empty(t, rc.received())
+	cancel()
+	require.NoError(t, <-done)
+	require.Len(t, rc.received(), 1)
+	assert.NotEmpty(t, rc.received()[0].ResourceMetrics[0].ScopeMetrics[0].Metrics[2].Gauge.DataPoints)
+}
+
+func TestOTLP_RunKeepsCollectingWhileSending(t *testing.T) {
+	rc := &receiver{}
+	_, m := newOTLPTest(t, rc, OTLPConfig{})
+
+	// The receiver hangs until released: Run must keep collecting.
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		rc.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	e, err := NewOTLPExporter(m, OTLPConfig{Endpoint: srv.URL, Timeout: time.Minute})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- e.Run(ctx, 2*time.Millisecond) }()
+	require.Eventually(t, func() bool { return e.Stats().Discarded > 0 }, 5*time.Second, time.Millisecond,
+		"collections pile up, bounded, while the first request hangs")
+	e.mu.Lock()
+	assert.Len(t, e.batch, otlpMaxPending)
+	e.mu.Unlock()
+
+	close(release)
+	require.Eventually(t, func() bool { return e.Stats().Sent >= 2 }, 5*time.Second, time.Millisecond,
+		"the backlog goes out once the receiver answers")
+	cancel()
+	require.NoError(t, <-done)
+}
@@ -0,0 +1,144 @@
+//go:build linux
+
+package export
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// PrometheusContentType is the text exposition format served by Handler.
+const PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// WritePrometheus writes the current state in the Prometheus text
+// exposition format. Energy is split by component (cpu, disk, ram, idle);
+// the components of a target add up to its total.
+func (m *Monitor) WritePrometheus(w io.Writer) error {
+	targets, h := m.Targets(), m.Health()
+	var p promWriter
+
+	p.family("consumption_energy_joules_total", "counter", "Estimated energy by component since start.")
+	for _, t := range targets {
+		for _, c := range components(t.Energy.CPU, t.Energy.Disk, t.Energy.RAM, t.Energy.IdleShare) {
+			p.sample("consumption_energy_joules_total", c.v, "target", t.Name, "component", c.name)
+		}
+	}
+	p.family("consumption_power_watts", "gauge", "Estimated power by component over the last tick.")
+	for _, t := range targets {
+		for _, c := range components(t.Last.PCPU, t.Last.PDisk, t.Last.PRAM, t.Last.PIdleShare) {
+			p.sample("consumption_power_watts", c.v, "target", t.Name, "component", c.name)
+		}
+	}
+	p.family("consumption_utilization_ratio", "gauge", "Target CPU utilization over the last tick, normalized to all CPUs [0..1].")
+	for _, t := range targets {
+		p.sample("consumption_utilization_ratio", t.Snapshot.UProc, "target", t.Name)
+	}
+	p.family("consumption_io_bytes_total", "counter", "Disk bytes read and written since start.")
+	for _, t := range targets {
+		p.sample("consumption_io_bytes_total", float64(t.ReadBytes), "target", t.Name, "direction", "read")
+		p.sample("consumption_io_bytes_total", float64(t.WriteBytes), "target", t.Name, "direction", "write")
+	}
+	p.family("consumption_target_processes", "gauge", "Processes resolved for the target at the last tick.")
+	for _, t := range targets {
+		p.sample("consumption_target_processes", float64(len(t.PIDs)), "target", t.Name)
+	}
+	p.family("consumption_target_up", "gauge", "1 when at least one of the target's processes was sampled at the last tick.")
+	for _, t := range targets {
+		p.sample("consumption_target_up", b2f(t.Up), "target", t.Name)
+	}
+	p.family("consumption_target_resolve_failures_total", "counter", "Target selectors that failed or matched no process.")
+	for _, t := range targets {
+		p.sample("consumption_target_resolve_failures_total", float64(t.ResolveFailures), "target", t.Name)
+	}
+
+	p.family("consumption_vm_utilization_ratio", "gauge", "Whole-VM CPU utilization over the last tick [0..1].")
+	p.sample("consumption_vm_utilization_ratio", h.UVm)
+	p.family("consumption_collector_info", "gauge", "Sampling backend in use.")
+	p.sample("consumption_collector_info", 1, "collector", h.Collector)
+	p.family("consumption_collector_up", "gauge", "1 when the last tick succeeded.")
+	p.sample("consumption_collector_up", b2f(h.Ticks > 0 && h.LastError == ""))
+	p.family("consumption_collector_ticks_total", "counter", "Successful sampling ticks.")
+	p.sample("consumption_collector_ticks_total", float64(h.Ticks))
+	p.family("consumption_collector_errors_total", "counter", "Failed sampling ticks.")
+	p.sample("consumption_collector_errors_total", float64(h.Errors))
+	p.family("consumption_collector_tick_duration_seconds", "gauge", "Time spent resolving and sampling in the last tick.")
+	p.sample("consumption_collector_tick_duration_seconds", h.LastDuration.Seconds())
+	p.family("consumption_collector_last_tick_timestamp_seconds", "gauge", "Unix time of the last successful tick.")
+	if !h.LastTick.IsZero() {
+		p.sample("consumption_collector_last_tick_timestamp_seconds", float64(h.LastTick.UnixNano())/1e9)
+	}
+
+	_, err := w.Write(p.buf.Bytes())
+	return err
+}
+
+// Handler serves WritePrometheus, e.g. on /metrics.
+func (m *Monitor) Handler() http.Handler { return promHandler(m.WritePrometheus) }
+
+// promHandler serves a text exposition written by write to GET and HEAD
+// requests.
+func promHandler(write func(io.Writer) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var buf bytes.Buffer
+		if err := write(&buf); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", PrometheusContentType)
+		_, _ = w.Write(buf.Bytes())
+	})
+}
+
+type component struct {
+	name string
+	v    float64
+}
+
+func components(cpu, disk, ram, idle float64) []component {
+	return []component{{"cpu", cpu}, {"disk", disk}, {"ram", ram}, {"idle", idle}}
+}
+
+func b2f(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// promWriter builds a text exposition.
+type promWriter struct {
+	buf bytes.Buffer
+}
+
+func (p *promWriter) family(name, typ, help string) {
+	p.buf.WriteString("# HELP " + name + " " + help + "\n")
+	p.buf.WriteString("# TYPE " + name + " " + typ + "\n")
+}
+
+// sample writes one line; labels are name/value pairs.
+func (p *promWriter) sample(name string, v float64, labels ...string) {
+	p.buf.WriteString(name)
+	if len(labels) > 0 {
+		p.buf.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				p.buf.WriteByte(',')
+			}
+			p.buf.WriteString(labels[i] + `="` + labelEscaper.Replace(labels[i+1]) + `"`)
+		}
+		p.buf.WriteByte('}')
+	}
+	p.buf.WriteByte(' ')
+	p.buf.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+	p.buf.WriteByte('\n')
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
@@ -0,0 +1,96 @@
+//go:build linux
+
+package export
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ja7ad/consumption/pkg/consumption"
+	"github.com/ja7ad/consumption/pkg/system/proc"
+)
+
+func TestPrometheus_ScrapeOverHTTP(t *testing.T) {
+	snap := proc.Snapshot{UVm: 0.5, UProc: 0.25, ReadBytes: 100, WriteBytes: 300}
+	col := &fakeGroups{snaps: map[string]proc.Snapshot{"web": snap}}
+	m := newTestMonitor(t, col, map[string][]int{"1": {1}},
+		Target{Name: "web", Selectors: []string{"1"}},
+		Target{Name: `odd "name"`, Selectors: []string{"name:gone"}},
+	)
+	require.NoError(t, m.Tick(1))
+	require.NoError(t, m.Tick(1))
+
+	srv := httptest.NewServer(m.Handler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/metrics")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, PrometheusContentType, resp.Header.Get("Content-Type"))
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	body := string(b)
+
+	snap.TimeSec = 1
+	want := consumption.New(consumption.DefaultConfig()).Apply(snap)
+	for _, line := range []string{
+		"# TYPE consumption_energy_joules_total counter",
+		`consumption_energy_joules_total{target="web",component="cpu"} ` + fmtF(want.PCPU),
+		`consumption_energy_joules_total{target="web",component="disk"} ` + fmtF(want.PDisk),
+		`consumption_power_watts{target="web",component="ram"} ` + fmtF(want.PRAM),
+		`consumption_utilization_ratio{target="web"} 0.25`,
+		`consumption_io_bytes_total{target="web",direction="write"} 300`,
+		`consumption_target_up{target="web"} 1`,
+		`consumption_target_up{target="odd \"name\""} 0`,
+		`consumption_target_resolve_failures_total{target="odd \"name\""} 2`,
+		`consumption_target_processes{target="web"} 1`,
+		"consumption_vm_utilization_ratio 0.5",
+		`consumption_collector_info{collector="fake"} 1`,
+		"consumption_collector_up 1",
+		"consumption_collector_ticks_total 2",
+		"consumption_collector_errors_total 0",
+		"consumption_collector_last_tick_timestamp_seconds ",
+	} {
+		assert.Contains(t, body, line)
+	}
+
+	// Every sample belongs to a declared family.
+	families := map[string]bool{}
+	for _, l := range strings.Split(strings.TrimSpace(body), "\n") {
+		if f, ok := strings.CutPrefix(l, "# TYPE "); ok {
+			families[strings.Fields(f)[0]] = true
+			continue
+		}
+		if strings.HasPrefix(l, "#") {
+			continue
+		}
+		name, _, _ := strings.Cut(strings.Fields(l)[0], "{")
+		assert.True(t, families[name], "undeclared family for %q", l)
+	}
+
+	resp, err = http.Post(srv.URL+"/metrics", "text/plain", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func TestPrometheus_BeforeFirstTick(t *testing.T) {
+	m := newTestMonitor(t, &fakeGroups{}, nil, Target{Name: "a", Selectors: []string{"1"}})
+	var sb strings.Builder
+	require.NoError(t, m.WritePrometheus(&sb))
+	assert.Contains(t, sb.String(), "consumption_collector_up 0")
+	assert.NotContains(t, sb.String(), "consumption_collector_last_tick_timestamp_seconds 0")
+}
+
+func fmtF(v float64) string {
+	var p promWriter
+	p.sample("x", v)
+	return strings.TrimSpace(strings.TrimPrefix(p.buf.String(), "x "))
+}
@@ -0,0 +1,349 @@
+//go:build linux
+
+package export
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Point is one measurement for the push sinks: tags identify the series and
+// fields carry the values.
+type Point struct {
+	Measurement string
+	Tags        []Tag
+	Fields      []Field
+	Time        time.Time
+}
+
+// Tag is a series label. Tags with an empty value are left out.
+type Tag struct {
+	Key, Value string
+}
+
+// Field is one value of a point. Delta marks per-tick increments (bytes,
+// emissions, cost), which StatsD sends as counters instead of gauges.
+type Field struct {
+	Key   string
+	Value float64
+	Delta bool
+}
+
+// Sink receives points. Write may buffer; Flush pushes what is pending.
+type Sink interface {
+	Write(p Point) error
+	Flush() error
+	Close() error
+}
+
+// AppendLine appends p in InfluxDB line protocol, tags sorted by key,
+// float fields and a nanosecond timestamp.
+func AppendLine(b []byte, p Point) []byte {
+	b = append(b, lineEscape(p.Measurement, false)...)
+	tags := slices.Clone(p.Tags)
+	slices.SortStableFunc(tags, func(x, y Tag) int { return strings.Compare(x.Key, y.Key) })
+	for _, t := range tags {
+		if t.Value == "" {
+			continue
+		}
+		b = append(b, ',')
+		b = append(b, lineEscape(t.Key, true)...)
+		b = append(b, '=')
+		b = append(b, lineEscape(t.Value, true)...)
+	}
+	for i, f := range p.Fields {
+		if i == 0 {
+			b = append(b, ' ')
+		} else {
+			b = append(b, ',')
+		}
+		b = append(b, lineEscape(f.Key, true)...)
+		b = append(b, '=')
+		b = strconv.AppendFloat(b, f.Value, 'g', -1, 64)
+	}
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, p.Time.UnixNano(), 10)
+	return append(b, '\n')
+}
+
+// lineEscape escapes commas and spaces, plus '=' in tag keys/values and
+// field keys.
+func lineEscape(s string, eq bool) string {
+	if eq {
+		return lineKeyEscaper.Replace(s)
+	}
+	return lineMeasurementEscaper.Replace(s)
+}
+
+var (
+	lineMeasurementEscaper = strings.NewReplacer(`,`, `\,`, ` `, `\ `, "\n", `\n`)
+	lineKeyEscaper         = strings.NewReplacer(`,`, `\,`, ` `, `\ `, `=`, `\=`, "\n", `\n`)
+)
+
+// Path returns the dotted Graphite/StatsD name of field f of p:
+// measurement, then the tag values in order, then the field key. Each part
+// keeps [A-Za-z0-9_-]; other characters become '_'.
+func Path(p Point, f Field) string {
+	parts := []string{pathPart(p.Measurement)}
+	for _, t := range p.Tags {
+		if t.Value != "" {
+			parts = append(parts, pathPart(t.Value))
+		}
+	}
+	return strings.Join(append(parts, pathPart(f.Key)), ".")
+}
+
+func pathPart(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// AppendStatsD appends p as StatsD lines: Delta fields as counters (|c),
+// the others as gauges (|g). Negative gauges are clamped to 0, since a
+// leading sign means a relative change in StatsD.
+func AppendStatsD(b []byte, p Point) []byte {
+	for _, f := range p.Fields {
+		b = append(b, Path(p, f)...)
+		b = append(b, ':')
+		if f.Delta {
+			b = strconv.AppendFloat(b, f.Value, 'g', -1, 64)
+			b = append(b, "|c\n"...)
+			continue
+		}
+		b = strconv.AppendFloat(b, max(f.Value, 0), 'g', -1, 64)
+		b = append(b, "|g\n"...)
+	}
+	return b
+}
+
+// AppendGraphite appends p in the Graphite plaintext protocol, one
+// "path value unix-seconds" line per field.
+func AppendGraphite(b []byte, p Point) []byte {
+	ts := p.Time.Unix()
+	for _, f := range p.Fields {
+		b = append(b, Path(p, f)...)
+		b = append(b, ' ')
+		b = strconv.AppendFloat(b, f.Value, 'g', -1, 64)
+		b = append(b, ' ')
+		b = strconv.AppendInt(b, ts, 10)
+		b = append(b, '\n')
+	}
+	return b
+}
+
+// LineWriter writes line protocol to w, one flush per point.
+type LineWriter struct {
+	w   io.Writer
+	buf []byte
+}
+
+// NewLineWriter returns a sink writing line protocol to w. Close closes w
+// when it is an io.Closer.
+func NewLineWriter(w io.Writer) *LineWriter { return &LineWriter{w: w} }
+
+func (l *LineWriter) Write(p Point) error {
+	l.buf = AppendLine(l.buf, p)
+	return l.Flush()
+}
+
+func (l *LineWriter) Flush() error {
+	if len(l.buf) == 0 {
+		return nil
+	}
+	_, err := l.w.Write(l.buf)
+	l.buf = l.buf[:0]
+	return err
+}
+
+func (l *LineWriter) Close() error {
+	err := l.Flush()
+	if c, ok := l.w.(io.Closer); ok {
+		err = errors.Join(err, c.Close())
+	}
+	return err
+}
+
+// InfluxHTTP posts line protocol to an InfluxDB v2 /api/v2/write compatible
+// endpoint, one request per Flush.
+type InfluxHTTP struct {
+	url    string
+	token  string
+	client *http.Client
+	buf    []byte
+}
+
+// NewInfluxHTTP returns a sink posting to rawURL, e.g.
+// http://localhost:8086/api/v2/write?org=acme&bucket=energy. precision=ns
+// is added when missing. A non-empty token is sent as "Authorization: Token".
+func NewInfluxHTTP(rawURL, token string) (*InfluxHTTP, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("export: influx url %q: want http(s)://HOST/api/v2/write?...", rawURL)
+	}
+	q := u.Query()
+	if q.Get("precision") == "" {
+		q.Set("precision", "ns")
+		u.RawQuery = q.Encode()
+	}
+	return &InfluxHTTP{url: u.String(), token: token, client: &http.Client{Timeout: DefaultOTLPTimeout}}, nil
+}
+
+func (s *InfluxHTTP) Write(p Point) error {
+	s.buf = AppendLine(s.buf, p)
+	return nil
+}
+
+// Flush posts the pending lines; they are dropped when the request fails.
+func (s *InfluxHTTP) Flush() error {
+	if len(s.buf) == 0 {
+		return nil
+	}
+	body := s.buf
+	s.buf = nil
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Token "+s.token)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("export: influx: %w", err)
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("export: influx: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+func (s *InfluxHTTP) Close() error { return s.Flush() }
+
+// maxDatagram keeps UDP payloads under a typical path MTU.
+const maxDatagram = 1432
+
+// NetSink pushes StatsD or Graphite lines over UDP or TCP. Over UDP, lines
+// are packed into datagrams of at most 1432 bytes; over TCP they are
+// streamed, redialing after a failed write.
+type NetSink struct {
+	network, addr string
+	encode        func([]byte, Point) []byte
+	conn          net.Conn
+	buf           []byte
+}
+
+// NewStatsD returns a StatsD sink; target is [udp|tcp://]HOST:PORT,
+// UDP by default.
+func NewStatsD(target string) (*NetSink, error) { return newNetSink(target, "udp", AppendStatsD) }
+
+// NewGraphite returns a Graphite plaintext sink; target is
+// [tcp|udp://]HOST:PORT, TCP by default.
+func NewGraphite(target string) (*NetSink, error) { return newNetSink(target, "tcp", AppendGraphite) }
+
+func newNetSink(target, network string, enc func([]byte, Point) []byte) (*NetSink, error) {
+	addr := target
+	if scheme, rest, ok := strings.Cut(target, "://"); ok {
+		network, addr = scheme, rest
+	}
+	if network != "udp" && network != "tcp" {
+		return nil, fmt.Errorf("export: %q: network must be udp or tcp", target)
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil, fmt.Errorf("export: %q: %w", target, err)
+	}
+	s := &NetSink{network: network, addr: addr, encode: enc}
+	return s, s.dial()
+}
+
+func (s *NetSink) dial() error {
+	c, err := net.DialTimeout(s.network, s.addr, 5*time.Second)
+	if err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+	s.conn = c
+	return nil
+}
+
+func (s *NetSink) Write(p Point) error {
+	s.buf = s.encode(s.buf, p)
+	return nil
+}
+
+// Flush sends the pending lines; they are dropped when sending fails.
+func (s *NetSink) Flush() error {
+	if len(s.buf) == 0 {
+		return nil
+	}
+	buf := s.buf
+	s.buf = s.buf[:0]
+	if s.conn == nil {
+		if err := s.dial(); err != nil {
+			return err
+		}
+	}
+	var err error
+	if s.network == "udp" {
+		for _, d := range datagrams(buf) {
+			if _, err = s.conn.Write(d); err != nil {
+				break
+			}
+		}
+	} else {
+		_ = s.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+		_, err = s.conn.Write(buf)
+	}
+	if err != nil {
+		_ = s.conn.Close()
+		s.conn = nil
+		return fmt.Errorf("export: %w", err)
+	}
+	return nil
+}
+
+func (s *NetSink) Close() error {
+	err := s.Flush()
+	if s.conn != nil {
+		err = errors.Join(err, s.conn.Close())
+		s.conn = nil
+	}
+	return err
+}
+
+// datagrams splits newline-terminated lines into payloads of at most
+// maxDatagram bytes; a longer single line is sent alone.
+func datagrams(buf []byte) [][]byte {
+	var out [][]byte
+	for len(buf) > 0 {
+		n := len(buf)
+		if n > maxDatagram {
+			n = bytes.LastIndexByte(buf[:maxDatagram], '\n') + 1
+			if n == 0 {
+				n = bytes.IndexByte(buf, '\n') + 1
+			}
+			if n == 0 {
+				n = len(buf)
+			}
+		}
+		out = append(out, buf[:n])
+		buf = buf[n:]
+	}
+	return out
+}
@@ -0,0 +1,188 @@
+//go:build linux
+
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testPoint() Point {
+	return Point{
+		Measurement: "consumption",
+		Tags:        []Tag{{"host", "box 1"}, {"group", "web"}, {"empty", ""}, {"profile", "laptop (overrides: p-max=30)"}},
+		Fields:      []Field{{Key: "p_total_w", Value: 3.5}, {Key: "read_bytes", Value: 4096, Delta: true}},
+		Time:        time.Unix(1700000000, 5),
+	}
+}
+
+func TestAppendLine(t *testing.T) {
+	got := string(AppendLine(nil, testPoint()))
+	assert.Equal(t, `consumption,group=web,host=box\ 1,profile=laptop\ (overrides:\ p-max\=30) p_total_w=3.5,read_bytes=4096 1700000000000000005`+"\n", got)
+
+	p := Point{Measurement: "a b,c", Fields: []Field{{Key: "x=y", Value: -1e-9}}, Time: time.Unix(0, 0)}
+	assert.Equal(t, `a\ b\,c x\=y=-1e-09 0`+"\n", string(AppendLine(nil, p)))
+}
+
+func TestAppendStatsDAndGraphite(t *testing.T) {
+	p := testPoint()
+	p.Fields = append(p.Fields, Field{Key: "u_vm", Value: -0.1})
+	assert.Equal(t, "consumption.box_1.web.laptop__overrides__p-max_30_.p_total_w:3.5|g\n"+
+		"consumption.box_1.web.laptop__overrides__p-max_30_.read_bytes:4096|c\n"+
+		"consumption.box_1.web.laptop__overrides__p-max_30_.u_vm:0|g\n", string(AppendStatsD(nil, p)))
+
+	p.Tags = p.Tags[:2]
+	p.Fields = p.Fields[:1]
+	assert.Equal(t, "consumption.box_1.web.p_total_w 3.5 1700000000\n", string(AppendGraphite(nil, p)))
+}
+
+type closeBuffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (c *closeBuffer) Close() error { c.closed = true; return nil }
+
+func TestLineWriter(t *testing.T) {
+	var buf closeBuffer
+	w := NewLineWriter(&buf)
+	require.NoError(t, w.Write(testPoint()))
+	require.NoError(t, w.Write(testPoint()))
+	assert.Equal(t, 2, strings.Count(buf.String(), "\n"), "each point is written right away")
+	require.NoError(t, w.Close())
+	assert.True(t, buf.closed)
+}
+
+func TestInfluxHTTP(t *testing.T) {
+	var (
+		req  *http.Request
+		body string
+		code = http.StatusNoContent
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		req, body = r, string(b)
+		w.WriteHeader(code)
+		if code != http.StatusNoContent {
+			_, _ = io.WriteString(w, `{"code":"invalid","message":"bad line"}`)
+		}
+	}))
+	defer srv.Close()
+
+	s, err := NewInfluxHTTP(srv.URL+"/api/v2/write?org=acme&bucket=energy", "s3cret")
+	require.NoError(t, err)
+	require.NoError(t, s.Flush(), "nothing pending, no request")
+	assert.Nil(t, req)
+
+	require.NoError(t, s.Write(testPoint()))
+	require.NoError(t, s.Write(testPoint()))
+	require.NoError(t, s.Flush())
+	assert.Equal(t, http.MethodPost, req.Method)
+	assert.Equal(t, "/api/v2/write", req.URL.Path)
+	assert.Equal(t, "acme", req.URL.Query().Get("org"))
+	assert.Equal(t, "ns", req.URL.Query().Get("precision"))
+	assert.Equal(t, "Token s3cret", req.Header.Get("Authorization"))
+	assert.Equal(t, string(AppendLine(AppendLine(nil, testPoint()), testPoint())), body)
+
+	code = http.StatusBadRequest
+	require.NoError(t, s.Write(testPoint()))
+	require.ErrorContains(t, s.Close(), "400 Bad Request")
+	req = nil
+	require.NoError(t, s.Flush(), "failed lines are dropped")
+	assert.Nil(t, req)
+
+	_, err = NewInfluxHTTP("localhost:8086", "")
+	assert.ErrorContains(t, err, "want http(s)")
+}
+
+func TestStatsD_UDPDatagrams(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer pc.Close()
+
+	s, err := NewStatsD(pc.LocalAddr().String())
+	require.NoError(t, err)
+	defer s.Close()
+
+	p := testPoint()
+	for range 40 {
+		require.NoError(t, s.Write(p))
+	}
+	want := len(AppendStatsD(nil, p)) * 40
+	require.NoError(t, s.Flush())
+
+	got := 0
+	buf := make([]byte, 64<<10)
+	_ = pc.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for got < want {
+		n, _, err := pc.ReadFrom(buf)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, n, maxDatagram)
+		assert.Equal(t, byte('\n'), buf[n-1], "datagrams hold whole lines")
+		got += n
+	}
+	assert.Equal(t, want, got)
+}
+
+func TestGraphite_TCPRedials(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	lines := make(chan string, 16)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				sc := bufio.NewScanner(c)
+				for sc.Scan() {
+					lines <- sc.Text()
+				}
+			}()
+		}
+	}()
+
+	s, err := NewGraphite("tcp://" + ln.Addr().String())
+	require.NoError(t, err)
+	p := testPoint()
+	p.Tags, p.Fields = p.Tags[1:2], p.Fields[:1]
+	require.NoError(t, s.Write(p))
+	require.NoError(t, s.Flush())
+	assert.Equal(t, "consumption.web.p_total_w 3.5 1700000000", <-lines)
+
+	// A dropped connection is redialed on the next flush.
+	_ = s.conn.Close()
+	_ = s.Write(p)
+	_ = s.Flush()
+	require.NoError(t, s.Write(p))
+	require.NoError(t, s.Flush())
+	assert.Equal(t, "consumption.web.p_total_w 3.5 1700000000", <-lines)
+	require.NoError(t, s.Close())
+
+	for _, bad := range []string{"http://x:1", "nohost"} {
+		_, err := NewGraphite(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestDatagrams(t *testing.T) {
+	long := strings.Repeat("x", maxDatagram+10) + "\n"
+	got := datagrams([]byte("a\n" + long + "b\n"))
+	require.Len(t, got, 3)
+	assert.Equal(t, "a\n", string(got[0]))
+	assert.Equal(t, long, string(got[1]))
+	assert.Equal(t, "b\n", string(got[2]))
+}
@@ -0,0 +1,36 @@
+package profile
+
+import "github.com/ja7ad/consumption/pkg/consumption"
+
+// Builtins returns the built-in profiles keyed by name. The values are rough
+// starting points for a hardware class; run `consumption calibrate` for
+// numbers that match a specific machine.
+func Builtins() map[string]Profile {
+	out := map[string]Profile{}
+	add := func(name, desc string, cfg consumption.Config) {
+		out[name] = Profile{Name: name, Description: desc, Config: cfg, Source: "builtin"}
+	}
+
+	add("default", "tool defaults (small VM / laptop-class shell experiments)", *consumption.DefaultConfig())
+	add("laptop", "ultrabook-class x86 laptop with NVMe SSD", consumption.Config{
+		PIdle: 3, PMax: 28, Gamma: 1.4,
+		ER: 3.0e-8, EW: 6.0e-8,
+		EMemRef: 5e-10, EMemRSS: 2e-10,
+	})
+	add("xeon", "dual-socket Xeon server with SATA/NVMe storage", consumption.Config{
+		PIdle: 95, PMax: 360, Gamma: 1.2,
+		ER: 5.0e-8, EW: 1.0e-7,
+		EMemRef: 1e-9, EMemRSS: 4e-10,
+	})
+	add("graviton", "AWS Graviton (ARM Neoverse) instance with EBS storage", consumption.Config{
+		PIdle: 18, PMax: 105, Gamma: 1.1,
+		ER: 4.0e-8, EW: 8.0e-8,
+		EMemRef: 6e-10, EMemRSS: 2.5e-10,
+	})
+	add("vm", "2-4 vCPU cloud VM share of its host", consumption.Config{
+		PIdle: 2, PMax: 12, Gamma: 1.3,
+		ER: 4.8e-8, EW: 9.5e-8,
+		EMemRef: 7e-10, EMemRSS: 3e-10,
+	})
+	return out
+}
@@ -0,0 +1,181 @@
+// Package profile stores named sets of model coefficients (consumption.Config),
+// optionally with the calibration statistics they were fitted with.
+//
+// Profiles come from two places:
+//   - built-ins (Builtins): rough starting points for common hardware classes;
+//   - user files in Dir() (usually ~/.config/consumption/profiles), named
+//     <name>.yaml, <name>.yml or <name>.json. A user file shadows a built-in
+//     of the same name.
+//
+// File format (YAML or JSON, same keys); omitted coefficients keep the
+// consumption.DefaultConfig value:
+//
+//	name: xeon-lab
+//	description: dual-socket Xeon, measured with RAPL
+//	config:
+//	  p_idle: 95
+//	  p_max: 360
+//	  gamma: 1.2
+package profile
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/ja7ad/consumption/pkg/consumption"
+)
+
+var (
+	// ErrNotFound means no built-in or user profile has the requested name.
+	ErrNotFound = errors.New("profile: not found")
+	// ErrBadName means a profile name is not a plain file name.
+	ErrBadName = errors.New("profile: invalid name")
+)
+
+// Profile is a reusable, named model configuration.
+type Profile struct {
+	Name        string             `json:"name" yaml:"name"`
+	Description string             `json:"description,omitempty" yaml:"description,omitempty"`
+	Config      consumption.Config `json:"config" yaml:"config"`
+	Fit         *FitStats          `json:"fit,omitempty" yaml:"fit,omitempty"`
+
+	// Source is where the profile was loaded from ("builtin" or a file path).
+	Source string `json:"-" yaml:"-"`
+}
+
+// FitStats records how a calibrated profile was obtained and how well it fits.
+type FitStats struct {
+	Reference string    `json:"reference" yaml:"reference"`               // e.g. "rapl", "battery", "csv:meter.csv"
+	Samples   int       `json:"samples" yaml:"samples"`                   // windows used in the fit
+	Fitted    []string  `json:"fitted" yaml:"fitted"`                     // coefficients actually estimated
+	Fixed     []string  `json:"fixed,omitempty" yaml:"fixed,omitempty"`   // unidentifiable, kept from the base config
+	R2        float64   `json:"r2" yaml:"r2"`                             // coefficient of determination
+	RMSE      float64   `json:"rmse_w" yaml:"rmse_w"`                     // root mean squared error (W)
+	MAE       float64   `json:"mae_w" yaml:"mae_w"`                       // mean absolute error (W)
+	MaxErr    float64   `json:"max_abs_err_w" yaml:"max_abs_err_w"`       // worst absolute residual (W)
+	Host      string    `json:"host,omitempty" yaml:"host,omitempty"`     // host the calibration ran on
+	Kernel    string    `json:"kernel,omitempty" yaml:"kernel,omitempty"` // kernel release
+	At        time.Time `json:"at" yaml:"at"`
+}
+
+// Save writes p as indented JSON, or YAML for .yaml/.yml paths, creating
+// parent directories.
+func (p *Profile) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	var (
+		b   []byte
+		err error
+	)
+	if isYAML(path) {
+		b, err = yaml.Marshal(p)
+	} else {
+		b, err = json.MarshalIndent(p, "", "  ")
+		b = append(b, '\n')
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o644)
+}
+
+// Load reads a profile file (YAML for .yaml/.yml, JSON otherwise).
+// Coefficients missing from the file keep their default values; a missing
+// name defaults to the file's base name.
+func Load(path string) (*Profile, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p := &Profile{Config: *consumption.DefaultConfig(), Source: path}
+	if isYAML(path) {
+		err = yaml.Unmarshal(b, p)
+	} else {
+		err = json.Unmarshal(b, p)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("profile %s: %w", path, err)
+	}
+	if p.Name == "" {
+		p.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	return p, nil
+}
+
+// Dir returns the user profile directory: $CONSUMPTION_PROFILE_DIR if set,
+// otherwise <user config dir>/consumption/profiles.
+func Dir() (string, error) {
+	if d := os.Getenv("CONSUMPTION_PROFILE_DIR"); d != "" {
+		return d, nil
+	}
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, "consumption", "profiles"), nil
+}
+
+// Find resolves a profile by name: user files first, then built-ins. Names
+// with a path separator or ".." are rejected, so only files directly in
+// Dir are read.
+func Find(name string) (*Profile, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.Contains(name, "..") {
+		return nil, fmt.Errorf("%w: %q", ErrBadName, name)
+	}
+	if dir, err := Dir(); err == nil {
+		for _, ext := range []string{".yaml", ".yml", ".json"} {
+			path := filepath.Join(dir, name+ext)
+			if _, err := os.Stat(path); err == nil {
+				return Load(path)
+			}
+		}
+	}
+	if p, ok := Builtins()[name]; ok {
+		return &p, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrNotFound, name)
+}
+
+// List returns every available profile (user files shadow built-ins), sorted
+// by name. Unreadable user files are reported in the returned error but do
+// not prevent listing the rest.
+func List() ([]Profile, error) {
+	byName := Builtins()
+	var errs []error
+	if dir, err := Dir(); err == nil {
+		entries, _ := os.ReadDir(dir)
+		for _, e := range entries {
+			ext := filepath.Ext(e.Name())
+			if e.IsDir() || (ext != ".json" && !isYAML(e.Name())) {
+				continue
+			}
+			p, err := Load(filepath.Join(dir, e.Name()))
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			byName[strings.TrimSuffix(e.Name(), ext)] = *p
+		}
+	}
+
+	out := make([]Profile, 0, len(byName))
+	for _, p := range byName {
+		out = append(out, p)
+	}
+	slices.SortFunc(out, func(a, b Profile) int { return strings.Compare(a.Name, b.Name) })
+	return out, errors.Join(errs...)
+}
+
+func isYAML(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
@@ -0,0 +1,104 @@
+package profile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ja7ad/consumption/pkg/consumption"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaveLoad_RoundTripJSONAndYAML(t *testing.T) {
+	dir := t.TempDir()
+	p := &Profile{
+		Name:   "lab",
+		Config: consumption.Config{PIdle: 9, PMax: 90, Gamma: 1.5, ER: 1e-8, EW: 2e-8, EMemRef: 3e-10, EMemRSS: 4e-10, Alpha: 0.5},
+		Fit:    &FitStats{Reference: "rapl", Samples: 42, R2: 0.97},
+	}
+	for _, name := range []string{"lab.json", "lab.yaml"} {
+		path := filepath.Join(dir, "sub", name)
+		require.NoError(t, p.Save(path))
+
+		got, err := Load(path)
+		require.NoError(t, err)
+		assert.Equal(t, p.Config, got.Config, name)
+		assert.Equal(t, "lab", got.Name)
+		require.NotNil(t, got.Fit)
+		assert.Equal(t, 42, got.Fit.Samples)
+		assert.Equal(t, path, got.Source)
+	}
+}
+
+func TestLoad_PartialFileKeepsDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "partial.yml")
+	require.NoError(t, os.WriteFile(path, []byte("config:\n  p_max: 50\n"), 0o644))
+
+	p, err := Load(path)
+	require.NoError(t, err)
+	def := consumption.DefaultConfig()
+	assert.Equal(t, "partial", p.Name)
+	assert.Equal(t, 50.0, p.Config.PMax)
+	assert.Equal(t, def.PIdle, p.Config.PIdle)
+	assert.Equal(t, def.EMemRSS, p.Config.EMemRSS)
+
+	require.NoError(t, os.WriteFile(path, []byte("config: [not, a, map]\n"), 0o644))
+	_, err = Load(path)
+	assert.Error(t, err)
+}
+
+func TestFind_UserShadowsBuiltin(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("CONSUMPTION_PROFILE_DIR", dir)
+
+	p, err := Find("xeon")
+	require.NoError(t, err)
+	assert.Equal(t, "builtin", p.Source)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "xeon.json"),
+		[]byte(`{"name":"xeon","config":{"p_idle":120,"p_max":400}}`), 0o644))
+	p, err = Find("xeon")
+	require.NoError(t, err)
+	assert.Equal(t, 120.0, p.Config.PIdle)
+	assert.Contains(t, p.Source, dir)
+
+	_, err = Find("nope")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestFind_RejectsPaths(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("CONSUMPTION_PROFILE_DIR", filepath.Join(dir, "profiles"))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "outside.json"),
+		[]byte(`{"name":"outside","config":{"p_idle":1}}`), 0o644))
+
+	for _, name := range []string{"../outside", "../../etc/x", "a/b", `a\b`, "..", ""} {
+		_, err := Find(name)
+		assert.ErrorIs(t, err, ErrBadName, name)
+	}
+}
+
+func TestList_BuiltinsAndUserFiles(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("CONSUMPTION_PROFILE_DIR", dir)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "edge.yaml"), []byte("description: edge box\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.json"), []byte("{"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("ignored"), 0o644))
+
+	ps, err := List()
+	assert.Error(t, err) // broken.json reported
+	var names []string
+	for _, p := range ps {
+		names = append(names, p.Name)
+	}
+	assert.Equal(t, []string{"default", "edge", "graviton", "laptop", "vm", "xeon"}, names)
+}
+
+func TestBuiltins_Sane(t *testing.T) {
+	for name, p := range Builtins() {
+		assert.Equal(t, name, p.Name)
+		assert.Greater(t, p.Config.PMax, p.Config.PIdle, name)
+		assert.Greater(t, p.Config.Gamma, 0.0, name)
+	}
+}
@@ -5,7 +5,6 @@ package proc
 import (
 	"fmt"
 
-	"github.com/ja7ad/consumption/pkg/system/cgroup"
 	"github.com/ja7ad/consumption/pkg/types"
 )
 
@@ -27,23 +26,68 @@ type Collector interface {
 	Close() error
 }
 
-// NewCollector returns a Collector implementation chosen by the detected cgroup mode.
-// - V2 or Hybrid: prefer v2 (more accurate CPU attribution).
-// - V1: fallback to /proc-only collector.
-func NewCollector(alpha float64) (Collector, error) {
-	ver, _, err := cgroup.Detect()
-	if err != nil {
-		return nil, fmt.Errorf("collector: detect cgroup: %w", err)
+// Group is a named set of PIDs measured together.
+type Group struct {
+	Name string
+	PIDs []int
+}
+
+// GroupSnapshot is one group's sample. Err is ErrAllExited once every PID
+// of the group is gone (Snapshot is zero then).
+type GroupSnapshot struct {
+	Name string
+	Snapshot
+	Err error
+}
+
+// GroupCollector samples several groups per tick against a single U_vm
+// reading, so the system counters are read once and the groups' results are
+// directly comparable. Groups must have unique names and must not share
+// PIDs. SampleGroups returns ErrAllExited when no group has a live PID.
+// Both built-in backends implement it.
+type GroupCollector interface {
+	Collector
+	SampleGroups(groups []Group, dtSec float64) ([]GroupSnapshot, error)
+}
+
+// ValidateGroups checks that groups is non-empty, every group has PIDs and
+// a unique name, and no PID belongs to two groups.
+func ValidateGroups(groups []Group) error {
+	if len(groups) == 0 {
+		return ErrNoPIDs
+	}
+	names := make(map[string]bool, len(groups))
+	owner := map[int]string{}
+	for _, g := range groups {
+		if len(g.PIDs) == 0 {
+			return fmt.Errorf("%w: group %q", ErrNoPIDs, g.Name)
+		}
+		if names[g.Name] {
+			return fmt.Errorf("%w: duplicate group %q", ErrBadGroups, g.Name)
+		}
+		names[g.Name] = true
+		for _, pid := range g.PIDs {
+			if o, dup := owner[pid]; dup {
+				return fmt.Errorf("%w: pid %d in groups %q and %q", ErrBadGroups, pid, o, g.Name)
+			}
+			owner[pid] = g.Name
+		}
 	}
+	return nil
+}
 
-	switch ver {
-	case cgroup.V2:
-		return newV2(alpha)
-	case cgroup.Hybrid:
-		return newV2(alpha)
-	case cgroup.V1:
-		return newV1(alpha)
-	default:
-		return nil, ErrUnsupported
+// checkGroups validates the SampleGroups arguments.
+func checkGroups(groups []Group, dtSec float64) error {
+	if !(dtSec > 0) {
+		return ErrBadDt
 	}
+	return ValidateGroups(groups)
+}
+
+// NewCollector returns the highest-priority registered Collector whose probe
+// succeeds on this host (see Register and Select).
+//   - cgroup2: preferred when cgroup v2 is mounted on /sys/fs/cgroup and writable.
+//   - procfs: /proc-only fallback.
+func NewCollector(alpha float64) (Collector, error) {
+	return NewCollectorByName(Auto, alpha)
 }
@@ -5,6 +5,7 @@ package proc
 import (
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -13,3 +14,21 @@ func TestCollector(t *testing.T) {
 	require.NoError(t, err)
 	require.NotNil(t, col)
 }
+
+func TestCheckGroups(t *testing.T) {
+	assert.ErrorIs(t, ValidateGroups(nil), ErrNoPIDs)
+	assert.ErrorIs(t, checkGroups([]Group{{Name: "a", PIDs: []int{1}}}, 0), ErrBadDt)
+	assert.ErrorIs(t, checkGroups([]Group{{Name: "a"}}, 1), ErrNoPIDs)
+	assert.ErrorIs(t, checkGroups([]Group{{Name: "a", PIDs: []int{1}}, {Name: "a", PIDs: []int{2}}}, 1), ErrBadGroups)
+
+	err := checkGroups([]Group{{Name: "a", PIDs: []int{1, 2}}, {Name: "b", PIDs: []int{3, 2}}}, 1)
+	assert.ErrorIs(t, err, ErrBadGroups)
+	assert.ErrorContains(t, err, `pid 2 in groups "a" and "b"`)
+
+	require.NoError(t, checkGroups([]Group{{Name: "a", PIDs: []int{1}}, {Name: "b", PIDs: []int{2}}}, 1))
+}
+
+func TestBuiltinsImplementGroupCollector(t *testing.T) {
+	var _ GroupCollector = (*v1Collector)(nil)
+	var _ GroupCollector = (*v2Collector)(nil)
+}
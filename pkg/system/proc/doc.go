@@ -88,13 +88,27 @@
 //   - v1 needs only /proc.
 //   - Both backends are read-only to /proc; v2 writes to cgroup.procs when possible.
 //
-// Factory & version selection
+// Factory & backend registry
 //
-//	NewCollector(alpha float64) (Collector, error) chooses the backend:
-//	  - v2 (or hybrid): tries v2 first, falls back to v1 if not implemented/available.
-//	  - v1: uses v1.
+// Backends register by name with a capability probe (registry.go):
 //
-// Callers don’t need to check cgroup version explicitly.
+//	cgroup2 (priority 20): cgroup v2 on /sys/fs/cgroup, writable (moves PIDs)
+//	procfs  (priority 10): /proc only, never touches cgroups
+//
+//	NewCollector(alpha)               // same as NewCollectorByName(Auto, alpha)
+//	NewCollectorByName(name, alpha)   // "auto", "procfs", "cgroup2", or a custom name
+//	Select(name) (Backend, error)     // resolve without constructing
+//	Available() []Availability        // probe all backends; Err says why one was rejected
+//
+// Auto picks the highest-priority backend whose probe succeeds, so hybrid hosts
+// with cgroup2 mounted elsewhere (e.g. /sys/fs/cgroup/unified) fall back to procfs.
+// Callers can add their own backend:
+//
+//	proc.Register(proc.Backend{
+//	    Name:  "ebpf",
+//	    Probe: func() error { ... },
+//	    New:   func(alpha float64) (proc.Collector, error) { ... },
+//	})
 //
 // Example: one-shot sampling
 //
@@ -140,6 +154,8 @@
 //
 // Example: expanding a process tree
 //
+// ReadProcTree(rootPID) returns the root and all descendants; by hand:
+//
 //	/*
 //	// Use /proc/<pid>/task/*/children to discover descendants (non-recursive by design).
 //	// You can layer a small BFS/queue on top to collect the full tree before sampling.
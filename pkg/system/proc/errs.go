@@ -28,6 +28,15 @@ var (
 	// ErrBadDt means dtSec <= 0 was provided to Sample.
 	ErrBadDt = errors.New("collector: dtSec must be > 0")
 
+	// ErrBadGroups means SampleGroups got duplicate names or overlapping PIDs.
+	ErrBadGroups = errors.New("collector: invalid groups")
+
 	// ErrUnsupported collector fails because the detected cgroup mode is unsupported.
 	ErrUnsupported = errors.New("collector: unsupported cgroup mode")
+
+	// ErrUnknownCollector means the requested backend name is not registered.
+	ErrUnknownCollector = errors.New("collector: unknown backend")
+
+	// ErrNoCollector means no registered backend passed its probe on this host.
+	ErrNoCollector = errors.New("collector: no usable backend")
 )
@@ -229,3 +229,21 @@ func ReadProcChildren(pid int) ([]int, error) {
 	}
 	return out, nil
 }
+
+// ReadProcTree returns pid followed by all of its descendants, found
+// breadth-first through ReadProcChildren. Processes that exit while the
+// tree is walked are simply missing.
+func ReadProcTree(pid int) []int {
+	out := []int{pid}
+	seen := map[int]bool{pid: true}
+	for i := 0; i < len(out); i++ {
+		kids, _ := ReadProcChildren(out[i])
+		for _, k := range kids {
+			if !seen[k] {
+				seen[k] = true
+				out = append(out, k)
+			}
+		}
+	}
+	return out
+}
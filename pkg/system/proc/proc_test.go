@@ -5,6 +5,7 @@ package proc
 import (
 	"errors"
 	"os"
+	"os/exec"
 	"strconv"
 	"strings"
 	"testing"
@@ -145,6 +146,19 @@ func TestReadProcChildren_NoSuchPid(t *testing.T) {
 	require.True(t, errors.Is(err, ErrNoChildren) || err != nil)
 }
 
+func TestReadProcTree(t *testing.T) {
+	cmd := exec.Command("sleep", "5")
+	require.NoError(t, cmd.Start())
+	t.Cleanup(func() { _ = cmd.Process.Kill(); _ = cmd.Wait() })
+
+	tree := ReadProcTree(os.Getpid())
+	require.NotEmpty(t, tree)
+	assert.Equal(t, os.Getpid(), tree[0], "root first")
+	assert.Contains(t, tree, cmd.Process.Pid)
+
+	assert.Equal(t, []int{999999}, ReadProcTree(999999))
+}
+
 func TestExistsRoundTrip_WithSpawnedChild(t *testing.T) {
 	// Spawn a short-lived child (sleep 0.05s) and ensure Exists() toggles.
 	ch := make(chan int, 1)
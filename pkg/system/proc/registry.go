@@ -0,0 +1,195 @@
+//go:build linux
+
+package proc
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// Auto is the pseudo backend name that selects the highest-priority backend
+// whose probe succeeds on this host.
+const Auto = "auto"
+
+// Backend describes a named Collector implementation.
+//
+// Probe reports whether the backend can run on the current host; a nil error
+// means usable, a non-nil error explains why it was rejected. New constructs
+// the collector with the given EMA alpha for U_vm smoothing.
+//
+// Priority orders backends for Auto selection (higher first).
+type Backend struct {
+	Name        string
+	Description string
+	Priority    int
+	Probe       func() error
+	New         func(alpha float64) (Collector, error)
+}
+
+// Availability is the probe result of a registered backend.
+type Availability struct {
+	Backend
+	Err error // nil when usable
+}
+
+// Usable reports whether the backend passed its probe.
+func (a Availability) Usable() bool { return a.Err == nil }
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Backend{}
+)
+
+// Register makes a collector backend available by name.
+// It panics if the name is empty, reserved, already registered, or if New is nil,
+// mirroring database/sql.Register.
+func Register(b Backend) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if b.Name == "" || b.Name == Auto {
+		panic(fmt.Sprintf("proc: invalid collector name %q", b.Name))
+	}
+	if b.New == nil {
+		panic("proc: Register collector " + b.Name + " with nil New")
+	}
+	if _, dup := registry[b.Name]; dup {
+		panic("proc: Register called twice for collector " + b.Name)
+	}
+	registry[b.Name] = b
+}
+
+// Backends returns all registered backends ordered by priority (highest first),
+// then by name.
+func Backends() []Backend {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	out := make([]Backend, 0, len(registry))
+	for _, b := range registry {
+		out = append(out, b)
+	}
+	slices.SortFunc(out, func(a, b Backend) int {
+		if a.Priority != b.Priority {
+			return b.Priority - a.Priority
+		}
+		switch {
+		case a.Name < b.Name:
+			return -1
+		case a.Name > b.Name:
+			return 1
+		default:
+			return 0
+		}
+	})
+	return out
+}
+
+// Available probes every registered backend and reports which can run here
+// and why the others were rejected. Order matches Backends.
+func Available() []Availability {
+	bs := Backends()
+	out := make([]Availability, 0, len(bs))
+	for _, b := range bs {
+		out = append(out, Availability{Backend: b, Err: probe(b)})
+	}
+	return out
+}
+
+// Select resolves a backend by name. For Auto (or ""), it returns the
+// highest-priority backend whose probe succeeds; otherwise the named backend
+// is returned only if its probe succeeds.
+func Select(name string) (Backend, error) {
+	if name == "" || name == Auto {
+		var errs []error
+		for _, a := range Available() {
+			if a.Usable() {
+				return a.Backend, nil
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", a.Name, a.Err))
+		}
+		return Backend{}, fmt.Errorf("%w: %w", ErrNoCollector, errors.Join(errs...))
+	}
+
+	registryMu.RLock()
+	b, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return Backend{}, fmt.Errorf("%w: %q", ErrUnknownCollector, name)
+	}
+	if err := probe(b); err != nil {
+		return Backend{}, fmt.Errorf("collector %s unavailable: %w", name, err)
+	}
+	return b, nil
+}
+
+// NewCollectorByName selects a backend via Select and constructs it.
+func NewCollectorByName(name string, alpha float64) (Collector, error) {
+	b, err := Select(name)
+	if err != nil {
+		return nil, err
+	}
+	return b.New(alpha)
+}
+
+func probe(b Backend) error {
+	if b.Probe == nil {
+		return nil
+	}
+	return b.Probe()
+}
+
+// ---- built-in backends ----
+
+const (
+	// ProcFS is the /proc-only collector (works everywhere, never moves PIDs).
+	ProcFS = "procfs"
+	// Cgroup2 is the cgroup v2 collector (moves PIDs into a temporary leaf cgroup).
+	Cgroup2 = "cgroup2"
+)
+
+func init() {
+	Register(Backend{
+		Name:        Cgroup2,
+		Description: "cgroup v2 unified hierarchy; moves PIDs into a temporary leaf cgroup",
+		Priority:    20,
+		Probe:       probeCgroup2,
+		New:         newV2,
+	})
+	Register(Backend{
+		Name:        ProcFS,
+		Description: "/proc only; per-PID jiffies, never touches cgroups",
+		Priority:    10,
+		Probe:       probeProcFS,
+		New:         newV1,
+	})
+}
+
+func probeProcFS() error {
+	_, _, err := ReadSystemCPU()
+	return err
+}
+
+func probeCgroup2() error {
+	const root = "/sys/fs/cgroup"
+	ok, err := isCgroup2Mounted(root)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("cgroup v2 not mounted on " + root)
+	}
+	if _, err := os.Stat(filepath.Join(root, "cpu.stat")); err != nil {
+		return fmt.Errorf("root cpu.stat: %w", err)
+	}
+	if err := unix.Access(root, unix.W_OK); err != nil {
+		return fmt.Errorf("cannot create cgroups under %s: %w", root, err)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+//go:build linux
+
+package proc
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeCollector struct{}
+
+func (fakeCollector) Sample([]int, float64) (Snapshot, error) { return Snapshot{TimeSec: 1}, nil }
+func (fakeCollector) Close() error                            { return nil }
+
+func TestRegistry_BuiltinsRegistered(t *testing.T) {
+	names := map[string]bool{}
+	for _, b := range Backends() {
+		names[b.Name] = true
+	}
+	assert.True(t, names[ProcFS])
+	assert.True(t, names[Cgroup2])
+}
+
+func TestRegistry_AvailableExplainsRejections(t *testing.T) {
+	av := Available()
+	require.NotEmpty(t, av)
+	for _, a := range av {
+		if a.Usable() {
+			t.Logf("%-8s usable", a.Name)
+		} else {
+			assert.Error(t, a.Err)
+			t.Logf("%-8s rejected: %v", a.Name, a.Err)
+		}
+	}
+}
+
+func TestRegistry_SelectAutoAndByName(t *testing.T) {
+	b, err := Select(Auto)
+	require.NoError(t, err)
+	assert.NotEmpty(t, b.Name)
+
+	// procfs only needs /proc and should always be usable on Linux
+	b, err = Select(ProcFS)
+	require.NoError(t, err)
+	assert.Equal(t, ProcFS, b.Name)
+
+	col, err := NewCollectorByName(ProcFS, 0)
+	require.NoError(t, err)
+	require.NoError(t, col.Close())
+
+	_, err = Select("no-such-backend")
+	assert.ErrorIs(t, err, ErrUnknownCollector)
+}
+
+func TestRegistry_CustomBackend(t *testing.T) {
+	Register(Backend{
+		Name:        "test-fake",
+		Description: "fake",
+		Priority:    -100,
+		New:         func(float64) (Collector, error) { return fakeCollector{}, nil },
+	})
+	Register(Backend{
+		Name:     "test-broken",
+		Priority: -101,
+		Probe:    func() error { return errors.New("no hardware") },
+		New:      func(float64) (Collector, error) { return fakeCollector{}, nil },
+	})
+
+	col, err := NewCollectorByName("test-fake", 0)
+	require.NoError(t, err)
+	s, err := col.Sample([]int{1}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, s.TimeSec)
+
+	_, err = Select("test-broken")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no hardware")
+
+	// lower priority than built-ins: auto must not prefer it
+	b, err := Select(Auto)
+	require.NoError(t, err)
+	assert.NotEqual(t, "test-fake", b.Name)
+
+	assert.Panics(t, func() {
+		Register(Backend{Name: "test-fake", New: func(float64) (Collector, error) { return nil, nil }})
+	})
+	assert.Panics(t, func() { Register(Backend{Name: Auto}) })
+}
@@ -28,7 +28,10 @@ type v1Collector struct {
 	vmActivePrev uint64
 	vmTotalPrev  uint64
 
-	// Per-PID prev counters
+	// Per-PID prev counters. Once primed (after the first sample), a PID
+	// seen for the first time only records baselines: its lifetime counters
+	// predate the window. Exited PIDs are forgotten.
+	primed     bool
 	cpuPrev    map[int]uint64 // utime+stime (jiffies)
 	rbytesPrev map[int]uint64
 	wbytesPrev map[int]uint64
@@ -73,11 +76,46 @@ func (c *v1Collector) Sample(pids []int, dtSec float64) (Snapshot, error) {
 	if !(dtSec > 0) {
 		return Snapshot{}, ErrBadDt
 	}
+	uvm, err := c.sampleVM()
+	if err != nil {
+		return Snapshot{}, err
+	}
+	defer func() { c.primed = true }()
+	return c.samplePIDs(pids, uvm, dtSec)
+}
+
+// SampleGroups implements GroupCollector: one /proc/stat read per tick,
+// then per-group PID deltas.
+func (c *v1Collector) SampleGroups(groups []Group, dtSec float64) ([]GroupSnapshot, error) {
+	if err := checkGroups(groups, dtSec); err != nil {
+		return nil, err
+	}
+	uvm, err := c.sampleVM()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { c.primed = true }()
+	out := make([]GroupSnapshot, len(groups))
+	alive := 0
+	for i, g := range groups {
+		s, err := c.samplePIDs(g.PIDs, uvm, dtSec)
+		out[i] = GroupSnapshot{Name: g.Name, Snapshot: s, Err: err}
+		if err == nil {
+			alive++
+		}
+	}
+	if alive == 0 {
+		return out, ErrAllExited
+	}
+	return out, nil
+}
 
-	// VM CPU deltas
+// sampleVM returns the (optionally EMA-smoothed) VM utilization since the
+// previous call.
+func (c *v1Collector) sampleVM() (float64, error) {
 	vmActiveNow, vmTotalNow, err := ReadSystemCPU()
 	if err != nil {
-		return Snapshot{}, err
+		return 0, err
 	}
 	dActive := util.DeltaU64(vmActiveNow, c.vmActivePrev)
 	dTotal := util.DeltaU64(vmTotalNow, c.vmTotalPrev)
@@ -94,8 +132,11 @@ func (c *v1Collector) Sample(pids []int, dtSec float64) (Snapshot, error) {
 		}
 		uvm = c.emaPrevUV
 	}
-	uvm = util.Clamp01(uvm)
+	return util.Clamp01(uvm), nil
+}
 
+// samplePIDs aggregates the per-PID deltas of pids into a snapshot.
+func (c *v1Collector) samplePIDs(pids []int, uvm, dtSec float64) (Snapshot, error) {
 	// Aggregate per-PID deltas
 	var (
 		cpuJiffiesDelta uint64
@@ -107,14 +148,20 @@ func (c *v1Collector) Sample(pids []int, dtSec float64) (Snapshot, error) {
 	)
 	for _, pid := range pids {
 		if !Exists(pid) {
+			c.forget(pid)
 			continue
 		}
 		alive++
+		_, seen := c.cpuPrev[pid]
+		fresh := c.primed && !seen
 
 		// CPU jiffies (utime+stime)
 		ut, st, mn, mj, err := ReadProcStat(pid)
 		if err == nil {
 			j := ut + st
+			if fresh {
+				c.cpuPrev[pid], c.minfltPrev[pid], c.majfltPrev[pid] = j, mn, mj
+			}
 			cpuJiffiesDelta += util.DeltaU64(j, c.cpuPrev[pid])
 			c.cpuPrev[pid] = j
 			// Minor faults (first-touch, no IO)
@@ -130,6 +177,9 @@ func (c *v1Collector) Sample(pids []int, dtSec float64) (Snapshot, error) {
 
 		// I/O bytes
 		if rNow, wNow, err := ReadProcIO(pid); err == nil {
+			if fresh {
+				c.rbytesPrev[pid], c.wbytesPrev[pid] = rNow, wNow
+			}
 			readDelta += util.DeltaU64(rNow, c.rbytesPrev[pid])
 			writeDelta += util.DeltaU64(wNow, c.wbytesPrev[pid])
 			c.rbytesPrev[pid] = rNow
@@ -138,6 +188,9 @@ func (c *v1Collector) Sample(pids []int, dtSec float64) (Snapshot, error) {
 
 		// RSS churn (absolute delta)
 		if rssNow, err := ReadProcRSS(pid); err == nil {
+			if fresh {
+				c.rssPrev[pid] = rssNow
+			}
 			prev := c.rssPrev[pid]
 			if rssNow >= prev {
 				rssChurnBytes += rssNow - prev
@@ -166,3 +219,10 @@ func (c *v1Collector) Sample(pids []int, dtSec float64) (Snapshot, error) {
 		RSSChurnBytes: types.ToBytes(rssChurnBytes), // per-PID RSS absolute deltas
 	}, nil
 }
+
+// forget drops the per-PID counters of an exited PID.
+func (c *v1Collector) forget(pid int) {
+	for _, m := range []map[int]uint64{c.cpuPrev, c.rbytesPrev, c.wbytesPrev, c.rssPrev, c.minfltPrev, c.majfltPrev} {
+		delete(m, pid)
+	}
+}
@@ -188,3 +188,59 @@ func doWork(t *testing.T, d time.Duration) {
 
 	<-done
 }
+
+func TestV1_SampleGroups_SharesUVm(t *testing.T) {
+	c, err := newV1(0.0)
+	require.NoError(t, err)
+	defer c.Close()
+	gc := c.(GroupCollector)
+
+	groups := []Group{
+		{Name: "self", PIDs: []int{os.Getpid()}},
+		{Name: "gone", PIDs: []int{99999999}},
+	}
+	go spinWork(t, 150*time.Millisecond)
+	dt := sleepSec(150 * time.Millisecond)
+
+	out, err := gc.SampleGroups(groups, dt)
+	require.NoError(t, err)
+	require.Len(t, out, 2)
+	assert.Equal(t, "self", out[0].Name)
+	require.NoError(t, out[0].Err)
+	assert.InDelta(t, dt, out[0].TimeSec, 1e-9)
+	assert.GreaterOrEqual(t, out[0].UVm, 0.0)
+	assert.LessOrEqual(t, out[0].UProc, 1.0)
+	assert.ErrorIs(t, out[1].Err, ErrAllExited)
+
+	_, err = gc.SampleGroups(groups[1:], dt)
+	assert.ErrorIs(t, err, ErrAllExited)
+}
+
+func TestV1_Sample_BaselinesLatePIDsAndForgetsExited(t *testing.T) {
+	c, err := newV1(0.0)
+	require.NoError(t, err)
+	defer c.Close()
+	v1 := c.(*v1Collector)
+
+	// The first sample primes the collector even when nothing is alive.
+	_, err = c.Sample([]int{99999999}, 1.0)
+	require.ErrorIs(t, err, ErrAllExited)
+	require.True(t, v1.primed)
+
+	// Our own lifetime CPU predates this window: a PID first seen now only
+	// records its baselines.
+	doWork(t, 50*time.Millisecond)
+	snap, err := c.Sample([]int{os.Getpid()}, 0.05)
+	require.NoError(t, err)
+	assert.Zero(t, snap.UProc)
+	assert.Zero(t, snap.WriteBytes)
+	assert.Zero(t, snap.RSSChurnBytes)
+	assert.Contains(t, v1.cpuPrev, os.Getpid())
+
+	// Counters of exited PIDs are dropped.
+	v1.cpuPrev[99999999], v1.rssPrev[99999999] = 1, 1
+	_, err = c.Sample([]int{os.Getpid(), 99999999}, 0.05)
+	require.NoError(t, err)
+	assert.NotContains(t, v1.cpuPrev, 99999999)
+	assert.NotContains(t, v1.rssPrev, 99999999)
+}
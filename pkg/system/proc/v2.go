@@ -23,6 +23,9 @@ import (
 // - Group CPU from <grp>/cpu.stat (usage_usec)
 // - Memory refaults from <grp>/memory.stat (workingset_refault)
 // - Per-PID IO/RSS from /proc (same as v1)
+//
+// Sample uses one temporary leaf cgroup; SampleGroups creates one more per
+// named group on first use.
 type v2Collector struct {
 	// Config
 	alpha    float64 // EMA smoothing factor for U_vm (0..1)
@@ -30,24 +33,33 @@ type v2Collector struct {
 	nproc    int
 
 	// Cgroup paths
-	rootCG string // usually /sys/fs/cgroup
-	grpCG  string // created temporary leaf cgroup
+	rootCG string  // usually /sys/fs/cgroup
+	grp    *v2Leaf // created temporary leaf cgroup
+	groups map[string]*v2Leaf
 
 	// Prev counters
-	vmUsageUsecPrev  uint64 // root usage_usec
-	grpUsageUsecPrev uint64 // group usage_usec
-	wsRefaultPrev    uint64 // group workingset_refault (count of pages)
+	vmUsageUsecPrev uint64 // root usage_usec
 
 	// EMA state for U_vm
 	emaOK     bool
 	emaPrevUV float64
 
-	// Per-PID previous counters
+	// Per-PID previous counters. Once primed (after the first sample), a
+	// PID seen for the first time only records baselines: its lifetime
+	// counters predate the window. Exited PIDs are forgotten.
+	primed     bool
 	rbytesPrev map[int]uint64
 	wbytesPrev map[int]uint64
 	rssPrev    map[int]uint64
 }
 
+// v2Leaf is a temporary leaf cgroup and its previous counters.
+type v2Leaf struct {
+	path          string
+	usageUsecPrev uint64 // usage_usec
+	wsRefaultPrev uint64 // workingset_refault (count of pages)
+}
+
 // newV2 constructs the v2 collector, creates a temp cgroup under /sys/fs/cgroup,
 // and seeds the root vmUsageUsecPrev from root cpu.stat.
 func newV2(alpha float64) (Collector, error) {
@@ -65,7 +77,7 @@ func newV2(alpha float64) (Collector, error) {
 		return nil, errors.New("cgroup v2 not mounted on /sys/fs/cgroup")
 	}
 
-	grp, err := createTempGroup(root)
+	grp, err := createTempGroup(root, "")
 	if err != nil {
 		return nil, fmt.Errorf("create temp cgroup: %w", err)
 	}
@@ -82,7 +94,8 @@ func newV2(alpha float64) (Collector, error) {
 		pageSize:        PageSize(),
 		nproc:           runtime.NumCPU(),
 		rootCG:          root,
-		grpCG:           grp,
+		grp:             &v2Leaf{path: grp},
+		groups:          map[string]*v2Leaf{},
 		vmUsageUsecPrev: vmUse,
 
 		rbytesPrev: make(map[int]uint64),
@@ -92,10 +105,14 @@ func newV2(alpha float64) (Collector, error) {
 }
 
 func (c *v2Collector) Close() error {
-	// Best effort: remove the temporary cgroup directory.
-	// This will only succeed if it's empty (no processes).
+	// Best effort: remove the temporary cgroup directories.
+	// This will only succeed if they are empty (no processes).
 	// If processes remain (caller stopped sampling early), removal will fail.
-	return os.Remove(c.grpCG)
+	errs := []error{os.Remove(c.grp.path)}
+	for _, g := range c.groups {
+		errs = append(errs, os.Remove(g.path))
+	}
+	return errors.Join(errs...)
 }
 
 func (c *v2Collector) Sample(pids []int, dtSec float64) (Snapshot, error) {
@@ -105,45 +122,92 @@ func (c *v2Collector) Sample(pids []int, dtSec float64) (Snapshot, error) {
 	if !(dtSec > 0) {
 		return Snapshot{}, ErrBadDt
 	}
+	defer func() { c.primed = true }()
+
+	if !c.move(c.grp, pids) {
+		return Snapshot{}, ErrAllExited
+	}
+	uVm, err := c.sampleVM(dtSec)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	return c.sampleLeaf(c.grp, pids, uVm, dtSec)
+}
+
+// SampleGroups implements GroupCollector. Each group gets its own leaf
+// cgroup; the root cpu.stat is read once per tick, after all moves.
+func (c *v2Collector) SampleGroups(groups []Group, dtSec float64) ([]GroupSnapshot, error) {
+	if err := checkGroups(groups, dtSec); err != nil {
+		return nil, err
+	}
+	defer func() { c.primed = true }()
+	leaves := make([]*v2Leaf, len(groups))
+	alive := make([]bool, len(groups))
+	for i, g := range groups {
+		leaf, ok := c.groups[g.Name]
+		if !ok {
+			path, err := createTempGroup(c.rootCG, g.Name)
+			if err != nil {
+				return nil, fmt.Errorf("create temp cgroup for %q: %w", g.Name, err)
+			}
+			leaf = &v2Leaf{path: path}
+			c.groups[g.Name] = leaf
+		}
+		leaves[i] = leaf
+		alive[i] = c.move(leaf, g.PIDs)
+	}
+
+	uVm, err := c.sampleVM(dtSec)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]GroupSnapshot, len(groups))
+	n := 0
+	for i, g := range groups {
+		out[i] = GroupSnapshot{Name: g.Name, Err: ErrAllExited}
+		if !alive[i] {
+			continue
+		}
+		s, err := c.sampleLeaf(leaves[i], g.PIDs, uVm, dtSec)
+		out[i].Snapshot, out[i].Err = s, err
+		if err == nil {
+			n++
+		}
+	}
+	if n == 0 {
+		return out, ErrAllExited
+	}
+	return out, nil
+}
 
-	// Move PIDs into our group (idempotent; ignore EPERM/ENOENT per PID)
+// move puts pids into leaf (idempotent; ignore EPERM/ENOENT per PID) and
+// reports whether any of them is alive.
+func (c *v2Collector) move(leaf *v2Leaf, pids []int) bool {
 	alive := 0
 	for _, pid := range pids {
 		if !Exists(pid) {
 			continue
 		}
-		if err := writePIDtoCgroup(c.grpCG, pid); err == nil {
-			alive++
-		} else {
-			// Ignore if we fail to move — we'll still account IO/RSS via /proc
-			// but CPU/memory accounting will miss that pid this tick.
-			alive++
-		}
-	}
-	if alive == 0 {
-		return Snapshot{}, ErrAllExited
+		// If the move fails we still account IO/RSS via /proc, but
+		// CPU/memory accounting will miss that pid this tick.
+		_ = writePIDtoCgroup(leaf.path, pid)
+		alive++
 	}
+	return alive > 0
+}
 
-	// CPU usage (VM/root and group) from cpu.stat
+// sampleVM returns the (optionally EMA-smoothed) VM utilization from the
+// root cpu.stat since the previous call.
+func (c *v2Collector) sampleVM(dtSec float64) (float64, error) {
 	vmUseNow, err := readCPUUsageUsec(filepath.Join(c.rootCG, "cpu.stat"))
 	if err != nil {
-		return Snapshot{}, fmt.Errorf("read root cpu.stat: %w", err)
+		return 0, fmt.Errorf("read root cpu.stat: %w", err)
 	}
-	grpUseNow, err := readCPUUsageUsec(filepath.Join(c.grpCG, "cpu.stat"))
-	if err != nil {
-		return Snapshot{}, fmt.Errorf("read group cpu.stat: %w", err)
-	}
-
 	dVMusec := util.DeltaU64(vmUseNow, c.vmUsageUsecPrev)
-	dGRPusec := util.DeltaU64(grpUseNow, c.grpUsageUsecPrev)
-	c.vmUsageUsecPrev, c.grpUsageUsecPrev = vmUseNow, grpUseNow
+	c.vmUsageUsecPrev = vmUseNow
 
-	// Utilizations
 	// vm seconds over dt and nproc
 	uVm := util.SafeDiv(float64(dVMusec)/1e6, float64(c.nproc)*dtSec)
-	// group seconds normalized the same (NOTE: this is already "absolute" group utilization,
-	// but we report it as UProc in [0,1] relative to total capacity)
-	uProc := util.SafeDiv(float64(dGRPusec)/1e6, float64(c.nproc)*dtSec)
 
 	// EMA smoothing on VM utilization (optional)
 	if c.alpha > 0 {
@@ -155,17 +219,31 @@ func (c *v2Collector) Sample(pids []int, dtSec float64) (Snapshot, error) {
 		}
 		uVm = c.emaPrevUV
 	}
-	uVm = util.Clamp01(uVm)
-	uProc = util.Clamp01(uProc)
+	return util.Clamp01(uVm), nil
+}
+
+// sampleLeaf reads leaf's CPU and memory counters and the per-PID IO/RSS
+// deltas of pids.
+func (c *v2Collector) sampleLeaf(leaf *v2Leaf, pids []int, uVm, dtSec float64) (Snapshot, error) {
+	grpUseNow, err := readCPUUsageUsec(filepath.Join(leaf.path, "cpu.stat"))
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("read group cpu.stat: %w", err)
+	}
+	dGRPusec := util.DeltaU64(grpUseNow, leaf.usageUsecPrev)
+	leaf.usageUsecPrev = grpUseNow
+
+	// group seconds normalized the same (NOTE: this is already "absolute" group utilization,
+	// but we report it as UProc in [0,1] relative to total capacity)
+	uProc := util.Clamp01(util.SafeDiv(float64(dGRPusec)/1e6, float64(c.nproc)*dtSec))
 
 	// Memory refaults (workingset_refault) from memory.stat
-	wsRefNow, err := readWorkingsetRefault(filepath.Join(c.grpCG, "memory.stat"))
+	wsRefNow, err := readWorkingsetRefault(filepath.Join(leaf.path, "memory.stat"))
 	if err != nil {
 		// Some kernels may not expose it (unlikely on v2). If missing, treat as zero.
-		wsRefNow = c.wsRefaultPrev
+		wsRefNow = leaf.wsRefaultPrev
 	}
-	dWsRef := util.DeltaU64(wsRefNow, c.wsRefaultPrev)
-	c.wsRefaultPrev = wsRefNow
+	dWsRef := util.DeltaU64(wsRefNow, leaf.wsRefaultPrev)
+	leaf.wsRefaultPrev = wsRefNow
 	refaultBytes := dWsRef * uint64(c.pageSize)
 
 	// Per-PID IO + RSS churn (via /proc)
@@ -173,12 +251,16 @@ func (c *v2Collector) Sample(pids []int, dtSec float64) (Snapshot, error) {
 	aliveCount := 0
 	for _, pid := range pids {
 		if !Exists(pid) {
+			c.forget(pid)
 			continue
 		}
 		aliveCount++
 
 		// IO
 		if rNow, wNow, err := ReadProcIO(pid); err == nil {
+			if _, seen := c.rbytesPrev[pid]; c.primed && !seen {
+				c.rbytesPrev[pid], c.wbytesPrev[pid] = rNow, wNow
+			}
 			readDelta += util.DeltaU64(rNow, c.rbytesPrev[pid])
 			writeDelta += util.DeltaU64(wNow, c.wbytesPrev[pid])
 			c.rbytesPrev[pid] = rNow
@@ -186,6 +268,9 @@ func (c *v2Collector) Sample(pids []int, dtSec float64) (Snapshot, error) {
 		}
 		// RSS churn
 		if rssNow, err := ReadProcRSS(pid); err == nil {
+			if _, seen := c.rssPrev[pid]; c.primed && !seen {
+				c.rssPrev[pid] = rssNow
+			}
 			prev := c.rssPrev[pid]
 			if rssNow >= prev {
 				rssChurn += (rssNow - prev)
@@ -211,6 +296,13 @@ func (c *v2Collector) Sample(pids []int, dtSec float64) (Snapshot, error) {
 	}, nil
 }
 
+// forget drops the per-PID counters of an exited PID.
+func (c *v2Collector) forget(pid int) {
+	for _, m := range []map[int]uint64{c.rbytesPrev, c.wbytesPrev, c.rssPrev} {
+		delete(m, pid)
+	}
+}
+
 // ---- cgroup v2 helpers ----
 
 // isCgroup2Mounted returns true if the given path is a cgroup2 mount.
@@ -247,11 +339,15 @@ func isCgroup2Mounted(path string) (bool, error) {
 	return false, sc.Err()
 }
 
-// createTempGroup makes a unique sub-cgroup under root (e.g., /sys/fs/cgroup/consumption.<pid>.<rand>)
-func createTempGroup(root string) (string, error) {
+// createTempGroup makes a unique sub-cgroup under root (e.g., /sys/fs/cgroup/consumption.<pid>.<rand>);
+// a non-empty label is appended in sanitized form (consumption.<pid>.<rand>.<label>).
+func createTempGroup(root, label string) (string, error) {
 	suffix := make([]byte, 4)
 	_, _ = rand.Read(suffix)
 	name := fmt.Sprintf("consumption.%d.%s", os.Getpid(), hex.EncodeToString(suffix))
+	if label = cgroupLabel(label); label != "" {
+		name += "." + label
+	}
 	dir := filepath.Join(root, name)
 	if err := os.Mkdir(dir, 0o755); err != nil {
 		return "", err
@@ -259,6 +355,20 @@ func createTempGroup(root string) (string, error) {
 	return dir, nil
 }
 
+// cgroupLabel keeps [A-Za-z0-9_-] of s, at most 32 bytes.
+func cgroupLabel(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if b.Len() >= 32 {
+			break
+		}
+		if r == '-' || r == '_' || (r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
 // writePIDtoCgroup moves a PID into the given cgroup by writing to <grp>/cgroup.procs.
 func writePIDtoCgroup(grp string, pid int) error {
 	f, err := os.OpenFile(filepath.Join(grp, "cgroup.procs"), os.O_WRONLY|os.O_APPEND, 0)
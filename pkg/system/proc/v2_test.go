@@ -189,6 +189,81 @@ func TestV2_InternalHelpers(t *testing.T) {
 		assert.GreaterOrEqual(t, v, uint64(0))
 	}
 
+	// cgroup directory labels keep only safe characters
+	assert.Equal(t, "web-1_x", cgroupLabel("web-1/../_x"))
+	assert.Len(t, cgroupLabel(strings.Repeat("a", 40)), 32)
+
 	// memory.stat refault parsing (may not exist on some kernels; allow error)
 	_, _ = readWorkingsetRefault(filepath.Join("/sys/fs/cgroup", "memory.stat"))
 }
+
+func TestV2_SampleGroups_LeafPerGroup(t *testing.T) {
+	ok, err := cgroup2MountedOn("/sys/fs/cgroup")
+	if err != nil || !ok {
+		t.Skip("skip: cgroup v2 not available")
+	}
+
+	c, err := newV2(0.0)
+	require.NoError(t, err)
+	defer c.Close()
+	v2 := c.(*v2Collector)
+
+	groups := []Group{{Name: "self", PIDs: []int{os.Getpid()}}, {Name: "gone", PIDs: []int{99999999}}}
+	out, err := v2.SampleGroups(groups, sleepSecs(100*time.Millisecond))
+	require.NoError(t, err)
+	require.NoError(t, out[0].Err)
+	assert.ErrorIs(t, out[1].Err, ErrAllExited)
+	assert.Len(t, v2.groups, 2)
+	assert.Contains(t, v2.groups["self"].path, ".self")
+}
+
+func TestV2_SampleLeaf_BaselinesLatePIDsAndForgetsExited(t *testing.T) {
+	// A fake leaf: sampleLeaf only reads cpu.stat/memory.stat from it.
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cpu.stat"), []byte("usage_usec 1000\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "memory.stat"), []byte("workingset_refault 0\n"), 0o644))
+	leaf := &v2Leaf{path: dir}
+	c := &v2Collector{
+		pageSize:   PageSize(),
+		nproc:      runtime.NumCPU(),
+		rbytesPrev: map[int]uint64{},
+		wbytesPrev: map[int]uint64{},
+		rssPrev:    map[int]uint64{},
+		primed:     true, // a previous tick has already happened
+	}
+
+	// Our own lifetime IO and RSS predate this window: a PID first seen
+	// now only records its baselines.
+	self := os.Getpid()
+	snap, err := c.sampleLeaf(leaf, []int{self}, 0, 0.05)
+	require.NoError(t, err)
+	assert.Zero(t, snap.ReadBytes)
+	assert.Zero(t, snap.WriteBytes)
+	assert.Zero(t, snap.RSSChurnBytes)
+	assert.Contains(t, c.rssPrev, self)
+
+	// Counters of exited PIDs are dropped.
+	c.rbytesPrev[99999999], c.wbytesPrev[99999999], c.rssPrev[99999999] = 1, 1, 1
+	_, err = c.sampleLeaf(leaf, []int{self, 99999999}, 0, 0.05)
+	require.NoError(t, err)
+	assert.NotContains(t, c.rbytesPrev, 99999999)
+	assert.NotContains(t, c.wbytesPrev, 99999999)
+	assert.NotContains(t, c.rssPrev, 99999999)
+}
+
+func TestV2_Sample_PrimesOnFirstTick(t *testing.T) {
+	ok, err := cgroup2MountedOn("/sys/fs/cgroup")
+	if err != nil || !ok {
+		t.Skip("skip: cgroup v2 not available")
+	}
+
+	c, err := newV2(0.0)
+	require.NoError(t, err)
+	defer c.Close()
+	v2 := c.(*v2Collector)
+
+	// The first tick primes the collector even when nothing is alive.
+	_, err = c.Sample([]int{99999999}, 1.0)
+	require.ErrorIs(t, err, ErrAllExited)
+	assert.True(t, v2.primed)
+}
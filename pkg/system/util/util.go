@@ -7,7 +7,9 @@ import (
 	"math"
 	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -97,6 +99,133 @@ func ParsePIDs(args []string) ([]int, error) {
 	return out, nil
 }
 
+// ResolvePIDs is ParsePIDs plus process selectors, resolved once against the
+// processes running now:
+//
+//	name:NAME    processes whose comm is exactly NAME
+//	pg:PATTERN   processes whose comm matches the regexp PATTERN (like pgrep)
+//	cgroup:PATH  processes in the cgroup v2 PATH or its descendants; relative
+//	             paths are under CgroupRoot
+//
+// The calling process is never selected. Duplicates are dropped, keeping the
+// first occurrence. A selector that matches nothing is an error.
+func ResolvePIDs(args []string) ([]int, error) {
+	var (
+		out  []int
+		seen = map[int]bool{}
+		self = os.Getpid()
+		all  []int // lazily listed /proc entries
+	)
+	add := func(pids ...int) {
+		for _, pid := range pids {
+			if !seen[pid] {
+				seen[pid] = true
+				out = append(out, pid)
+			}
+		}
+	}
+	for _, tok := range args {
+		tok = strings.TrimSpace(tok)
+		var match func(comm string) bool
+		switch {
+		case strings.HasPrefix(tok, "cgroup:"):
+			pids, err := cgroupPIDs(strings.TrimPrefix(tok, "cgroup:"))
+			if err != nil {
+				return nil, err
+			}
+			n := len(out)
+			for _, pid := range pids {
+				if pid != self {
+					add(pid)
+				}
+			}
+			if len(out) == n {
+				return nil, fmt.Errorf("no process matches %q", tok)
+			}
+			continue
+		case strings.HasPrefix(tok, "name:"):
+			name := strings.TrimPrefix(tok, "name:")
+			match = func(comm string) bool { return comm == name }
+		case strings.HasPrefix(tok, "pg:"):
+			re, err := regexp.Compile(strings.TrimPrefix(tok, "pg:"))
+			if err != nil {
+				return nil, fmt.Errorf("bad pattern: %q: %w", tok, err)
+			}
+			match = re.MatchString
+		default:
+			pids, err := ParsePIDs([]string{tok})
+			if err != nil {
+				return nil, err
+			}
+			add(pids...)
+			continue
+		}
+
+		if all == nil {
+			var err error
+			if all, err = listPIDs(); err != nil {
+				return nil, err
+			}
+		}
+		n := len(out)
+		for _, pid := range all {
+			if pid != self && match(readComm(pid)) {
+				add(pid)
+			}
+		}
+		if len(out) == n {
+			return nil, fmt.Errorf("no process matches %q", tok)
+		}
+	}
+	return out, nil
+}
+
+// CgroupRoot is where cgroup: selectors resolve relative paths.
+const CgroupRoot = "/sys/fs/cgroup"
+
+// cgroupPIDs returns the members of the cgroup at path and its descendants.
+func cgroupPIDs(path string) ([]int, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(CgroupRoot, path)
+	}
+	var pids []int
+	err := filepath.WalkDir(path, func(p string, d os.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return err
+		}
+		b, err := os.ReadFile(filepath.Join(p, "cgroup.procs"))
+		if err != nil {
+			return err
+		}
+		for _, f := range strings.Fields(string(b)) {
+			if pid, err := strconv.Atoi(f); err == nil {
+				pids = append(pids, pid)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cgroup %s: %w", path, err)
+	}
+	return pids, nil
+}
+
+// listPIDs returns the numeric entries of /proc in ascending order.
+func listPIDs() ([]int, error) {
+	ents, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	var pids []int
+	for _, e := range ents {
+		if pid, err := strconv.Atoi(e.Name()); err == nil && e.IsDir() {
+			pids = append(pids, pid)
+		}
+	}
+	slices.Sort(pids)
+	return pids, nil
+}
+
 func FmtFloat(f float64) string {
 	// avoid -0.000 and very long tails
 	if math.Abs(f) < 0.0005 {
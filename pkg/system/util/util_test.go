@@ -4,6 +4,9 @@ package util
 
 import (
 	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -249,6 +252,55 @@ func TestParsePIDs_CombinedOrdering(t *testing.T) {
 	assert.Equal(t, []int{3, 1, 2, 10, 8, 9}, got, "should preserve input order and expand ranges inline")
 }
 
+func TestResolvePIDs_Selectors(t *testing.T) {
+	cmd := exec.Command("sleep", "30")
+	require.NoError(t, cmd.Start())
+	t.Cleanup(func() { _ = cmd.Process.Kill(); _ = cmd.Wait() })
+	child := cmd.Process.Pid
+
+	got, err := ResolvePIDs([]string{"name:sleep"})
+	require.NoError(t, err)
+	assert.Contains(t, got, child)
+
+	got, err = ResolvePIDs([]string{"7", "pg:^sl(ee)p$", "7..8"})
+	require.NoError(t, err)
+	assert.Equal(t, 7, got[0])
+	assert.Contains(t, got, child)
+	assert.Equal(t, 8, got[len(got)-1], "duplicates dropped, order kept")
+	assert.NotContains(t, got, os.Getpid())
+
+	_, err = ResolvePIDs([]string{"name:no-such-process-xyz"})
+	assert.ErrorContains(t, err, "no process matches")
+	_, err = ResolvePIDs([]string{"pg:("})
+	assert.ErrorContains(t, err, "bad pattern")
+	_, err = ResolvePIDs([]string{"x1"})
+	assert.ErrorContains(t, err, "bad pid")
+}
+
+func TestResolvePIDs_Cgroup(t *testing.T) {
+	b, err := os.ReadFile("/proc/self/cgroup")
+	require.NoError(t, err)
+	rel, ok := strings.CutPrefix(strings.TrimSpace(string(b)), "0::")
+	if !ok || strings.Contains(rel, "\n") {
+		t.Skip("not on a pure cgroup v2 hierarchy")
+	}
+	if _, err := os.Stat(filepath.Join(CgroupRoot, rel, "cgroup.procs")); err != nil {
+		t.Skipf("cgroup not readable: %v", err)
+	}
+
+	cmd := exec.Command("sleep", "30")
+	require.NoError(t, cmd.Start())
+	t.Cleanup(func() { _ = cmd.Process.Kill(); _ = cmd.Wait() })
+
+	got, err := ResolvePIDs([]string{"cgroup:" + rel})
+	require.NoError(t, err)
+	assert.Contains(t, got, cmd.Process.Pid, "child inherits our cgroup")
+	assert.NotContains(t, got, os.Getpid())
+
+	_, err = ResolvePIDs([]string{"cgroup:/no/such/cgroup"})
+	assert.ErrorContains(t, err, "cgroup /no/such/cgroup")
+}
+
 func TestFmtFloat_RoundingAndNearZero(t *testing.T) {
 	tests := []struct {
 		in  float64
@@ -308,3 +360,17 @@ func TestSystemSummary_Sanity(t *testing.T) {
 	// Accept any parseable positive number
 	assert.NotEmpty(t, num, "mem numeric part should not be empty")
 }
+
+func TestCgroupPIDs_WalksDescendants(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "svc", "worker"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "svc", "cgroup.procs"), []byte("10\n11\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "svc", "worker", "cgroup.procs"), []byte("12\n"), 0o644))
+
+	got, err := cgroupPIDs(filepath.Join(root, "svc"))
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []int{10, 11, 12}, got)
+
+	_, err = cgroupPIDs(filepath.Join(root, "missing"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,246 @@
+// Package tariff prices estimated energy with a flat or time-of-use
+// electricity tariff.
+//
+// A tariff file is YAML (.yaml/.yml) or JSON. Bands are matched in order;
+// the first band whose weekday and time window contain the tick wins, and
+// price_per_kwh applies outside all bands:
+//
+//	currency: EUR
+//	timezone: Europe/Berlin   # optional, default local time
+//	price_per_kwh: 0.28       # base price
+//	bands:
+//	  - name: peak
+//	    days: [mon, tue, wed, thu, fri]
+//	    from: "17:00"
+//	    to: "21:00"
+//	    price_per_kwh: 0.41
+//	  - name: night           # windows may wrap midnight
+//	    from: "23:00"
+//	    to: "07:00"
+//	    price_per_kwh: 0.14
+package tariff
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/ja7ad/consumption/pkg/types"
+)
+
+// HoursPerMonth is the average month length used for projections (365.25·24/12).
+const HoursPerMonth = 730.5
+
+var ErrBadTariff = errors.New("tariff: invalid tariff")
+
+// Tariff is a price schedule in currency units per kWh.
+type Tariff struct {
+	Currency    string  `json:"currency,omitempty" yaml:"currency,omitempty"`
+	Timezone    string  `json:"timezone,omitempty" yaml:"timezone,omitempty"`
+	PricePerKWh float64 `json:"price_per_kwh" yaml:"price_per_kwh"`
+	Bands       []Band  `json:"bands,omitempty" yaml:"bands,omitempty"`
+
+	loc *time.Location
+}
+
+// Band is a time-of-use window. Empty Days means every day; From == To
+// means the whole day.
+type Band struct {
+	Name        string   `json:"name,omitempty" yaml:"name,omitempty"`
+	Days        []string `json:"days,omitempty" yaml:"days,omitempty"` // mon..sun
+	From        string   `json:"from,omitempty" yaml:"from,omitempty"` // HH:MM, inclusive
+	To          string   `json:"to,omitempty" yaml:"to,omitempty"`     // HH:MM, exclusive
+	PricePerKWh float64  `json:"price_per_kwh" yaml:"price_per_kwh"`
+
+	days     [7]bool
+	from, to int // minutes since midnight
+}
+
+// Flat returns a single-price tariff.
+func Flat(price float64, currency string) (*Tariff, error) {
+	t := &Tariff{Currency: currency, PricePerKWh: price}
+	if err := t.compile(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Load reads and validates a tariff file.
+func Load(path string) (*Tariff, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var t Tariff
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &t)
+	default:
+		err = json.Unmarshal(b, &t)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("tariff %s: %w", path, err)
+	}
+	if err := t.compile(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &t, nil
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+func (t *Tariff) compile() error {
+	if t.PricePerKWh < 0 {
+		return fmt.Errorf("%w: negative price_per_kwh", ErrBadTariff)
+	}
+	t.loc = time.Local
+	if t.Timezone != "" {
+		loc, err := time.LoadLocation(t.Timezone)
+		if err != nil {
+			return fmt.Errorf("%w: timezone: %v", ErrBadTariff, err)
+		}
+		t.loc = loc
+	}
+	for i := range t.Bands {
+		b := &t.Bands[i]
+		if b.Name == "" {
+			b.Name = fmt.Sprintf("band%d", i+1)
+		}
+		if b.PricePerKWh < 0 {
+			return fmt.Errorf("%w: band %s: negative price_per_kwh", ErrBadTariff, b.Name)
+		}
+		b.days = [7]bool{}
+		if len(b.Days) == 0 {
+			b.days = [7]bool{true, true, true, true, true, true, true}
+		}
+		for _, d := range b.Days {
+			key := strings.ToLower(strings.TrimSpace(d))
+			if len(key) > 3 {
+				key = key[:3] // "monday" → "mon"
+			}
+			wd, ok := weekdays[key]
+			if !ok {
+				return fmt.Errorf("%w: band %s: unknown day %q", ErrBadTariff, b.Name, d)
+			}
+			b.days[wd] = true
+		}
+		var err error
+		if b.from, err = parseClock(b.From); err != nil {
+			return fmt.Errorf("%w: band %s: from: %v", ErrBadTariff, b.Name, err)
+		}
+		if b.to, err = parseClock(b.To); err != nil {
+			return fmt.Errorf("%w: band %s: to: %v", ErrBadTariff, b.Name, err)
+		}
+	}
+	return nil
+}
+
+// parseClock parses HH:MM (or HH) into minutes since midnight; "" is 0 and
+// "24:00" is 1440.
+func parseClock(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	var h, m int
+	if strings.Contains(s, ":") {
+		if _, err := fmt.Sscanf(s, "%d:%d", &h, &m); err != nil {
+			return 0, fmt.Errorf("%q: want HH:MM", s)
+		}
+	} else if _, err := fmt.Sscanf(s, "%d", &h); err != nil {
+		return 0, fmt.Errorf("%q: want HH:MM", s)
+	}
+	if h < 0 || h > 24 || m < 0 || m > 59 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("%q: out of range", s)
+	}
+	return h*60 + m, nil
+}
+
+// contains reports whether the band covers weekday wd at minute-of-day min.
+// A wrapping window (from > to) belongs to the day it starts on.
+func (b *Band) contains(wd time.Weekday, m int) bool {
+	switch {
+	case b.from == b.to:
+		return b.days[wd]
+	case b.from < b.to:
+		return b.days[wd] && m >= b.from && m < b.to
+	case m >= b.from:
+		return b.days[wd]
+	default: // early-morning tail of yesterday's window
+		return m < b.to && b.days[(wd+6)%7]
+	}
+}
+
+// PriceAt returns the price per kWh at time at and the matching band name
+// ("" for the base price).
+func (t *Tariff) PriceAt(at time.Time) (float64, string) {
+	lt := at.In(t.loc)
+	m := lt.Hour()*60 + lt.Minute()
+	for i := range t.Bands {
+		if t.Bands[i].contains(lt.Weekday(), m) {
+			return t.Bands[i].PricePerKWh, t.Bands[i].Name
+		}
+	}
+	return t.PricePerKWh, ""
+}
+
+// AvgPrice returns the time-averaged price per kWh over a week, i.e. the
+// effective price for a constant load.
+func (t *Tariff) AvgPrice() float64 {
+	if len(t.Bands) == 0 {
+		return t.PricePerKWh
+	}
+	var sum float64
+	n := 0
+	for wd := time.Sunday; wd <= time.Saturday; wd++ {
+		for m := 0; m < 24*60; m++ {
+			p := t.PricePerKWh
+			for i := range t.Bands {
+				if t.Bands[i].contains(wd, m) {
+					p = t.Bands[i].PricePerKWh
+					break
+				}
+			}
+			sum += p
+			n++
+		}
+	}
+	return sum / float64(n)
+}
+
+// MonthlyCost projects the cost of drawing watts continuously for an
+// average month at AvgPrice.
+func (t *Tariff) MonthlyCost(watts float64) float64 {
+	return watts / 1000 * HoursPerMonth * t.AvgPrice()
+}
+
+// Meter accumulates cost tick by tick.
+type Meter struct {
+	t     *Tariff
+	total float64
+}
+
+// NewMeter returns a meter pricing energy with t.
+func NewMeter(t *Tariff) *Meter { return &Meter{t: t} }
+
+// Add prices a tick's energy (J) ending at time at and returns its cost.
+func (m *Meter) Add(at time.Time, joules float64) float64 {
+	p, _ := m.t.PriceAt(at)
+	c := joules / types.JoulesPerKWh * p
+	m.total += c
+	return c
+}
+
+// Total returns the accumulated cost.
+func (m *Meter) Total() float64 { return m.total }
+
+// Tariff returns the tariff in use.
+func (m *Meter) Tariff() *Tariff { return m.t }
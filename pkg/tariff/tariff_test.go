@@ -0,0 +1,105 @@
+package tariff
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ja7ad/consumption/pkg/types"
+)
+
+const touYAML = `currency: EUR
+timezone: UTC
+price_per_kwh: 0.30
+bands:
+  - name: peak
+    days: [mon, tue, wed, thu, friday]
+    from: "17:00"
+    to: "21:00"
+    price_per_kwh: 0.50
+  - name: night
+    from: "23:00"
+    to: "07:00"
+    price_per_kwh: 0.10
+`
+
+func loadTOU(t *testing.T) *Tariff {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "tou.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(touYAML), 0o644))
+	tf, err := Load(path)
+	require.NoError(t, err)
+	return tf
+}
+
+func TestPriceAt_TimeOfUse(t *testing.T) {
+	tf := loadTOU(t)
+	assert.Equal(t, "EUR", tf.Currency)
+
+	// 2025-01-06 is a Monday.
+	at := func(day, h, m int) time.Time { return time.Date(2025, 1, day, h, m, 0, 0, time.UTC) }
+	cases := []struct {
+		at    time.Time
+		price float64
+		band  string
+	}{
+		{at(6, 12, 0), 0.30, ""},
+		{at(6, 17, 0), 0.50, "peak"},
+		{at(6, 20, 59), 0.50, "peak"},
+		{at(6, 21, 0), 0.30, ""},
+		{at(11, 18, 0), 0.30, ""}, // Saturday: no peak
+		{at(6, 23, 30), 0.10, "night"},
+		{at(7, 6, 59), 0.10, "night"}, // wrapped tail
+		{at(7, 7, 0), 0.30, ""},
+	}
+	for _, c := range cases {
+		p, band := tf.PriceAt(c.at)
+		assert.Equal(t, c.price, p, c.at.String())
+		assert.Equal(t, c.band, band, c.at.String())
+	}
+}
+
+func TestAvgPriceAndMonthly(t *testing.T) {
+	flat, err := Flat(0.25, "USD")
+	require.NoError(t, err)
+	assert.Equal(t, 0.25, flat.AvgPrice())
+	assert.InDelta(t, 0.25*HoursPerMonth, flat.MonthlyCost(1000), 1e-9)
+
+	tf := loadTOU(t)
+	// per week: 20h peak, 56h night, 92h base
+	want := (20*0.50 + 56*0.10 + 92*0.30) / 168
+	assert.InDelta(t, want, tf.AvgPrice(), 1e-9)
+}
+
+func TestMeter(t *testing.T) {
+	tf := loadTOU(t)
+	m := NewMeter(tf)
+	mon := time.Date(2025, 1, 6, 0, 0, 0, 0, time.UTC)
+
+	assert.InDelta(t, 0.10, m.Add(mon.Add(time.Hour), types.JoulesPerKWh), 1e-12)
+	assert.InDelta(t, 0.25, m.Add(mon.Add(18*time.Hour), types.JoulesPerKWh/2), 1e-12)
+	assert.InDelta(t, 0.35, m.Total(), 1e-12)
+	assert.Same(t, tf, m.Tariff())
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	for name, body := range map[string]string{
+		"neg.json":   `{"price_per_kwh": -1}`,
+		"day.json":   `{"price_per_kwh": 1, "bands": [{"days": ["funday"], "price_per_kwh": 2}]}`,
+		"clock.yaml": "price_per_kwh: 1\nbands:\n  - from: \"25:00\"\n    price_per_kwh: 2\n",
+		"tz.yaml":    "price_per_kwh: 1\ntimezone: Mars/Olympus\n",
+	} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(body), 0o644))
+		_, err := Load(path)
+		assert.ErrorIs(t, err, ErrBadTariff, name)
+	}
+
+	_, err := Flat(-0.1, "")
+	assert.ErrorIs(t, err, ErrBadTariff)
+}
@@ -0,0 +1,253 @@
+//go:build linux
+
+// Package trace records raw collector snapshots to a compact binary file and
+// reads them back, so that the power model can be re-run offline with
+// different coefficients (see `consumption replay`).
+//
+// File layout (little-endian):
+//
+//	magic   [8]byte  "CSMTRACE"
+//	version uint16   (currently 1)
+//	metaLen uint32
+//	meta    [metaLen]byte  JSON-encoded Meta
+//	records ...      fixed-size, see recordSize
+//
+// Each record stores the exact Snapshot values (no rounding):
+//
+//	at_unix_nano int64
+//	flags        uint8   (bit 0: warmup sample)
+//	time_sec     float64
+//	u_vm         float64
+//	u_proc       float64
+//	read_bytes   uint64
+//	write_bytes  uint64
+//	refault      uint64
+//	rss_churn    uint64
+package trace
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ja7ad/consumption/pkg/system/proc"
+	"github.com/ja7ad/consumption/pkg/types"
+)
+
+// Version is the trace format version written by this package.
+const Version uint16 = 1
+
+const (
+	magic      = "CSMTRACE"
+	recordSize = 8 + 1 + 3*8 + 4*8
+
+	flagWarmup = 1 << 0
+)
+
+var (
+	// ErrBadMagic means the input is not a consumption trace.
+	ErrBadMagic = errors.New("trace: bad magic")
+
+	// ErrVersion means the trace was written by an unsupported format version.
+	ErrVersion = errors.New("trace: unsupported version")
+
+	// ErrTruncated means the last record was cut short (e.g. the writer was killed).
+	ErrTruncated = errors.New("trace: truncated record")
+)
+
+// Meta describes the host and sampling setup a trace was recorded on.
+type Meta struct {
+	ToolVersion string         `json:"tool_version,omitempty"`
+	Host        string         `json:"host,omitempty"`
+	Kernel      string         `json:"kernel,omitempty"`
+	CPUs        string         `json:"cpus,omitempty"`
+	Mem         string         `json:"mem,omitempty"`
+	NumCPU      int            `json:"num_cpu,omitempty"`
+	Collector   string         `json:"collector,omitempty"`
+	Interval    time.Duration  `json:"interval_ns,omitempty"`
+	EMA         float64        `json:"ema"`
+	PIDs        []int          `json:"pids,omitempty"`
+	Names       map[int]string `json:"names,omitempty"`
+	Started     time.Time      `json:"started"`
+}
+
+// Record is one raw sample.
+type Record struct {
+	At       time.Time
+	Warmup   bool // sample was skipped from display/averages at record time
+	Snapshot proc.Snapshot
+}
+
+// Writer appends records to a trace stream.
+type Writer struct {
+	bw  *bufio.Writer
+	c   io.Closer
+	buf [recordSize]byte
+}
+
+// Create creates (or truncates) path, making parent directories, and writes the header.
+func Create(path string, meta Meta) (*Writer, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w, err := NewWriter(f, meta)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	w.c = f
+	return w, nil
+}
+
+// NewWriter writes the header to w and returns a Writer for records.
+func NewWriter(w io.Writer, meta Meta) (*Writer, error) {
+	mb, err := json.Marshal(meta)
+	if err != nil {
+		return nil, fmt.Errorf("trace: meta: %w", err)
+	}
+	bw := bufio.NewWriter(w)
+	hdr := make([]byte, 0, len(magic)+2+4)
+	hdr = append(hdr, magic...)
+	hdr = binary.LittleEndian.AppendUint16(hdr, Version)
+	hdr = binary.LittleEndian.AppendUint32(hdr, uint32(len(mb)))
+	if _, err := bw.Write(hdr); err != nil {
+		return nil, err
+	}
+	if _, err := bw.Write(mb); err != nil {
+		return nil, err
+	}
+	return &Writer{bw: bw}, bw.Flush()
+}
+
+// Write appends one record. Records are flushed to the underlying writer
+// immediately so a killed process leaves at most one partial record.
+func (w *Writer) Write(r Record) error {
+	b := w.buf[:0]
+	b = binary.LittleEndian.AppendUint64(b, uint64(r.At.UnixNano()))
+	var flags uint8
+	if r.Warmup {
+		flags |= flagWarmup
+	}
+	b = append(b, flags)
+	s := r.Snapshot
+	b = binary.LittleEndian.AppendUint64(b, math.Float64bits(s.TimeSec))
+	b = binary.LittleEndian.AppendUint64(b, math.Float64bits(s.UVm))
+	b = binary.LittleEndian.AppendUint64(b, math.Float64bits(s.UProc))
+	b = binary.LittleEndian.AppendUint64(b, s.ReadBytes.ToUin64())
+	b = binary.LittleEndian.AppendUint64(b, s.WriteBytes.ToUin64())
+	b = binary.LittleEndian.AppendUint64(b, s.RefaultBytes.ToUin64())
+	b = binary.LittleEndian.AppendUint64(b, s.RSSChurnBytes.ToUin64())
+	if _, err := w.bw.Write(b); err != nil {
+		return err
+	}
+	return w.bw.Flush()
+}
+
+// Close flushes pending data and closes the file if the Writer was made by Create.
+func (w *Writer) Close() error {
+	err := w.bw.Flush()
+	if w.c != nil {
+		if cerr := w.c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Reader decodes a trace stream.
+type Reader struct {
+	r    *bufio.Reader
+	meta Meta
+	buf  [recordSize]byte
+}
+
+// NewReader reads and validates the header.
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	hdr := make([]byte, len(magic)+2+4)
+	if _, err := io.ReadFull(br, hdr); err != nil {
+		return nil, fmt.Errorf("trace: header: %w", err)
+	}
+	if string(hdr[:len(magic)]) != magic {
+		return nil, ErrBadMagic
+	}
+	if v := binary.LittleEndian.Uint16(hdr[len(magic):]); v != Version {
+		return nil, fmt.Errorf("%w: %d", ErrVersion, v)
+	}
+	mb := make([]byte, binary.LittleEndian.Uint32(hdr[len(magic)+2:]))
+	if _, err := io.ReadFull(br, mb); err != nil {
+		return nil, fmt.Errorf("trace: meta: %w", err)
+	}
+	rd := &Reader{r: br}
+	if err := json.Unmarshal(mb, &rd.meta); err != nil {
+		return nil, fmt.Errorf("trace: meta: %w", err)
+	}
+	return rd, nil
+}
+
+// Meta returns the recorded host/sampling metadata.
+func (r *Reader) Meta() Meta { return r.meta }
+
+// Next returns the next record, io.EOF at a clean end, or ErrTruncated if the
+// stream ends mid-record.
+func (r *Reader) Next() (Record, error) {
+	n, err := io.ReadFull(r.r, r.buf[:])
+	if err == io.EOF {
+		return Record{}, io.EOF
+	}
+	if err == io.ErrUnexpectedEOF {
+		return Record{}, fmt.Errorf("%w: %d of %d bytes", ErrTruncated, n, recordSize)
+	}
+	if err != nil {
+		return Record{}, err
+	}
+
+	b := r.buf[:]
+	u64 := func() uint64 {
+		v := binary.LittleEndian.Uint64(b)
+		b = b[8:]
+		return v
+	}
+	at := time.Unix(0, int64(u64()))
+	flags := b[0]
+	b = b[1:]
+
+	var rec Record
+	rec.At = at
+	rec.Warmup = flags&flagWarmup != 0
+	rec.Snapshot.TimeSec = math.Float64frombits(u64())
+	rec.Snapshot.UVm = math.Float64frombits(u64())
+	rec.Snapshot.UProc = math.Float64frombits(u64())
+	rec.Snapshot.ReadBytes = types.ToBytes(u64())
+	rec.Snapshot.WriteBytes = types.ToBytes(u64())
+	rec.Snapshot.RefaultBytes = types.ToBytes(u64())
+	rec.Snapshot.RSSChurnBytes = types.ToBytes(u64())
+	return rec, nil
+}
+
+// ReadAll reads every remaining record. A truncated final record is dropped
+// and reported via ErrTruncated alongside the records read so far.
+func (r *Reader) ReadAll() ([]Record, error) {
+	var out []Record
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return out, err
+		}
+		out = append(out, rec)
+	}
+}
@@ -0,0 +1,84 @@
+//go:build linux
+
+package trace
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ja7ad/consumption/pkg/system/proc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sampleRecords() []Record {
+	t0 := time.Date(2025, 1, 2, 3, 4, 5, 123456789, time.UTC)
+	return []Record{
+		{At: t0, Warmup: true, Snapshot: proc.Snapshot{TimeSec: 1, UVm: 0.1}},
+		{At: t0.Add(time.Second), Snapshot: proc.Snapshot{
+			TimeSec: 1.000123456789, UVm: 0.123456789012345, UProc: 0.0000012345,
+			ReadBytes: 1<<40 + 7, WriteBytes: 3, RefaultBytes: 4096, RSSChurnBytes: 1,
+		}},
+	}
+}
+
+func TestTrace_RoundTripExact(t *testing.T) {
+	meta := Meta{Host: "h", Kernel: "k", Collector: "procfs", Interval: time.Second, PIDs: []int{1, 2}, Names: map[int]string{1: "init"}}
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, meta)
+	require.NoError(t, err)
+	for _, r := range sampleRecords() {
+		require.NoError(t, w.Write(r))
+	}
+	require.NoError(t, w.Close())
+
+	rd, err := NewReader(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, "procfs", rd.Meta().Collector)
+	assert.Equal(t, []int{1, 2}, rd.Meta().PIDs)
+	assert.Equal(t, "init", rd.Meta().Names[1])
+
+	got, err := rd.ReadAll()
+	require.NoError(t, err)
+	want := sampleRecords()
+	require.Len(t, got, len(want))
+	for i := range want {
+		assert.True(t, want[i].At.Equal(got[i].At), "time %d", i)
+		assert.Equal(t, want[i].Warmup, got[i].Warmup)
+		assert.Equal(t, want[i].Snapshot, got[i].Snapshot) // bit-exact floats
+	}
+}
+
+func TestTrace_TruncatedAndBadInput(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, Meta{})
+	require.NoError(t, err)
+	for _, r := range sampleRecords() {
+		require.NoError(t, w.Write(r))
+	}
+	data := buf.Bytes()[:buf.Len()-5] // cut the last record
+
+	rd, err := NewReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	got, err := rd.ReadAll()
+	assert.ErrorIs(t, err, ErrTruncated)
+	assert.Len(t, got, 1)
+
+	_, err = NewReader(bytes.NewReader([]byte("not a trace file at all")))
+	assert.ErrorIs(t, err, ErrBadMagic)
+
+	_, err = NewReader(bytes.NewReader(nil))
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestTrace_CreateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "trace.bin")
+	w, err := Create(path, Meta{Host: "x"})
+	require.NoError(t, err)
+	require.NoError(t, w.Write(sampleRecords()[1]))
+	require.NoError(t, w.Close())
+}
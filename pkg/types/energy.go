@@ -0,0 +1,7 @@
+package types
+
+// Energy unit conversions.
+const (
+	JoulesPerWh  = 3600.0
+	JoulesPerKWh = 1000 * JoulesPerWh
+)